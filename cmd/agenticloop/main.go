@@ -4,9 +4,11 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -71,36 +73,46 @@ func runStart(args []string) error {
 	}
 
 	// Setup logger
-	logLevel := slog.LevelInfo
-	switch cfg.Service.LogLevel {
-	case "debug":
-		logLevel = slog.LevelDebug
-	case "warn":
-		logLevel = slog.LevelWarn
-	case "error":
-		logLevel = slog.LevelError
+	logger, closeLog, err := newLogger(cfg.Service)
+	if err != nil {
+		return fmt.Errorf("setup logger: %w", err)
 	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
+	defer closeLog()
 	slog.SetDefault(logger)
 
 	logger.Info("starting agenticloop", "version", version, "config", *configPath)
 
 	// Open SQLite
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Cancelling with agent.ErrShutdown tells the runner to requeue, not fail,
+	// the in-flight run.
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(agent.ErrShutdown)
 
-	db, err := storage.OpenSQLite(ctx, cfg.Database.Path)
+	db, err := storage.OpenSQLiteWithOptions(ctx, cfg.Database.Path, storage.Options{
+		MaxOpenConns: cfg.Database.MaxOpenConns,
+		BusyTimeout:  cfg.Database.BusyTimeout,
+	})
 	if err != nil {
 		return fmt.Errorf("open database: %w", err)
 	}
 	defer db.Close()
+	go storage.StartWALCheckpointer(ctx, db, cfg.Database.WALCheckpointInterval, logger)
 
 	// Create stores
 	runStore := store.NewRunStore(db)
 	stepStore := store.NewStepStore(db)
 
 	// Create Ductile client
-	dc := ductile.NewClient(cfg.Ductile.BaseURL, cfg.Ductile.Token, logger)
+	dc := ductile.NewClient(cfg.Ductile.BaseURL, cfg.Ductile.Token, logger).
+		WithTimeout(cfg.Ductile.RequestTimeout).
+		WithCallbackSecret(cfg.Ductile.CallbackSecret).
+		WithMaxConcurrentCalls(cfg.Ductile.MaxConcurrentCalls).
+		WithCircuitBreaker(ductile.BreakerConfig{
+			Threshold:   cfg.Ductile.CircuitBreaker.Threshold,
+			Window:      cfg.Ductile.CircuitBreaker.Window,
+			Cooldown:    cfg.Ductile.CircuitBreaker.Cooldown,
+			MaxCooldown: cfg.Ductile.CircuitBreaker.MaxCooldown,
+		})
 
 	// Create LLM provider
 	chatModel, err := provider.NewChatModel(ctx, cfg.LLM)
@@ -109,11 +121,51 @@ func runStart(args []string) error {
 	}
 
 	// Create tools from allowlist
-	tools := ductile.BuildTools(dc, cfg.Ductile.Allowlist, nil)
-	tools = append(tools, localtools.BuildDefaultTools()...)
+	tools, err := ductile.BuildTools(dc, cfg.Ductile.Allowlist, nil)
+	if err != nil {
+		return fmt.Errorf("ductile.allowlist: %w", err)
+	}
+	tools = append(tools, localtools.BuildDefaultTools(localtools.SysToolsConfig{
+		Timeout:        cfg.Agent.SysTools.Timeout,
+		MaxOutputBytes: cfg.Agent.SysTools.MaxOutputBytes,
+		ExternalIPURL:  cfg.Agent.SysTools.ExternalIPURL,
+	})...)
 
 	// Create agent runner
 	runner := agent.NewRunner(runStore, stepStore, chatModel, tools, cfg.Agent, dc, cfg.Ductile.CallbackURL, logger)
+	if opts := provider.JSONModeOptions(cfg.LLM); len(opts) > 0 {
+		runner.SetStageModelOptions(store.StepPhaseReflect, opts...)
+		logger.Info("reflect JSON mode enabled", "provider", cfg.LLM.Provider)
+		if cfg.Agent.FrameFormat == "json" {
+			runner.SetStageModelOptions(store.StepPhaseFrame, opts...)
+			logger.Info("frame JSON mode enabled", "provider", cfg.LLM.Provider)
+		}
+	}
+
+	models, err := provider.NewModels(ctx, cfg.LLM, chatModel)
+	if err != nil {
+		return fmt.Errorf("create allowed models: %w", err)
+	}
+	for name, m := range models {
+		runner.SetModel(name, m)
+	}
+	for stage, name := range cfg.Agent.StageModels {
+		runner.SetStageModel(store.StepPhase(stage), models[name])
+		logger.Info("stage model configured", "stage", stage, "model", name)
+	}
+
+	if len(cfg.LLM.Pricing) > 0 {
+		runner.SetPricing(cfg.LLM.Model, cfg.LLM.Pricing)
+	}
+	if window := contextWindow(cfg.LLM); window > 0 {
+		runner.SetContextWindow(window)
+		logger.Info("prompt clipping sized from context window", "context_window", window, "context_fraction", cfg.Agent.ContextFraction)
+	}
+
+	runner.SetCallbackPolicy(agent.CallbackPolicy{
+		MaxRetries: cfg.Ductile.CallbackMaxRetries,
+		Backoff:    cfg.Ductile.CallbackBackoff,
+	})
 
 	// Recover interrupted runs
 	if err := runner.RecoverRuns(ctx); err != nil {
@@ -123,14 +175,50 @@ func runStart(args []string) error {
 	// Start runner worker
 	go runner.Start(ctx)
 
+	// Start stale run reaper (off unless agent.stale_run_threshold is set)
+	if cfg.Agent.StaleRunThreshold > 0 {
+		go runner.StartStaleRunReaper(ctx)
+	}
+
+	// Retry completion callbacks the webhook did not accept
+	if cfg.Ductile.CallbackURL != "" {
+		go runner.StartCallbackRetrier(ctx, cfg.Ductile.CallbackRetryInterval)
+	}
+
+	// Start workspace retention sweep (off unless agent.workspace_retention is set)
+	if cfg.Agent.WorkspaceRetention > 0 {
+		go agent.NewWorkspaceReaper(runStore, cfg.Agent, logger).Start(ctx)
+	}
+
 	// Create and start API server
 	srv := api.New(api.Config{
 		Listen:                  cfg.API.Listen,
 		Token:                   cfg.API.Token,
+		Tokens:                  apiTokens(cfg.API.Tokens),
 		WorkspaceDir:            cfg.Agent.WorkspaceDir,
 		StreamPollInterval:      cfg.API.StreamPollInterval,
 		StreamHeartbeatInterval: cfg.API.StreamHeartbeatInterval,
+		SnapshotMaxSteps:        cfg.API.SnapshotMaxSteps,
+		MaxContextBytes:         cfg.API.MaxContextBytes,
+		MaxRequestBytes:         cfg.API.MaxRequestBytes,
+		MaxConcurrentStreams:    cfg.API.MaxConcurrentStreams,
+		MaxStreamDuration:       cfg.API.MaxStreamDuration,
+		ReadHeaderTimeout:       cfg.API.ReadHeaderTimeout,
+		IdleTimeout:             cfg.API.IdleTimeout,
+		H2C:                     cfg.API.H2C,
+		HTTP2MaxStreams:         cfg.API.HTTP2MaxConcurrentStreams,
+		DedupIdenticalGoals:     cfg.API.DedupIdenticalGoals,
+		DedupWindow:             cfg.API.DedupWindow,
+		MaxDeadlineExtension:    cfg.Agent.MaxDeadlineExtension,
+		ReadinessChecks:         readinessChecks(cfg),
+		AllowedConstraints:      cfg.API.AllowedConstraints,
+		DefaultContext:          cfg.API.DefaultContext,
+		DefaultConstraints:      cfg.API.DefaultConstraints,
+		Models:                  append([]string{cfg.LLM.Model}, cfg.LLM.AllowedModels...),
 	}, runStore, runner, logger)
+	if err := srv.ValidateDefaults(); err != nil {
+		return err
+	}
 
 	// Signal handling
 	sigCh := make(chan os.Signal, 1)
@@ -144,7 +232,7 @@ func runStart(args []string) error {
 	select {
 	case sig := <-sigCh:
 		logger.Info("received signal, shutting down", "signal", sig)
-		cancel()
+		cancel(agent.ErrShutdown)
 		select {
 		case <-runner.Done():
 			logger.Info("runner stopped gracefully")
@@ -159,3 +247,74 @@ func runStart(args []string) error {
 		return nil
 	}
 }
+
+// newLogger builds the service logger from log_level, log_format, and log_file.
+// Logs go to stdout unless log_file is set, in which case they are appended to
+// it so external rotation (e.g. logrotate copytruncate) keeps working.
+func newLogger(svc config.ServiceConfig) (*slog.Logger, func(), error) {
+	logLevel := slog.LevelInfo
+	switch svc.LogLevel {
+	case "debug":
+		logLevel = slog.LevelDebug
+	case "warn":
+		logLevel = slog.LevelWarn
+	case "error":
+		logLevel = slog.LevelError
+	}
+
+	var out io.Writer = os.Stdout
+	closeFn := func() {}
+	if svc.LogFile != "" {
+		if err := os.MkdirAll(filepath.Dir(svc.LogFile), 0o755); err != nil {
+			return nil, nil, fmt.Errorf("create log directory: %w", err)
+		}
+		f, err := os.OpenFile(svc.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open log file: %w", err)
+		}
+		out = f
+		closeFn = func() { _ = f.Close() }
+	}
+
+	opts := &slog.HandlerOptions{Level: logLevel}
+	if svc.LogFormat == "text" {
+		return slog.New(slog.NewTextHandler(out, opts)), closeFn, nil
+	}
+	return slog.New(slog.NewJSONHandler(out, opts)), closeFn, nil
+}
+
+// contextWindow returns the smallest llm.context_window in the fallback
+// chain, since any of its models may be sent the same prompt, or 0 when the
+// primary model's window is not configured.
+func contextWindow(llm config.LLMConfig) int {
+	window := llm.ContextWindow
+	for _, fb := range llm.Fallbacks {
+		if fb.ContextWindow > 0 && fb.ContextWindow < window {
+			window = fb.ContextWindow
+		}
+	}
+	return window
+}
+
+func apiTokens(cfgTokens []config.APITokenConfig) []api.Token {
+	tokens := make([]api.Token, 0, len(cfgTokens))
+	for _, t := range cfgTokens {
+		scopes := make([]api.Scope, 0, len(t.Scopes))
+		for _, scope := range t.Scopes {
+			scopes = append(scopes, api.Scope(scope))
+		}
+		tokens = append(tokens, api.Token{Name: t.Name, Value: t.Token, Scopes: scopes})
+	}
+	return tokens
+}
+
+func readinessChecks(cfg *config.Config) []api.ReadinessCheck {
+	if !cfg.API.ReadinessProviderCheck {
+		return nil
+	}
+	llm := cfg.LLM
+	return []api.ReadinessCheck{{
+		Name:  "llm_provider",
+		Check: func(ctx context.Context) error { return provider.Ping(ctx, llm) },
+	}}
+}
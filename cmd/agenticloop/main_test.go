@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/config"
+)
+
+func TestNewLoggerAppendsTextToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "agenticloop.log")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("existing line\n"), 0o644); err != nil {
+		t.Fatalf("seed log file: %v", err)
+	}
+
+	logger, closeLog, err := newLogger(config.ServiceConfig{LogLevel: "info", LogFormat: "text", LogFile: path})
+	if err != nil {
+		t.Fatalf("newLogger: %v", err)
+	}
+	logger.Debug("hidden")
+	logger.Info("hello", "run_id", "r1")
+	closeLog()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log file: %v", err)
+	}
+	got := string(data)
+	if !strings.HasPrefix(got, "existing line\n") {
+		t.Fatalf("expected log file to be appended to, got %q", got)
+	}
+	if !strings.Contains(got, "msg=hello run_id=r1") || strings.Contains(got, "hidden") {
+		t.Fatalf("unexpected text log output: %q", got)
+	}
+}
+
+func TestContextWindowUsesSmallestInFallbackChain(t *testing.T) {
+	llm := config.LLMConfig{ContextWindow: 200000, Fallbacks: []config.LLMConfig{{ContextWindow: 32000}, {}}}
+	if got := contextWindow(llm); got != 32000 {
+		t.Fatalf("contextWindow = %d, want 32000", got)
+	}
+	if got := contextWindow(config.LLMConfig{Fallbacks: []config.LLMConfig{{ContextWindow: 8000}}}); got != 0 {
+		t.Fatalf("contextWindow without a primary window = %d, want 0", got)
+	}
+}
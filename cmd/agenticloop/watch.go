@@ -71,11 +71,6 @@ type runFoundMsg struct {
 
 type pollTickMsg struct{}
 
-type workspaceSnapshotMsg struct {
-	Summary workspaceSummary
-	Err     string
-}
-
 type tokenUsage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
@@ -105,17 +100,21 @@ func (u *toolTokenUsage) add(other toolTokenUsage) {
 type stepMetrics struct {
 	Tokens         tokenUsage
 	ToolTokenUsage map[string]toolTokenUsage
+	// Cost is the step's estimated_cost, nil when its model is unpriced.
+	Cost *float64
 }
 
 type parsedStepOutput struct {
 	Content        string
 	TokenUsage     tokenUsage
 	ToolTokenUsage map[string]toolTokenUsage
+	EstimatedCost  *float64
 }
 
 type workspaceFile struct {
 	Path      string `json:"path"`
 	SizeBytes int64  `json:"size_bytes"`
+	Category  string `json:"category"`
 }
 
 type workspaceSummary struct {
@@ -134,17 +133,21 @@ type watchModel struct {
 	height          int
 	connected       bool
 	done            bool
+	reconnect       bool
 	err             error
 	runStatus       string
 	events          []string
 	stepMetrics     map[string]stepMetrics
 	tokenTotals     tokenUsage
 	toolTokenTotals map[string]toolTokenUsage
+	partialSteps    int // steps in a truncated snapshot; token totals are partial
+	totalSteps      int // run step count reported by a truncated snapshot
 	workspace       workspaceSummary
 	workspaceErr    string
 	iteration       int
 	currentPhase    string
-	reflectChoice   string // "plan" | "act" | "done" | ""
+	reflectChoice   string   // "plan" | "act" | "done" | ""
+	costTotal       *float64 // summed step estimated_cost; nil while a step with token usage is unpriced
 }
 
 func newWatchModel(cfg watchConfig) watchModel {
@@ -171,7 +174,6 @@ func (m watchModel) Init() tea.Cmd {
 	return tea.Batch(
 		startEventStreamCmd(m.cfg, m.streamEvents),
 		waitForStreamEventCmd(m.streamEvents),
-		fetchWorkspaceCmd(m.cfg.APIBase, m.cfg.Token, m.cfg.RunID),
 	)
 }
 
@@ -197,6 +199,7 @@ func (m watchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.stepMetrics = map[string]stepMetrics{}
 		m.tokenTotals = tokenUsage{}
 		m.toolTokenTotals = map[string]toolTokenUsage{}
+		m.costTotal = nil
 		m.workspace = workspaceSummary{}
 		m.workspaceErr = ""
 		m.iteration = 0
@@ -206,21 +209,9 @@ func (m watchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, tea.Batch(
 			startEventStreamCmd(m.cfg, m.streamEvents),
 			waitForStreamEventCmd(m.streamEvents),
-			fetchWorkspaceCmd(m.cfg.APIBase, m.cfg.Token, m.cfg.RunID),
 		)
 	case streamStartedMsg:
 		m.connected = true
-		if strings.TrimSpace(m.cfg.RunID) == "" {
-			return m, nil
-		}
-		return m, fetchWorkspaceCmd(m.cfg.APIBase, m.cfg.Token, m.cfg.RunID)
-	case workspaceSnapshotMsg:
-		if msg.Err != "" {
-			m.workspaceErr = msg.Err
-			return m, nil
-		}
-		m.workspace = msg.Summary
-		m.workspaceErr = ""
 		return m, nil
 	case streamEventMsg:
 		if msg.Err != nil {
@@ -236,10 +227,15 @@ func (m watchModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.done {
 			return m, m.resetToWaiting()
 		}
-		return m, tea.Batch(
-			waitForStreamEventCmd(m.streamEvents),
-			fetchWorkspaceCmd(m.cfg.APIBase, m.cfg.Token, m.cfg.RunID),
-		)
+		if m.reconnect {
+			m.reconnect = false
+			m.streamEvents = make(chan streamEventMsg, 32)
+			return m, tea.Batch(
+				startEventStreamCmd(m.cfg, m.streamEvents),
+				waitForStreamEventCmd(m.streamEvents),
+			)
+		}
+		return m, waitForStreamEventCmd(m.streamEvents)
 	default:
 		return m, nil
 	}
@@ -386,11 +382,17 @@ func (m *watchModel) handleEvent(event string, data []byte) {
 				Status     string          `json:"status"`
 				ToolOutput json.RawMessage `json:"tool_output"`
 			} `json:"steps"`
+			Truncated  bool `json:"truncated"`
+			TotalSteps int  `json:"total_steps"`
 		}
 		if err := json.Unmarshal(data, &payload); err != nil {
 			m.appendEvent("snapshot (unparsed)")
 			return
 		}
+		m.partialSteps, m.totalSteps = 0, 0
+		if payload.Truncated {
+			m.partialSteps, m.totalSteps = len(payload.Steps), payload.TotalSteps
+		}
 		m.runStatus = payload.Run.Status
 		m.stepMetrics = map[string]stepMetrics{}
 		for _, step := range payload.Steps {
@@ -398,10 +400,25 @@ func (m *watchModel) handleEvent(event string, data []byte) {
 			m.stepMetrics[step.ID] = stepMetrics{
 				Tokens:         parsed.TokenUsage,
 				ToolTokenUsage: parsed.ToolTokenUsage,
+				Cost:           parsed.EstimatedCost,
 			}
 		}
 		m.recalculateTokenTotals()
-		m.appendEvent(fmt.Sprintf("[%s] snapshot: %d step(s)", time.Now().Format("15:04:05"), len(payload.Steps)))
+		if payload.Truncated {
+			m.appendEvent(fmt.Sprintf("[%s] snapshot: last %d of %d step(s)", time.Now().Format("15:04:05"), len(payload.Steps), payload.TotalSteps))
+		} else {
+			m.appendEvent(fmt.Sprintf("[%s] snapshot: %d step(s)", time.Now().Format("15:04:05"), len(payload.Steps)))
+		}
+	case "workspace.updated":
+		var payload struct {
+			Workspace workspaceSummary `json:"workspace"`
+		}
+		if err := json.Unmarshal(data, &payload); err != nil {
+			m.workspaceErr = "workspace.updated (unparsed)"
+			return
+		}
+		m.workspace = payload.Workspace
+		m.workspaceErr = ""
 	case "run.updated":
 		var payload struct {
 			Run struct {
@@ -488,6 +505,7 @@ func (m *watchModel) handleEvent(event string, data []byte) {
 			m.stepMetrics[payload.Step.ID] = stepMetrics{
 				Tokens:         parsed.TokenUsage,
 				ToolTokenUsage: parsed.ToolTokenUsage,
+				Cost:           parsed.EstimatedCost,
 			}
 			m.recalculateTokenTotals()
 		}
@@ -499,6 +517,13 @@ func (m *watchModel) handleEvent(event string, data []byte) {
 		if err := json.Unmarshal(data, &payload); err != nil {
 			payload.Status = "unknown"
 		}
+		// The server closes streams that reach api.max_stream_duration; the
+		// run is still going, so open a fresh stream for it.
+		if payload.Status == "timeout" {
+			m.reconnect = true
+			m.appendEvent(fmt.Sprintf("[%s] stream reached max duration; reconnecting", time.Now().Format("15:04:05")))
+			return
+		}
 		m.runStatus = payload.Status
 		m.done = true
 		m.appendEvent(fmt.Sprintf("[%s] stream closed status=%s", time.Now().Format("15:04:05"), payload.Status))
@@ -519,19 +544,42 @@ func (m *watchModel) handleEvent(event string, data []byte) {
 func (m *watchModel) recalculateTokenTotals() {
 	m.tokenTotals = tokenUsage{}
 	m.toolTokenTotals = map[string]toolTokenUsage{}
+	m.costTotal = nil
+	var cost float64
+	priced, unpriced := false, false
 	for _, metrics := range m.stepMetrics {
 		m.tokenTotals.add(metrics.Tokens)
+		if metrics.Tokens != (tokenUsage{}) {
+			if metrics.Cost == nil {
+				unpriced = true
+			} else {
+				cost += *metrics.Cost
+				priced = true
+			}
+		}
 		for toolName, usage := range metrics.ToolTokenUsage {
 			current := m.toolTokenTotals[toolName]
 			current.add(usage)
 			m.toolTokenTotals[toolName] = current
 		}
 	}
+	if priced && !unpriced {
+		m.costTotal = &cost
+	}
 }
 
 func (m *watchModel) tokenPanelLines(maxLines int) []string {
+	total := fmt.Sprintf("job total: total=%d prompt=%d completion=%d", m.tokenTotals.TotalTokens, m.tokenTotals.PromptTokens, m.tokenTotals.CompletionTokens)
+	if m.costTotal != nil {
+		total += fmt.Sprintf(" est_cost=%.4f", *m.costTotal)
+	} else if m.tokenTotals != (tokenUsage{}) {
+		total += " est_cost=unknown"
+	}
+	if m.totalSteps > 0 {
+		total += fmt.Sprintf(" (partial: snapshot had last %d of %d steps)", m.partialSteps, m.totalSteps)
+	}
 	lines := []string{
-		fmt.Sprintf("job total: total=%d prompt=%d completion=%d", m.tokenTotals.TotalTokens, m.tokenTotals.PromptTokens, m.tokenTotals.CompletionTokens),
+		total,
 		"per-tool ACT usage (estimated split per tool-call round):",
 	}
 	if len(m.toolTokenTotals) == 0 {
@@ -578,7 +626,11 @@ func (m *watchModel) workspacePanelLines(maxLines int) []string {
 		return trimPanelLines(lines, maxLines)
 	}
 	for _, f := range m.workspace.Files {
-		lines = append(lines, fmt.Sprintf("  %s (%s)", f.Path, formatBytes(f.SizeBytes)))
+		if f.Category != "" {
+			lines = append(lines, fmt.Sprintf("  %s (%s, %s)", f.Path, formatBytes(f.SizeBytes), f.Category))
+		} else {
+			lines = append(lines, fmt.Sprintf("  %s (%s)", f.Path, formatBytes(f.SizeBytes)))
+		}
 	}
 	return trimPanelLines(lines, maxLines)
 }
@@ -603,13 +655,15 @@ func parseStepOutput(raw json.RawMessage) parsedStepOutput {
 		Content        string                    `json:"content"`
 		TokenUsage     tokenUsage                `json:"token_usage"`
 		ToolTokenUsage map[string]toolTokenUsage `json:"tool_token_usage"`
+		EstimatedCost  *float64                  `json:"estimated_cost"`
 	}
 	if err := json.Unmarshal(raw, &payload); err != nil {
 		return parsedStepOutput{}
 	}
 	out := parsedStepOutput{
-		Content:    payload.Content,
-		TokenUsage: payload.TokenUsage,
+		Content:       payload.Content,
+		TokenUsage:    payload.TokenUsage,
+		EstimatedCost: payload.EstimatedCost,
 	}
 	if len(payload.ToolTokenUsage) > 0 {
 		out.ToolTokenUsage = payload.ToolTokenUsage
@@ -654,6 +708,7 @@ func (m *watchModel) resetToWaiting() tea.Cmd {
 	m.stepMetrics = map[string]stepMetrics{}
 	m.tokenTotals = tokenUsage{}
 	m.toolTokenTotals = map[string]toolTokenUsage{}
+	m.costTotal = nil
 	m.workspace = workspaceSummary{}
 	m.workspaceErr = ""
 	return pollForRunCmd(m.cfg.APIBase, m.cfg.Token, m.cfg.PollInterval)
@@ -688,35 +743,6 @@ func pollForRunCmd(apiBase, token string, pollInterval time.Duration) tea.Cmd {
 	}
 }
 
-func fetchWorkspaceCmd(apiBase, token, runID string) tea.Cmd {
-	return func() tea.Msg {
-		if strings.TrimSpace(runID) == "" {
-			return workspaceSnapshotMsg{}
-		}
-		u := fmt.Sprintf("%s/v1/runs/%s/workspace", apiBase, url.PathEscape(runID))
-		req, err := http.NewRequest(http.MethodGet, u, nil)
-		if err != nil {
-			return workspaceSnapshotMsg{Err: fmt.Sprintf("create workspace request: %v", err)}
-		}
-		req.Header.Set("Authorization", "Bearer "+token)
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return workspaceSnapshotMsg{Err: fmt.Sprintf("workspace fetch: %v", err)}
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-			return workspaceSnapshotMsg{Err: fmt.Sprintf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))}
-		}
-
-		var payload workspaceSummary
-		if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-			return workspaceSnapshotMsg{Err: fmt.Sprintf("decode workspace payload: %v", err)}
-		}
-		return workspaceSnapshotMsg{Summary: payload}
-	}
-}
-
 func startEventStreamCmd(cfg watchConfig, out chan streamEventMsg) tea.Cmd {
 	return func() tea.Msg {
 		go streamRunEvents(cfg, out)
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -69,3 +70,85 @@ func TestWatchModelRecalculateTokenTotals(t *testing.T) {
 		t.Fatalf("workspace_list totals = %+v, want total=15 calls=1", list)
 	}
 }
+
+func TestWatchModelShowsEstimatedCost(t *testing.T) {
+	m := newWatchModel(watchConfig{RunID: "run-1"})
+	m.handleEvent("snapshot", []byte(`{
+		"run": {"status": "running"},
+		"steps": [
+			{"id": "s1", "step_num": 1, "phase": "frame", "status": "ok", "tool_output": {"token_usage": {"total_tokens": 40}, "estimated_cost": 0.0125}},
+			{"id": "s2", "step_num": 2, "phase": "act", "status": "ok", "tool_output": {"token_usage": {"total_tokens": 10}, "estimated_cost": 0.0025}}
+		]
+	}`))
+	if lines := m.tokenPanelLines(10); !strings.Contains(lines[0], "est_cost=0.0150") {
+		t.Fatalf("expected summed cost in token panel, got %q", lines[0])
+	}
+
+	m.handleEvent("step.updated", []byte(`{"step": {"id": "s3", "step_num": 3, "phase": "reflect", "status": "ok", "tool_output": {"token_usage": {"total_tokens": 5}, "estimated_cost": null}}}`))
+	if lines := m.tokenPanelLines(10); !strings.Contains(lines[0], "est_cost=unknown") {
+		t.Fatalf("expected unknown cost once a step is unpriced, got %q", lines[0])
+	}
+}
+
+func TestWatchModelHandlesTruncatedSnapshot(t *testing.T) {
+	m := newWatchModel(watchConfig{RunID: "run-1"})
+	m.handleEvent("snapshot", []byte(`{
+		"run": {"status": "running"},
+		"steps": [
+			{"id": "s9", "step_num": 9, "phase": "act", "status": "ok", "tool_output": {"token_usage": {"total_tokens": 40}}},
+			{"id": "s10", "step_num": 10, "phase": "reflect", "status": "ok", "tool_output": {"token_usage": {"total_tokens": 10}}}
+		],
+		"truncated": true,
+		"total_steps": 10
+	}`))
+
+	if m.tokenTotals.TotalTokens != 50 {
+		t.Fatalf("token total = %d, want 50", m.tokenTotals.TotalTokens)
+	}
+	lines := m.tokenPanelLines(10)
+	if !strings.Contains(lines[0], "partial") || !strings.Contains(lines[0], "last 2 of 10") {
+		t.Fatalf("expected partial marker in token panel, got %q", lines[0])
+	}
+
+	m.handleEvent("snapshot", []byte(`{"run": {"status": "running"}, "steps": [], "truncated": false, "total_steps": 0}`))
+	if lines := m.tokenPanelLines(10); strings.Contains(lines[0], "partial") {
+		t.Fatalf("expected full snapshot to clear partial marker, got %q", lines[0])
+	}
+}
+
+func TestWatchModelAppliesWorkspaceUpdatedEvent(t *testing.T) {
+	m := newWatchModel(watchConfig{RunID: "run-1"})
+	m.handleEvent("workspace.updated", []byte(`{
+		"type": "workspace.updated",
+		"run_id": "run-1",
+		"workspace": {"run_id": "run-1", "file_count": 1, "total_size_bytes": 12, "files": [{"path": "notes.md", "size_bytes": 12, "category": "text"}]}
+	}`))
+
+	if m.workspace.FileCount != 1 || len(m.workspace.Files) != 1 || m.workspace.Files[0].Path != "notes.md" {
+		t.Fatalf("unexpected workspace summary: %+v", m.workspace)
+	}
+	lines := m.workspacePanelLines(5)
+	if !strings.Contains(strings.Join(lines, "\n"), "notes.md") {
+		t.Fatalf("expected workspace panel to list notes.md, got %q", lines)
+	}
+}
+
+func TestWatchModelReconnectsWhenStreamTimesOut(t *testing.T) {
+	m := newWatchModel(watchConfig{RunID: "run-1"})
+	m.explicitRunID = true
+	m.runStatus = "running"
+
+	m.handleEvent("stream.closed", []byte(`{"type":"stream.closed","run_id":"run-1","status":"timeout"}`))
+	if m.done || !m.reconnect {
+		t.Fatalf("timeout close should reconnect, got done=%v reconnect=%v", m.done, m.reconnect)
+	}
+	if m.runStatus != "running" {
+		t.Fatalf("run status = %q, want running", m.runStatus)
+	}
+
+	m.reconnect = false
+	m.handleEvent("stream.closed", []byte(`{"type":"stream.closed","run_id":"run-1","status":"done"}`))
+	if !m.done || m.reconnect {
+		t.Fatalf("finished run should end the stream, got done=%v reconnect=%v", m.done, m.reconnect)
+	}
+}
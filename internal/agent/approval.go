@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/mattjoyce/agenticloop/internal/localtools"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// ErrApprovalRejected is returned when an operator rejects a request_approval
+// request, or none decides it within agent.approval.timeout.
+var ErrApprovalRejected = errors.New("approval rejected")
+
+// maxApprovalChars bounds the action and reason of one approval request.
+const maxApprovalChars = 2000
+
+// approvalTool lets ACT pause the run until an operator approves or rejects
+// an action through POST /v1/runs/{run_id}/approve or /reject. The ACT stage
+// ends after the call and the loop waits for the decision before going on.
+type approvalTool struct {
+	runs     *store.RunStore
+	runID    string
+	redactor *Redactor
+	observer localtools.Observer
+}
+
+var _ tool.InvokableTool = (*approvalTool)(nil)
+
+func newApprovalTool(runs *store.RunStore, runID string, redactor *Redactor, observer localtools.Observer) *approvalTool {
+	return &approvalTool{runs: runs, runID: runID, redactor: redactor, observer: observer}
+}
+
+// Info returns tool metadata for model planning.
+func (t *approvalTool) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: "request_approval",
+		Desc: "Ask a human operator to approve a sensitive action before you take it. The run pauses after this call until the operator decides; the decision is then shown as user guidance, and a rejection ends the run. Do not take the action until it is approved.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"action": {Type: schema.String, Desc: "The exact action you want to take, e.g. the command or tool call", Required: true},
+			"reason": {Type: schema.String, Desc: "Why the action is needed and what it will change"},
+		}),
+	}, nil
+}
+
+// InvokableRun records the request and returns JSON output; failures are
+// reported to the model as a status "error" result.
+func (t *approvalTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	resp, err := t.request(ctx, json.RawMessage(argumentsInJSON))
+	status := "ok"
+	if err != nil {
+		status = "error"
+		resp = map[string]any{"status": status, "error": err.Error()}
+	} else {
+		resp["status"] = status
+	}
+	out := string(mustJSON(resp))
+	if t.observer != nil {
+		t.observer("request_approval", argumentsInJSON, out, status)
+	}
+	return out, nil
+}
+
+func (t *approvalTool) request(ctx context.Context, raw json.RawMessage) (map[string]any, error) {
+	var args struct {
+		Action string `json:"action"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("parse arguments: %w", err)
+	}
+	action := strings.TrimSpace(args.Action)
+	if action == "" {
+		return nil, fmt.Errorf("action is required")
+	}
+	pending, err := t.runs.PendingApproval(ctx, t.runID)
+	if err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		return nil, fmt.Errorf("an approval request is already pending")
+	}
+	approval := store.Approval{
+		Action:      clipText(t.redactor.String(action), maxApprovalChars),
+		Reason:      clipText(t.redactor.String(strings.TrimSpace(args.Reason)), maxApprovalChars),
+		RequestedAt: time.Now().UTC(),
+	}
+	if err := t.runs.RequestApproval(ctx, t.runID, approval); err != nil {
+		return nil, err
+	}
+	return map[string]any{"approval": "pending", "message": "The run is paused until an operator decides."}, nil
+}
+
+// awaitApproval blocks while the run has an undecided request_approval
+// request, checking every agent.approval.poll_interval. An approval is added
+// to {{.UserGuidance}} and run memory and the run goes on; a rejection, or
+// no decision within agent.approval.timeout, returns ErrApprovalRejected.
+// It returns at once when the run has no request.
+func (l *Loop) awaitApproval(ctx context.Context, runID string, iter int, state *stageState) error {
+	approval, err := l.runStore.PendingApproval(ctx, runID)
+	if err != nil || approval == nil {
+		return err
+	}
+	if err := l.runStore.RequestApproval(ctx, runID, *approval); err != nil {
+		return fmt.Errorf("await approval: %w", err)
+	}
+	l.logger.Info("run awaiting approval", "run_id", runID, "iteration", iter, "action", approval.Action)
+
+	poll := l.cfg.Approval.PollInterval
+	if poll <= 0 {
+		poll = 2 * time.Second
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	var expired <-chan time.Time
+	if timeout := l.cfg.Approval.Timeout; timeout > 0 {
+		timer := time.NewTimer(time.Until(approval.RequestedAt.Add(timeout)))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for approval.Decision == "" {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("awaiting approval: %w", context.Cause(ctx))
+		case <-expired:
+			expired = nil
+			// A decision made at the same moment wins; it is read below.
+			if _, err := l.runStore.DecideApproval(ctx, runID, false, fmt.Sprintf("no decision within %s", l.cfg.Approval.Timeout)); err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("expire approval: %w", err)
+			}
+		case <-ticker.C:
+		}
+		if approval, err = l.runStore.PendingApproval(ctx, runID); err != nil {
+			return err
+		}
+		if approval == nil {
+			return nil
+		}
+	}
+
+	outcome := fmt.Sprintf("Operator %s: %s", approval.Decision, approval.Action)
+	if approval.Note != "" {
+		outcome += " (" + approval.Note + ")"
+	}
+	l.logger.Info("approval decided", "run_id", runID, "iteration", iter, "decision", approval.Decision)
+	if l.ws != nil {
+		if err := l.ws.AppendRunMemory(iter, l.redactor.String(outcome)); err != nil {
+			l.logger.Error("failed to record approval decision", "run_id", runID, "iteration", iter, "error", err)
+		}
+	}
+	if approval.Decision != store.ApprovalApproved {
+		return fmt.Errorf("%w: %s", ErrApprovalRejected, outcome)
+	}
+	if err := l.runStore.ResolveApproval(ctx, runID); err != nil {
+		return err
+	}
+	decidedAt := time.Now()
+	if approval.DecidedAt != nil {
+		decidedAt = *approval.DecidedAt
+	}
+	state.UserGuidance = strings.TrimSpace(state.UserGuidance + "\n" + fmt.Sprintf("[%s] %s", decidedAt.UTC().Format(time.RFC3339), outcome))
+	return nil
+}
+
+// approvalPending reports whether a request_approval result recorded a
+// request, as opposed to reporting an error to the model.
+func approvalPending(out json.RawMessage) bool {
+	var parsed struct {
+		Approval string `json:"approval"`
+	}
+	return json.Unmarshal(out, &parsed) == nil && parsed.Approval == "pending"
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/mattjoyce/agenticloop/internal/config"
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestExecutePausesForApproval(t *testing.T) {
+	for _, approve := range []bool{true, false} {
+		ctx := context.Background()
+		db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+		if err != nil {
+			t.Fatalf("open sqlite: %v", err)
+		}
+		t.Cleanup(func() { _ = db.Close() })
+
+		runStore := store.NewRunStore(db)
+		stepStore := store.NewStepStore(db)
+		run, _, err := runStore.Create(ctx, "clean up old backups", nil, nil, nil, nil, 0)
+		if err != nil {
+			t.Fatalf("create run: %v", err)
+		}
+
+		chatModel := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{
+			responses: []*schema.Message{
+				{Role: schema.Assistant, Content: `{"todo":[]}`},
+				{Role: schema.Assistant, Content: "1. delete backups/2023 once approved"},
+				{Role: schema.Assistant, ToolCalls: []schema.ToolCall{
+					{ID: "tc-1", Type: "function", Function: schema.FunctionCall{Name: "request_approval", Arguments: `{"action":"rm -r backups/2023","reason":"frees 40GB"}`}},
+					{ID: "tc-2", Type: "function", Function: schema.FunctionCall{Name: "set_summary", Arguments: `{"summary":"deleted backups"}`}},
+				}},
+				{Role: schema.Assistant, Content: `{"next_stage":"act"}`},
+			},
+		}}
+
+		loop := NewLoop(chatModel, nil, config.AgentConfig{
+			DefaultMaxLoops: 1,
+			DefaultDeadline: time.Minute,
+			MaxActRounds:    3,
+			MaxRetryPerStep: 1,
+			WorkspaceDir:    t.TempDir(),
+			Approval:        config.ApprovalConfig{Enabled: true, PollInterval: 5 * time.Millisecond},
+			Prompts: config.AgentPrompts{
+				Frame:   "frame",
+				Plan:    "plan",
+				Act:     "act",
+				Reflect: "reflect {{.UserGuidance}}",
+			},
+		}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+		decided := make(chan error, 1)
+		go func() {
+			for {
+				got, err := runStore.GetByID(ctx, run.ID)
+				if err != nil {
+					decided <- err
+					return
+				}
+				if got.Status == store.RunStatusAwaitingApproval {
+					_, err := runStore.DecideApproval(ctx, run.ID, approve, "checked with the owner")
+					decided <- err
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}()
+
+		execErr := loop.Execute(ctx, run, "")
+		if err := <-decided; err != nil {
+			t.Fatalf("decide approval: %v", err)
+		}
+
+		got, err := runStore.GetByID(ctx, run.ID)
+		if err != nil {
+			t.Fatalf("get run: %v", err)
+		}
+		if got.WorkingSummary != nil {
+			t.Fatalf("set_summary ran before the decision: %q", *got.WorkingSummary)
+		}
+
+		if !approve {
+			if !errors.Is(execErr, ErrApprovalRejected) {
+				t.Fatalf("rejected run error = %v, want ErrApprovalRejected", execErr)
+			}
+			if got.Status != store.RunStatusFailed || got.FailureCode == nil || *got.FailureCode != store.FailureCodeApprovalRejected {
+				t.Fatalf("rejected run = status %s, failure code %v", got.Status, got.FailureCode)
+			}
+			if len(chatModel.prompts) != 3 {
+				t.Fatalf("rejected run made %d model calls, want 3 (no reflect)", len(chatModel.prompts))
+			}
+			continue
+		}
+
+		if execErr == nil || errors.Is(execErr, ErrApprovalRejected) {
+			t.Fatalf("approved run error = %v, want max loops failure", execErr)
+		}
+		if got.PendingApproval != nil {
+			t.Fatalf("approved request still pending: %+v", got.PendingApproval)
+		}
+		reflect := chatModel.prompts[len(chatModel.prompts)-1]
+		if !strings.Contains(reflect, "Operator approved: rm -r backups/2023 (checked with the owner)") {
+			t.Fatalf("reflect prompt %q lacks the approval guidance", reflect)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mattjoyce/agenticloop/internal/ductile"
+)
+
+// callbackTimeout bounds one callback delivery attempt.
+const callbackTimeout = 5 * time.Second
+
+// callbackRetryWindow is how long after a run completes the background
+// retrier keeps trying to deliver its callback.
+const callbackRetryWindow = 24 * time.Hour
+
+// CallbackPolicy controls completion callback delivery: each callback is
+// retried up to MaxRetries times, waiting Backoff before the first retry and
+// doubling it before each further one.
+type CallbackPolicy struct {
+	MaxRetries int
+	Backoff    time.Duration
+}
+
+// callbackPayload builds the webhook body for a finished run.
+func callbackPayload(runID, status string, summary, errMsg *string) map[string]any {
+	payload := map[string]any{
+		"run_id": runID,
+		"status": status,
+	}
+	if summary != nil {
+		payload["summary"] = *summary
+	}
+	if errMsg != nil {
+		payload["error"] = *errMsg
+	}
+	return payload
+}
+
+// deliverCallback posts payload to callbackURL, retrying failures with
+// exponential backoff under policy. It returns the last error once every
+// attempt has failed, or ctx's error if ctx ends first.
+func deliverCallback(ctx context.Context, client *ductile.Client, callbackURL string, payload map[string]any, policy CallbackPolicy) error {
+	backoff := policy.Backoff
+	var err error
+	for attempt := 0; attempt <= max(policy.MaxRetries, 0); attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, callbackTimeout)
+		err = client.Callback(attemptCtx, callbackURL, payload)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("after %d attempts: %w", max(policy.MaxRetries, 0)+1, err)
+}
+
+// StartCallbackRetrier re-attempts undelivered completion callbacks
+// immediately and then on every interval until ctx is cancelled.
+func (r *Runner) StartCallbackRetrier(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	r.logger.Info("callback retrier started", "interval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RetryPendingCallbacks(ctx); err != nil {
+			r.logger.Error("callback retry sweep failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			r.logger.Info("callback retrier stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RetryPendingCallbacks delivers the callbacks of runs that finished within
+// callbackRetryWindow but whose callback was not delivered, for example
+// because the webhook was down or the process restarted. It returns how many
+// were delivered.
+func (r *Runner) RetryPendingCallbacks(ctx context.Context) (int, error) {
+	if r.callback == "" || r.client == nil {
+		return 0, nil
+	}
+	runs, err := r.runStore.ListPendingCallbacks(ctx, time.Now().Add(-callbackRetryWindow))
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, run := range runs {
+		if ctx.Err() != nil {
+			return delivered, ctx.Err()
+		}
+		// The worker is still delivering this one with its own retries.
+		if r.owns(run.ID) {
+			continue
+		}
+		payload := callbackPayload(run.ID, string(run.Status), run.Summary, run.Error)
+		if err := deliverCallback(ctx, r.client, r.callback, payload, CallbackPolicy{}); err != nil {
+			r.logger.Warn("callback retry failed", "run_id", run.ID, "error", err)
+			continue
+		}
+		if err := r.runStore.SetCallbackDelivered(ctx, run.ID, true); err != nil {
+			r.logger.Error("failed to record callback delivery", "run_id", run.ID, "error", err)
+			continue
+		}
+		delivered++
+		r.logger.Info("pending callback delivered", "run_id", run.ID, "status", run.Status)
+	}
+	return delivered, nil
+}
+
+// SetCallbackPolicy sets the retry policy for completion callbacks.
+func (r *Runner) SetCallbackPolicy(policy CallbackPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.callbackPolicy = policy
+}
+
+// markCallback records the run's callback as pending or delivered.
+func (l *Loop) markCallback(runID string, delivered bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := l.runStore.SetCallbackDelivered(ctx, runID, delivered); err != nil {
+		l.logger.Error("failed to record callback state", "run_id", runID, "delivered", delivered, "error", err)
+	}
+}
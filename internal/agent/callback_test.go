@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattjoyce/agenticloop/internal/config"
+	"github.com/mattjoyce/agenticloop/internal/ductile"
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestCallbackRetriesThenBackgroundRetrierDelivers(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	runStore := store.NewRunStore(db)
+
+	var calls, failUntil atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) <= failUntil.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	client := ductile.NewClient(server.URL, "test-token", logger)
+	runner := NewRunner(runStore, store.NewStepStore(db), nil, nil, config.AgentConfig{}, client, server.URL+"/callback", logger)
+
+	newDoneRun := func() *store.Run {
+		run, _, err := runStore.Create(ctx, "goal", nil, nil, nil, nil, 0)
+		if err != nil {
+			t.Fatalf("create run: %v", err)
+		}
+		summary := "finished"
+		if err := runStore.UpdateStatus(ctx, run.ID, store.RunStatusDone, &summary, nil); err != nil {
+			t.Fatalf("complete run: %v", err)
+		}
+		return run
+	}
+	loop := NewLoop(nil, nil, config.AgentConfig{}, runStore, nil, client, logger)
+	loop.callbackPolicy = CallbackPolicy{MaxRetries: 2, Backoff: time.Millisecond}
+
+	// Two failures are absorbed by the inline retries.
+	retried := newDoneRun()
+	failUntil.Store(2)
+	summary := "finished"
+	loop.emitCallback(ctx, server.URL+"/callback", retried.ID, "done", &summary, nil)
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("callback attempts = %d, want 3", got)
+	}
+
+	// Three failures exhaust them and leave the callback pending.
+	pending := newDoneRun()
+	calls.Store(0)
+	failUntil.Store(3)
+	loop.emitCallback(ctx, server.URL+"/callback", pending.ID, "done", &summary, nil)
+	runs, err := runStore.ListPendingCallbacks(ctx, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("list pending callbacks: %v", err)
+	}
+	if len(runs) != 1 || runs[0].ID != pending.ID {
+		t.Fatalf("pending callbacks = %v, want only %s", runs, pending.ID)
+	}
+
+	delivered, err := runner.RetryPendingCallbacks(ctx)
+	if err != nil || delivered != 1 {
+		t.Fatalf("RetryPendingCallbacks() = %d, %v; want 1 delivered", delivered, err)
+	}
+	if runs, _ := runStore.ListPendingCallbacks(ctx, time.Now().Add(-time.Hour)); len(runs) != 0 {
+		t.Fatalf("pending callbacks after retry = %d, want 0", len(runs))
+	}
+}
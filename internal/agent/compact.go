@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// StepArchiveFile is the file in the run's state directory that
+// agent.compact_completed_runs moves full step outputs to before shrinking
+// them in the database. The state directory outlives the workspace, so the
+// archive survives keep_workspace and workspace_retention.
+const StepArchiveFile = "step_outputs.jsonl"
+
+// compactMinOutputBytes is the smallest tool_output that is compacted.
+const compactMinOutputBytes = 4096
+
+// compactSummaryChars bounds each string field kept in a compacted output.
+const compactSummaryChars = 500
+
+// stepArchiveEntry is one step output recorded in step_outputs.jsonl.
+type stepArchiveEntry struct {
+	StepNum    int             `json:"step_num"`
+	Phase      string          `json:"phase"`
+	ToolOutput json.RawMessage `json:"tool_output"`
+}
+
+// compactSteps applies agent.compact_completed_runs once Execute returns.
+// Step outputs of a done or failed run larger than compactMinOutputBytes are
+// appended to step_outputs.jsonl and replaced in the database by a compacted
+// copy. Requeued runs are left alone, as are runs whose archive cannot be
+// written, so no output is dropped without an archived copy.
+func (l *Loop) compactSteps(runID string, ws *Workspace) {
+	if !l.cfg.CompactCompletedRuns {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	run, err := l.runStore.GetByID(ctx, runID)
+	if err != nil {
+		l.logger.Warn("compact_completed_runs: failed to look up run", "run_id", runID, "error", err)
+		return
+	}
+	if run.Status != store.RunStatusDone && run.Status != store.RunStatusFailed {
+		return
+	}
+	steps, err := l.stepStore.GetByRunID(ctx, runID)
+	if err != nil {
+		l.logger.Warn("compact_completed_runs: failed to list steps", "run_id", runID, "error", err)
+		return
+	}
+
+	var large []*store.Step
+	for _, step := range steps {
+		if len(step.ToolOutput) >= compactMinOutputBytes {
+			large = append(large, step)
+		}
+	}
+	if len(large) == 0 {
+		return
+	}
+	if err := ws.archiveStepOutputs(large); err != nil {
+		l.logger.Error("compact_completed_runs: failed to archive step outputs", "run_id", runID, "error", err)
+		return
+	}
+
+	saved := 0
+	for _, step := range large {
+		compacted := compactToolOutput(step.ToolOutput, step.StepNum)
+		if err := l.stepStore.ReplaceOutput(ctx, step.ID, compacted); err != nil {
+			l.logger.Warn("compact_completed_runs: failed to compact step", "run_id", runID, "step_num", step.StepNum, "error", err)
+			continue
+		}
+		saved += len(step.ToolOutput) - len(compacted)
+	}
+	l.logger.Info("compacted step outputs", "run_id", runID, "steps", len(large), "bytes_saved", saved)
+}
+
+// archiveStepOutputs appends each step's full tool_output to
+// step_outputs.jsonl in the state directory.
+func (w *Workspace) archiveStepOutputs(steps []*store.Step) error {
+	if err := os.MkdirAll(w.stateDir, 0o755); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(w.stateDir, StepArchiveFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open step archive: %w", err)
+	}
+	defer f.Close()
+
+	for _, step := range steps {
+		line, err := json.Marshal(stepArchiveEntry{StepNum: step.StepNum, Phase: string(step.Phase), ToolOutput: step.ToolOutput})
+		if err != nil {
+			return fmt.Errorf("marshal step %d: %w", step.StepNum, err)
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("write step %d: %w", step.StepNum, err)
+		}
+	}
+	return f.Sync()
+}
+
+// compactToolOutput returns the stored form of an archived step output. For
+// an object, every non-string field (token_usage, tool_token_usage,
+// tool_time_ms, ...) is kept as is and string fields are clipped to
+// compactSummaryChars. A "compacted" object points at the archived copy.
+func compactToolOutput(raw json.RawMessage, stepNum int) json.RawMessage {
+	pointer := map[string]any{
+		"archive":        StepArchiveFile,
+		"step_num":       stepNum,
+		"original_bytes": len(raw),
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return mustJSON(map[string]any{
+			"summary":   clipText(string(raw), compactSummaryChars),
+			"compacted": pointer,
+		})
+	}
+	out := make(map[string]any, len(fields)+1)
+	for key, value := range fields {
+		var text string
+		if err := json.Unmarshal(value, &text); err == nil {
+			out[key] = clipText(text, compactSummaryChars)
+			continue
+		}
+		out[key] = value
+	}
+	out["compacted"] = pointer
+	return mustJSON(out)
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/config"
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestCompactStepsArchivesLargeOutputsOfFinishedRuns(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	baseDir := t.TempDir()
+
+	run, _, err := runStore.Create(ctx, "goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	ws, err := NewWorkspace(baseDir, run.ID)
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+
+	largeOutput := mustJSON(map[string]any{
+		"content":          strings.Repeat("transcript ", 1000),
+		"token_usage":      map[string]int{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15},
+		"tool_token_usage": map[string]int{"workspace_read": 40},
+		"tool_time_ms":     12,
+	})
+	smallOutput := mustJSON(map[string]any{"content": "short"})
+	large, err := stepStore.Append(ctx, run.ID, 1, store.StepPhaseAct, nil, nil)
+	if err != nil {
+		t.Fatalf("append step: %v", err)
+	}
+	small, err := stepStore.Append(ctx, run.ID, 2, store.StepPhaseReflect, nil, nil)
+	if err != nil {
+		t.Fatalf("append step: %v", err)
+	}
+	for id, output := range map[string]json.RawMessage{large.ID: largeOutput, small.ID: smallOutput} {
+		if err := stepStore.UpdateStatus(ctx, id, store.StepStatusOK, output, nil); err != nil {
+			t.Fatalf("update step: %v", err)
+		}
+	}
+
+	loop := NewLoop(nil, nil, config.AgentConfig{WorkspaceDir: baseDir, CompactCompletedRuns: true},
+		runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// A run that is still queued (requeued on shutdown) is not compacted.
+	loop.compactSteps(run.ID, ws)
+	if _, err := os.Stat(filepath.Join(ws.StateDir(), StepArchiveFile)); !os.IsNotExist(err) {
+		t.Fatalf("archive written for unfinished run (stat error %v)", err)
+	}
+
+	if err := runStore.UpdateStatus(ctx, run.ID, store.RunStatusDone, nil, nil); err != nil {
+		t.Fatalf("update run status: %v", err)
+	}
+	loop.compactSteps(run.ID, ws)
+
+	steps, err := stepStore.GetByRunID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("list steps: %v", err)
+	}
+	var got struct {
+		Content        string         `json:"content"`
+		TokenUsage     map[string]int `json:"token_usage"`
+		ToolTokenUsage map[string]int `json:"tool_token_usage"`
+		ToolTimeMS     int            `json:"tool_time_ms"`
+		Compacted      struct {
+			Archive       string `json:"archive"`
+			StepNum       int    `json:"step_num"`
+			OriginalBytes int    `json:"original_bytes"`
+		} `json:"compacted"`
+	}
+	if err := json.Unmarshal(steps[0].ToolOutput, &got); err != nil {
+		t.Fatalf("decode compacted output: %v", err)
+	}
+	if len(got.Content) > compactSummaryChars+len("\n...[truncated]") {
+		t.Fatalf("content not clipped: %d chars", len(got.Content))
+	}
+	if got.TokenUsage["total_tokens"] != 15 || got.ToolTokenUsage["workspace_read"] != 40 || got.ToolTimeMS != 12 {
+		t.Fatalf("usage metadata not kept: %s", steps[0].ToolOutput)
+	}
+	if got.Compacted.Archive != StepArchiveFile || got.Compacted.StepNum != 1 || got.Compacted.OriginalBytes != len(largeOutput) {
+		t.Fatalf("compacted pointer = %+v", got.Compacted)
+	}
+	if string(steps[1].ToolOutput) != string(smallOutput) {
+		t.Fatalf("small output changed: %s", steps[1].ToolOutput)
+	}
+
+	// The archive lives in the state directory, so removing the workspace
+	// under keep_workspace leaves it in place.
+	loop.cfg.KeepWorkspace = "never"
+	loop.discardWorkspace(run.ID, ws)
+	if _, err := os.Stat(ws.Dir()); !os.IsNotExist(err) {
+		t.Fatalf("workspace not removed (stat error %v)", err)
+	}
+	data, err := os.ReadFile(filepath.Join(ws.StateDir(), StepArchiveFile))
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("archive lines = %d, want 1", len(lines))
+	}
+	var entry stepArchiveEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("decode archive entry: %v", err)
+	}
+	if entry.StepNum != 1 || entry.Phase != string(store.StepPhaseAct) || string(entry.ToolOutput) != string(largeOutput) {
+		t.Fatalf("archive entry = %+v", entry)
+	}
+}
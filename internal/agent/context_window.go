@@ -0,0 +1,29 @@
+package agent
+
+// defaultClipChars bounds each memory and state field in a stage prompt when
+// the model's context window is unknown.
+const defaultClipChars = 12000
+
+// minClipChars keeps a tiny context window from clipping fields to nothing.
+const minClipChars = 2000
+
+// charsPerToken is a rough average of characters per token.
+const charsPerToken = 4
+
+// SetContextWindow sets the model context window, in tokens, that prompt
+// clipping is sized from (llm.context_window). Zero keeps the fixed default.
+func (r *Runner) SetContextWindow(tokens int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.contextWindow = tokens
+}
+
+// clipChars returns the character budget for each memory, state, and
+// evidence field rendered into a stage prompt: agent.context_fraction of the
+// context window, or defaultClipChars when the window is unknown.
+func (l *Loop) clipChars() int {
+	if l.contextWindow <= 0 || l.cfg.ContextFraction <= 0 {
+		return defaultClipChars
+	}
+	return max(int(float64(l.contextWindow*charsPerToken)*l.cfg.ContextFraction), minClipChars)
+}
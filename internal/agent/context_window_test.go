@@ -0,0 +1,25 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/config"
+)
+
+func TestClipCharsScalesWithContextWindow(t *testing.T) {
+	for _, tc := range []struct {
+		window   int
+		fraction float64
+		want     int
+	}{
+		{0, 0.1, defaultClipChars},
+		{200000, 0.1, 80000},
+		{32768, 0.25, 32768},
+		{2048, 0.1, minClipChars},
+	} {
+		l := &Loop{cfg: config.AgentConfig{ContextFraction: tc.fraction}, contextWindow: tc.window}
+		if got := l.clipChars(); got != tc.want {
+			t.Errorf("clipChars(window=%d, fraction=%g) = %d, want %d", tc.window, tc.fraction, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"math"
+	"strings"
+
+	"github.com/mattjoyce/agenticloop/internal/config"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// costTable prices token usage with llm.pricing.
+type costTable struct {
+	// model is llm.model, which serves stages without a stage model.
+	model  string
+	prices map[string]config.ModelPricing
+}
+
+// price returns the cost of u on model, or nil when model has no price.
+func (c costTable) price(model string, u tokenUsage) *float64 {
+	p, ok := c.prices[model]
+	if !ok {
+		return nil
+	}
+	cost := float64(u.PromptTokens)/1000*p.PromptPer1K + float64(u.CompletionTokens)/1000*p.CompletionPer1K
+	cost = math.Round(cost*1e6) / 1e6
+	return &cost
+}
+
+// SetPricing sets the price table used to estimate each step's cost.
+// model is llm.model, the model of stages without a stage model.
+func (r *Runner) SetPricing(model string, prices map[string]config.ModelPricing) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.costs = costTable{model: model, prices: prices}
+}
+
+// estimateCost prices the usage of one step in phase. Usage served through
+// a fallback chain is priced per provider, by its "provider/model" name or
+// else its model name. It returns nil when any model involved has no price,
+// so an unknown cost is never reported as zero.
+func (l *Loop) estimateCost(phase store.StepPhase, u tokenUsage) *float64 {
+	if len(u.ByProvider) == 0 {
+		name := l.costs.model
+		if l.runModel != "" {
+			name = l.runModel
+		} else if staged := l.cfg.StageModels[string(phase)]; staged != "" {
+			name = staged
+		}
+		return l.costs.price(name, u)
+	}
+	var total float64
+	for servedBy, pu := range u.ByProvider {
+		cost := l.costs.price(servedBy, pu)
+		if cost == nil {
+			_, name, _ := strings.Cut(servedBy, "/")
+			cost = l.costs.price(name, pu)
+		}
+		if cost == nil {
+			return nil
+		}
+		total += *cost
+	}
+	total = math.Round(total*1e6) / 1e6
+	return &total
+}
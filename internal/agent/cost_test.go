@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/config"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestEstimateCostPricesStageModelsAndReportsUnknownAsNil(t *testing.T) {
+	l := &Loop{
+		cfg: config.AgentConfig{StageModels: map[string]string{"act": "big", "plan": "unpriced"}},
+		costs: costTable{model: "small", prices: map[string]config.ModelPricing{
+			"small":        {PromptPer1K: 0.001, CompletionPer1K: 0.002},
+			"big":          {PromptPer1K: 0.01, CompletionPer1K: 0.03},
+			"backup/other": {PromptPer1K: 0.5, CompletionPer1K: 0.5},
+		}},
+	}
+	usage := tokenUsage{PromptTokens: 2000, CompletionTokens: 500, TotalTokens: 2500}
+
+	for _, tc := range []struct {
+		phase store.StepPhase
+		usage tokenUsage
+		want  *float64
+	}{
+		{store.StepPhaseReflect, usage, ptrFloat(0.003)},
+		{store.StepPhaseAct, usage, ptrFloat(0.035)},
+		{store.StepPhasePlan, usage, nil},
+		// Fallback usage is priced per provider, by full name or model name.
+		{store.StepPhasePlan, tokenUsage{ByProvider: map[string]tokenUsage{
+			"openai/small": {PromptTokens: 1000},
+			"backup/other": {CompletionTokens: 1000},
+		}}, ptrFloat(0.501)},
+		{store.StepPhaseReflect, tokenUsage{ByProvider: map[string]tokenUsage{
+			"openai/small":   {PromptTokens: 1000},
+			"openai/missing": {PromptTokens: 1000},
+		}}, nil},
+	} {
+		got := l.estimateCost(tc.phase, tc.usage)
+		if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+			t.Fatalf("estimateCost(%s, %+v) = %v, want %v", tc.phase, tc.usage, fmtCost(got), fmtCost(tc.want))
+		}
+	}
+
+	if got := (&Loop{}).estimateCost(store.StepPhaseAct, usage); got != nil {
+		t.Fatalf("expected nil cost without llm.pricing, got %v", *got)
+	}
+}
+
+func ptrFloat(v float64) *float64 { return &v }
+
+func fmtCost(v *float64) any {
+	if v == nil {
+		return "nil"
+	}
+	return *v
+}
@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errRunDeadlineExceeded is the cancellation cause of a run whose deadline,
+// including any extension, has passed.
+var errRunDeadlineExceeded = fmt.Errorf("run deadline exceeded: %w", context.DeadlineExceeded)
+
+// extendableDeadline cancels a run's context once its deadline passes. The
+// deadline is the run's deadline constraint plus the extension granted
+// through POST /v1/runs/{run_id}/extend. The extension is re-read whenever
+// the timer fires, so one granted in the middle of a stage still counts.
+type extendableDeadline struct {
+	start     time.Time
+	base      time.Duration
+	extension func() time.Duration
+	cancel    context.CancelCauseFunc
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	stopped bool
+}
+
+// withRunDeadline returns a context cancelled with errRunDeadlineExceeded
+// once base plus the run's deadline extension has elapsed. Call stop when
+// the run ends.
+func (l *Loop) withRunDeadline(parent context.Context, runID string, base time.Duration) (context.Context, *extendableDeadline) {
+	ctx, cancel := context.WithCancelCause(parent)
+	d := &extendableDeadline{
+		start:     time.Now(),
+		base:      base,
+		extension: func() time.Duration { return l.deadlineExtension(runID) },
+		cancel:    cancel,
+	}
+	d.mu.Lock()
+	d.timer = time.AfterFunc(base+d.extension(), d.fire)
+	d.mu.Unlock()
+	return ctx, d
+}
+
+// total returns the run's deadline including the extension granted so far.
+func (d *extendableDeadline) total() time.Duration {
+	return d.base + d.extension()
+}
+
+func (d *extendableDeadline) fire() {
+	remaining := d.total() - time.Since(d.start)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return
+	}
+	if remaining > 0 {
+		d.timer.Reset(remaining)
+		return
+	}
+	d.cancel(errRunDeadlineExceeded)
+}
+
+// stop releases the timer and the run context.
+func (d *extendableDeadline) stop() {
+	d.mu.Lock()
+	d.stopped = true
+	d.timer.Stop()
+	d.mu.Unlock()
+	d.cancel(nil)
+}
+
+// deadlineExtension reads the run's granted deadline extension. A lookup
+// error counts as no extension.
+func (l *Loop) deadlineExtension(runID string) time.Duration {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	extension, err := l.runStore.DeadlineExtension(ctx, runID)
+	if err != nil {
+		l.logger.Warn("failed to read deadline extension", "run_id", runID, "error", err)
+		return 0
+	}
+	return extension
+}
@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/mattjoyce/agenticloop/internal/config"
+	"github.com/mattjoyce/agenticloop/internal/localtools"
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// slowModel delays every scripted reply and calls onFirst before the first.
+type slowModel struct {
+	*scriptedToolCallingModel
+	delay   time.Duration
+	onFirst func()
+	calls   int
+}
+
+func (m *slowModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	m.calls++
+	if m.calls == 1 && m.onFirst != nil {
+		m.onFirst()
+	}
+	select {
+	case <-time.After(m.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return m.scriptedToolCallingModel.Generate(ctx, input, opts...)
+}
+
+func (m *slowModel) WithTools(_ []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+func TestExecuteHonoursDeadlineExtension(t *testing.T) {
+	for _, extend := range []bool{false, true} {
+		name := "without extension"
+		if extend {
+			name = "with extension"
+		}
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+			if err != nil {
+				t.Fatalf("open sqlite: %v", err)
+			}
+			t.Cleanup(func() { _ = db.Close() })
+
+			runStore := store.NewRunStore(db)
+			stepStore := store.NewStepStore(db)
+			run, _, err := runStore.Create(ctx, "slow goal", nil, nil, nil, nil, 0)
+			if err != nil {
+				t.Fatalf("create run: %v", err)
+			}
+
+			chatModel := &slowModel{
+				delay: 40 * time.Millisecond,
+				scriptedToolCallingModel: &scriptedToolCallingModel{responses: []*schema.Message{
+					{Role: schema.Assistant, Content: `{"todo":[]}`},
+					{Role: schema.Assistant, Content: "1. finish"},
+					{
+						Role: schema.Assistant,
+						ToolCalls: []schema.ToolCall{
+							{ID: "tc-1", Type: "function", Function: schema.FunctionCall{Name: "report_success", Arguments: `{"summary":"finished","evidence":"none needed"}`}},
+						},
+					},
+					{Role: schema.Assistant, Content: "finished"},
+					{Role: schema.Assistant, Content: `{"next_stage":"done","summary":"finished"}`},
+				}},
+			}
+			if extend {
+				chatModel.onFirst = func() {
+					if _, err := runStore.ExtendDeadline(ctx, run.ID, 5, 10); err != nil {
+						t.Errorf("extend deadline: %v", err)
+					}
+				}
+			}
+
+			loop := NewLoop(chatModel, localtools.BuildDefaultTools(localtools.SysToolsConfig{}), config.AgentConfig{
+				DefaultMaxLoops: 1,
+				DefaultDeadline: 100 * time.Millisecond,
+				MaxActRounds:    3,
+				MaxRetryPerStep: 1,
+				WorkspaceDir:    t.TempDir(),
+				Prompts:         config.AgentPrompts{Frame: "frame", Plan: "plan", Act: "act", Reflect: "reflect"},
+			}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			execErr := loop.Execute(ctx, run, "")
+			got, err := runStore.GetByID(ctx, run.ID)
+			if err != nil {
+				t.Fatalf("get run: %v", err)
+			}
+			if extend {
+				if execErr != nil || got.Status != store.RunStatusDone {
+					t.Fatalf("Execute() = %v, status %s; want done within the extended deadline", execErr, got.Status)
+				}
+				return
+			}
+			if got.Status != store.RunStatusFailed || got.Error == nil || !strings.Contains(*got.Error, "run deadline exceeded") {
+				t.Fatalf("status = %s, error %v; want failed with run deadline exceeded", got.Status, got.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/mattjoyce/agenticloop/internal/localtools"
+)
+
+// decisionTool lets ACT record a key decision and its rationale in the run's
+// decisions.jsonl, an audit trail kept apart from the free-form loop memory.
+type decisionTool struct {
+	ws        *Workspace
+	iteration func() int
+	redactor  *Redactor
+	observer  localtools.Observer
+}
+
+var _ tool.InvokableTool = (*decisionTool)(nil)
+
+func newDecisionTool(ws *Workspace, iteration func() int, redactor *Redactor, observer localtools.Observer) *decisionTool {
+	return &decisionTool{ws: ws, iteration: iteration, redactor: redactor, observer: observer}
+}
+
+// Info returns tool metadata for model planning.
+func (t *decisionTool) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: "log_decision",
+		Desc: "Record a key decision with its rationale and the alternatives you rejected, for later review. Use it for choices that shape the outcome, not routine steps.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"decision":  {Type: schema.String, Desc: "What was decided", Required: true},
+			"rationale": {Type: schema.String, Desc: "Why this option was chosen", Required: true},
+			"alternatives_considered": {
+				Type:     schema.Array,
+				Desc:     "Options considered and rejected",
+				ElemInfo: &schema.ParameterInfo{Type: schema.String},
+			},
+		}),
+	}, nil
+}
+
+// InvokableRun appends the decision and returns JSON output; failures are
+// reported to the model as a status "error" result.
+func (t *decisionTool) InvokableRun(_ context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	resp, err := t.record(json.RawMessage(argumentsInJSON))
+	status := "ok"
+	if err != nil {
+		status = "error"
+		resp = map[string]any{"status": status, "error": err.Error()}
+	} else {
+		resp["status"] = status
+	}
+	out := string(mustJSON(resp))
+	if t.observer != nil {
+		t.observer("log_decision", argumentsInJSON, out, status)
+	}
+	return out, nil
+}
+
+func (t *decisionTool) record(raw json.RawMessage) (map[string]any, error) {
+	var args struct {
+		Decision               string   `json:"decision"`
+		Rationale              string   `json:"rationale"`
+		AlternativesConsidered []string `json:"alternatives_considered"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("parse arguments: %w", err)
+	}
+	entry := DecisionEntry{
+		Iteration:  t.iteration(),
+		RecordedAt: time.Now().UTC().Format(time.RFC3339),
+		Decision:   t.redactor.String(strings.TrimSpace(args.Decision)),
+		Rationale:  t.redactor.String(strings.TrimSpace(args.Rationale)),
+	}
+	if entry.Decision == "" || entry.Rationale == "" {
+		return nil, fmt.Errorf("decision and rationale are required")
+	}
+	for _, alt := range args.AlternativesConsidered {
+		if alt = strings.TrimSpace(alt); alt != "" {
+			entry.AlternativesConsidered = append(entry.AlternativesConsidered, t.redactor.String(alt))
+		}
+	}
+	if err := t.ws.AppendDecision(entry); err != nil {
+		return nil, err
+	}
+	return map[string]any{"iteration": entry.Iteration, "recorded_at": entry.RecordedAt}, nil
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecisionToolAppendsEntriesAndNotifiesObserver(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir(), "run-1")
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+	var observed []string
+	observer := func(tool, input, output, status string) { observed = append(observed, tool+":"+status) }
+	decisionTool := newDecisionTool(ws, func() int { return 2 }, nil, observer)
+
+	if out, _ := decisionTool.InvokableRun(context.Background(), `{"decision":"use sqlite"}`); !strings.Contains(out, `"status":"error"`) {
+		t.Fatalf("expected a decision without rationale to be rejected, got %s", out)
+	}
+	out, _ := decisionTool.InvokableRun(context.Background(), `{"decision":"use sqlite","rationale":"single binary, no server","alternatives_considered":["postgres"," ","bolt"]}`)
+	if !strings.Contains(out, `"status":"ok"`) {
+		t.Fatalf("log_decision: %s", out)
+	}
+	if _, err := decisionTool.InvokableRun(context.Background(), `{"decision":"skip caching","rationale":"inputs are small"}`); err != nil {
+		t.Fatalf("log_decision: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(ws.Dir(), DecisionsFile))
+	if err != nil {
+		t.Fatalf("read decisions: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 decision lines, got %d: %s", len(lines), data)
+	}
+	var first DecisionEntry
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("decode decision: %v", err)
+	}
+	if first.Iteration != 2 || first.Decision != "use sqlite" || first.Rationale != "single binary, no server" || first.RecordedAt == "" {
+		t.Fatalf("unexpected decision entry: %+v", first)
+	}
+	if strings.Join(first.AlternativesConsidered, ",") != "postgres,bolt" {
+		t.Fatalf("alternatives = %v, want [postgres bolt]", first.AlternativesConsidered)
+	}
+	if strings.Join(observed, ",") != "log_decision:error,log_decision:ok,log_decision:ok" {
+		t.Fatalf("observed calls = %v", observed)
+	}
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// frameFormatDirective re-prompts a structured FRAME whose reply could not be
+// parsed. The parse error is appended.
+const frameFormatDirective = "Your previous reply was not a valid frame. Return only the JSON object from the output contract, with a non-empty objective and success_condition. Problem: "
+
+// structuredFrame is the FRAME output required by agent.frame_format: json.
+type structuredFrame struct {
+	Objective        string   `json:"objective"`
+	KnownFacts       []string `json:"known_facts"`
+	Unknowns         []string `json:"unknowns"`
+	SuccessCondition string   `json:"success_condition"`
+}
+
+// parseStructuredFrame parses a FRAME reply as a single JSON object with the
+// structuredFrame fields, optionally wrapped in one ```json fence. Unlike
+// normalizeStateJSON it never salvages prose: anything else is an error. The
+// returned state keeps every field of the object and adds empty todo,
+// evidence, notes, known_facts, and unknowns lists where they are missing.
+func parseStructuredFrame(raw string) (json.RawMessage, error) {
+	text := strings.TrimSpace(raw)
+	if fenced, ok := strings.CutPrefix(text, "```"); ok {
+		fenced = strings.TrimPrefix(fenced, "json")
+		body, rest, found := strings.Cut(fenced, "```")
+		if !found || strings.TrimSpace(rest) != "" {
+			return nil, errors.New("reply is not a single JSON object")
+		}
+		text = strings.TrimSpace(body)
+	}
+	if !strings.HasPrefix(text, "{") {
+		return nil, errors.New("reply is not a JSON object")
+	}
+
+	var frame structuredFrame
+	if err := json.Unmarshal([]byte(text), &frame); err != nil {
+		return nil, fmt.Errorf("parse frame: %w", err)
+	}
+	var missing []string
+	if strings.TrimSpace(frame.Objective) == "" {
+		missing = append(missing, "objective")
+	}
+	if strings.TrimSpace(frame.SuccessCondition) == "" {
+		missing = append(missing, "success_condition")
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("frame is missing %s", strings.Join(missing, " and "))
+	}
+
+	var state map[string]any
+	if err := json.Unmarshal([]byte(text), &state); err != nil {
+		return nil, fmt.Errorf("parse frame: %w", err)
+	}
+	for _, key := range []string{"todo", "evidence", "notes", "known_facts", "unknowns"} {
+		if state[key] == nil {
+			state[key] = []any{}
+		}
+	}
+	return mustJSON(state), nil
+}
+
+// runFrameStep runs the FRAME stage and returns its reply and the state.json
+// payload derived from it. With agent.frame_format: json the reply must parse
+// as a structured frame; one that does not is re-prompted once with the
+// problem, and a second failure falls back to normalizeStateJSON.
+func (l *Loop) runFrameStep(ctx context.Context, runID string, stepNum *int, prompt string) (string, json.RawMessage, error) {
+	frameOut, err := l.runTextStageStep(ctx, runID, stepNum, store.StepPhaseFrame, prompt, "Produce the frame now.")
+	if err != nil {
+		return "", nil, err
+	}
+	if l.cfg.FrameFormat != "json" {
+		return frameOut, normalizeStateJSON(frameOut), nil
+	}
+
+	statePayload, parseErr := parseStructuredFrame(frameOut)
+	if parseErr != nil {
+		l.logger.Warn("frame reply is not a structured frame, re-prompting", "run_id", runID, "error", parseErr)
+		frameOut, err = l.runTextStageStep(ctx, runID, stepNum, store.StepPhaseFrame, prompt, frameFormatDirective+parseErr.Error())
+		if err != nil {
+			return "", nil, err
+		}
+		statePayload, parseErr = parseStructuredFrame(frameOut)
+	}
+	if parseErr != nil {
+		l.logger.Warn("frame reply is still not a structured frame, using lenient parsing", "run_id", runID, "error", parseErr)
+		return frameOut, normalizeStateJSON(frameOut), nil
+	}
+	return frameOut, statePayload, nil
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/mattjoyce/agenticloop/internal/config"
+	"github.com/mattjoyce/agenticloop/internal/localtools"
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestParseStructuredFrame(t *testing.T) {
+	got, err := parseStructuredFrame("```json\n{\"objective\":\"ship it\",\"success_condition\":\"release tagged\",\"unknowns\":[\"date\"]}\n```")
+	if err != nil {
+		t.Fatalf("parse fenced frame: %v", err)
+	}
+	var state map[string]any
+	if err := json.Unmarshal(got, &state); err != nil {
+		t.Fatalf("decode state: %v", err)
+	}
+	if state["objective"] != "ship it" || state["success_condition"] != "release tagged" {
+		t.Fatalf("state = %v", state)
+	}
+	for _, key := range []string{"todo", "evidence", "notes", "known_facts"} {
+		if list, ok := state[key].([]any); !ok || len(list) != 0 {
+			t.Fatalf("state[%s] = %v, want empty list", key, state[key])
+		}
+	}
+	if unknowns, _ := state["unknowns"].([]any); len(unknowns) != 1 {
+		t.Fatalf("unknowns = %v, want kept", state["unknowns"])
+	}
+
+	for input, want := range map[string]string{
+		"The objective is to ship it.":                                   "not a JSON object",
+		`{"objective":"ship it"}`:                                        "missing success_condition",
+		`{"objective":"","success_condition":""}`:                        "missing objective and success_condition",
+		`{"objective":"x","success_condition":"y","unknowns":1}`:         "parse frame",
+		"Here you go: {\"objective\":\"x\",\"success_condition\":\"y\"}": "not a JSON object",
+	} {
+		if _, err := parseStructuredFrame(input); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseStructuredFrame(%q) error = %v, want %q", input, err, want)
+		}
+	}
+}
+
+func TestExecuteRepromptsInvalidStructuredFrame(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	run, _, err := runStore.Create(ctx, "ship it", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	chatModel := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{Role: schema.Assistant, Content: "We need to ship it."},
+			{Role: schema.Assistant, Content: `{"objective":"ship it","known_facts":["tests pass"],"unknowns":[],"success_condition":"release tagged"}`},
+			{Role: schema.Assistant, Content: "1. tag"},
+			{
+				Role: schema.Assistant,
+				ToolCalls: []schema.ToolCall{
+					{ID: "tc-1", Type: "function", Function: schema.FunctionCall{Name: "report_success", Arguments: `{"summary":"tagged","evidence":"v1"}`}},
+				},
+			},
+			{Role: schema.Assistant, Content: "tagged"},
+			{Role: schema.Assistant, Content: `{"next_stage":"done","summary":"tagged"}`},
+		},
+	}}
+	workspaceDir := t.TempDir()
+	loop := NewLoop(chatModel, localtools.BuildDefaultTools(localtools.SysToolsConfig{}), config.AgentConfig{
+		DefaultMaxLoops: 1,
+		DefaultDeadline: time.Minute,
+		MaxActRounds:    3,
+		MaxRetryPerStep: 1,
+		FrameFormat:     "json",
+		WorkspaceDir:    workspaceDir,
+		Prompts: config.AgentPrompts{
+			Frame:   "frame structured={{.StructuredFrame}}",
+			Plan:    "plan {{.State}}",
+			Act:     "act",
+			Reflect: "reflect",
+		},
+	}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := loop.Execute(ctx, run, ""); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if chatModel.prompts[0] != "frame structured=true" || chatModel.prompts[1] != "frame structured=true" {
+		t.Fatalf("prompts = %q, want the frame re-prompted", chatModel.prompts)
+	}
+	if !strings.Contains(chatModel.prompts[2], `"success_condition":"release tagged"`) {
+		t.Fatalf("plan prompt = %q, want structured frame in state", chatModel.prompts[2])
+	}
+	steps, err := stepStore.GetByRunID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("list steps: %v", err)
+	}
+	if steps[0].Phase != store.StepPhaseFrame || steps[1].Phase != store.StepPhaseFrame {
+		t.Fatalf("steps = %s, %s; want two frame steps", steps[0].Phase, steps[1].Phase)
+	}
+}
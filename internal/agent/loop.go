@@ -2,12 +2,22 @@ package agent
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/components/tool"
@@ -16,6 +26,7 @@ import (
 	"github.com/mattjoyce/agenticloop/internal/config"
 	"github.com/mattjoyce/agenticloop/internal/ductile"
 	"github.com/mattjoyce/agenticloop/internal/localtools"
+	"github.com/mattjoyce/agenticloop/internal/provider"
 	"github.com/mattjoyce/agenticloop/internal/store"
 )
 
@@ -28,8 +39,78 @@ type Loop struct {
 	stepStore *store.StepStore
 	client    *ductile.Client
 	logger    *slog.Logger
+
+	// toolTime accumulates time spent inside tool invocations for this run.
+	toolTime time.Duration
+	// modelOpts carries per-run sampling overrides passed to every Generate call.
+	modelOpts []model.Option
+	// toolPolicy carries the per-run allowed_tools/denied_tools constraints.
+	toolPolicy toolPolicy
+	// stageOpts adds phase-specific options, e.g. JSON mode on reflect.
+	stageOpts map[store.StepPhase][]model.Option
+	// stageModels replaces chatModel for the listed phases (agent.stage_models).
+	stageModels map[store.StepPhase]model.ToolCallingChatModel
+	// models are the models the model constraint may select, by name.
+	models map[string]model.ToolCallingChatModel
+	// runModel is the model constraint; it serves every stage of the run.
+	runModel string
+	// costs prices step token usage (llm.pricing).
+	costs costTable
+	// contextWindow is the model context window in tokens (llm.context_window).
+	contextWindow int
+	// ws is the run workspace, or nil when it could not be created.
+	ws *Workspace
+	// actionCounts tracks identical tool calls across the run by actionKey.
+	actionCounts map[string]int
+	// redactor masks secrets in persisted step output and workspace memory.
+	redactor *Redactor
+	// now is the clock behind the prompt time fields; nil uses time.Now.
+	now func() time.Time
+	// loopExtension is how many iterations reflect has added via request_more_loops.
+	loopExtension int
+	// startedAt and deadlineAt bound the current execution for prompt time
+	// fields. deadlineAt includes the deadline extension read at the start of
+	// the iteration.
+	startedAt  time.Time
+	deadlineAt time.Time
+	// subrunExec runs children created by spawn_subrun; nil leaves the
+	// subrun tools unbound.
+	subrunExec subrunExecutor
+	// maxSubrunDepth is the resolved subrun depth limit for this run.
+	maxSubrunDepth int
+	// iteration is the loop iteration in progress, recorded in LLM traces.
+	iteration int
+	// actRounds overrides agent.max_act_rounds for the current iteration's
+	// ACT stage when the plan requested another limit (0 = use the config).
+	actRounds int
+	// callbackPolicy sets how completion callbacks are retried.
+	callbackPolicy CallbackPolicy
 }
 
+// ErrToolTimeBudgetExceeded is returned when a run spends more than
+// agent.max_tool_time_per_run inside tool invocations.
+var ErrToolTimeBudgetExceeded = errors.New("tool time budget exceeded")
+
+// ErrStepLimitExceeded is returned when a run would append more than
+// agent.max_steps_per_run steps.
+var ErrStepLimitExceeded = errors.New("step limit exceeded")
+
+// ErrStuckLoop is returned when the same tool call recurs more than
+// agent.stuck_loop_threshold times in a run.
+var ErrStuckLoop = errors.New("stuck loop: repeated identical actions")
+
+// ErrQueueExpired is the failure of a run that waited in the queue longer
+// than agent.max_queue_wait before it first started.
+var ErrQueueExpired = errors.New("queue wait expired")
+
+// ErrShutdown is the cancellation cause the process uses when it is stopping.
+// A run interrupted with this cause is requeued rather than failed.
+var ErrShutdown = errors.New("agenticloop shutting down")
+
+// ErrRunInterrupted is returned by Execute when a run was requeued because of
+// shutdown.
+var ErrRunInterrupted = errors.New("run interrupted by shutdown")
+
 // NewLoop creates a new Loop.
 func NewLoop(chatModel model.ToolCallingChatModel, tools []tool.BaseTool, cfg config.AgentConfig, runStore *store.RunStore, stepStore *store.StepStore, client *ductile.Client, logger *slog.Logger) *Loop {
 	return &Loop{
@@ -40,6 +121,7 @@ func NewLoop(chatModel model.ToolCallingChatModel, tools []tool.BaseTool, cfg co
 		stepStore: stepStore,
 		client:    client,
 		logger:    logger,
+		redactor:  NewRedactor(cfg.RedactPatterns),
 	}
 }
 
@@ -51,114 +133,191 @@ func (l *Loop) Execute(ctx context.Context, run *store.Run, callbackURL string)
 		return fmt.Errorf("mark run running: %w", err)
 	}
 
-	ws, err := NewWorkspace(l.cfg.WorkspaceDir, run.ID)
+	constraints, err := l.resolveConstraints(run.ID, run.Constraints)
 	if err != nil {
-		l.logger.Error("failed to create workspace", "run_id", run.ID, "error", err)
+		return l.failRun(ctx, callbackURL, run.ID, err)
 	}
 
-	maxLoops := l.cfg.DefaultMaxLoops
-	deadline := l.cfg.DefaultDeadline
-	if len(run.Constraints) > 0 {
-		var constraints struct {
-			MaxLoops int    `json:"max_loops"`
-			Deadline string `json:"deadline"`
+	var ws *Workspace
+	if constraints.WorkspacePath != "" {
+		if ws, err = NewExternalWorkspace(l.cfg.ExternalWorkspaceRoot, constraints.WorkspacePath, localtools.RunStateDir(l.cfg.WorkspaceDir, run.ID)); err != nil {
+			return l.failRun(ctx, callbackURL, run.ID, fmt.Errorf("workspace_path: %w", err))
 		}
-		if err := json.Unmarshal(run.Constraints, &constraints); err == nil {
-			if constraints.MaxLoops > 0 {
-				maxLoops = constraints.MaxLoops
-			}
-			if constraints.Deadline != "" {
-				if d, err := time.ParseDuration(constraints.Deadline); err == nil {
-					deadline = d
-				}
-			}
+		l.logger.Info("using external workspace", "run_id", run.ID, "path", ws.Dir())
+	} else if ws, err = NewWorkspace(l.cfg.WorkspaceDir, run.ID); err != nil {
+		l.logger.Error("failed to create workspace", "run_id", run.ID, "error", err)
+	}
+	l.ws = ws
+	if ws != nil {
+		if err := l.runStore.SetWorkspacePath(ctx, run.ID, ws.Dir()); err != nil {
+			l.logger.Error("failed to record workspace path", "run_id", run.ID, "error", err)
+		}
+		defer l.discardWorkspace(run.ID, ws)
+		defer l.clearCheckpoint(run.ID, ws)
+		defer l.compactSteps(run.ID, ws)
+	}
+
+	maxLoops := constraints.MaxLoops
+	deadline := constraints.Deadline
+	l.modelOpts = constraints.ModelOptions
+	l.toolPolicy = constraints.Tools
+	l.maxSubrunDepth = constraints.MaxSubrunDepth
+	if constraints.Model != "" {
+		if err := l.useModel(constraints.Model); err != nil {
+			return l.failRun(ctx, callbackURL, run.ID, err)
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, deadline)
-	defer cancel()
+	ctx, runDeadline := l.withRunDeadline(ctx, run.ID, deadline)
+	defer runDeadline.stop()
+	l.startedAt = l.clock()
+	l.deadlineAt = l.startedAt.Add(runDeadline.total())
 
 	stepNum, err := l.stepStore.MaxStepNum(ctx, run.ID)
 	if err != nil {
 		return fmt.Errorf("get max step num: %w", err)
 	}
 
+	clip := l.clipChars()
 	state := stageState{
-		Goal:        run.Goal,
-		Context:     jsonOrNull(run.Context),
-		Constraints: jsonOrNull(run.Constraints),
-		MaxLoops:    maxLoops,
+		Goal:                run.Goal,
+		Context:             jsonOrNull(run.Context),
+		Constraints:         jsonOrNull(run.Constraints),
+		MaxLoops:            maxLoops,
+		NextStages:          nextStageOptions(l.nextStageRoutes()),
+		RequireEvidenceRefs: l.cfg.RequireReflectEvidence,
+		AllowEmptyPlan:      l.cfg.AllowEmptyPlan,
+		StructuredFrame:     l.cfg.FrameFormat == "json",
+		ActRounds:           l.actRoundLimit(),
+		ActRoundsCeiling:    l.cfg.MaxActRoundsCeiling,
 	}
 
 	if ws != nil {
 		if memory := ws.ReadRunMemory(); memory != "" {
-			state.Memory = clipText(memory, 12000)
+			state.Memory = clipText(memory, clip)
 		}
 		if savedState := ws.ReadState(); savedState != "" {
-			state.State = clipText(savedState, 12000)
+			state.State = clipText(savedState, clip)
 		}
-		if err := ws.WritePromptSnapshot(run.Goal, run.Context, run.Constraints, "staged-prompts: frame, plan, act, reflect"); err != nil {
+		if err := ws.WritePromptSnapshot(run.Goal, run.Context, run.Constraints, "staged-prompts: "+strings.Join(l.stageNames(), ", ")); err != nil {
 			l.logger.Error("failed to write prompt snapshot", "run_id", run.ID, "error", err)
 		}
 	}
 
+	files, err := contextFiles(run.Context)
+	if err == nil {
+		state.ReferenceDocs, err = loadReferenceDocs(l.cfg.ReferenceDir, files, l.cfg.MaxReferenceBytes)
+	}
+	if err != nil {
+		return l.failRun(ctx, callbackURL, run.ID, fmt.Errorf("load context files: %w", err))
+	}
+
 	activeTools := l.tools
 	if ws != nil {
-		activeTools = l.rebuildToolsWithObserver(ws)
+		activeTools = l.rebuildToolsWithObserver(run, ws)
 	}
 
 	toolset, err := l.buildToolset(ctx, activeTools)
 	if err != nil {
 		return l.failRun(ctx, callbackURL, run.ID, fmt.Errorf("prepare toolset: %w", err))
 	}
-	state.AvailableTools = buildToolCatalog(toolset.infos)
+	state.AvailableTools = buildToolCatalog(toolset.infos, l.cfg.ToolCatalogVerbose)
 
 	nextStage := "frame" // first iteration always starts at frame
-
-	for iter := 1; iter <= maxLoops; iter++ {
+	startIter := 1
+	if cp := l.resumeCheckpoint(ws, maxLoops); cp != nil {
+		startIter = cp.Iteration
+		nextStage = cp.NextStage
+		l.loopExtension = cp.LoopExtension
+		maxLoops += cp.LoopExtension
+		state.MaxLoops = maxLoops
+		state.Frame = cp.Frame
+		state.Plan = cp.Plan
+		state.Act = cp.Act
+		state.Observe = cp.Observe
+		state.RecentErrors = cp.RecentErrors
+		state.ActTruncated = cp.ActTruncated
+		state.NextFocus = cp.NextFocus
+		state.LastReflection = cp.LastReflection
+		state.UserGuidance = cp.UserGuidance
+		state.SuccessReported = cp.SuccessReported
+		state.SuccessSummary = cp.SuccessSummary
+		l.logger.Info("resuming run from checkpoint", "run_id", run.ID, "iteration", cp.Iteration, "next_stage", cp.NextStage)
+	}
+	// A run interrupted while paused by request_approval waits again first.
+	if err := l.awaitApproval(ctx, run.ID, startIter, &state); err != nil {
+		return l.failRun(ctx, callbackURL, run.ID, err)
+	}
+
+	for iter := startIter; iter <= maxLoops; iter++ {
 		select {
 		case <-ctx.Done():
-			return l.failRun(ctx, callbackURL, run.ID, fmt.Errorf("context cancelled: %w", ctx.Err()))
+			return l.failRun(ctx, callbackURL, run.ID, fmt.Errorf("context cancelled: %w", context.Cause(ctx)))
 		default:
 		}
 		state.Iteration = iter
+		l.iteration = iter
+		l.deadlineAt = l.startedAt.Add(runDeadline.total())
+		state.FinalIteration = iter == maxLoops
+		state.GraceMessage = ""
+		state.LoopExtensionLeft = max(l.cfg.MaxLoopExtension-l.loopExtension, 0)
+		if state.FinalIteration {
+			state.GraceMessage = l.cfg.FinalIterationMessage
+		}
+		l.takeGuidance(ctx, run.ID, iter, &state)
 		if ws != nil {
-			state.Memory = clipText(ws.ReadRunMemory(), 12000)
-			state.State = clipText(ws.ReadState(), 12000)
-			if l.cfg.SaveLoopMemory && iter > 1 {
+			state.Memory = clipText(ws.ReadRunMemory(), clip)
+			state.State = clipText(ws.ReadState(), clip)
+			// Resuming past act keeps this iteration's loop memory for observe/reflect.
+			resumingPastAct := stageOrder(nextStage) > stageOrder("act")
+			if l.cfg.SaveLoopMemory && iter > 1 && !resumingPastAct {
 				if err := ws.ArchiveLoopMemory(iter - 1); err != nil {
 					l.logger.Error("failed to archive loop memory", "run_id", run.ID, "iteration", iter-1, "error", err)
 				}
 			}
-			if err := ws.ClearLoopMemory(); err != nil {
-				l.logger.Error("failed to clear loop memory", "run_id", run.ID, "iteration", iter, "error", err)
+			if l.cfg.SaveLoopMemory && l.cfg.LoopMemoryWindow > 0 {
+				// Oldest iterations come first; clipping keeps the most recent.
+				state.RecentLoops = clipTextTail(ws.ReadRecentLoopMemories(iter, l.cfg.LoopMemoryWindow), clip)
+			}
+			if !resumingPastAct {
+				if err := ws.ClearLoopMemory(); err != nil {
+					l.logger.Error("failed to clear loop memory", "run_id", run.ID, "iteration", iter, "error", err)
+				}
 			}
 		}
 
 		l.logger.Info("loop iteration", "run_id", run.ID, "iter", iter, "next_stage", nextStage)
 
+		skipPlan := false
 		if nextStage == "frame" {
-			framePrompt := l.renderPrompt(l.cfg.Prompts.Frame, state)
+			framePrompt := l.renderStagePrompt(run.ID, "frame", l.cfg.Prompts.Frame, state)
 			if ws != nil {
 				_ = ws.AppendStagePrompt(iter, "frame", framePrompt)
 			}
-			frameOut, err := l.runTextStageStep(ctx, run.ID, &stepNum, store.StepPhaseFrame, framePrompt, "Produce the frame now.")
+			frameOut, statePayload, err := l.runFrameStep(ctx, run.ID, &stepNum, framePrompt)
 			if err != nil {
 				return l.failRun(ctx, callbackURL, run.ID, fmt.Errorf("frame stage: %w", err))
 			}
 			state.Frame = frameOut
 			if ws != nil {
-				statePayload := normalizeStateJSON(frameOut)
 				if err := ws.WriteState(statePayload); err != nil {
 					l.logger.Error("failed to write frame state", "run_id", run.ID, "iteration", iter, "error", err)
 				} else {
-					state.State = clipText(string(statePayload), 12000)
+					state.State = clipText(string(statePayload), clip)
 				}
 			}
+			afterFrame := "plan"
+			if iter == 1 && (constraints.SkipInitialPlan || (l.cfg.AllowEmptyPlan && frameImmediatelyActionable(frameOut))) {
+				skipPlan = true
+				afterFrame = "act"
+				state.Plan = ""
+				l.logger.Info("skipping initial plan stage", "run_id", run.ID, "skip_initial_plan", constraints.SkipInitialPlan)
+			}
+			l.saveCheckpoint(run.ID, iter, afterFrame, state)
 		}
 
-		if nextStage == "frame" || nextStage == "plan" {
-			planPrompt := l.renderPrompt(l.cfg.Prompts.Plan, state)
+		if (nextStage == "frame" || nextStage == "plan") && !skipPlan {
+			planPrompt := l.renderStagePrompt(run.ID, "plan", l.cfg.Prompts.Plan, state)
 			if ws != nil {
 				_ = ws.AppendStagePrompt(iter, "plan", planPrompt)
 			}
@@ -167,28 +326,75 @@ func (l *Loop) Execute(ctx context.Context, run *store.Run, callbackURL string)
 				return l.failRun(ctx, callbackURL, run.ID, fmt.Errorf("plan stage: %w", err))
 			}
 			state.Plan = planOut
+			l.saveCheckpoint(run.ID, iter, "act", state)
 		}
 
-		actPrompt := l.renderPrompt(l.cfg.Prompts.Act, state)
-		if ws != nil {
-			_ = ws.AppendStagePrompt(iter, "act", actPrompt)
-		}
-		actResult, err := l.runActStageStep(ctx, run.ID, &stepNum, toolset, actPrompt)
-		if err != nil {
-			return l.failRun(ctx, callbackURL, run.ID, fmt.Errorf("act stage: %w", err))
-		}
-		state.Act = actResult.Summary
-		if actResult.SuccessReported {
-			state.SuccessReported = true
-			if actResult.ReportedSummary != "" {
-				state.SuccessSummary = actResult.ReportedSummary
+		repeatWarning := ""
+		if stageOrder(nextStage) <= stageOrder("act") {
+			actPrompt := l.renderStagePrompt(run.ID, "act", l.cfg.Prompts.Act, state)
+			if ws != nil {
+				_ = ws.AppendStagePrompt(iter, "act", actPrompt)
+			}
+			l.actRounds = l.planActRounds(state.Plan)
+			if l.actRounds > 0 {
+				l.logger.Info("plan overrides act round limit", "run_id", run.ID, "iteration", iter, "act_rounds", l.actRounds)
+			}
+			actResult, err := l.runActStageStep(ctx, run.ID, &stepNum, toolset, actPrompt)
+			if err != nil {
+				if errors.Is(err, ErrStuckLoop) && ws != nil {
+					if noteErr := ws.AppendRunMemory(iter, l.redactor.String("Stuck loop detected, run stopped: "+err.Error())); noteErr != nil {
+						l.logger.Error("failed to record stuck loop note", "run_id", run.ID, "iteration", iter, "error", noteErr)
+					}
+				}
+				return l.failRun(ctx, callbackURL, run.ID, fmt.Errorf("act stage: %w", err))
+			}
+			if len(actResult.RepeatedActions) > 0 {
+				repeatWarning = repeatedActionWarning(actResult.RepeatedActions)
+				l.logger.Warn("repeated identical actions detected", "run_id", run.ID, "iteration", iter, "actions", actResult.RepeatedActions)
+				if ws != nil {
+					if err := ws.AppendRunMemory(iter, repeatWarning); err != nil {
+						l.logger.Error("failed to record repeated action note", "run_id", run.ID, "iteration", iter, "error", err)
+					}
+				}
+			}
+			state.Act = actResult.Summary
+			state.ActTruncated = actResult.Truncated
+			if actResult.Truncated {
+				l.logger.Warn("act stage ran out of tool-call rounds", "run_id", run.ID, "iteration", iter, "act_rounds", l.actRoundLimit())
+			}
+			state.RecentErrors = ""
+			if l.cfg.ReflectIncludeErrors {
+				state.RecentErrors = l.redactor.String(recentErrorsText(actResult.ToolErrors))
+			}
+			l.recordReports(run.ID, iter, ws, actResult, &state)
+			l.saveCheckpoint(run.ID, iter, "observe", state)
+			if actResult.ApprovalRequested {
+				if err := l.awaitApproval(ctx, run.ID, iter, &state); err != nil {
+					return l.failRun(ctx, callbackURL, run.ID, fmt.Errorf("act stage: %w", err))
+				}
+				l.saveCheckpoint(run.ID, iter, "observe", state)
 			}
 		}
 		if ws != nil {
-			state.LoopMemory = clipText(ws.ReadLoopMemory(), 12000)
+			state.LoopMemory = clipText(ws.ReadLoopMemory(), clip)
+			// ACT may have edited the todo list through the state tools.
+			state.State = clipText(ws.ReadState(), clip)
 		}
 
-		reflectPrompt := l.renderPrompt(l.cfg.Prompts.Reflect, state)
+		if l.observeEnabled() && stageOrder(nextStage) <= stageOrder("observe") {
+			observePrompt := l.renderStagePrompt(run.ID, "observe", l.cfg.Prompts.Observe, state)
+			if ws != nil {
+				_ = ws.AppendStagePrompt(iter, "observe", observePrompt)
+			}
+			observeOut, err := l.runTextStageStep(ctx, run.ID, &stepNum, store.StepPhaseObserve, observePrompt, "Produce the observation now.")
+			if err != nil {
+				return l.failRun(ctx, callbackURL, run.ID, fmt.Errorf("observe stage: %w", err))
+			}
+			state.Observe = observeOut
+			l.saveCheckpoint(run.ID, iter, "reflect", state)
+		}
+
+		reflectPrompt := l.renderStagePrompt(run.ID, "reflect", l.cfg.Prompts.Reflect, state)
 		if ws != nil {
 			_ = ws.AppendStagePrompt(iter, "reflect", reflectPrompt)
 		}
@@ -198,6 +404,7 @@ func (l *Loop) Execute(ctx context.Context, run *store.Run, callbackURL string)
 		}
 
 		decision := parseReflectDecision(reflectOut)
+		state.LastReflection = strings.TrimSpace(decision.Summary)
 		if ws != nil {
 			if len(decision.UpdatedState) > 0 {
 				mergedState, err := mergeStateJSON(json.RawMessage(ws.ReadState()), decision.UpdatedState)
@@ -206,7 +413,7 @@ func (l *Loop) Execute(ctx context.Context, run *store.Run, callbackURL string)
 				} else if err := ws.WriteState(mergedState); err != nil {
 					l.logger.Error("failed to persist merged state.json", "run_id", run.ID, "iteration", iter, "error", err)
 				} else {
-					state.State = clipText(string(mergedState), 12000)
+					state.State = clipText(string(mergedState), clip)
 				}
 			}
 
@@ -215,7 +422,7 @@ func (l *Loop) Execute(ctx context.Context, run *store.Run, callbackURL string)
 				memoryUpdate = strings.TrimSpace(decision.NextFocus)
 			}
 			if memoryUpdate != "" {
-				if err := ws.AppendRunMemory(iter, memoryUpdate); err != nil {
+				if err := ws.AppendRunMemory(iter, l.redactor.String(memoryUpdate)); err != nil {
 					l.logger.Error("failed to append run memory", "run_id", run.ID, "iteration", iter, "error", err)
 				}
 			}
@@ -227,18 +434,48 @@ func (l *Loop) Execute(ctx context.Context, run *store.Run, callbackURL string)
 			if err := ws.ClearLoopMemory(); err != nil {
 				l.logger.Error("failed to clear loop memory after reflect", "run_id", run.ID, "iteration", iter, "error", err)
 			}
+			if err := ws.SnapshotFiles(iter); err != nil {
+				l.logger.Error("failed to snapshot workspace files", "run_id", run.ID, "iteration", iter, "error", err)
+			}
 		}
 
-		nextStage = decision.resolvedNextStage()
-		l.logger.Info("reflect decision", "run_id", run.ID, "iter", iter, "next_stage", nextStage)
+		nextStage = decision.resolvedNextStage(l.nextStageRoutes())
+		l.logger.Info("reflect decision", "run_id", run.ID, "iter", iter, "requested", decision.NextStage, "next_stage", nextStage)
+
+		if decision.RequestMoreLoops > 0 && !(nextStage == "done" && state.SuccessReported) {
+			maxLoops += l.extendLoops(run.ID, iter, maxLoops, decision.RequestMoreLoops)
+			state.MaxLoops = maxLoops
+		}
 
 		if nextStage == "done" {
+			if !state.SuccessReported && l.cfg.FinalizeRounds > 0 {
+				if err := l.runFinalizeStage(ctx, run.ID, iter, &stepNum, toolset, ws, decision, &state); err != nil {
+					return l.failRun(ctx, callbackURL, run.ID, fmt.Errorf("finalize stage: %w", err))
+				}
+			}
 			if !state.SuccessReported {
 				state.NextFocus = "Call report_success with summary and evidence before declaring done."
 				l.logger.Info("reflect requested done but report_success not yet called; continuing", "run_id", run.ID, "iteration", iter)
 				nextStage = "frame"
+				l.saveNextIteration(run.ID, iter, nextStage, state)
 				continue
 			}
+			if minIter := min(l.cfg.MinIterations, maxLoops); iter < minIter {
+				state.NextFocus = fmt.Sprintf("Completion is not accepted before iteration %d. Verify the result and strengthen the evidence before declaring done again.", minIter)
+				l.logger.Info("reflect requested done before min_iterations; continuing", "run_id", run.ID, "iteration", iter, "min_iterations", minIter)
+				nextStage = "plan"
+				l.saveNextIteration(run.ID, iter, nextStage, state)
+				continue
+			}
+			if l.cfg.RequireReflectEvidence {
+				if problem := checkEvidenceRefs(decision.EvidenceRefs, ws, stepNum); problem != "" {
+					state.NextFocus = "Completion is not accepted: " + problem + `. Return "evidence_refs" naming existing workspace files or "step:N" steps that prove the result.`
+					l.logger.Info("reflect requested done without valid evidence_refs; continuing", "run_id", run.ID, "iteration", iter, "problem", problem)
+					nextStage = "plan"
+					l.saveNextIteration(run.ID, iter, nextStage, state)
+					continue
+				}
+			}
 
 			summary := strings.TrimSpace(decision.Summary)
 			if summary == "" {
@@ -247,6 +484,10 @@ func (l *Loop) Execute(ctx context.Context, run *store.Run, callbackURL string)
 			if summary == "" {
 				summary = strings.TrimSpace(state.Act)
 			}
+			if l.summarizeEnabled() {
+				summary = l.summarizeRun(ctx, run.ID, &stepNum, ws, state, summary)
+			}
+			summary = l.redactor.String(summary)
 			doneCtx, doneCancel := context.WithTimeout(context.Background(), 5*time.Second)
 			if err := l.runStore.UpdateStatus(doneCtx, run.ID, store.RunStatusDone, &summary, nil); err != nil {
 				doneCancel()
@@ -262,6 +503,10 @@ func (l *Loop) Execute(ctx context.Context, run *store.Run, callbackURL string)
 		}
 
 		state.NextFocus = decision.NextFocus
+		if repeatWarning != "" {
+			state.NextFocus = strings.TrimSpace(repeatWarning + "\n" + decision.NextFocus)
+		}
+		l.saveNextIteration(run.ID, iter, nextStage, state)
 	}
 
 	if !state.SuccessReported {
@@ -270,22 +515,414 @@ func (l *Loop) Execute(ctx context.Context, run *store.Run, callbackURL string)
 	return l.failRun(ctx, callbackURL, run.ID, fmt.Errorf("max loops exhausted without completion"))
 }
 
+// runConstraints are the effective per-run limits after applying constraint overrides.
+type runConstraints struct {
+	MaxLoops     int
+	Deadline     time.Duration
+	ModelOptions []model.Option
+	Tools        toolPolicy
+	// MaxSubrunDepth is agent.max_subrun_depth, optionally lowered by the
+	// max_subrun_depth constraint.
+	MaxSubrunDepth int
+	// SkipInitialPlan goes straight from FRAME to ACT on iteration 1.
+	SkipInitialPlan bool
+	// WorkspacePath selects a pre-existing directory under
+	// agent.external_workspace_root as the run's workspace.
+	WorkspacePath string
+	// Model serves every stage with llm.model or one of llm.allowed_models,
+	// replacing agent.stage_models for the run.
+	Model string
+}
+
+// toolPolicy restricts which bound tools a run may call, from the
+// allowed_tools and denied_tools constraints. report_success is always
+// permitted so a restricted run can still complete.
+type toolPolicy struct {
+	allowed map[string]bool
+	denied  map[string]bool
+}
+
+func newToolPolicy(allowed, denied []string) toolPolicy {
+	var p toolPolicy
+	if len(allowed) > 0 {
+		p.allowed = make(map[string]bool, len(allowed))
+		for _, name := range allowed {
+			p.allowed[strings.TrimSpace(name)] = true
+		}
+	}
+	if len(denied) > 0 {
+		p.denied = make(map[string]bool, len(denied))
+		for _, name := range denied {
+			p.denied[strings.TrimSpace(name)] = true
+		}
+	}
+	return p
+}
+
+// check returns a reason when name may not be called in this run.
+func (p toolPolicy) check(name string) string {
+	if name == "report_success" {
+		return ""
+	}
+	if p.denied[name] {
+		return fmt.Sprintf("tool %s is not permitted in this run (denied_tools)", name)
+	}
+	if p.allowed != nil && !p.allowed[name] {
+		return fmt.Sprintf("tool %s is not permitted in this run (not in allowed_tools)", name)
+	}
+	return ""
+}
+
+// resolveConstraints applies run.constraints overrides on top of agent defaults.
+// Malformed constraints are an error, as in decodeConstraints. Only an
+// out-of-range temperature or top_p, or a deadline that does not parse, is
+// ignored with a warning.
+func (l *Loop) resolveConstraints(runID string, raw json.RawMessage) (runConstraints, error) {
+	out := runConstraints{
+		MaxLoops:       l.cfg.DefaultMaxLoops,
+		Deadline:       l.cfg.DefaultDeadline,
+		MaxSubrunDepth: l.cfg.MaxSubrunDepth,
+	}
+	c, err := decodeConstraints(raw)
+	if err != nil {
+		return out, err
+	}
+	out.Tools = newToolPolicy(c.AllowedTools, c.DeniedTools)
+	out.SkipInitialPlan = c.SkipInitialPlan
+	out.WorkspacePath = strings.TrimSpace(c.WorkspacePath)
+	out.Model = strings.TrimSpace(c.Model)
+	if c.MaxLoops > 0 {
+		out.MaxLoops = c.MaxLoops
+	}
+	if c.Deadline != "" {
+		if d, err := time.ParseDuration(c.Deadline); err == nil {
+			out.Deadline = d
+		} else {
+			l.logger.Warn("ignoring invalid deadline constraint", "run_id", runID, "deadline", c.Deadline)
+		}
+	}
+	if c.MaxSubrunDepth != nil && *c.MaxSubrunDepth >= 0 && *c.MaxSubrunDepth < out.MaxSubrunDepth {
+		out.MaxSubrunDepth = *c.MaxSubrunDepth
+	}
+	if c.Temperature != nil {
+		if *c.Temperature >= 0 && *c.Temperature <= 2 {
+			out.ModelOptions = append(out.ModelOptions, model.WithTemperature(*c.Temperature))
+		} else {
+			l.logger.Warn("ignoring out-of-range temperature constraint", "run_id", runID, "temperature", *c.Temperature)
+		}
+	}
+	if c.TopP != nil {
+		if *c.TopP >= 0 && *c.TopP <= 1 {
+			out.ModelOptions = append(out.ModelOptions, model.WithTopP(*c.TopP))
+		} else {
+			l.logger.Warn("ignoring out-of-range top_p constraint", "run_id", runID, "top_p", *c.TopP)
+		}
+	}
+	return out, nil
+}
+
+// runConstraintsJSON is the wire form of a run's constraints.
+type runConstraintsJSON struct {
+	MaxLoops     int      `json:"max_loops"`
+	Deadline     string   `json:"deadline"`
+	Temperature  *float32 `json:"temperature"`
+	TopP         *float32 `json:"top_p"`
+	AllowedTools []string `json:"allowed_tools"`
+	DeniedTools  []string `json:"denied_tools"`
+	// MaxSubrunDepth can only lower the configured limit, so a run
+	// cannot grant its subruns more nesting than the operator allows.
+	MaxSubrunDepth  *int   `json:"max_subrun_depth"`
+	SkipInitialPlan bool   `json:"skip_initial_plan"`
+	WorkspacePath   string `json:"workspace_path"`
+	Model           string `json:"model"`
+}
+
+// decodeConstraints parses a run's constraints. Malformed constraints are an
+// error rather than empty: ignoring them would also drop allowed_tools and
+// denied_tools and let the run call every tool.
+func decodeConstraints(raw json.RawMessage) (runConstraintsJSON, error) {
+	var c runConstraintsJSON
+	if len(raw) == 0 || string(raw) == "null" {
+		return c, nil
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return c, fmt.Errorf("invalid constraints: %w", err)
+	}
+	return c, nil
+}
+
+// ValidateConstraints reports whether raw can be used as a run's
+// constraints, so the API can reject a wake that the loop would fail.
+func ValidateConstraints(raw json.RawMessage) error {
+	_, err := decodeConstraints(raw)
+	return err
+}
+
+// UsesExternalWorkspace reports whether a run with constraints raw works in
+// an external workspace, whose loop files live in the run's state dir.
+func UsesExternalWorkspace(raw json.RawMessage) bool {
+	c, err := decodeConstraints(raw)
+	return err == nil && strings.TrimSpace(c.WorkspacePath) != ""
+}
+
 type stageState struct {
 	Goal            string
 	Context         string
 	Constraints     string
+	ReferenceDocs   string
 	Memory          string
 	State           string
 	LoopMemory      string
+	RecentLoops     string
 	Frame           string
 	Plan            string
 	Act             string
+	Observe         string
 	NextFocus       string
+	UserGuidance    string
 	AvailableTools  string
 	SuccessReported bool
 	SuccessSummary  string
-	Iteration       int
-	MaxLoops        int
+	// Summary and Evidence are set for the summarize prompt only: the draft
+	// final summary and the recorded report_success evidence trail.
+	Summary        string
+	Evidence       string
+	Iteration      int
+	MaxLoops       int
+	FinalIteration bool
+	GraceMessage   string
+	NextStages     string
+	// LoopExtensionLeft is how many more iterations reflect may still request.
+	LoopExtensionLeft int
+	// RequireEvidenceRefs mirrors agent.require_reflect_evidence for the
+	// reflect output contract.
+	RequireEvidenceRefs bool
+	// AllowEmptyPlan mirrors agent.allow_empty_plan for the frame output
+	// contract.
+	AllowEmptyPlan bool
+	// StructuredFrame is set when agent.frame_format is "json", for the
+	// frame output contract.
+	StructuredFrame bool
+	// RecentErrors lists the tool errors of the last ACT stage when
+	// agent.reflect_include_errors is set.
+	RecentErrors string
+	// ActTruncated is set when the last ACT stage used all its tool-call
+	// rounds and was cut off.
+	ActTruncated bool
+	// LastReflection is the summary from the previous iteration's REFLECT
+	// stage, so PLAN can follow its course corrections.
+	LastReflection string
+	// ActRounds is agent.max_act_rounds, and ActRoundsCeiling mirrors
+	// agent.max_act_rounds_ceiling for the plan output contract.
+	ActRounds        int
+	ActRoundsCeiling int
+	// CurrentTime, ElapsedSeconds, and RemainingSeconds are stamped at render
+	// time from the execution start and its deadline.
+	CurrentTime      string
+	ElapsedSeconds   int
+	RemainingSeconds int
+}
+
+// clock returns the current time from l.now, defaulting to time.Now.
+func (l *Loop) clock() time.Time {
+	if l.now != nil {
+		return l.now()
+	}
+	return time.Now()
+}
+
+// stampClock sets the prompt time fields from the execution start and its
+// effective deadline. It is a no-op outside Execute.
+func (l *Loop) stampClock(state *stageState) {
+	if l.startedAt.IsZero() {
+		return
+	}
+	now := l.clock()
+	state.CurrentTime = now.UTC().Format(time.RFC3339)
+	state.ElapsedSeconds = int(now.Sub(l.startedAt).Seconds())
+	state.RemainingSeconds = max(int(l.deadlineAt.Sub(now).Seconds()), 0)
+}
+
+// observeEnabled reports whether the optional observe stage runs between act and reflect.
+func (l *Loop) observeEnabled() bool {
+	return strings.TrimSpace(l.cfg.Prompts.Observe) != ""
+}
+
+// summarizeEnabled reports whether a completed run gets a final summarize call.
+func (l *Loop) summarizeEnabled() bool {
+	return strings.TrimSpace(l.cfg.Prompts.Summarize) != ""
+}
+
+// summarizeRun asks the model for a polished final summary built from the
+// goal, state, and evidence. The run is already complete, so a failed or
+// empty response falls back to the draft rather than failing the run.
+func (l *Loop) summarizeRun(ctx context.Context, runID string, stepNum *int, ws *Workspace, state stageState, draft string) string {
+	state.Summary = draft
+	if ws != nil {
+		state.Evidence = clipText(ws.ReadEvidence(), l.clipChars())
+	}
+	prompt := l.renderStagePrompt(runID, "summarize", l.cfg.Prompts.Summarize, state)
+	if ws != nil {
+		_ = ws.AppendStagePrompt(state.Iteration, "summarize", prompt)
+	}
+	out, err := l.runTextStageStep(ctx, runID, stepNum, store.StepPhaseSummarize, prompt, "Write the final summary now.")
+	if err != nil {
+		l.logger.Warn("summarize stage failed; using draft summary", "run_id", runID, "error", err)
+		return draft
+	}
+	if strings.TrimSpace(out) == "" {
+		return draft
+	}
+	return out
+}
+
+// maxUserGuidanceChars bounds {{.UserGuidance}}; the oldest guidance is
+// dropped first.
+const maxUserGuidanceChars = 8000
+
+// takeGuidance moves messages posted via POST /v1/runs/{run_id}/message from
+// the run's inbox into state.UserGuidance and notes each one in run memory.
+func (l *Loop) takeGuidance(ctx context.Context, runID string, iter int, state *stageState) {
+	messages, err := l.runStore.TakeMessages(ctx, runID)
+	if err != nil {
+		l.logger.Error("failed to read run inbox", "run_id", runID, "iteration", iter, "error", err)
+		return
+	}
+	for _, m := range messages {
+		entry := fmt.Sprintf("[%s] %s", m.ReceivedAt.UTC().Format(time.RFC3339), strings.TrimSpace(m.Message))
+		state.UserGuidance = strings.TrimSpace(state.UserGuidance + "\n" + entry)
+		l.logger.Info("user guidance received", "run_id", runID, "iteration", iter, "chars", len(m.Message))
+		if l.ws != nil {
+			if err := l.ws.AppendRunMemory(iter, "User guidance: "+l.redactor.String(strings.TrimSpace(m.Message))); err != nil {
+				l.logger.Error("failed to record user guidance", "run_id", runID, "iteration", iter, "error", err)
+			}
+		}
+	}
+	if over := len(state.UserGuidance) - maxUserGuidanceChars; over > 0 {
+		state.UserGuidance = "...[earlier guidance truncated]\n" + state.UserGuidance[over:]
+	}
+}
+
+// extendLoops grants up to requested extra iterations, bounded by what is left
+// of agent.max_loop_extension, and records the outcome in run memory. It
+// returns the number of iterations granted.
+func (l *Loop) extendLoops(runID string, iter, maxLoops, requested int) int {
+	granted := min(requested, l.cfg.MaxLoopExtension-l.loopExtension)
+	if granted <= 0 {
+		l.logger.Info("loop extension denied", "run_id", runID, "iteration", iter, "requested", requested,
+			"extended", l.loopExtension, "max_loop_extension", l.cfg.MaxLoopExtension)
+		return 0
+	}
+	l.loopExtension += granted
+	l.logger.Info("loop budget extended", "run_id", runID, "iteration", iter, "requested", requested,
+		"granted", granted, "max_loops", maxLoops+granted, "extended", l.loopExtension)
+	if l.ws != nil {
+		note := fmt.Sprintf("Loop budget extended by %d (requested %d): max_loops is now %d.", granted, requested, maxLoops+granted)
+		if err := l.ws.AppendRunMemory(iter, note); err != nil {
+			l.logger.Error("failed to record loop extension", "run_id", runID, "iteration", iter, "error", err)
+		}
+	}
+	return granted
+}
+
+// stageOrder ranks stage names in execution order; unknown names rank as frame.
+func stageOrder(stage string) int {
+	switch stage {
+	case "plan":
+		return 1
+	case "act":
+		return 2
+	case "observe":
+		return 3
+	case "reflect":
+		return 4
+	default:
+		return 0
+	}
+}
+
+// resumeCheckpoint returns the workspace checkpoint when it points at a
+// resumable stage within the run's loop budget.
+func (l *Loop) resumeCheckpoint(ws *Workspace, maxLoops int) *Checkpoint {
+	if ws == nil {
+		return nil
+	}
+	cp := ws.ReadCheckpoint()
+	if cp == nil || cp.LoopExtension < 0 || cp.Iteration < 1 || cp.Iteration > maxLoops+cp.LoopExtension {
+		return nil
+	}
+	switch cp.NextStage {
+	case "frame", "plan", "act", "observe", "reflect":
+		return cp
+	default:
+		return nil
+	}
+}
+
+// saveCheckpoint persists the loop position reached after a stage completes.
+func (l *Loop) saveCheckpoint(runID string, iteration int, nextStage string, state stageState) {
+	if l.ws == nil {
+		return
+	}
+	cp := Checkpoint{
+		Iteration:       iteration,
+		NextStage:       nextStage,
+		Frame:           l.redactor.String(state.Frame),
+		Plan:            l.redactor.String(state.Plan),
+		Act:             l.redactor.String(state.Act),
+		Observe:         l.redactor.String(state.Observe),
+		RecentErrors:    state.RecentErrors,
+		ActTruncated:    state.ActTruncated,
+		NextFocus:       l.redactor.String(state.NextFocus),
+		LastReflection:  l.redactor.String(state.LastReflection),
+		UserGuidance:    l.redactor.String(state.UserGuidance),
+		SuccessReported: state.SuccessReported,
+		SuccessSummary:  l.redactor.String(state.SuccessSummary),
+		LoopExtension:   l.loopExtension,
+		UpdatedAt:       time.Now().UTC(),
+	}
+	if err := l.ws.WriteCheckpoint(cp); err != nil {
+		l.logger.Error("failed to write checkpoint", "run_id", runID, "iteration", iteration, "error", err)
+	}
+}
+
+// clearCheckpoint removes the checkpoint once the run is done or failed, so
+// only a run requeued on shutdown resumes from one.
+func (l *Loop) clearCheckpoint(runID string, ws *Workspace) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	run, err := l.runStore.GetByID(ctx, runID)
+	if err != nil {
+		l.logger.Warn("failed to look up run to clear checkpoint", "run_id", runID, "error", err)
+		return
+	}
+	if run.Status != store.RunStatusDone && run.Status != store.RunStatusFailed {
+		return
+	}
+	if err := ws.RemoveCheckpoint(); err != nil {
+		l.logger.Error("failed to remove checkpoint", "run_id", runID, "error", err)
+	}
+}
+
+// saveNextIteration checkpoints the start of iteration iter+1 and adds the
+// checkpoint to iteration iter's replay snapshot.
+func (l *Loop) saveNextIteration(runID string, iter int, nextStage string, state stageState) {
+	l.saveCheckpoint(runID, iter+1, nextStage, state)
+	if l.ws == nil {
+		return
+	}
+	if err := l.ws.SnapshotCheckpoint(iter); err != nil {
+		l.logger.Error("failed to snapshot checkpoint for replay", "run_id", runID, "iteration", iter, "error", err)
+	}
+}
+
+// stageNames returns the configured stage sequence in execution order.
+func (l *Loop) stageNames() []string {
+	names := []string{"frame", "plan", "act"}
+	if l.observeEnabled() {
+		names = append(names, "observe")
+	}
+	return append(names, "reflect")
 }
 
 type reflectDecision struct {
@@ -295,12 +932,92 @@ type reflectDecision struct {
 	NextFocus    string          `json:"next_focus"`
 	MemoryUpdate string          `json:"memory_update"`
 	UpdatedState json.RawMessage `json:"updated_state"`
+	// RequestMoreLoops asks for extra iterations, capped by agent.max_loop_extension.
+	RequestMoreLoops int `json:"request_more_loops"`
+	// EvidenceRefs names workspace files or "step:N" steps that support the
+	// decision; agent.require_reflect_evidence checks them on done.
+	EvidenceRefs evidenceRefs `json:"evidence_refs"`
 }
 
-func (d reflectDecision) resolvedNextStage() string {
-	switch d.NextStage {
-	case "plan", "act", "done":
-		return d.NextStage
+// evidenceRefs accepts strings and bare step numbers, so a model writing
+// [3, "report.md"] does not invalidate the whole decision.
+type evidenceRefs []string
+
+func (r *evidenceRefs) UnmarshalJSON(data []byte) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		var single string
+		if err := json.Unmarshal(data, &single); err != nil {
+			return nil
+		}
+		items = []json.RawMessage{data}
+	}
+	refs := make(evidenceRefs, 0, len(items))
+	for _, item := range items {
+		var s string
+		if err := json.Unmarshal(item, &s); err == nil {
+			if s = strings.TrimSpace(s); s != "" {
+				refs = append(refs, s)
+			}
+			continue
+		}
+		var n int
+		if err := json.Unmarshal(item, &n); err == nil {
+			refs = append(refs, fmt.Sprintf("step:%d", n))
+		}
+	}
+	*r = refs
+	return nil
+}
+
+// checkEvidenceRefs returns why refs do not ground a done decision, or ""
+// when every ref names an existing workspace file or a step from 1 to
+// maxStep. Files the loop maintains itself, such as state.json, are not
+// evidence of the agent's work.
+func checkEvidenceRefs(refs []string, ws *Workspace, maxStep int) string {
+	if len(refs) == 0 {
+		return "evidence_refs is missing"
+	}
+	var invalid, bookkeeping []string
+	for _, ref := range refs {
+		if num, ok := strings.CutPrefix(strings.ToLower(ref), "step:"); ok {
+			if n, err := strconv.Atoi(strings.TrimSpace(num)); err != nil || n < 1 || n > maxStep {
+				invalid = append(invalid, ref)
+			}
+			continue
+		}
+		if ws == nil {
+			invalid = append(invalid, ref)
+			continue
+		}
+		abs, err := localtools.ResolveWorkspacePath(ws.Dir(), ref)
+		if err != nil {
+			invalid = append(invalid, ref)
+			continue
+		}
+		if isBookkeepingFile(filepath.ToSlash(filepath.Clean(ref))) {
+			bookkeeping = append(bookkeeping, ref)
+			continue
+		}
+		if info, err := os.Stat(abs); err != nil || !info.Mode().IsRegular() {
+			invalid = append(invalid, ref)
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Sprintf("evidence_refs not found: %s", strings.Join(invalid, ", "))
+	}
+	if len(bookkeeping) > 0 {
+		return fmt.Sprintf("evidence_refs name loop bookkeeping files, not evidence: %s", strings.Join(bookkeeping, ", "))
+	}
+	return ""
+}
+
+// resolvedNextStage routes the decision's next_stage through routes (see
+// agent.next_stages). Unknown values fall back to plan, or done for the
+// legacy done flag.
+func (d reflectDecision) resolvedNextStage(routes map[string]string) string {
+	if target, ok := routes[strings.ToLower(strings.TrimSpace(d.NextStage))]; ok {
+		return target
 	}
 	// legacy fallback
 	if d.Done {
@@ -309,6 +1026,24 @@ func (d reflectDecision) resolvedNextStage() string {
 	return "plan"
 }
 
+// nextStageRoutes returns the configured reflect next_stage routing table.
+func (l *Loop) nextStageRoutes() map[string]string {
+	if len(l.cfg.NextStages) == 0 {
+		return config.DefaultNextStages
+	}
+	return l.cfg.NextStages
+}
+
+// nextStageOptions lists the accepted next_stage values for the reflect prompt.
+func nextStageOptions(routes map[string]string) string {
+	values := make([]string, 0, len(routes))
+	for value := range routes {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return strings.Join(values, "|")
+}
+
 type preparedToolset struct {
 	model  model.ToolCallingChatModel
 	byName map[string]tool.InvokableTool
@@ -332,7 +1067,7 @@ func (l *Loop) buildToolset(ctx context.Context, tools []tool.BaseTool) (*prepar
 		byName[info.Name] = inv
 	}
 
-	toolModel, err := l.chatModel.WithTools(infos)
+	toolModel, err := l.stageModel(store.StepPhaseAct).WithTools(infos)
 	if err != nil {
 		return nil, fmt.Errorf("bind tools: %w", err)
 	}
@@ -340,7 +1075,71 @@ func (l *Loop) buildToolset(ctx context.Context, tools []tool.BaseTool) (*prepar
 	return &preparedToolset{model: toolModel, byName: byName, infos: infos}, nil
 }
 
-func (l *Loop) runTextStage(ctx context.Context, prompt, userDirective string) (string, int, tokenUsage, error) {
+// useModel serves every stage of the run with the model the model
+// constraint names.
+func (l *Loop) useModel(name string) error {
+	m, ok := l.models[name]
+	if !ok {
+		return fmt.Errorf("model: %q is not llm.model or one of llm.allowed_models", name)
+	}
+	l.chatModel = m
+	l.stageModels = nil
+	l.runModel = name
+	return nil
+}
+
+// stageModel returns the model that serves phase: its agent.stage_models
+// entry, or the default model.
+func (l *Loop) stageModel(phase store.StepPhase) model.ToolCallingChatModel {
+	if m, ok := l.stageModels[phase]; ok {
+		return m
+	}
+	return l.chatModel
+}
+
+// generateOptions returns the model options for a Generate call in phase,
+// including its agent.stage_max_tokens budget when one is configured.
+func (l *Loop) generateOptions(phase store.StepPhase) []model.Option {
+	stage := l.stageOpts[phase]
+	maxTokens := l.cfg.StageMaxTokens[string(phase)]
+	if len(stage) == 0 && maxTokens <= 0 {
+		return l.modelOpts
+	}
+	opts := make([]model.Option, 0, len(l.modelOpts)+len(stage)+1)
+	opts = append(opts, l.modelOpts...)
+	opts = append(opts, stage...)
+	if maxTokens > 0 {
+		opts = append(opts, model.WithMaxTokens(maxTokens))
+	}
+	return opts
+}
+
+// generate calls the model and, when agent.debug_capture_llm is on, appends
+// the call to the workspace LLM trace. Trace failures are logged, not returned.
+func (l *Loop) generate(ctx context.Context, m model.BaseChatModel, phase store.StepPhase, msgs []*schema.Message, opts []model.Option) (*schema.Message, error) {
+	if !l.cfg.DebugCaptureLLM || l.ws == nil {
+		return m.Generate(ctx, msgs, opts...)
+	}
+	started := time.Now()
+	resp, err := m.Generate(ctx, msgs, opts...)
+	entry := LLMTraceEntry{
+		Iteration:  l.iteration,
+		Phase:      string(phase),
+		StartedAt:  started.UTC().Format(time.RFC3339Nano),
+		DurationMS: time.Since(started).Milliseconds(),
+		Messages:   msgs,
+		Response:   resp,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if werr := l.ws.AppendLLMTrace(l.redactor.JSON(mustJSON(entry))); werr != nil {
+		l.logger.Error("failed to write llm trace", "phase", phase, "error", werr)
+	}
+	return resp, err
+}
+
+func (l *Loop) runTextStage(ctx context.Context, phase store.StepPhase, prompt, userDirective string) (string, int, tokenUsage, error) {
 	if l.cfg.StepTimeout > 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, l.cfg.StepTimeout)
@@ -358,9 +1157,10 @@ func (l *Loop) runTextStage(ctx context.Context, prompt, userDirective string) (
 	if maxRetries <= 0 {
 		maxRetries = 1
 	}
+	opts := l.generateOptions(phase)
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		attempts = attempt + 1
-		resp, err = l.chatModel.Generate(ctx, msgs)
+		resp, err = l.generate(ctx, l.stageModel(phase), phase, msgs, opts)
 		if err == nil {
 			usage.add(tokenUsageFromMessage(resp))
 			break
@@ -381,15 +1181,42 @@ func (l *Loop) runTextStage(ctx context.Context, prompt, userDirective string) (
 	return strings.TrimSpace(resp.Content), attempts, usage, nil
 }
 
+type successReport struct {
+	Summary  string
+	Evidence string
+}
+
 type actStageResult struct {
 	Summary         string
 	SuccessReported bool
 	ReportedSummary string
-	Attempts        int
-	TokenUsage      tokenUsage
-	ToolTokenUsage  map[string]toolTokenUsage
+	// Reports holds each accepted report_success call in this ACT stage.
+	Reports        []successReport
+	Attempts       int
+	TokenUsage     tokenUsage
+	ToolTokenUsage map[string]toolTokenUsage
+	ToolTime       time.Duration
+	// RepeatedActions maps tools called past agent.max_identical_actions
+	// with identical arguments to their run-wide call count.
+	RepeatedActions map[string]int
+	// ToolErrors lists each failed tool call as "tool: error", in call order.
+	ToolErrors []string
+	// Truncated is set when the stage used every tool-call round and the
+	// model was still calling tools.
+	Truncated bool
+	// ApprovalRequested is set when request_approval ended the stage; the
+	// loop waits for the operator's decision before going on.
+	ApprovalRequested bool
 }
 
+// maxActToolNudges caps how many times one ACT stage is re-prompted to use a
+// tool when agent.act_requires_tool is set.
+const maxActToolNudges = 1
+
+// actToolDirective is the re-prompt sent when an ACT round describes work
+// instead of doing it.
+const actToolDirective = "You have not called any tool yet. Do not describe what you would do; call the tool that performs the next step of the plan now. If the task is already complete, call report_success."
+
 func (l *Loop) runActStage(ctx context.Context, toolset *preparedToolset, prompt string) (actStageResult, error) {
 	if l.cfg.StepTimeout > 0 {
 		var cancel context.CancelFunc
@@ -403,11 +1230,9 @@ func (l *Loop) runActStage(ctx context.Context, toolset *preparedToolset, prompt
 
 	result := actStageResult{}
 	var transcript strings.Builder
-	maxRounds := l.cfg.MaxActRounds
-	if maxRounds <= 0 {
-		maxRounds = 6
-	}
+	maxRounds := l.actRoundLimit()
 	toolSeq := 0
+	toolNudges := 0
 
 	for round := 1; round <= maxRounds; round++ {
 		var resp *schema.Message
@@ -418,7 +1243,7 @@ func (l *Loop) runActStage(ctx context.Context, toolset *preparedToolset, prompt
 		}
 		for attempt := 0; attempt < maxRetries; attempt++ {
 			result.Attempts++
-			resp, genErr = toolset.model.Generate(ctx, messages)
+			resp, genErr = l.generate(ctx, toolset.model, store.StepPhaseAct, messages, l.generateOptions(store.StepPhaseAct))
 			if genErr == nil {
 				break
 			}
@@ -438,8 +1263,19 @@ func (l *Loop) runActStage(ctx context.Context, toolset *preparedToolset, prompt
 		roundUsage := tokenUsageFromMessage(resp)
 		result.TokenUsage.add(roundUsage)
 		messages = append(messages, resp)
+		if l.ws != nil {
+			if err := l.ws.AppendLoopAssistant(round, l.redactor.String(resp.Content)); err != nil {
+				l.logger.Error("failed to write assistant content to loop memory", "round", round, "error", err)
+			}
+		}
 
 		if len(resp.ToolCalls) == 0 {
+			if l.cfg.ActRequiresTool && toolSeq == 0 && toolNudges < maxActToolNudges && round < maxRounds {
+				toolNudges++
+				l.logger.Info("act round returned no tool calls; re-prompting for tool use", "round", round)
+				messages = append(messages, schema.UserMessage(actToolDirective))
+				continue
+			}
 			content := strings.TrimSpace(resp.Content)
 			if content != "" {
 				if transcript.Len() > 0 {
@@ -458,7 +1294,7 @@ func (l *Loop) runActStage(ctx context.Context, toolset *preparedToolset, prompt
 		for i, tc := range resp.ToolCalls {
 			toolSeq++
 			name := tc.Function.Name
-			arguments := normalizeJSON(tc.Function.Arguments)
+			arguments := l.toolArguments(name, tc.Function.Arguments)
 			if name != "" {
 				if result.ToolTokenUsage == nil {
 					result.ToolTokenUsage = map[string]toolTokenUsage{}
@@ -469,52 +1305,323 @@ func (l *Loop) runActStage(ctx context.Context, toolset *preparedToolset, prompt
 				result.ToolTokenUsage[name] = stat
 			}
 
+			if count, err := l.trackAction(name, arguments); err != nil {
+				return result, err
+			} else if count > 0 {
+				if result.RepeatedActions == nil {
+					result.RepeatedActions = map[string]int{}
+				}
+				result.RepeatedActions[name] = max(result.RepeatedActions[name], count)
+			}
+
 			inv, ok := toolset.byName[name]
 			if !ok {
 				errMsg := fmt.Sprintf("unknown tool: %s", name)
 				obsJSON := mustJSON(map[string]string{"error": errMsg})
-				messages = append(messages, schema.ToolMessage(string(obsJSON), toolCallID(tc, name, toolSeq)))
+				messages = append(messages, schema.ToolMessage(l.observation(name, obsJSON), toolCallID(tc, name, toolSeq)))
 				transcript.WriteString(fmt.Sprintf("Tool %s error: %s\n", name, errMsg))
+				result.ToolErrors = append(result.ToolErrors, name+": "+errMsg)
+				continue
+			}
+			if reason := l.toolPolicy.check(name); reason != "" {
+				obsJSON := mustJSON(map[string]string{"error": reason})
+				messages = append(messages, schema.ToolMessage(l.observation(name, obsJSON), toolCallID(tc, name, toolSeq)))
+				transcript.WriteString(fmt.Sprintf("Tool %s error: %s\n", name, reason))
+				result.ToolErrors = append(result.ToolErrors, name+": "+reason)
 				continue
 			}
 
-			out, runErr := inv.InvokableRun(ctx, string(arguments))
+			if err := l.checkToolBudget(); err != nil {
+				return result, err
+			}
+			out, runErr := l.invokeTool(ctx, name, inv, string(arguments), &result)
+			if err := l.checkToolBudget(); err != nil {
+				return result, err
+			}
 			obsJSON := normalizeJSON(out)
 			if runErr != nil {
 				e := runErr.Error()
 				obsJSON = mustJSON(map[string]string{"error": e})
+				result.ToolErrors = append(result.ToolErrors, name+": "+e)
 			} else if name == "report_success" {
 				result.SuccessReported = true
-				if summary := extractSummaryFromArguments(arguments); summary != "" {
-					result.ReportedSummary = summary
+				report := extractReportFromArguments(arguments)
+				if report.Summary != "" {
+					result.ReportedSummary = report.Summary
 				}
+				result.Reports = append(result.Reports, report)
 			}
 
-			messages = append(messages, schema.ToolMessage(string(obsJSON), toolCallID(tc, name, toolSeq)))
+			messages = append(messages, schema.ToolMessage(l.observation(name, obsJSON), toolCallID(tc, name, toolSeq)))
 			transcript.WriteString(fmt.Sprintf("Tool %s output:\n%s\n", name, string(obsJSON)))
+
+			// Nothing more runs until the operator has decided.
+			if name == "request_approval" && runErr == nil && approvalPending(obsJSON) {
+				if skipped := len(resp.ToolCalls) - i - 1; skipped > 0 {
+					transcript.WriteString(fmt.Sprintf("Skipped %d tool calls made alongside request_approval.\n", skipped))
+				}
+				result.ApprovalRequested = true
+				result.Summary = strings.TrimSpace(transcript.String())
+				return result, nil
+			}
 		}
 	}
 
+	result.Truncated = true
 	result.Summary = strings.TrimSpace(transcript.String())
 	return result, nil
 }
 
+// finalizeDirective is appended to the ACT prompt of a finalize stage.
+const finalizeDirective = "Reflection judged the goal complete, but report_success has not been called. Do not start new work. Call report_success now with a summary of the result and the evidence for it. If the goal is not actually met, explain what is missing instead."
+
+// runFinalizeStage runs one ACT-only stage of agent.finalize_rounds rounds
+// after reflect says done without a report_success call, so the run can
+// finish in this iteration instead of spending a full one on the report.
+// Its summary and tool errors replace the ACT ones in state, so a run that
+// still has not reported sees why in the next iteration.
+func (l *Loop) runFinalizeStage(ctx context.Context, runID string, iter int, stepNum *int, toolset *preparedToolset, ws *Workspace, decision reflectDecision, state *stageState) error {
+	l.logger.Info("reflect requested done but report_success not yet called; finalizing", "run_id", runID, "iteration", iter, "rounds", l.cfg.FinalizeRounds)
+	prompt := l.renderStagePrompt(runID, "act", l.cfg.Prompts.Act, *state) + "\n\n" + finalizeDirective
+	if summary := strings.TrimSpace(decision.Summary); summary != "" {
+		prompt += "\n\nReflection summary: " + summary
+	}
+	if ws != nil {
+		_ = ws.AppendStagePrompt(iter, "finalize", prompt)
+	}
+	l.actRounds = l.cfg.FinalizeRounds
+	result, err := l.runActStageStep(ctx, runID, stepNum, toolset, prompt)
+	if err != nil {
+		return err
+	}
+	state.Act = result.Summary
+	state.ActTruncated = result.Truncated
+	state.RecentErrors = ""
+	if l.cfg.ReflectIncludeErrors {
+		state.RecentErrors = l.redactor.String(recentErrorsText(result.ToolErrors))
+	}
+	l.recordReports(runID, iter, ws, result, state)
+	// A run interrupted here resumes at reflect with the finalize outcome.
+	l.saveCheckpoint(runID, iter, "reflect", *state)
+	if result.ApprovalRequested {
+		if err := l.awaitApproval(ctx, runID, iter, state); err != nil {
+			return err
+		}
+		l.saveCheckpoint(runID, iter, "reflect", *state)
+	}
+	return nil
+}
+
+// recordReports folds an ACT stage's report_success calls into state and
+// the run's evidence file.
+func (l *Loop) recordReports(runID string, iter int, ws *Workspace, result actStageResult, state *stageState) {
+	if result.SuccessReported {
+		state.SuccessReported = true
+		if result.ReportedSummary != "" {
+			state.SuccessSummary = result.ReportedSummary
+		}
+	}
+	if ws == nil {
+		return
+	}
+	for _, report := range result.Reports {
+		if err := ws.AppendEvidence(l.cfg.EvidenceFormat, iter, l.redactor.String(report.Summary), l.redactor.String(report.Evidence)); err != nil {
+			l.logger.Error("failed to append evidence", "run_id", runID, "iteration", iter, "error", err)
+		}
+	}
+}
+
+// actRoundLimit returns the tool-call round limit of the current ACT stage:
+// the plan's override when set, else agent.max_act_rounds.
+func (l *Loop) actRoundLimit() int {
+	if l.actRounds > 0 {
+		return l.actRounds
+	}
+	if l.cfg.MaxActRounds > 0 {
+		return l.cfg.MaxActRounds
+	}
+	return 6
+}
+
+// actRoundsPattern matches an "act_rounds: N" line in the plan output.
+var actRoundsPattern = regexp.MustCompile(`(?im)^[\s*_-]*act_rounds[*_]*\s*:\s*(\d+)\s*$`)
+
+// planActRounds returns the ACT round limit the plan requests with an
+// "act_rounds: N" line, capped at agent.max_act_rounds_ceiling. It returns 0
+// when the plan sets none or overrides are disabled.
+func (l *Loop) planActRounds(plan string) int {
+	if l.cfg.MaxActRoundsCeiling <= 0 {
+		return 0
+	}
+	matches := actRoundsPattern.FindAllStringSubmatch(plan, -1)
+	if len(matches) == 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(matches[len(matches)-1][1])
+	if err != nil || n <= 0 {
+		return 0
+	}
+	return min(n, l.cfg.MaxActRoundsCeiling)
+}
+
+// trackAction counts a tool call against identical earlier calls in the run.
+// It returns the call count once it exceeds agent.max_identical_actions, and
+// ErrStuckLoop once it exceeds agent.stuck_loop_threshold.
+func (l *Loop) trackAction(name string, arguments json.RawMessage) (int, error) {
+	if l.cfg.MaxIdenticalActions <= 0 {
+		return 0, nil
+	}
+	if l.actionCounts == nil {
+		l.actionCounts = map[string]int{}
+	}
+	key := actionKey(name, arguments)
+	l.actionCounts[key]++
+	count := l.actionCounts[key]
+	if l.cfg.StuckLoopThreshold > 0 && count > l.cfg.StuckLoopThreshold {
+		return count, fmt.Errorf("%w: %s called %d times with identical arguments", ErrStuckLoop, name, count)
+	}
+	if count > l.cfg.MaxIdenticalActions {
+		return count, nil
+	}
+	return 0, nil
+}
+
+// actionKey hashes a tool name with its arguments re-encoded so that key
+// order and whitespace do not affect identity.
+func actionKey(name string, arguments json.RawMessage) string {
+	canonical := []byte(arguments)
+	var v any
+	if err := json.Unmarshal(arguments, &v); err == nil {
+		canonical, _ = json.Marshal(v)
+	}
+	sum := sha256.Sum256(append([]byte(name+"\x00"), canonical...))
+	return hex.EncodeToString(sum[:])
+}
+
+// repeatedActionWarning is the next_focus warning for tools called past
+// agent.max_identical_actions.
+func repeatedActionWarning(repeated map[string]int) string {
+	names := make([]string, 0, len(repeated))
+	for name := range repeated {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s (%d times)", name, repeated[name]))
+	}
+	return "WARNING: repeated identical tool calls with no progress: " + strings.Join(parts, ", ") +
+		". Do not repeat these calls with the same arguments; change approach, or call report_success if the goal is met."
+}
+
+// maxRecentErrors and maxRecentErrorChars bound {{.RecentErrors}}: only the
+// last errors are kept and each is clipped.
+const (
+	maxRecentErrors     = 10
+	maxRecentErrorChars = 500
+)
+
+// recentErrorsText renders ACT tool errors for {{.RecentErrors}}, one per
+// line, keeping the last maxRecentErrors.
+func recentErrorsText(toolErrors []string) string {
+	if len(toolErrors) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	if omitted := len(toolErrors) - maxRecentErrors; omitted > 0 {
+		fmt.Fprintf(&b, "(%d earlier errors omitted)\n", omitted)
+		toolErrors = toolErrors[omitted:]
+	}
+	for _, e := range toolErrors {
+		b.WriteString("- ")
+		b.WriteString(clipText(e, maxRecentErrorChars))
+		b.WriteString("\n")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// invokeTool runs a single tool call, charging its duration against the run's
+// tool time budget. When a budget is set the call is bounded by what remains.
+// Each call is also bounded by its agent.tool_timeouts entry (default
+// agent.step_timeout); hitting that limit is returned as a tool error so the
+// model can react instead of the stage failing.
+func (l *Loop) invokeTool(ctx context.Context, name string, inv tool.InvokableTool, arguments string, result *actStageResult) (string, error) {
+	if budget := l.cfg.MaxToolTimePerRun; budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget-l.toolTime)
+		defer cancel()
+	}
+	toolCtx := ctx
+	timeout := l.toolTimeout(name)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		toolCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	out, err := inv.InvokableRun(toolCtx, arguments)
+	elapsed := time.Since(start)
+	l.toolTime += elapsed
+	result.ToolTime += elapsed
+	if err != nil && ctx.Err() == nil && errors.Is(toolCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("tool %s timed out after %s", name, timeout)
+	}
+	return out, err
+}
+
+// toolTimeout returns the per-call limit for a tool: its agent.tool_timeouts
+// entry, falling back to agent.step_timeout (none for spawn_subrun).
+func (l *Loop) toolTimeout(name string) time.Duration {
+	if timeout, ok := l.cfg.ToolTimeouts[name]; ok && timeout > 0 {
+		return timeout
+	}
+	if name == "spawn_subrun" {
+		// The child is bounded by its own deadline and by this run's.
+		return 0
+	}
+	return l.cfg.StepTimeout
+}
+
+// checkToolBudget returns ErrToolTimeBudgetExceeded once the run has used its tool time allowance.
+func (l *Loop) checkToolBudget() error {
+	budget := l.cfg.MaxToolTimePerRun
+	if budget <= 0 || l.toolTime < budget {
+		return nil
+	}
+	return fmt.Errorf("%w: used %s of %s", ErrToolTimeBudgetExceeded, l.toolTime.Round(time.Millisecond), budget)
+}
+
+// checkStepLimit returns ErrStepLimitExceeded when appending another step would
+// take the run past agent.max_steps_per_run. The done marker is exempt.
+func (l *Loop) checkStepLimit(stepNum int) error {
+	limit := l.cfg.MaxStepsPerRun
+	if limit <= 0 || stepNum < limit {
+		return nil
+	}
+	return fmt.Errorf("%w: run has %d steps; limit is %d", ErrStepLimitExceeded, stepNum, limit)
+}
+
 func (l *Loop) runTextStageStep(ctx context.Context, runID string, stepNum *int, phase store.StepPhase, prompt, userDirective string) (string, error) {
+	if err := l.checkStepLimit(*stepNum); err != nil {
+		return "", err
+	}
 	*stepNum = *stepNum + 1
 	step, err := l.stepStore.Append(ctx, runID, *stepNum, phase, nil, nil)
 	if err != nil {
 		return "", fmt.Errorf("append step: %w", err)
 	}
+	*stepNum = step.StepNum // Append skips numbers already taken
 	if err := l.stepStore.UpdateStatusWithAttempt(ctx, step.ID, store.StepStatusRunning, nil, nil, 1); err != nil {
 		return "", fmt.Errorf("mark step running: %w", err)
 	}
 
-	out, attempts, usage, stageErr := l.runTextStage(ctx, prompt, userDirective)
+	out, attempts, usage, stageErr := l.runTextStage(ctx, phase, prompt, userDirective)
 	if attempts <= 0 {
 		attempts = 1
 	}
 	if stageErr != nil {
-		errMsg := stageErr.Error()
+		errMsg := l.redactor.String(stageErr.Error())
 		_ = l.stepStore.UpdateStatusWithAttempt(ctx, step.ID, store.StepStatusError, nil, &errMsg, attempts)
 		return "", stageErr
 	}
@@ -522,8 +1629,9 @@ func (l *Loop) runTextStageStep(ctx context.Context, runID string, stepNum *int,
 	outPayload := map[string]any{"content": out}
 	if !usage.isZero() {
 		outPayload["token_usage"] = usage
+		outPayload["estimated_cost"] = l.estimateCost(phase, usage)
 	}
-	outJSON := mustJSON(outPayload)
+	outJSON := l.redactor.JSON(mustJSON(outPayload))
 	if err := l.stepStore.UpdateStatusWithAttempt(ctx, step.ID, store.StepStatusOK, outJSON, nil, attempts); err != nil {
 		return "", fmt.Errorf("mark step ok: %w", err)
 	}
@@ -531,11 +1639,15 @@ func (l *Loop) runTextStageStep(ctx context.Context, runID string, stepNum *int,
 }
 
 func (l *Loop) runActStageStep(ctx context.Context, runID string, stepNum *int, toolset *preparedToolset, prompt string) (actStageResult, error) {
+	if err := l.checkStepLimit(*stepNum); err != nil {
+		return actStageResult{}, err
+	}
 	*stepNum = *stepNum + 1
 	step, err := l.stepStore.Append(ctx, runID, *stepNum, store.StepPhaseAct, nil, nil)
 	if err != nil {
 		return actStageResult{}, fmt.Errorf("append act step: %w", err)
 	}
+	*stepNum = step.StepNum // Append skips numbers already taken
 	if err := l.stepStore.UpdateStatusWithAttempt(ctx, step.ID, store.StepStatusRunning, nil, nil, 1); err != nil {
 		return actStageResult{}, fmt.Errorf("mark act step running: %w", err)
 	}
@@ -546,7 +1658,7 @@ func (l *Loop) runActStageStep(ctx context.Context, runID string, stepNum *int,
 		attempts = 1
 	}
 	if stageErr != nil {
-		errMsg := stageErr.Error()
+		errMsg := l.redactor.String(stageErr.Error())
 		_ = l.stepStore.UpdateStatusWithAttempt(ctx, step.ID, store.StepStatusError, nil, &errMsg, attempts)
 		return result, stageErr
 	}
@@ -554,12 +1666,20 @@ func (l *Loop) runActStageStep(ctx context.Context, runID string, stepNum *int,
 	outPayload := map[string]any{"content": result.Summary}
 	if !result.TokenUsage.isZero() {
 		outPayload["token_usage"] = result.TokenUsage
+		outPayload["estimated_cost"] = l.estimateCost(store.StepPhaseAct, result.TokenUsage)
 	}
 	if len(result.ToolTokenUsage) > 0 {
 		outPayload["tool_token_usage"] = result.ToolTokenUsage
 		outPayload["tool_token_usage_estimated"] = true
 	}
-	outJSON := mustJSON(outPayload)
+	if result.ToolTime > 0 {
+		outPayload["tool_time_ms"] = result.ToolTime.Milliseconds()
+	}
+	if result.Truncated {
+		outPayload["act_truncated"] = true
+		outPayload["act_rounds"] = l.actRoundLimit()
+	}
+	outJSON := l.redactor.JSON(mustJSON(outPayload))
 	if err := l.stepStore.UpdateStatusWithAttempt(ctx, step.ID, store.StepStatusOK, outJSON, nil, attempts); err != nil {
 		return actStageResult{}, fmt.Errorf("mark act step ok: %w", err)
 	}
@@ -572,13 +1692,80 @@ func (l *Loop) appendTextStep(ctx context.Context, runID string, stepNum *int, p
 	if err != nil {
 		return err
 	}
+	*stepNum = step.StepNum // Append skips numbers already taken
 	if err := l.stepStore.UpdateStatusWithAttempt(ctx, step.ID, store.StepStatusRunning, nil, nil, 1); err != nil {
 		return err
 	}
-	out := mustJSON(map[string]string{"content": content})
+	out := l.redactor.JSON(mustJSON(map[string]string{"content": content}))
 	return l.stepStore.UpdateStatusWithAttempt(ctx, step.ID, store.StepStatusOK, out, nil, 1)
 }
 
+// promptTrimOrder lists the stageState fields trimmed, lowest priority first,
+// when a rendered prompt exceeds agent.max_prompt_chars.
+var promptTrimOrder = []struct {
+	name  string
+	field func(*stageState) *string
+}{
+	{"recent_loops", func(s *stageState) *string { return &s.RecentLoops }},
+	{"loop_memory", func(s *stageState) *string { return &s.LoopMemory }},
+	{"run_memory", func(s *stageState) *string { return &s.Memory }},
+	{"frame", func(s *stageState) *string { return &s.Frame }},
+}
+
+// renderStagePrompt renders a stage prompt and, when agent.max_prompt_chars is
+// set, progressively trims low-priority fields until the prompt fits.
+func (l *Loop) renderStagePrompt(runID, stage, tmpl string, state stageState) string {
+	l.stampClock(&state)
+	prompt := l.renderPrompt(tmpl, state)
+	limit := l.cfg.MaxPromptChars
+	if limit <= 0 || len(prompt) <= limit {
+		return prompt
+	}
+
+	originalLen := len(prompt)
+	var trimmed []string
+	for _, candidate := range promptTrimOrder {
+		excess := len(prompt) - limit
+		if excess <= 0 {
+			break
+		}
+		field := candidate.field(&state)
+		if *field == "" {
+			continue
+		}
+		before := len(*field)
+		*field = trimForPrompt(*field, excess)
+		next := l.renderPrompt(tmpl, state)
+		if len(next) < len(prompt) {
+			trimmed = append(trimmed, fmt.Sprintf("%s(%d->%d)", candidate.name, before, len(*field)))
+		}
+		prompt = next
+	}
+
+	l.logger.Warn("stage prompt exceeded max_prompt_chars; trimmed",
+		"run_id", runID, "stage", stage, "limit", limit,
+		"original_chars", originalLen, "final_chars", len(prompt), "trimmed", trimmed)
+	if len(prompt) > limit {
+		l.logger.Warn("stage prompt still exceeds max_prompt_chars after trimming", "run_id", runID, "stage", stage, "chars", len(prompt))
+	}
+	return prompt
+}
+
+// trimForPrompt shortens s by at least excess bytes, leaving a marker that
+// records how much was dropped. The cut moves back to a rune boundary so the
+// result stays valid UTF-8.
+func trimForPrompt(s string, excess int) string {
+	const markerAllowance = 64
+	end := len(s) - excess - markerAllowance
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	if end <= 0 {
+		return fmt.Sprintf("...[truncated %d bytes to fit max_prompt_chars]", len(s))
+	}
+	return s[:end] + fmt.Sprintf("\n...[truncated %d bytes to fit max_prompt_chars]", len(s)-end)
+}
+
 func (l *Loop) renderPrompt(tmpl string, data stageState) string {
 	t, err := template.New("stage_prompt").Parse(tmpl)
 	if err != nil {
@@ -591,45 +1778,86 @@ func (l *Loop) renderPrompt(tmpl string, data stageState) string {
 	return b.String()
 }
 
-func (l *Loop) failRun(_ context.Context, callbackURL, runID string, err error) error {
+func (l *Loop) failRun(ctx context.Context, callbackURL, runID string, err error) error {
+	if errors.Is(context.Cause(ctx), ErrShutdown) {
+		return l.requeueRun(runID, err)
+	}
+	if cause := context.Cause(ctx); errors.Is(cause, errRunDeadlineExceeded) && !errors.Is(err, cause) {
+		err = fmt.Errorf("%w: %w", err, cause)
+	}
 	bgCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	errMsg := err.Error()
-	updateErr := l.runStore.UpdateStatus(bgCtx, runID, store.RunStatusFailed, nil, &errMsg)
+	errMsg := l.redactor.String(err.Error())
+	updateErr := l.runStore.Fail(bgCtx, runID, failureCode(err), errMsg)
 	if updateErr != nil {
 		l.logger.Error("failed to persist failed run status", "run_id", runID, "error", updateErr)
 	}
-	l.emitCallback(bgCtx, callbackURL, runID, "failed", nil, &errMsg)
+	// Fail promotes the working summary, so the callback can carry it.
+	var summary *string
+	if updateErr == nil && callbackURL != "" {
+		if failed, err := l.runStore.GetByID(bgCtx, runID); err == nil {
+			summary = failed.Summary
+		}
+	}
+	l.emitCallback(bgCtx, callbackURL, runID, "failed", summary, &errMsg)
 	if updateErr != nil {
 		return fmt.Errorf("%w; additionally failed to persist run status: %v", err, updateErr)
 	}
 	return err
 }
 
-func (l *Loop) emitCallback(_ context.Context, callbackURL, runID, status string, summary *string, errMsg *string) {
-	if callbackURL == "" || l.client == nil {
-		return
-	}
-
+// requeueRun puts a run interrupted by shutdown back to queued and closes its
+// in-flight steps, so RecoverRuns resumes it on the next boot. No callback is
+// sent because the run has not finished.
+func (l *Loop) requeueRun(runID string, cause error) error {
 	bgCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-
-	payload := map[string]any{
-		"run_id": runID,
-		"status": status,
+	if n, err := l.stepStore.InterruptOpen(bgCtx, runID, "interrupted by shutdown"); err != nil {
+		l.logger.Error("failed to close in-flight steps on shutdown", "run_id", runID, "error", err)
+	} else if n > 0 {
+		l.logger.Info("closed in-flight steps on shutdown", "run_id", runID, "steps", n)
 	}
-	if summary != nil {
-		payload["summary"] = *summary
+	if err := l.runStore.Requeue(bgCtx, runID); err != nil {
+		l.logger.Error("failed to requeue run on shutdown", "run_id", runID, "error", err)
+		return fmt.Errorf("%w: %v; additionally failed to requeue: %v", ErrRunInterrupted, cause, err)
 	}
-	if errMsg != nil {
-		payload["error"] = *errMsg
+	return fmt.Errorf("%w: %v", ErrRunInterrupted, cause)
+}
+
+// failureCode maps known run-ending errors to a machine-readable failure code.
+func failureCode(err error) string {
+	switch {
+	case errors.Is(err, ErrToolTimeBudgetExceeded):
+		return store.FailureCodeToolTimeExceeded
+	case errors.Is(err, ErrStuckLoop):
+		return store.FailureCodeStuckLoop
+	case errors.Is(err, ErrQueueExpired):
+		return store.FailureCodeQueueExpired
+	case errors.Is(err, ErrStepLimitExceeded):
+		return store.FailureCodeStepLimit
+	case errors.Is(err, ErrApprovalRejected):
+		return store.FailureCodeApprovalRejected
+	default:
+		return ""
 	}
+}
 
-	if err := l.client.Callback(bgCtx, callbackURL, payload); err != nil {
+// emitCallback delivers the completion callback under l.callbackPolicy. The
+// run is marked pending first, so a callback that still fails after its
+// retries is picked up by the runner's callback retrier.
+func (l *Loop) emitCallback(_ context.Context, callbackURL, runID, status string, summary *string, errMsg *string) {
+	if callbackURL == "" || l.client == nil {
+		return
+	}
+	l.markCallback(runID, false)
+
+	payload := callbackPayload(runID, status, summary, errMsg)
+	if err := deliverCallback(context.Background(), l.client, callbackURL, payload, l.callbackPolicy); err != nil {
 		l.logger.Error("failed to emit callback", "run_id", runID, "url", callbackURL, "error", err)
-	} else {
-		l.logger.Info("callback emitted", "run_id", runID, "url", callbackURL, "status", status)
+		return
 	}
+	l.markCallback(runID, true)
+	l.logger.Info("callback emitted", "run_id", runID, "url", callbackURL, "status", status)
 }
 
 func jsonOrNull(raw json.RawMessage) string {
@@ -639,7 +1867,7 @@ func jsonOrNull(raw json.RawMessage) string {
 	return string(raw)
 }
 
-func buildToolCatalog(infos []*schema.ToolInfo) string {
+func buildToolCatalog(infos []*schema.ToolInfo, verbose bool) string {
 	var b strings.Builder
 	for _, info := range infos {
 		b.WriteString(info.Name)
@@ -648,10 +1876,100 @@ func buildToolCatalog(infos []*schema.ToolInfo) string {
 			b.WriteString(info.Desc)
 		}
 		b.WriteByte('\n')
+		if verbose {
+			if params := toolCatalogParams(info); params != nil {
+				writeCatalogParams(&b, params, "  ")
+			}
+		}
 	}
 	return strings.TrimSpace(b.String())
 }
 
+// catalogSchema is the part of a tool's parameter JSON schema that a verbose
+// tool catalog renders.
+type catalogSchema struct {
+	Type        json.RawMessage           `json:"type"`
+	Description string                    `json:"description"`
+	Properties  map[string]*catalogSchema `json:"properties"`
+	Required    []string                  `json:"required"`
+	Items       *catalogSchema            `json:"items"`
+	Enum        []any                     `json:"enum"`
+}
+
+// toolCatalogParams returns the tool's parameter schema, or nil when it has
+// none or it cannot be read.
+func toolCatalogParams(info *schema.ToolInfo) *catalogSchema {
+	js, err := info.ParamsOneOf.ToJSONSchema()
+	if err != nil || js == nil {
+		return nil
+	}
+	raw, err := json.Marshal(js)
+	if err != nil {
+		return nil
+	}
+	var s catalogSchema
+	if err := json.Unmarshal(raw, &s); err != nil || len(s.Properties) == 0 {
+		return nil
+	}
+	return &s
+}
+
+// writeCatalogParams writes one "- name (type, required): description" line
+// per property, nesting object and array-of-object fields one level deeper.
+func writeCatalogParams(b *strings.Builder, s *catalogSchema, indent string) {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := s.Properties[name]
+		if p == nil {
+			continue
+		}
+		fmt.Fprintf(b, "%s- %s (%s", indent, name, p.typeName())
+		if slices.Contains(s.Required, name) {
+			b.WriteString(", required")
+		}
+		b.WriteByte(')')
+		if p.Description != "" {
+			b.WriteString(": ")
+			b.WriteString(p.Description)
+		}
+		if len(p.Enum) > 0 {
+			values := make([]string, len(p.Enum))
+			for i, v := range p.Enum {
+				values[i] = fmt.Sprint(v)
+			}
+			fmt.Fprintf(b, " [one of: %s]", strings.Join(values, ", "))
+		}
+		b.WriteByte('\n')
+		switch {
+		case len(p.Properties) > 0:
+			writeCatalogParams(b, p, indent+"  ")
+		case p.Items != nil && len(p.Items.Properties) > 0:
+			writeCatalogParams(b, p.Items, indent+"  ")
+		}
+	}
+}
+
+func (s *catalogSchema) typeName() string {
+	var name string
+	if err := json.Unmarshal(s.Type, &name); err != nil {
+		var names []string
+		if err := json.Unmarshal(s.Type, &names); err == nil {
+			name = strings.Join(names, "|")
+		}
+	}
+	if name == "" {
+		name = "any"
+	}
+	if name == "array" && s.Items != nil {
+		return "array of " + s.Items.typeName()
+	}
+	return name
+}
+
 func clipText(s string, max int) string {
 	if len(s) <= max {
 		return s
@@ -659,6 +1977,36 @@ func clipText(s string, max int) string {
 	return s[:max] + "\n...[truncated]"
 }
 
+// clipTextTail is clipText keeping the end of s, for text whose newest
+// entries come last.
+func clipTextTail(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	start := len(s) - max
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return "...[truncated]\n" + s[start:]
+}
+
+// toolArguments normalizes a tool call's arguments. With
+// agent.repair_tool_args, arguments that are not valid JSON are passed
+// through repairJSON first. The logged original is redacted, since arguments
+// can carry secrets the model copied from its context.
+func (l *Loop) toolArguments(name, raw string) json.RawMessage {
+	if l.cfg.RepairToolArgs {
+		if trimmed := strings.TrimSpace(raw); trimmed != "" && !json.Valid([]byte(trimmed)) {
+			if repaired, ok := repairJSON(trimmed); ok {
+				l.logger.Info("repaired malformed tool arguments", "tool", name, "original", l.redactor.String(clipText(trimmed, 500)))
+				return json.RawMessage(repaired)
+			}
+			l.logger.Warn("could not repair malformed tool arguments", "tool", name, "original", l.redactor.String(clipText(trimmed, 500)))
+		}
+	}
+	return normalizeJSON(raw)
+}
+
 func normalizeJSON(s string) json.RawMessage {
 	trimmed := strings.TrimSpace(s)
 	if trimmed == "" {
@@ -679,27 +2027,46 @@ type tokenUsage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// ByProvider splits usage by the provider that served each call when
+	// llm.fallbacks is configured.
+	ByProvider map[string]tokenUsage `json:"by_provider,omitempty"`
 }
 
 func tokenUsageFromMessage(msg *schema.Message) tokenUsage {
-	if msg == nil || msg.ResponseMeta == nil || msg.ResponseMeta.Usage == nil {
-		return tokenUsage{}
+	var u tokenUsage
+	if msg != nil && msg.ResponseMeta != nil && msg.ResponseMeta.Usage != nil {
+		u = tokenUsage{
+			PromptTokens:     msg.ResponseMeta.Usage.PromptTokens,
+			CompletionTokens: msg.ResponseMeta.Usage.CompletionTokens,
+			TotalTokens:      msg.ResponseMeta.Usage.TotalTokens,
+		}
 	}
-	return tokenUsage{
-		PromptTokens:     msg.ResponseMeta.Usage.PromptTokens,
-		CompletionTokens: msg.ResponseMeta.Usage.CompletionTokens,
-		TotalTokens:      msg.ResponseMeta.Usage.TotalTokens,
+	if name := provider.ServedBy(msg); name != "" {
+		u.ByProvider = map[string]tokenUsage{name: {
+			PromptTokens:     u.PromptTokens,
+			CompletionTokens: u.CompletionTokens,
+			TotalTokens:      u.TotalTokens,
+		}}
 	}
+	return u
 }
 
 func (u *tokenUsage) add(other tokenUsage) {
 	u.PromptTokens += other.PromptTokens
 	u.CompletionTokens += other.CompletionTokens
 	u.TotalTokens += other.TotalTokens
+	for name, pu := range other.ByProvider {
+		if u.ByProvider == nil {
+			u.ByProvider = map[string]tokenUsage{}
+		}
+		cur := u.ByProvider[name]
+		cur.add(pu)
+		u.ByProvider[name] = cur
+	}
 }
 
 func (u tokenUsage) isZero() bool {
-	return u.PromptTokens == 0 && u.CompletionTokens == 0 && u.TotalTokens == 0
+	return u.PromptTokens == 0 && u.CompletionTokens == 0 && u.TotalTokens == 0 && len(u.ByProvider) == 0
 }
 
 type toolTokenUsage struct {
@@ -767,14 +2134,28 @@ func parseReflectDecision(raw string) reflectDecision {
 	return reflectDecision{Done: false, Summary: text}
 }
 
-func extractSummaryFromArguments(arguments json.RawMessage) string {
+func extractReportFromArguments(arguments json.RawMessage) successReport {
 	var payload struct {
-		Summary string `json:"summary"`
+		Summary  string `json:"summary"`
+		Evidence string `json:"evidence"`
 	}
 	if err := json.Unmarshal(arguments, &payload); err != nil {
-		return ""
+		return successReport{}
+	}
+	return successReport{
+		Summary:  strings.TrimSpace(payload.Summary),
+		Evidence: strings.TrimSpace(payload.Evidence),
 	}
-	return strings.TrimSpace(payload.Summary)
+}
+
+// frameImmediatelyActionable reports whether the frame output sets
+// "immediately_actionable": true, asking to go straight to ACT.
+func frameImmediatelyActionable(frameOut string) bool {
+	var frame struct {
+		ImmediatelyActionable bool `json:"immediately_actionable"`
+	}
+	_ = json.Unmarshal(normalizeStateJSON(frameOut), &frame)
+	return frame.ImmediatelyActionable
 }
 
 func normalizeStateJSON(raw string) json.RawMessage {
@@ -944,9 +2325,9 @@ func toStringList(v any) []string {
 	return out
 }
 
-func (l *Loop) rebuildToolsWithObserver(ws *Workspace) []tool.BaseTool {
+func (l *Loop) rebuildToolsWithObserver(run *store.Run, ws *Workspace) []tool.BaseTool {
 	observer := func(toolName, input, output, status string) {
-		if err := ws.AppendLoopToolCall(toolName, input, output, status); err != nil {
+		if err := ws.AppendLoopToolCall(toolName, l.redactor.String(input), l.redactor.String(output), status); err != nil {
 			l.logger.Error("failed to write loop memory", "tool", toolName, "error", err)
 		}
 	}
@@ -968,6 +2349,38 @@ func (l *Loop) rebuildToolsWithObserver(ws *Workspace) []tool.BaseTool {
 	for _, wt := range localtools.BuildWorkspaceTools(ws.Dir()) {
 		wrapped = append(wrapped, wt.WithObserver(observer))
 	}
+	// Add run_command when the config approves any commands.
+	if len(l.cfg.ShellAllowlist) > 0 {
+		rc := localtools.BuildRunCommandTool(ws.Dir(), l.cfg.ShellAllowlist, l.cfg.ShellEnv, localtools.SysToolsConfig{
+			Timeout:        l.cfg.SysTools.Timeout,
+			MaxOutputBytes: l.cfg.SysTools.MaxOutputBytes,
+		})
+		wrapped = append(wrapped, rc.WithObserver(observer))
+	}
+	// Add fetch_url when the config allows any hosts.
+	if len(l.cfg.FetchURL.AllowedHosts) > 0 {
+		fu := localtools.BuildFetchURLTool(localtools.FetchURLConfig{
+			AllowedHosts:         l.cfg.FetchURL.AllowedHosts,
+			Timeout:              l.cfg.FetchURL.Timeout,
+			MaxChars:             l.cfg.FetchURL.MaxChars,
+			AllowPrivateNetworks: l.cfg.FetchURL.AllowPrivateNetworks,
+		})
+		wrapped = append(wrapped, fu.WithObserver(observer))
+	}
+	// Add todo tools that edit the run's state.json.
+	wrapped = append(wrapped, buildStateTools(ws, observer)...)
+	// Add set_summary so a run that never finishes still has a summary.
+	wrapped = append(wrapped, newSummaryTool(l.runStore, run.ID, l.redactor, observer))
+	// Add log_decision for an auditable trail of key decisions.
+	wrapped = append(wrapped, newDecisionTool(ws, func() int { return l.iteration }, l.redactor, observer))
+	// Add request_approval when operators gate sensitive actions.
+	if l.cfg.Approval.Enabled {
+		wrapped = append(wrapped, newApprovalTool(l.runStore, run.ID, l.redactor, observer))
+	}
+	// Add subrun tools when this run may still spawn children.
+	if l.subrunExec != nil && l.maxSubrunDepth > 0 {
+		wrapped = append(wrapped, buildSubrunTools(l.runStore, l.subrunExec, run, l.maxSubrunDepth, l.cfg.MaxSubrunsPerRun, observer)...)
+	}
 
 	return wrapped
 }
@@ -8,14 +8,19 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cloudwego/eino/components/model"
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/schema"
 	"github.com/mattjoyce/agenticloop/internal/config"
 	"github.com/mattjoyce/agenticloop/internal/ductile"
+	"github.com/mattjoyce/agenticloop/internal/store"
 )
 
 func TestRunActStageCanExecuteTwoDuctileTools(t *testing.T) {
@@ -52,7 +57,10 @@ func TestRunActStageCanExecuteTwoDuctileTools(t *testing.T) {
 	defer server.Close()
 
 	client := ductile.NewClient(server.URL, "test-token", slog.New(slog.NewTextHandler(io.Discard, nil)))
-	baseTools := ductile.BuildTools(client, []string{"alpha/one", "beta/two"}, nil)
+	baseTools, err := ductile.BuildTools(client, []string{"alpha/one", "beta/two"}, nil)
+	if err != nil {
+		t.Fatalf("build tools: %v", err)
+	}
 
 	toolMap := make(map[string]tool.InvokableTool, 2)
 	for _, bt := range baseTools {
@@ -148,6 +156,579 @@ func TestRunActStageCanExecuteTwoDuctileTools(t *testing.T) {
 	}
 }
 
+func TestRunActStageAbortsWhenToolTimeBudgetExceeded(t *testing.T) {
+	model := &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{
+				Role: schema.Assistant,
+				ToolCalls: []schema.ToolCall{{
+					ID:       "tc-1",
+					Type:     "function",
+					Function: schema.FunctionCall{Name: "slow", Arguments: `{}`},
+				}},
+			},
+			{Role: schema.Assistant, Content: "should not be reached"},
+		},
+	}
+
+	loop := &Loop{
+		cfg: config.AgentConfig{
+			MaxActRounds:      3,
+			MaxRetryPerStep:   1,
+			MaxToolTimePerRun: 20 * time.Millisecond,
+		},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	result, err := loop.runActStage(context.Background(), &preparedToolset{
+		model:  model,
+		byName: map[string]tool.InvokableTool{"slow": &sleepTool{delay: time.Second}},
+	}, "prompt")
+	if !errors.Is(err, ErrToolTimeBudgetExceeded) {
+		t.Fatalf("expected ErrToolTimeBudgetExceeded, got %v", err)
+	}
+	if result.ToolTime < 20*time.Millisecond {
+		t.Fatalf("expected tool time to be charged, got %v", result.ToolTime)
+	}
+	if result.ToolTime >= time.Second {
+		t.Fatalf("expected tool call to be cut short by the remaining budget, got %v", result.ToolTime)
+	}
+}
+
+func TestRunActStageReturnsToolTimeoutAsObservation(t *testing.T) {
+	model := &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{
+				Role: schema.Assistant,
+				ToolCalls: []schema.ToolCall{{
+					ID:       "tc-1",
+					Type:     "function",
+					Function: schema.FunctionCall{Name: "slow", Arguments: `{}`},
+				}},
+			},
+			{Role: schema.Assistant, Content: "slow tool timed out; moving on"},
+		},
+	}
+
+	loop := &Loop{
+		cfg: config.AgentConfig{
+			MaxActRounds:    3,
+			MaxRetryPerStep: 1,
+			StepTimeout:     time.Minute,
+			ToolTimeouts:    map[string]time.Duration{"slow": 20 * time.Millisecond},
+		},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	result, err := loop.runActStage(context.Background(), &preparedToolset{
+		model:  model,
+		byName: map[string]tool.InvokableTool{"slow": &sleepTool{delay: time.Second}},
+	}, "prompt")
+	if err != nil {
+		t.Fatalf("runActStage: %v", err)
+	}
+	if !strings.Contains(result.Summary, "tool slow timed out after 20ms") {
+		t.Fatalf("expected timeout observation in summary, got:\n%s", result.Summary)
+	}
+	if result.ToolTime >= time.Second {
+		t.Fatalf("expected tool call to be cut short by its timeout, got %v", result.ToolTime)
+	}
+}
+
+func TestRunActStageRepromptsForToolWhenRequired(t *testing.T) {
+	newModel := func() *scriptedToolCallingModel {
+		return &scriptedToolCallingModel{
+			responses: []*schema.Message{
+				{Role: schema.Assistant, Content: "I would run the counting tool."},
+				{
+					Role: schema.Assistant,
+					ToolCalls: []schema.ToolCall{{
+						ID:       "tc-1",
+						Type:     "function",
+						Function: schema.FunctionCall{Name: "counting", Arguments: `{}`},
+					}},
+				},
+				{Role: schema.Assistant, Content: "counted"},
+			},
+		}
+	}
+	run := func(requireTool bool) (actStageResult, *countingTool) {
+		counter := &countingTool{}
+		loop := &Loop{
+			cfg: config.AgentConfig{
+				MaxActRounds:    4,
+				MaxRetryPerStep: 1,
+				ActRequiresTool: requireTool,
+			},
+			logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		}
+		result, err := loop.runActStage(context.Background(), &preparedToolset{
+			model:  newModel(),
+			byName: map[string]tool.InvokableTool{"counting": counter},
+		}, "prompt")
+		if err != nil {
+			t.Fatalf("runActStage: %v", err)
+		}
+		return result, counter
+	}
+
+	result, counter := run(false)
+	if counter.calls != 0 || result.Summary != "I would run the counting tool." {
+		t.Fatalf("without act_requires_tool: calls=%d summary=%q", counter.calls, result.Summary)
+	}
+
+	result, counter = run(true)
+	if counter.calls != 1 {
+		t.Fatalf("expected the re-prompt to produce one tool call, got %d", counter.calls)
+	}
+	if !strings.HasSuffix(result.Summary, "counted") || strings.Contains(result.Summary, "I would run") {
+		t.Fatalf("summary = %q, want the post-tool reply only", result.Summary)
+	}
+}
+
+func TestRunActStageAppendsAssistantRoundsToLoopMemory(t *testing.T) {
+	model := &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{
+				Role:    schema.Assistant,
+				Content: "Checking the queue before acting.",
+				ToolCalls: []schema.ToolCall{{
+					ID:       "tc-1",
+					Type:     "function",
+					Function: schema.FunctionCall{Name: "slow", Arguments: `{}`},
+				}},
+			},
+			{Role: schema.Assistant, Content: "Queue is empty; nothing else to do."},
+		},
+	}
+
+	ws, err := NewWorkspace(t.TempDir(), "run-transcript")
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+	loop := &Loop{
+		cfg:    config.AgentConfig{MaxActRounds: 3, MaxRetryPerStep: 1},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		ws:     ws,
+	}
+
+	if _, err := loop.runActStage(context.Background(), &preparedToolset{
+		model:  model,
+		byName: map[string]tool.InvokableTool{"slow": &sleepTool{}},
+	}, "prompt"); err != nil {
+		t.Fatalf("runActStage: %v", err)
+	}
+
+	memory := ws.ReadLoopMemory()
+	first := strings.Index(memory, "assistant (round 1)\nChecking the queue before acting.")
+	second := strings.Index(memory, "assistant (round 2)\nQueue is empty; nothing else to do.")
+	if first < 0 || second < 0 || second < first {
+		t.Fatalf("expected round-tagged assistant entries in order, got:\n%s", memory)
+	}
+}
+
+func TestRunActStageWritesLLMTraceWhenEnabled(t *testing.T) {
+	model := &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{
+				Role: schema.Assistant,
+				ToolCalls: []schema.ToolCall{{
+					ID:       "tc-1",
+					Type:     "function",
+					Function: schema.FunctionCall{Name: "slow", Arguments: `{}`},
+				}},
+			},
+			{Role: schema.Assistant, Content: "Done with token sk-live-123."},
+		},
+	}
+
+	ws, err := NewWorkspace(t.TempDir(), "run-trace")
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+	loop := &Loop{
+		cfg:       config.AgentConfig{MaxActRounds: 3, MaxRetryPerStep: 1, DebugCaptureLLM: true},
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		ws:        ws,
+		redactor:  NewRedactor([]string{`sk-live-\w+`}),
+		iteration: 2,
+	}
+
+	if _, err := loop.runActStage(context.Background(), &preparedToolset{
+		model:  model,
+		byName: map[string]tool.InvokableTool{"slow": &sleepTool{}},
+	}, "act prompt"); err != nil {
+		t.Fatalf("runActStage: %v", err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(ws.Dir(), LLMTraceFile))
+	if err != nil {
+		t.Fatalf("read llm trace: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one trace line per Generate call, got %d:\n%s", len(lines), raw)
+	}
+	var first, second LLMTraceEntry
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("decode trace line: %v", err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatalf("decode trace line: %v", err)
+	}
+	if first.Iteration != 2 || first.Phase != "act" || first.StartedAt == "" || len(first.Messages) != 2 || first.Messages[0].Content != "act prompt" {
+		t.Fatalf("unexpected first trace entry: %+v", first)
+	}
+	if len(second.Messages) != 4 || second.Response == nil || second.Response.Content != "Done with token [REDACTED]." {
+		t.Fatalf("unexpected second trace entry: %s", lines[1])
+	}
+
+	// Capture is off by default.
+	loop.cfg.DebugCaptureLLM = false
+	model.idx = 0
+	if _, err := loop.runActStage(context.Background(), &preparedToolset{
+		model:  model,
+		byName: map[string]tool.InvokableTool{"slow": &sleepTool{}},
+	}, "act prompt"); err != nil {
+		t.Fatalf("runActStage: %v", err)
+	}
+	if again, _ := os.ReadFile(filepath.Join(ws.Dir(), LLMTraceFile)); len(again) != len(raw) {
+		t.Fatalf("trace grew with capture disabled")
+	}
+}
+
+func TestRecordReportsRedactsEvidence(t *testing.T) {
+	model := &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{
+				Role: schema.Assistant,
+				ToolCalls: []schema.ToolCall{{
+					ID:       "tc-1",
+					Type:     "function",
+					Function: schema.FunctionCall{Name: "report_success", Arguments: `{"summary":"deployed with sk-live-abc","evidence":"used key sk-live-def"}`},
+				}},
+			},
+			{Role: schema.Assistant, Content: "done"},
+		},
+	}
+
+	ws, err := NewWorkspace(t.TempDir(), "run-evidence")
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+	loop := &Loop{
+		cfg:      config.AgentConfig{MaxActRounds: 3, MaxRetryPerStep: 1},
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		ws:       ws,
+		redactor: NewRedactor([]string{`sk-live-\w+`}),
+	}
+
+	result, err := loop.runActStage(context.Background(), &preparedToolset{
+		model:  model,
+		byName: map[string]tool.InvokableTool{"report_success": &countingTool{}},
+	}, "act prompt")
+	if err != nil {
+		t.Fatalf("runActStage: %v", err)
+	}
+	var state stageState
+	loop.recordReports("run-evidence", 1, ws, result, &state)
+
+	md, err := os.ReadFile(filepath.Join(ws.Dir(), EvidenceMarkdownFile))
+	if err != nil {
+		t.Fatalf("read evidence.md: %v", err)
+	}
+	if strings.Contains(string(md), "sk-live-") {
+		t.Fatalf("evidence.md leaked a secret:\n%s", md)
+	}
+	if !strings.Contains(string(md), "deployed with [REDACTED]") || !strings.Contains(string(md), "used key [REDACTED]") {
+		t.Fatalf("expected redacted summary and evidence, got:\n%s", md)
+	}
+}
+
+func TestRunActStageDetectsRepeatedIdenticalActions(t *testing.T) {
+	call := func(id, args string) *schema.Message {
+		return &schema.Message{
+			Role: schema.Assistant,
+			ToolCalls: []schema.ToolCall{{
+				ID:       id,
+				Type:     "function",
+				Function: schema.FunctionCall{Name: "slow", Arguments: args},
+			}},
+		}
+	}
+	loop := &Loop{
+		cfg: config.AgentConfig{
+			MaxActRounds:        10,
+			MaxRetryPerStep:     1,
+			MaxIdenticalActions: 2,
+			StuckLoopThreshold:  4,
+		},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	toolset := func(responses ...*schema.Message) *preparedToolset {
+		return &preparedToolset{
+			model:  &scriptedToolCallingModel{responses: responses},
+			byName: map[string]tool.InvokableTool{"slow": &sleepTool{}},
+		}
+	}
+
+	// Key order and whitespace do not make calls distinct.
+	result, err := loop.runActStage(context.Background(), toolset(
+		call("tc-1", `{"a":1,"b":2}`),
+		call("tc-2", `{"b": 2, "a": 1}`),
+		call("tc-3", `{"a":1,"b":2}`),
+		call("tc-4", `{"a":1,"b":3}`),
+		&schema.Message{Role: schema.Assistant, Content: "done"},
+	), "prompt")
+	if err != nil {
+		t.Fatalf("runActStage: %v", err)
+	}
+	if result.RepeatedActions["slow"] != 3 {
+		t.Fatalf("RepeatedActions = %v, want slow=3", result.RepeatedActions)
+	}
+	if warning := repeatedActionWarning(result.RepeatedActions); !strings.Contains(warning, "slow (3 times)") {
+		t.Fatalf("unexpected warning: %s", warning)
+	}
+
+	// Counts carry across ACT stages; the fifth identical call stops the run.
+	_, err = loop.runActStage(context.Background(), toolset(
+		call("tc-5", `{"a":1,"b":2}`),
+		call("tc-6", `{"a":1,"b":2}`),
+		&schema.Message{Role: schema.Assistant, Content: "should not be reached"},
+	), "prompt")
+	if !errors.Is(err, ErrStuckLoop) {
+		t.Fatalf("expected ErrStuckLoop, got %v", err)
+	}
+	if failureCode(err) != store.FailureCodeStuckLoop {
+		t.Fatalf("failureCode = %q, want %q", failureCode(err), store.FailureCodeStuckLoop)
+	}
+}
+
+func TestRunActStageEnforcesToolPolicy(t *testing.T) {
+	model := &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{
+				Role: schema.Assistant,
+				ToolCalls: []schema.ToolCall{
+					{ID: "tc-1", Type: "function", Function: schema.FunctionCall{Name: "workspace_delete", Arguments: `{"path":"a.txt"}`}},
+					{ID: "tc-2", Type: "function", Function: schema.FunctionCall{Name: "slow", Arguments: `{}`}},
+					{ID: "tc-3", Type: "function", Function: schema.FunctionCall{Name: "report_success", Arguments: `{"summary":"ok","evidence":"e"}`}},
+				},
+			},
+			{Role: schema.Assistant, Content: "done"},
+		},
+	}
+	deleted := &countingTool{}
+	reported := &countingTool{}
+	loop := &Loop{
+		cfg:        config.AgentConfig{MaxActRounds: 3, MaxRetryPerStep: 1},
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		toolPolicy: newToolPolicy([]string{"slow", "workspace_delete"}, []string{"workspace_delete"}),
+	}
+
+	result, err := loop.runActStage(context.Background(), &preparedToolset{
+		model: model,
+		byName: map[string]tool.InvokableTool{
+			"workspace_delete": deleted,
+			"slow":             &sleepTool{},
+			"report_success":   reported,
+		},
+	}, "prompt")
+	if err != nil {
+		t.Fatalf("runActStage: %v", err)
+	}
+	if deleted.calls != 0 {
+		t.Fatalf("denied tool was invoked %d times", deleted.calls)
+	}
+	if reported.calls != 1 || !result.SuccessReported {
+		t.Fatalf("report_success should always be permitted (calls=%d)", reported.calls)
+	}
+	if !strings.Contains(result.Summary, "workspace_delete is not permitted in this run (denied_tools)") {
+		t.Fatalf("expected denial in transcript, got:\n%s", result.Summary)
+	}
+
+	policy := newToolPolicy([]string{"workspace_read"}, nil)
+	if reason := policy.check("workspace_write"); !strings.Contains(reason, "not in allowed_tools") {
+		t.Fatalf("check(workspace_write) = %q", reason)
+	}
+	if reason := policy.check("workspace_read"); reason != "" {
+		t.Fatalf("check(workspace_read) = %q, want permitted", reason)
+	}
+}
+
+func TestRunActStageFlagsExhaustedRounds(t *testing.T) {
+	call := func(id string) *schema.Message {
+		return &schema.Message{Role: schema.Assistant, ToolCalls: []schema.ToolCall{{
+			ID: id, Type: "function", Function: schema.FunctionCall{Name: "counting", Arguments: `{"n":"` + id + `"}`},
+		}}}
+	}
+	counter := &countingTool{}
+	toolset := func(responses ...*schema.Message) *preparedToolset {
+		return &preparedToolset{
+			model:  &scriptedToolCallingModel{responses: responses},
+			byName: map[string]tool.InvokableTool{"counting": counter},
+		}
+	}
+	loop := &Loop{
+		cfg:    config.AgentConfig{MaxActRounds: 2, MaxRetryPerStep: 1, MaxActRoundsCeiling: 5},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	result, err := loop.runActStage(context.Background(), toolset(call("a"), call("b"), call("c")), "prompt")
+	if err != nil {
+		t.Fatalf("runActStage: %v", err)
+	}
+	if !result.Truncated || counter.calls != 2 {
+		t.Fatalf("expected truncation after 2 rounds, got truncated=%v calls=%d", result.Truncated, counter.calls)
+	}
+
+	// A plan override raises the limit for one stage, capped at the ceiling.
+	loop.actRounds = loop.planActRounds("1. fetch every page\n2. summarize\n\nact_rounds: 50")
+	if loop.actRounds != 5 {
+		t.Fatalf("planActRounds = %d, want ceiling 5", loop.actRounds)
+	}
+	counter.calls = 0
+	result, err = loop.runActStage(context.Background(), toolset(call("a"), call("b"), call("c"), &schema.Message{Role: schema.Assistant, Content: "done"}), "prompt")
+	if err != nil {
+		t.Fatalf("runActStage: %v", err)
+	}
+	if result.Truncated || counter.calls != 3 {
+		t.Fatalf("expected the stage to finish within the override, got truncated=%v calls=%d", result.Truncated, counter.calls)
+	}
+}
+
+func TestRunActStageWrapsObservationsInEnvelope(t *testing.T) {
+	call := func(id, name string) schema.ToolCall {
+		return schema.ToolCall{ID: id, Type: "function", Function: schema.FunctionCall{Name: name, Arguments: `{}`}}
+	}
+	model := &messageRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{Role: schema.Assistant, ToolCalls: []schema.ToolCall{
+				call("tc-1", "read_file"),
+				call("tc-2", "ductile_fetch"),
+				call("tc-3", "get_subrun"),
+				call("tc-4", "missing_tool"),
+			}},
+			{Role: schema.Assistant, Content: "done"},
+		},
+	}}
+
+	ws, err := NewWorkspace(t.TempDir(), "run-envelope")
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+	loop := &Loop{
+		cfg:    config.AgentConfig{MaxActRounds: 3, MaxRetryPerStep: 1, ObservationEnvelope: true},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		ws:     ws,
+	}
+	if _, err := loop.runActStage(context.Background(), &preparedToolset{
+		model: model,
+		byName: map[string]tool.InvokableTool{
+			"read_file":     &fixedOutputTool{out: `{"status":"ok","content":"hello"}`},
+			"ductile_fetch": &fixedOutputTool{out: `{"status":"failed","job_id":"job-1","error":"job did not succeed"}`},
+			"get_subrun":    &fixedOutputTool{out: `{"status":"ok","run_status":"failed","error":"child gave up"}`},
+		},
+	}, "prompt"); err != nil {
+		t.Fatalf("runActStage: %v", err)
+	}
+
+	var got []string
+	for _, msg := range model.inputs[len(model.inputs)-1] {
+		if msg.Role == schema.Tool {
+			got = append(got, msg.Content)
+		}
+	}
+	want := []string{
+		`{"ok":true,"tool":"read_file","result":{"status":"ok","content":"hello"}}`,
+		`{"ok":false,"tool":"ductile_fetch","error":{"status":"failed","job_id":"job-1","error":"job did not succeed"}}`,
+		`{"ok":true,"tool":"get_subrun","result":{"status":"ok","run_status":"failed","error":"child gave up"}}`,
+		`{"ok":false,"tool":"missing_tool","error":"unknown tool: missing_tool"}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("tool messages:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPlanActRounds(t *testing.T) {
+	loop := &Loop{cfg: config.AgentConfig{MaxActRoundsCeiling: 12}}
+	for plan, want := range map[string]int{
+		"1. do the thing":                        0,
+		"1. do the thing\nact_rounds: 8":         8,
+		"1. first\n**act_rounds**: 10\n":         10,
+		"ACT_ROUNDS: 3\n1. later\nact_rounds: 4": 4,
+		"act_rounds: 0":                          0,
+		"Set act_rounds: 8 if needed":            0,
+	} {
+		if got := loop.planActRounds(plan); got != want {
+			t.Fatalf("planActRounds(%q) = %d, want %d", plan, got, want)
+		}
+	}
+	loop.cfg.MaxActRoundsCeiling = 0
+	if got := loop.planActRounds("act_rounds: 8"); got != 0 {
+		t.Fatalf("expected overrides to be off without a ceiling, got %d", got)
+	}
+}
+
+// countingTool records how many times it was invoked.
+type countingTool struct {
+	calls int
+}
+
+func (c *countingTool) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: "counting"}, nil
+}
+
+func (c *countingTool) InvokableRun(_ context.Context, _ string, _ ...tool.Option) (string, error) {
+	c.calls++
+	return `{"status":"ok"}`, nil
+}
+
+// sleepTool blocks for delay or until its context is cancelled.
+type sleepTool struct {
+	delay time.Duration
+}
+
+func (s *sleepTool) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: "slow"}, nil
+}
+
+func (s *sleepTool) InvokableRun(ctx context.Context, _ string, _ ...tool.Option) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-time.After(s.delay):
+		return `{"status":"ok"}`, nil
+	}
+}
+
+type fixedOutputTool struct {
+	out string
+}
+
+func (f *fixedOutputTool) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: "fixed"}, nil
+}
+
+func (f *fixedOutputTool) InvokableRun(_ context.Context, _ string, _ ...tool.Option) (string, error) {
+	return f.out, nil
+}
+
+// messageRecordingModel records the messages of every call.
+type messageRecordingModel struct {
+	*scriptedToolCallingModel
+	inputs [][]*schema.Message
+}
+
+func (m *messageRecordingModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	m.inputs = append(m.inputs, slices.Clone(input))
+	return m.scriptedToolCallingModel.Generate(ctx, input, opts...)
+}
+
+func (m *messageRecordingModel) WithTools(_ []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
 type scriptedToolCallingModel struct {
 	responses []*schema.Message
 	idx       int
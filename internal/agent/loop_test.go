@@ -2,13 +2,22 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/mattjoyce/agenticloop/internal/config"
+	"github.com/mattjoyce/agenticloop/internal/localtools"
 	"github.com/mattjoyce/agenticloop/internal/storage"
 	"github.com/mattjoyce/agenticloop/internal/store"
 )
@@ -41,3 +50,1316 @@ func TestFailRunReportsStatusPersistenceFailure(t *testing.T) {
 		t.Fatalf("expected persistence failure detail, got %q", gotErr.Error())
 	}
 }
+
+func TestExecuteRunsObserveStageWhenConfigured(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "agenticloop.db")
+	db, err := storage.OpenSQLite(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	run, _, err := runStore.Create(ctx, "observe goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	chatModel := &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{Role: schema.Assistant, Content: `{"todo":[],"evidence":[],"notes":[]}`},
+			{Role: schema.Assistant, Content: "1. report success"},
+			{
+				Role: schema.Assistant,
+				ToolCalls: []schema.ToolCall{{
+					ID:   "tc-1",
+					Type: "function",
+					Function: schema.FunctionCall{
+						Name:      "report_success",
+						Arguments: `{"summary":"all done","evidence":"checked"}`,
+					},
+				}},
+			},
+			{Role: schema.Assistant, Content: "reported success"},
+			{Role: schema.Assistant, Content: `{"tool_results":"report_success accepted"}`},
+			{Role: schema.Assistant, Content: `{"next_stage":"done","summary":"finished"}`},
+		},
+	}
+
+	loop := NewLoop(chatModel, localtools.BuildDefaultTools(localtools.SysToolsConfig{}), config.AgentConfig{
+		DefaultMaxLoops: 2,
+		DefaultDeadline: time.Minute,
+		MaxActRounds:    3,
+		MaxRetryPerStep: 1,
+		WorkspaceDir:    t.TempDir(),
+		Prompts: config.AgentPrompts{
+			Frame:   "frame",
+			Plan:    "plan",
+			Act:     "act",
+			Observe: "observe {{.Act}}",
+			Reflect: "reflect {{.Observe}}",
+		},
+	}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := loop.Execute(ctx, run, ""); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	steps, err := stepStore.GetByRunID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get steps: %v", err)
+	}
+	var phases []string
+	for _, step := range steps {
+		phases = append(phases, string(step.Phase))
+	}
+	want := "frame,plan,act,observe,reflect,done"
+	if got := strings.Join(phases, ","); got != want {
+		t.Fatalf("phases = %s, want %s", got, want)
+	}
+}
+
+func TestExecuteFinalizesWhenReflectIsDoneWithoutReport(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	run, _, err := runStore.Create(ctx, "finalize goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	chatModel := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{Role: schema.Assistant, Content: `{"todo":[]}`},
+			{Role: schema.Assistant, Content: "1. write the report"},
+			{Role: schema.Assistant, Content: "Wrote the report."},
+			{Role: schema.Assistant, Content: `{"next_stage":"done","summary":"report is written"}`},
+			{Role: schema.Assistant, ToolCalls: []schema.ToolCall{{
+				ID:       "tc-1",
+				Type:     "function",
+				Function: schema.FunctionCall{Name: "report_success", Arguments: `{"summary":"report written","evidence":"report.md"}`},
+			}}},
+			{Role: schema.Assistant, Content: "Reported."},
+		},
+	}}
+
+	loop := NewLoop(chatModel, localtools.BuildDefaultTools(localtools.SysToolsConfig{}), config.AgentConfig{
+		DefaultMaxLoops: 2,
+		DefaultDeadline: time.Minute,
+		MaxActRounds:    3,
+		MaxRetryPerStep: 1,
+		FinalizeRounds:  2,
+		WorkspaceDir:    t.TempDir(),
+		Prompts: config.AgentPrompts{
+			Frame:   "frame",
+			Plan:    "plan",
+			Act:     "act",
+			Reflect: "reflect",
+		},
+	}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := loop.Execute(ctx, run, ""); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	steps, err := stepStore.GetByRunID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get steps: %v", err)
+	}
+	var phases []string
+	for _, step := range steps {
+		phases = append(phases, string(step.Phase))
+	}
+	if got, want := strings.Join(phases, ","), "frame,plan,act,reflect,act,done"; got != want {
+		t.Fatalf("phases = %s, want %s", got, want)
+	}
+	finalize := chatModel.prompts[4]
+	if !strings.Contains(finalize, finalizeDirective) || !strings.Contains(finalize, "report is written") {
+		t.Fatalf("finalize prompt = %q, want the directive and reflection summary", finalize)
+	}
+	got, err := runStore.GetByID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got.Status != store.RunStatusDone || got.Summary == nil || *got.Summary != "report is written" {
+		t.Fatalf("run = status %s, summary %v", got.Status, got.Summary)
+	}
+}
+
+func TestExecuteCarriesUnreportedFinalizeOutputForward(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "finalize goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	chatModel := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{Role: schema.Assistant, Content: `{"todo":[]}`},
+			{Role: schema.Assistant, Content: "1. write the report"},
+			{Role: schema.Assistant, Content: "Wrote the report."},
+			{Role: schema.Assistant, Content: `{"next_stage":"done","summary":"report is written"}`},
+			{Role: schema.Assistant, Content: "The benchmark numbers are still missing."},
+		},
+	}}
+
+	loop := NewLoop(chatModel, localtools.BuildDefaultTools(localtools.SysToolsConfig{}), config.AgentConfig{
+		DefaultMaxLoops: 2,
+		DefaultDeadline: time.Minute,
+		MaxActRounds:    3,
+		MaxRetryPerStep: 1,
+		FinalizeRounds:  2,
+		WorkspaceDir:    t.TempDir(),
+		Prompts: config.AgentPrompts{
+			Frame:   "frame {{.Act}}",
+			Plan:    "plan",
+			Act:     "act",
+			Reflect: "reflect",
+		},
+	}, runStore, store.NewStepStore(db), nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// The script runs out in iteration 2, after its FRAME prompt is rendered.
+	_ = loop.Execute(ctx, run, "")
+	if len(chatModel.prompts) < 6 {
+		t.Fatalf("expected a second iteration, got prompts %q", chatModel.prompts)
+	}
+	if frame := chatModel.prompts[5]; !strings.Contains(frame, "benchmark numbers are still missing") {
+		t.Fatalf("iteration 2 frame prompt = %q, want the finalize output", frame)
+	}
+}
+
+func TestExecuteRequeuesRunOnShutdown(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	run, _, err := runStore.Create(ctx, "shutdown goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if _, err := runStore.IncrementRecoveryAttempts(ctx, run.ID); err != nil {
+		t.Fatalf("increment recovery attempts: %v", err)
+	}
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	chatModel := &shutdownModel{cancel: cancel}
+
+	loop := NewLoop(chatModel, nil, config.AgentConfig{
+		DefaultMaxLoops: 2,
+		DefaultDeadline: time.Minute,
+		MaxActRounds:    3,
+		MaxRetryPerStep: 1,
+		WorkspaceDir:    t.TempDir(),
+		Prompts:         config.AgentPrompts{Frame: "frame", Plan: "plan", Act: "act", Reflect: "reflect"},
+	}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	err = loop.Execute(runCtx, run, "")
+	if !errors.Is(err, ErrRunInterrupted) {
+		t.Fatalf("Execute() error = %v, want ErrRunInterrupted", err)
+	}
+
+	got, err := runStore.GetByID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got.Status != store.RunStatusQueued {
+		t.Fatalf("status = %s, want queued", got.Status)
+	}
+	if got.RecoveryAttempts != 0 {
+		t.Fatalf("recovery_attempts = %d, want 0", got.RecoveryAttempts)
+	}
+
+	steps, err := stepStore.GetByRunID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get steps: %v", err)
+	}
+	if len(steps) != 2 {
+		t.Fatalf("steps = %d, want 2", len(steps))
+	}
+	if steps[0].Status != store.StepStatusOK {
+		t.Fatalf("frame step status = %s, want ok", steps[0].Status)
+	}
+	if steps[1].Status != store.StepStatusError || steps[1].Error == nil || *steps[1].Error != "interrupted by shutdown" {
+		t.Fatalf("plan step = %s %v, want error interrupted by shutdown", steps[1].Status, steps[1].Error)
+	}
+}
+
+func TestExecuteFailsRunOnDeadline(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	run, _, err := runStore.Create(ctx, "deadline goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	loop := NewLoop(&shutdownModel{}, nil, config.AgentConfig{
+		DefaultMaxLoops: 2,
+		DefaultDeadline: 50 * time.Millisecond,
+		MaxActRounds:    3,
+		MaxRetryPerStep: 1,
+		WorkspaceDir:    t.TempDir(),
+		Prompts:         config.AgentPrompts{Frame: "frame", Plan: "plan", Act: "act", Reflect: "reflect"},
+	}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	err = loop.Execute(ctx, run, "")
+	if err == nil || errors.Is(err, ErrRunInterrupted) {
+		t.Fatalf("Execute() error = %v, want deadline failure", err)
+	}
+	got, err := runStore.GetByID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got.Status != store.RunStatusFailed {
+		t.Fatalf("status = %s, want failed", got.Status)
+	}
+}
+
+// shutdownModel answers the first Generate call, then blocks on the second.
+// When cancel is set it cancels the run context with ErrShutdown first.
+type shutdownModel struct {
+	cancel context.CancelCauseFunc
+	calls  int
+}
+
+func (m *shutdownModel) Generate(ctx context.Context, _ []*schema.Message, _ ...model.Option) (*schema.Message, error) {
+	m.calls++
+	if m.calls == 1 {
+		return &schema.Message{Role: schema.Assistant, Content: `{"todo":[]}`}, nil
+	}
+	if m.cancel != nil {
+		m.cancel(ErrShutdown)
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (m *shutdownModel) Stream(_ context.Context, _ []*schema.Message, _ ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	return nil, errors.New("stream not implemented")
+}
+
+func (m *shutdownModel) WithTools(_ []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+func TestExecuteExposesFinalIterationToPrompts(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	run, _, err := runStore.Create(ctx, "bounded goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	chatModel := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{Role: schema.Assistant, Content: `{"todo":[]}`},
+			{Role: schema.Assistant, Content: "1. act"},
+			{Role: schema.Assistant, Content: "acted once"},
+			{Role: schema.Assistant, Content: `{"next_stage":"act"}`},
+			{Role: schema.Assistant, Content: "acted twice"},
+			{Role: schema.Assistant, Content: `{"next_stage":"act"}`},
+		},
+	}}
+
+	loop := NewLoop(chatModel, nil, config.AgentConfig{
+		DefaultMaxLoops:       2,
+		DefaultDeadline:       time.Minute,
+		MaxActRounds:          3,
+		MaxRetryPerStep:       1,
+		WorkspaceDir:          t.TempDir(),
+		FinalIterationMessage: "wrap up now",
+		Prompts: config.AgentPrompts{
+			Frame:   "frame",
+			Plan:    "plan",
+			Act:     "act {{.Iteration}}{{if .FinalIteration}} final: {{.GraceMessage}}{{end}}",
+			Reflect: "reflect {{.Iteration}}{{if .FinalIteration}} final: {{.GraceMessage}}{{end}}",
+		},
+	}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := loop.Execute(ctx, run, ""); err == nil {
+		t.Fatalf("expected max loops failure without report_success")
+	}
+
+	want := []string{"frame", "plan", "act 1", "reflect 1", "act 2 final: wrap up now", "reflect 2 final: wrap up now"}
+	if got := strings.Join(chatModel.prompts, "|"); got != strings.Join(want, "|") {
+		t.Fatalf("prompts = %q, want %q", chatModel.prompts, want)
+	}
+}
+
+func TestExecutePassesLastReflectionToPlan(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	run, _, err := runStore.Create(ctx, "multi-step goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	chatModel := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{Role: schema.Assistant, Content: `{"todo":[]}`},
+			{Role: schema.Assistant, Content: "1. try the api"},
+			{Role: schema.Assistant, Content: "api is down"},
+			{Role: schema.Assistant, Content: `{"next_stage":"plan","summary":" switch to the cached export "}`},
+			{Role: schema.Assistant, Content: "1. read the export"},
+			{Role: schema.Assistant, Content: "read it"},
+			{Role: schema.Assistant, Content: `{"next_stage":"act"}`},
+		},
+	}}
+
+	loop := NewLoop(chatModel, nil, config.AgentConfig{
+		DefaultMaxLoops: 2,
+		DefaultDeadline: time.Minute,
+		MaxActRounds:    3,
+		MaxRetryPerStep: 1,
+		WorkspaceDir:    t.TempDir(),
+		Prompts: config.AgentPrompts{
+			Frame:   "frame",
+			Plan:    "plan {{.Iteration}}{{if .LastReflection}} last: {{.LastReflection}}{{end}}",
+			Act:     "act {{.Iteration}}",
+			Reflect: "reflect {{.Iteration}}",
+		},
+	}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := loop.Execute(ctx, run, ""); err == nil {
+		t.Fatalf("expected max loops failure without report_success")
+	}
+
+	want := []string{"frame", "plan 1", "act 1", "reflect 1", "plan 2 last: switch to the cached export", "act 2", "reflect 2"}
+	if got := strings.Join(chatModel.prompts, "|"); got != strings.Join(want, "|") {
+		t.Fatalf("prompts = %q, want %q", chatModel.prompts, want)
+	}
+}
+
+// promptRecordingModel records the system prompt of every Generate call.
+type promptRecordingModel struct {
+	*scriptedToolCallingModel
+	prompts []string
+}
+
+func (m *promptRecordingModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	if len(input) > 0 {
+		m.prompts = append(m.prompts, input[0].Content)
+	}
+	return m.scriptedToolCallingModel.Generate(ctx, input, opts...)
+}
+
+func (m *promptRecordingModel) WithTools(_ []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+func TestExecuteResumesFromCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	run, _, err := runStore.Create(ctx, "resumable goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	workspaceDir := t.TempDir()
+	ws, err := NewWorkspace(workspaceDir, run.ID)
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+	if err := ws.WriteCheckpoint(Checkpoint{Iteration: 2, NextStage: "reflect", Plan: "saved plan", Act: "saved act"}); err != nil {
+		t.Fatalf("write checkpoint: %v", err)
+	}
+
+	chatModel := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{Role: schema.Assistant, Content: `{"next_stage":"act"}`},
+			{Role: schema.Assistant, Content: "acted again"},
+			{Role: schema.Assistant, Content: `{"next_stage":"act"}`},
+		},
+	}}
+
+	loop := NewLoop(chatModel, nil, config.AgentConfig{
+		DefaultMaxLoops: 3,
+		DefaultDeadline: time.Minute,
+		MaxActRounds:    3,
+		MaxRetryPerStep: 1,
+		WorkspaceDir:    workspaceDir,
+		Prompts: config.AgentPrompts{
+			Frame:   "frame",
+			Plan:    "plan",
+			Act:     "act {{.Iteration}} {{.Plan}}",
+			Reflect: "reflect {{.Iteration}} {{.Act}}",
+		},
+	}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := loop.Execute(ctx, run, ""); err == nil {
+		t.Fatalf("expected max loops failure without report_success")
+	}
+
+	want := []string{"reflect 2 saved act", "act 3 saved plan", "reflect 3 acted again"}
+	if got := strings.Join(chatModel.prompts, "|"); got != strings.Join(want, "|") {
+		t.Fatalf("prompts = %q, want %q", chatModel.prompts, want)
+	}
+
+	if cp := ws.ReadCheckpoint(); cp != nil {
+		t.Fatalf("checkpoint = %+v, want it removed once the run failed", cp)
+	}
+
+	manifest, err := localtools.ReadWorkspaceManifest(ws.StateDir(), 3)
+	if err != nil {
+		t.Fatalf("expected workspace snapshot for iteration 3: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(localtools.ReplaySnapshotDir(ws.StateDir(), 3), "checkpoint.json"))
+	if err != nil {
+		t.Fatalf("expected replay checkpoint for iteration 3: %v", err)
+	}
+	var replayCP Checkpoint
+	if err := json.Unmarshal(data, &replayCP); err != nil || replayCP.Iteration != 4 || replayCP.NextStage != "act" || replayCP.Act != "acted again" {
+		t.Fatalf("replay checkpoint = %+v (%v), want iteration 4 next_stage act", replayCP, err)
+	}
+	for _, name := range []string{localtools.ManifestDir, localtools.ReplayDir} {
+		if _, err := os.Stat(filepath.Join(ws.Dir(), name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s outside the agent workspace, stat err = %v", name, err)
+		}
+	}
+	for path := range manifest.Files {
+		if isBookkeepingFile(path) {
+			t.Fatalf("snapshot should skip loop bookkeeping files, got %s", path)
+		}
+	}
+}
+
+func TestExecuteExtendsLoopsOnRequest(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	run, _, err := runStore.Create(ctx, "needs more time", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	chatModel := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{Role: schema.Assistant, Content: `{"todo":[]}`},
+			{Role: schema.Assistant, Content: "1. act"},
+			{Role: schema.Assistant, Content: "acted"},
+			{Role: schema.Assistant, Content: `{"next_stage":"act","request_more_loops":5}`},
+			{Role: schema.Assistant, Content: "acted"},
+			{Role: schema.Assistant, Content: `{"next_stage":"act"}`},
+			{Role: schema.Assistant, Content: "acted"},
+			{Role: schema.Assistant, Content: `{"next_stage":"act","request_more_loops":1}`},
+		},
+	}}
+
+	workspaceDir := t.TempDir()
+	loop := NewLoop(chatModel, nil, config.AgentConfig{
+		DefaultMaxLoops:  1,
+		DefaultDeadline:  time.Minute,
+		MaxActRounds:     3,
+		MaxRetryPerStep:  1,
+		MaxLoopExtension: 2,
+		WorkspaceDir:     workspaceDir,
+		Prompts: config.AgentPrompts{
+			Frame:   "frame",
+			Plan:    "plan",
+			Act:     "act {{.Iteration}}/{{.MaxLoops}}",
+			Reflect: "reflect {{.Iteration}}/{{.MaxLoops}} left={{.LoopExtensionLeft}}",
+		},
+	}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := loop.Execute(ctx, run, ""); err == nil {
+		t.Fatalf("expected max loops failure once the extension is used up")
+	}
+
+	want := []string{"frame", "plan", "act 1/1", "reflect 1/1 left=2", "act 2/3", "reflect 2/3 left=0", "act 3/3", "reflect 3/3 left=0"}
+	if got := strings.Join(chatModel.prompts, "|"); got != strings.Join(want, "|") {
+		t.Fatalf("prompts = %q, want %q", chatModel.prompts, want)
+	}
+
+	ws, err := NewWorkspace(workspaceDir, run.ID)
+	if err != nil {
+		t.Fatalf("open workspace: %v", err)
+	}
+	if memory := ws.ReadRunMemory(); !strings.Contains(memory, "Loop budget extended by 2 (requested 5): max_loops is now 3.") {
+		t.Fatalf("expected extension note in run memory, got:\n%s", memory)
+	}
+}
+
+func TestExecuteSummarizesCompletedRunWhenConfigured(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	run, _, err := runStore.Create(ctx, "summarize goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	chatModel := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{Role: schema.Assistant, Content: `{"todo":[]}`},
+			{Role: schema.Assistant, Content: "1. report success"},
+			{
+				Role: schema.Assistant,
+				ToolCalls: []schema.ToolCall{{
+					ID:   "tc-1",
+					Type: "function",
+					Function: schema.FunctionCall{
+						Name:      "report_success",
+						Arguments: `{"summary":"all done","evidence":"checked the logs"}`,
+					},
+				}},
+			},
+			{Role: schema.Assistant, Content: "reported success"},
+			{Role: schema.Assistant, Content: `{"next_stage":"done","summary":"finished"}`},
+			{Role: schema.Assistant, Content: "The task is complete and verified."},
+		},
+	}}
+
+	loop := NewLoop(chatModel, localtools.BuildDefaultTools(localtools.SysToolsConfig{}), config.AgentConfig{
+		DefaultMaxLoops: 1,
+		DefaultDeadline: time.Minute,
+		MaxActRounds:    3,
+		MaxRetryPerStep: 1,
+		WorkspaceDir:    t.TempDir(),
+		Prompts: config.AgentPrompts{
+			Frame:     "frame",
+			Plan:      "plan",
+			Act:       "act",
+			Reflect:   "reflect",
+			Summarize: "summarize {{.Goal}} | {{.Summary}} | {{.Evidence}}",
+		},
+	}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := loop.Execute(ctx, run, ""); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	last := chatModel.prompts[len(chatModel.prompts)-1]
+	if !strings.HasPrefix(last, "summarize summarize goal | finished | ") || !strings.Contains(last, "checked the logs") {
+		t.Fatalf("unexpected summarize prompt: %q", last)
+	}
+
+	got, err := runStore.GetByID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got.Summary == nil || *got.Summary != "The task is complete and verified." {
+		t.Fatalf("summary = %v, want summarize output", got.Summary)
+	}
+
+	steps, err := stepStore.GetByRunID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get steps: %v", err)
+	}
+	var phases []string
+	for _, step := range steps {
+		phases = append(phases, string(step.Phase))
+	}
+	if want := "frame,plan,act,reflect,summarize,done"; strings.Join(phases, ",") != want {
+		t.Fatalf("phases = %s, want %s", strings.Join(phases, ","), want)
+	}
+}
+
+func TestExecuteDefersDoneUntilMinIterations(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	run, _, err := runStore.Create(ctx, "verify twice", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	chatModel := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{Role: schema.Assistant, Content: `{"todo":[]}`},
+			{Role: schema.Assistant, Content: "1. report success"},
+			{
+				Role: schema.Assistant,
+				ToolCalls: []schema.ToolCall{{
+					ID:   "tc-1",
+					Type: "function",
+					Function: schema.FunctionCall{
+						Name:      "report_success",
+						Arguments: `{"summary":"done early","evidence":"none yet"}`,
+					},
+				}},
+			},
+			{Role: schema.Assistant, Content: "reported"},
+			{Role: schema.Assistant, Content: `{"next_stage":"done","summary":"early"}`},
+			{Role: schema.Assistant, Content: "1. verify"},
+			{Role: schema.Assistant, Content: "verified"},
+			{Role: schema.Assistant, Content: `{"next_stage":"done","summary":"verified"}`},
+		},
+	}}
+
+	loop := NewLoop(chatModel, localtools.BuildDefaultTools(localtools.SysToolsConfig{}), config.AgentConfig{
+		DefaultMaxLoops: 3,
+		DefaultDeadline: time.Minute,
+		MaxActRounds:    3,
+		MaxRetryPerStep: 1,
+		MinIterations:   2,
+		WorkspaceDir:    t.TempDir(),
+		Prompts: config.AgentPrompts{
+			Frame:   "frame",
+			Plan:    "plan {{.Iteration}} {{.NextFocus}}",
+			Act:     "act",
+			Reflect: "reflect {{.Iteration}}",
+		},
+	}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := loop.Execute(ctx, run, ""); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if len(chatModel.prompts) != 8 || !strings.HasPrefix(chatModel.prompts[5], "plan 2 Completion is not accepted before iteration 2.") {
+		t.Fatalf("expected a second iteration starting at plan, got %q", chatModel.prompts)
+	}
+	got, err := runStore.GetByID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got.Status != store.RunStatusDone || got.Summary == nil || *got.Summary != "verified" {
+		t.Fatalf("run = %s %v, want done with summary verified", got.Status, got.Summary)
+	}
+}
+
+func TestExecuteRequiresReflectEvidenceRefsForDone(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	run, _, err := runStore.Create(ctx, "write a report", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	chatModel := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{Role: schema.Assistant, Content: `{"todo":[]}`},
+			{Role: schema.Assistant, Content: "1. write report"},
+			{
+				Role: schema.Assistant,
+				ToolCalls: []schema.ToolCall{
+					{ID: "tc-1", Type: "function", Function: schema.FunctionCall{Name: "workspace_write", Arguments: `{"path":"report.md","content":"all good"}`}},
+					{ID: "tc-2", Type: "function", Function: schema.FunctionCall{Name: "report_success", Arguments: `{"summary":"report written","evidence":"report.md"}`}},
+				},
+			},
+			{Role: schema.Assistant, Content: "written"},
+			{Role: schema.Assistant, Content: `{"next_stage":"done","summary":"unproven","evidence_refs":["missing.md"]}`},
+			{Role: schema.Assistant, Content: "1. cite evidence"},
+			{Role: schema.Assistant, Content: "nothing more to do"},
+			{Role: schema.Assistant, Content: `{"next_stage":"done","summary":"proven","evidence_refs":["report.md", 3]}`},
+		},
+	}}
+
+	loop := NewLoop(chatModel, localtools.BuildDefaultTools(localtools.SysToolsConfig{}), config.AgentConfig{
+		DefaultMaxLoops:        3,
+		DefaultDeadline:        time.Minute,
+		MaxActRounds:           3,
+		MaxRetryPerStep:        1,
+		RequireReflectEvidence: true,
+		WorkspaceDir:           t.TempDir(),
+		Prompts: config.AgentPrompts{
+			Frame:   "frame",
+			Plan:    "plan {{.Iteration}} {{.NextFocus}}",
+			Act:     "act",
+			Reflect: "reflect {{.Iteration}} refs={{.RequireEvidenceRefs}}",
+		},
+	}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := loop.Execute(ctx, run, ""); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	if len(chatModel.prompts) != 8 || !strings.HasPrefix(chatModel.prompts[5], "plan 2 Completion is not accepted: evidence_refs not found: missing.md.") {
+		t.Fatalf("expected a second iteration asking for evidence, got %q", chatModel.prompts)
+	}
+	if chatModel.prompts[4] != "reflect 1 refs=true" {
+		t.Fatalf("reflect prompt = %q, want RequireEvidenceRefs exposed", chatModel.prompts[4])
+	}
+	got, err := runStore.GetByID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got.Status != store.RunStatusDone || got.Summary == nil || *got.Summary != "proven" {
+		t.Fatalf("run = %s %v, want done with summary proven", got.Status, got.Summary)
+	}
+}
+
+func TestCheckEvidenceRefs(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir(), "run-refs")
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(ws.Dir(), "report.md"), []byte("ok"), 0o644); err != nil {
+		t.Fatalf("seed file: %v", err)
+	}
+
+	d := parseReflectDecision(`{"next_stage":"done","evidence_refs":["report.md", 4, " ", "step:2"]}`)
+	if got := strings.Join(d.EvidenceRefs, ","); got != "report.md,step:4,step:2" {
+		t.Fatalf("evidence_refs = %q", got)
+	}
+	if problem := checkEvidenceRefs(d.EvidenceRefs, ws, 4); problem != "" {
+		t.Fatalf("valid refs rejected: %s", problem)
+	}
+	cases := map[string][]string{
+		"evidence_refs is missing":       nil,
+		"not found: step:9":              {"step:9"},
+		"not found: ../escape.md":        {"report.md", "../escape.md"},
+		"not found: /etc/passwd":         {"/etc/passwd"},
+		"not found: notes.md, step:zero": {"notes.md", "step:zero"},
+		"not evidence: ./state.json":     {"report.md", "./state.json"},
+		"not evidence: run_memory.md":    {"run_memory.md"},
+	}
+	for want, refs := range cases {
+		if problem := checkEvidenceRefs(refs, ws, 4); !strings.Contains(problem, want) {
+			t.Fatalf("refs %v: problem = %q, want %q", refs, problem, want)
+		}
+	}
+}
+
+func TestExecuteSkipsInitialPlan(t *testing.T) {
+	tests := []struct {
+		name           string
+		allowEmptyPlan bool
+		frame          string
+		constraints    json.RawMessage
+		wantSkip       bool
+	}{
+		{"frame flag", true, `{"todo":[],"immediately_actionable":true}`, nil, true},
+		{"frame flag without config", false, `{"todo":[],"immediately_actionable":true}`, nil, false},
+		{"constraint", false, `{"todo":[]}`, json.RawMessage(`{"skip_initial_plan":true}`), true},
+		{"neither", true, `{"todo":[]}`, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+			if err != nil {
+				t.Fatalf("open sqlite: %v", err)
+			}
+			t.Cleanup(func() { _ = db.Close() })
+
+			runStore := store.NewRunStore(db)
+			stepStore := store.NewStepStore(db)
+			run, _, err := runStore.Create(ctx, "say hello", nil, nil, tt.constraints, nil, 0)
+			if err != nil {
+				t.Fatalf("create run: %v", err)
+			}
+
+			responses := []*schema.Message{{Role: schema.Assistant, Content: tt.frame}}
+			if !tt.wantSkip {
+				responses = append(responses, &schema.Message{Role: schema.Assistant, Content: "1. say hello"})
+			}
+			responses = append(responses,
+				&schema.Message{
+					Role: schema.Assistant,
+					ToolCalls: []schema.ToolCall{
+						{ID: "tc-1", Type: "function", Function: schema.FunctionCall{Name: "report_success", Arguments: `{"summary":"hello","evidence":"said"}`}},
+					},
+				},
+				&schema.Message{Role: schema.Assistant, Content: "said hello"},
+				&schema.Message{Role: schema.Assistant, Content: `{"next_stage":"done","summary":"hello"}`},
+			)
+			chatModel := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{responses: responses}}
+
+			loop := NewLoop(chatModel, localtools.BuildDefaultTools(localtools.SysToolsConfig{}), config.AgentConfig{
+				DefaultMaxLoops: 1,
+				DefaultDeadline: time.Minute,
+				MaxActRounds:    3,
+				MaxRetryPerStep: 1,
+				AllowEmptyPlan:  tt.allowEmptyPlan,
+				WorkspaceDir:    t.TempDir(),
+				Prompts: config.AgentPrompts{
+					Frame:   "frame allow={{.AllowEmptyPlan}}",
+					Plan:    "plan",
+					Act:     "act plan=[{{.Plan}}]",
+					Reflect: "reflect",
+				},
+			}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			if err := loop.Execute(ctx, run, ""); err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+
+			if want := fmt.Sprintf("frame allow=%t", tt.allowEmptyPlan); chatModel.prompts[0] != want {
+				t.Fatalf("frame prompt = %q, want %q", chatModel.prompts[0], want)
+			}
+			wantAct := "act plan=[1. say hello]"
+			if tt.wantSkip {
+				wantAct = "act plan=[]"
+			}
+			if chatModel.prompts[1] != wantAct && chatModel.prompts[2] != wantAct {
+				t.Fatalf("prompts = %q, want act prompt %q", chatModel.prompts, wantAct)
+			}
+			if planned := slices.Contains(chatModel.prompts, "plan"); planned == tt.wantSkip {
+				t.Fatalf("plan stage ran = %v, want %v (prompts %q)", planned, !tt.wantSkip, chatModel.prompts)
+			}
+			got, err := runStore.GetByID(ctx, run.ID)
+			if err != nil {
+				t.Fatalf("get run: %v", err)
+			}
+			if got.Status != store.RunStatusDone {
+				t.Fatalf("run status = %s, want done", got.Status)
+			}
+		})
+	}
+}
+
+func TestExecuteFailsRunPastMaxStepsPerRun(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	run, _, err := runStore.Create(ctx, "too many steps", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	chatModel := &scriptedToolCallingModel{
+		responses: []*schema.Message{
+			{Role: schema.Assistant, Content: `{"todo":[]}`},
+			{Role: schema.Assistant, Content: "1. act"},
+			{Role: schema.Assistant, Content: "acted"},
+		},
+	}
+	loop := NewLoop(chatModel, nil, config.AgentConfig{
+		DefaultMaxLoops: 5,
+		DefaultDeadline: time.Minute,
+		MaxActRounds:    3,
+		MaxRetryPerStep: 1,
+		MaxStepsPerRun:  3,
+		WorkspaceDir:    t.TempDir(),
+		Prompts:         config.AgentPrompts{Frame: "frame", Plan: "plan", Act: "act", Reflect: "reflect"},
+	}, runStore, stepStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	err = loop.Execute(ctx, run, "")
+	if !errors.Is(err, ErrStepLimitExceeded) {
+		t.Fatalf("Execute() error = %v, want ErrStepLimitExceeded", err)
+	}
+	got, err := runStore.GetByID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got.Status != store.RunStatusFailed || got.FailureCode == nil || *got.FailureCode != store.FailureCodeStepLimit {
+		t.Fatalf("run = %s code %v, want failed with step_limit", got.Status, got.FailureCode)
+	}
+	steps, err := stepStore.GetByRunID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get steps: %v", err)
+	}
+	if len(steps) != 3 {
+		t.Fatalf("expected 3 steps before the limit, got %d", len(steps))
+	}
+}
+
+func TestBuildToolCatalogVerboseListsParameters(t *testing.T) {
+	infos := []*schema.ToolInfo{
+		{
+			Name: "notify",
+			Desc: "Send a notification",
+			ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+				"channel": {Type: schema.String, Desc: "Where to send it", Required: true, Enum: []string{"email", "sms"}},
+				"payload": {Type: schema.Object, SubParams: map[string]*schema.ParameterInfo{
+					"text": {Type: schema.String, Required: true},
+				}},
+				"tags": {Type: schema.Array, ElemInfo: &schema.ParameterInfo{Type: schema.String}},
+			}),
+		},
+		{Name: "ping", Desc: "No arguments"},
+	}
+
+	if got := buildToolCatalog(infos, false); got != "notify — Send a notification\nping — No arguments" {
+		t.Fatalf("compact catalog = %q", got)
+	}
+
+	want := strings.Join([]string{
+		"notify — Send a notification",
+		"  - channel (string, required): Where to send it [one of: email, sms]",
+		"  - payload (object)",
+		"    - text (string, required)",
+		"  - tags (array of string)",
+		"ping — No arguments",
+	}, "\n")
+	if got := buildToolCatalog(infos, true); got != want {
+		t.Fatalf("verbose catalog =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTakeGuidanceMovesInboxIntoPromptState(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "steerable", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	loop := NewLoop(nil, nil, config.AgentConfig{}, runStore, nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ws, err := NewWorkspace(t.TempDir(), run.ID)
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	loop.ws = ws
+
+	state := stageState{}
+	for i, msg := range []string{"skip the staging hosts", "prefer the v2 API"} {
+		if _, err := runStore.AppendMessage(ctx, run.ID, msg); err != nil {
+			t.Fatalf("append message: %v", err)
+		}
+		loop.takeGuidance(ctx, run.ID, i+1, &state)
+	}
+
+	lines := strings.Split(state.UserGuidance, "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "] skip the staging hosts") || !strings.HasSuffix(lines[1], "] prefer the v2 API") {
+		t.Fatalf("UserGuidance = %q", state.UserGuidance)
+	}
+	if memory := ws.ReadRunMemory(); !strings.Contains(memory, "User guidance: prefer the v2 API") {
+		t.Fatalf("run memory missing guidance note: %q", memory)
+	}
+
+	// An empty inbox leaves earlier guidance in place.
+	loop.takeGuidance(ctx, run.ID, 3, &state)
+	if len(strings.Split(state.UserGuidance, "\n")) != 2 {
+		t.Fatalf("UserGuidance changed on empty inbox: %q", state.UserGuidance)
+	}
+}
+
+func TestExecuteShowsToolErrorsToReflect(t *testing.T) {
+	for _, include := range []bool{false, true} {
+		t.Run(fmt.Sprintf("include=%v", include), func(t *testing.T) {
+			ctx := context.Background()
+			db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+			if err != nil {
+				t.Fatalf("open sqlite: %v", err)
+			}
+			t.Cleanup(func() { _ = db.Close() })
+
+			runStore := store.NewRunStore(db)
+			run, _, err := runStore.Create(ctx, "goal", nil, nil, nil, nil, 0)
+			if err != nil {
+				t.Fatalf("create run: %v", err)
+			}
+
+			chatModel := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{
+				responses: []*schema.Message{
+					{Role: schema.Assistant, Content: `{"todo":[]}`},
+					{Role: schema.Assistant, Content: "1. fetch"},
+					{
+						Role: schema.Assistant,
+						ToolCalls: []schema.ToolCall{
+							{ID: "tc-1", Type: "function", Function: schema.FunctionCall{Name: "fetch_page", Arguments: `{}`}},
+						},
+					},
+					{Role: schema.Assistant, Content: "fetch failed"},
+					{Role: schema.Assistant, Content: `{"next_stage":"act"}`},
+				},
+			}}
+
+			loop := NewLoop(chatModel, nil, config.AgentConfig{
+				DefaultMaxLoops:      1,
+				DefaultDeadline:      time.Minute,
+				MaxActRounds:         3,
+				MaxRetryPerStep:      1,
+				WorkspaceDir:         t.TempDir(),
+				ReflectIncludeErrors: include,
+				Prompts: config.AgentPrompts{
+					Frame:   "frame",
+					Plan:    "plan",
+					Act:     "act",
+					Reflect: "reflect{{if .RecentErrors}} errors:\n{{.RecentErrors}}{{end}}",
+				},
+			}, runStore, store.NewStepStore(db), nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			_ = loop.Execute(ctx, run, "")
+
+			want := "reflect"
+			if include {
+				want = "reflect errors:\n- fetch_page: unknown tool: fetch_page"
+			}
+			if got := chatModel.prompts[len(chatModel.prompts)-1]; got != want {
+				t.Fatalf("reflect prompt = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRecentErrorsTextKeepsLastErrors(t *testing.T) {
+	var toolErrors []string
+	for i := 1; i <= maxRecentErrors+2; i++ {
+		toolErrors = append(toolErrors, fmt.Sprintf("tool: error %d", i))
+	}
+	got := recentErrorsText(toolErrors)
+	if !strings.HasPrefix(got, "(2 earlier errors omitted)\n- tool: error 3\n") || !strings.HasSuffix(got, "- tool: error 12") {
+		t.Fatalf("recentErrorsText() = %q", got)
+	}
+	if recentErrorsText(nil) != "" {
+		t.Fatal("recentErrorsText(nil) is not empty")
+	}
+}
+
+func TestExecuteUsesExternalWorkspace(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	runStore := store.NewRunStore(db)
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "repo"), 0o755); err != nil {
+		t.Fatalf("mkdir repo: %v", err)
+	}
+	workspaceDir := t.TempDir()
+	newLoop := func(externalRoot string) *Loop {
+		chatModel := &scriptedToolCallingModel{responses: []*schema.Message{
+			{Role: schema.Assistant, Content: `{"todo":[]}`},
+			{Role: schema.Assistant, Content: "1. finish"},
+			{
+				Role: schema.Assistant,
+				ToolCalls: []schema.ToolCall{
+					{ID: "tc-1", Type: "function", Function: schema.FunctionCall{Name: "report_success", Arguments: `{"summary":"finished","evidence":"none needed"}`}},
+				},
+			},
+			{Role: schema.Assistant, Content: "finished"},
+			{Role: schema.Assistant, Content: `{"next_stage":"done","summary":"finished"}`},
+		}}
+		return NewLoop(chatModel, localtools.BuildDefaultTools(localtools.SysToolsConfig{}), config.AgentConfig{
+			DefaultMaxLoops:       1,
+			DefaultDeadline:       time.Minute,
+			MaxActRounds:          3,
+			MaxRetryPerStep:       1,
+			WorkspaceDir:          workspaceDir,
+			KeepWorkspace:         "never",
+			ExternalWorkspaceRoot: externalRoot,
+			Prompts:               config.AgentPrompts{Frame: "frame", Plan: "plan", Act: "act", Reflect: "reflect"},
+		}, runStore, store.NewStepStore(db), nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}
+	constraints := json.RawMessage(`{"workspace_path":"repo"}`)
+
+	run, _, err := runStore.Create(ctx, "edit the repo", nil, nil, constraints, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := newLoop(root).Execute(ctx, run, ""); err != nil {
+		t.Fatalf("Execute() = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "repo")); err != nil {
+		t.Fatalf("external workspace was removed: %v", err)
+	}
+	for _, name := range []string{"prompt.md", "state.json", "run_memory.md", "checkpoint.json", EvidenceMarkdownFile} {
+		if _, err := os.Stat(filepath.Join(root, "repo", name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s kept out of the external workspace, stat err = %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(localtools.RunStateDir(workspaceDir, run.ID), "prompt.md")); err != nil {
+		t.Fatalf("expected prompt.md in the run state dir: %v", err)
+	}
+	finished, err := runStore.GetByID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if want, _ := filepath.EvalSymlinks(filepath.Join(root, "repo")); finished.WorkspacePath == nil || *finished.WorkspacePath != want {
+		t.Fatalf("workspace_path = %v, want %s", finished.WorkspacePath, want)
+	}
+
+	denied, _, err := runStore.Create(ctx, "edit the repo", nil, nil, constraints, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	_ = newLoop("").Execute(ctx, denied, "")
+	got, err := runStore.GetByID(ctx, denied.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got.Status != store.RunStatusFailed || got.Error == nil || !strings.Contains(*got.Error, "workspace_path") {
+		t.Fatalf("status = %s, error %v; want failed with a workspace_path error", got.Status, got.Error)
+	}
+}
+
+func TestExecuteUsesStageModels(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	cheap := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{responses: []*schema.Message{
+		{Role: schema.Assistant, Content: `{"todo":[]}`},
+		{Role: schema.Assistant, Content: "1. finish"},
+		{Role: schema.Assistant, Content: `{"next_stage":"done","summary":"finished"}`},
+	}}}
+	strong := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{responses: []*schema.Message{
+		{
+			Role: schema.Assistant,
+			ToolCalls: []schema.ToolCall{
+				{ID: "tc-1", Type: "function", Function: schema.FunctionCall{Name: "report_success", Arguments: `{"summary":"finished","evidence":"none needed"}`}},
+			},
+		},
+		{Role: schema.Assistant, Content: "finished"},
+	}}}
+
+	loop := NewLoop(cheap, localtools.BuildDefaultTools(localtools.SysToolsConfig{}), config.AgentConfig{
+		DefaultMaxLoops: 1,
+		DefaultDeadline: time.Minute,
+		MaxActRounds:    3,
+		MaxRetryPerStep: 1,
+		WorkspaceDir:    t.TempDir(),
+		Prompts:         config.AgentPrompts{Frame: "frame", Plan: "plan", Act: "act", Reflect: "reflect"},
+	}, runStore, store.NewStepStore(db), nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	loop.stageModels = map[store.StepPhase]model.ToolCallingChatModel{store.StepPhaseAct: strong}
+
+	if err := loop.Execute(ctx, run, ""); err != nil {
+		t.Fatalf("Execute() = %v", err)
+	}
+	if got := strings.Join(cheap.prompts, ","); got != "frame,plan,reflect" {
+		t.Fatalf("default model prompts = %q, want frame,plan,reflect", got)
+	}
+	if got := strings.Join(strong.prompts, ","); got != "act,act" {
+		t.Fatalf("act model prompts = %q, want both act rounds", got)
+	}
+}
+
+func TestExecuteModelConstraintServesEveryStage(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "goal", nil, nil, json.RawMessage(`{"model":"strong"}`), nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	cheap := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{}}
+	strong := &promptRecordingModel{scriptedToolCallingModel: &scriptedToolCallingModel{responses: []*schema.Message{
+		{Role: schema.Assistant, Content: `{"todo":[]}`},
+		{Role: schema.Assistant, Content: "1. finish"},
+		{
+			Role: schema.Assistant,
+			ToolCalls: []schema.ToolCall{
+				{ID: "tc-1", Type: "function", Function: schema.FunctionCall{Name: "report_success", Arguments: `{"summary":"finished","evidence":"none needed"}`}},
+			},
+		},
+		{Role: schema.Assistant, Content: "finished"},
+		{Role: schema.Assistant, Content: `{"next_stage":"done","summary":"finished"}`},
+	}}}
+
+	newLoop := func() *Loop {
+		loop := NewLoop(cheap, localtools.BuildDefaultTools(localtools.SysToolsConfig{}), config.AgentConfig{
+			DefaultMaxLoops: 1,
+			DefaultDeadline: time.Minute,
+			MaxActRounds:    3,
+			MaxRetryPerStep: 1,
+			WorkspaceDir:    t.TempDir(),
+			StageModels:     map[string]string{"act": "cheap"},
+			Prompts:         config.AgentPrompts{Frame: "frame", Plan: "plan", Act: "act", Reflect: "reflect"},
+		}, runStore, store.NewStepStore(db), nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		loop.stageModels = map[store.StepPhase]model.ToolCallingChatModel{store.StepPhaseAct: cheap}
+		loop.models = map[string]model.ToolCallingChatModel{"cheap": cheap, "strong": strong}
+		return loop
+	}
+
+	if err := newLoop().Execute(ctx, run, ""); err != nil {
+		t.Fatalf("Execute() = %v", err)
+	}
+	if len(cheap.prompts) != 0 {
+		t.Fatalf("cheap model prompts = %q, want none", cheap.prompts)
+	}
+	if got := strings.Join(strong.prompts, ","); got != "frame,plan,act,act,reflect" {
+		t.Fatalf("strong model prompts = %q, want every stage", got)
+	}
+
+	unknown, _, err := runStore.Create(ctx, "goal", nil, nil, json.RawMessage(`{"model":"missing"}`), nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := newLoop().Execute(ctx, unknown, ""); err == nil || !strings.Contains(err.Error(), `model: "missing"`) {
+		t.Fatalf("Execute() with unknown model = %v", err)
+	}
+}
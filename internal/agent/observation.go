@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// failedToolStatuses are the "status" values tools and Ductile jobs use to
+// report a failed call.
+var failedToolStatuses = []string{"error", "failed", "timed_out", "dead", "invalid_arguments"}
+
+// toolObservation is the envelope agent.observation_envelope wraps around
+// every tool result sent to the model, so success and failure look the same
+// whichever tool produced them.
+type toolObservation struct {
+	OK     bool            `json:"ok"`
+	Tool   string          `json:"tool"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  any             `json:"error,omitempty"`
+}
+
+// observation returns the tool message content for out, the normalized
+// output of tool name. Without agent.observation_envelope it is out as is;
+// the raw output reaches loop memory through the tool observers either way.
+func (l *Loop) observation(name string, out json.RawMessage) string {
+	if !l.cfg.ObservationEnvelope {
+		return string(out)
+	}
+	if errValue, failed := toolOutputError(out); failed {
+		return string(mustJSON(toolObservation{Tool: name, Error: errValue}))
+	}
+	return string(mustJSON(toolObservation{OK: true, Tool: name, Result: out}))
+}
+
+// toolOutputError reports whether out describes a failed call. A "status"
+// field decides when present, since some successful results carry an
+// unrelated "error" (a failed subrun's, for one); otherwise any non-empty
+// "error" marks a failure. The returned value is the error message when out
+// is only that, else the whole output.
+func toolOutputError(out json.RawMessage) (any, bool) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(out, &fields) != nil {
+		return nil, false
+	}
+	failed := false
+	var status string
+	if raw, ok := fields["status"]; ok && json.Unmarshal(raw, &status) == nil {
+		failed = slices.Contains(failedToolStatuses, status)
+	} else if raw, ok := fields["error"]; ok {
+		var msg string
+		failed = string(raw) != "null" && (json.Unmarshal(raw, &msg) != nil || msg != "")
+	}
+	if !failed {
+		return nil, false
+	}
+	var msg string
+	if raw, ok := fields["error"]; ok && len(fields) == 1 && json.Unmarshal(raw, &msg) == nil {
+		return msg, true
+	}
+	return out, true
+}
@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// runQueue is a bounded priority queue of run IDs. Higher priority runs are
+// dequeued first; runs of equal priority keep FIFO order. With aging on, a
+// run's effective priority grows by one for every agingInterval it waits.
+type runQueue struct {
+	// slots bounds how many runs may be queued; ready counts queued runs.
+	slots chan struct{}
+	ready chan struct{}
+
+	agingInterval time.Duration
+	now           func() time.Time
+
+	mu    sync.Mutex
+	items queueHeap
+	seq   uint64
+}
+
+type queueItem struct {
+	runID      string
+	priority   int
+	seq        uint64
+	enqueuedAt time.Time
+}
+
+func newRunQueue(capacity int, agingInterval time.Duration) *runQueue {
+	return &runQueue{
+		slots:         make(chan struct{}, capacity),
+		ready:         make(chan struct{}, capacity),
+		agingInterval: agingInterval,
+		now:           time.Now,
+	}
+}
+
+// push adds a run, waiting up to timeout for space. A timeout <= 0 does not wait.
+// It reports false when the queue stayed full.
+func (q *runQueue) push(runID string, priority int, timeout time.Duration) bool {
+	if timeout <= 0 {
+		select {
+		case q.slots <- struct{}{}:
+		default:
+			return false
+		}
+	} else {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case q.slots <- struct{}{}:
+		case <-timer.C:
+			return false
+		}
+	}
+
+	q.mu.Lock()
+	q.seq++
+	heap.Push(&q.items, queueItem{runID: runID, priority: priority, seq: q.seq, enqueuedAt: q.now()})
+	q.mu.Unlock()
+	q.ready <- struct{}{}
+	return true
+}
+
+// pop blocks until a run is available or ctx is done. claim, when non-nil,
+// is called with the run before the queue lock is released, so a caller
+// checking has and then the claimed run never misses it in between.
+func (q *runQueue) pop(ctx context.Context, claim func(runID string)) (string, bool) {
+	select {
+	case <-ctx.Done():
+		return "", false
+	case <-q.ready:
+	}
+	return q.take(claim), true
+}
+
+// tryPop returns the next run without blocking.
+func (q *runQueue) tryPop() (string, bool) {
+	select {
+	case <-q.ready:
+		return q.take(nil), true
+	default:
+		return "", false
+	}
+}
+
+// len returns the number of queued runs.
+func (q *runQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.items.Len()
+}
+
+// has reports whether runID is waiting in the queue.
+func (q *runQueue) has(runID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, item := range q.items {
+		if item.runID == runID {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *runQueue) take(claim func(runID string)) string {
+	q.mu.Lock()
+	var item queueItem
+	if q.agingInterval > 0 {
+		item = heap.Remove(&q.items, q.agedBest()).(queueItem)
+	} else {
+		item = heap.Pop(&q.items).(queueItem)
+	}
+	if claim != nil {
+		claim(item.runID)
+	}
+	q.mu.Unlock()
+	<-q.slots
+	return item.runID
+}
+
+// agedBest returns the index of the item with the highest effective
+// priority, base + floor(wait/agingInterval), breaking ties by enqueue
+// order. Aging changes the order over time, so the heap order alone cannot
+// be used. Callers hold q.mu.
+func (q *runQueue) agedBest() int {
+	now := q.now()
+	best, bestPriority := -1, 0
+	for i, item := range q.items {
+		p := item.priority + int(now.Sub(item.enqueuedAt)/q.agingInterval)
+		if best < 0 || p > bestPriority || (p == bestPriority && item.seq < q.items[best].seq) {
+			best, bestPriority = i, p
+		}
+	}
+	return best
+}
+
+// queueHeap implements heap.Interface ordered by priority DESC, then enqueue order.
+type queueHeap []queueItem
+
+func (h queueHeap) Len() int { return len(h) }
+func (h queueHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h queueHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *queueHeap) Push(x any)   { *h = append(*h, x.(queueItem)) }
+func (h *queueHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
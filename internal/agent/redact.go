@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// redactedText replaces every secret matched by a redaction pattern.
+const redactedText = "[REDACTED]"
+
+// Redactor masks secrets before tool traffic and model output is persisted.
+// A nil Redactor leaves input unchanged.
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor compiles the given patterns. Patterns are validated when the
+// config is loaded, so invalid ones are skipped here rather than failing a run.
+func NewRedactor(patterns []string) *Redactor {
+	r := &Redactor{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			continue
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	if len(r.patterns) == 0 {
+		return nil
+	}
+	return r
+}
+
+// String redacts s. When a pattern has a capture group, the first group is
+// kept so that prefixes such as "Bearer " or `"password": "` survive.
+func (r *Redactor) String(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, re := range r.patterns {
+		repl := redactedText
+		if re.NumSubexp() > 0 {
+			repl = "${1}" + redactedText
+		}
+		s = re.ReplaceAllString(s, repl)
+	}
+	return s
+}
+
+// JSON redacts the strings in a JSON document and re-encodes it, so a match
+// can never cut through JSON syntax or escapes. A string object member is
+// matched as "key=value" so that key-based patterns such as password=...
+// still apply. A document that does not decode is redacted as text and
+// wrapped as {"raw": ...}.
+func (r *Redactor) JSON(raw json.RawMessage) json.RawMessage {
+	if r == nil || len(raw) == 0 {
+		return raw
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return mustJSON(map[string]string{"raw": r.String(string(raw))})
+	}
+	redacted, changed := r.value(v)
+	if !changed {
+		return raw
+	}
+	return mustJSON(redacted)
+}
+
+// value redacts the strings in a decoded JSON value and reports whether any
+// of them changed.
+func (r *Redactor) value(v any) (any, bool) {
+	switch v := v.(type) {
+	case string:
+		out := r.String(v)
+		return out, out != v
+	case []any:
+		changed := false
+		for i, item := range v {
+			var c bool
+			v[i], c = r.value(item)
+			changed = changed || c
+		}
+		return v, changed
+	case map[string]any:
+		changed := false
+		for key, item := range v {
+			var c bool
+			if s, ok := item.(string); ok {
+				out := r.member(key, s)
+				v[key], c = out, out != s
+			} else {
+				v[key], c = r.value(item)
+			}
+			changed = changed || c
+		}
+		return v, changed
+	default:
+		return v, false
+	}
+}
+
+// member redacts the string value of an object member. When a pattern
+// matches across the key, the whole value is redacted.
+func (r *Redactor) member(key, value string) string {
+	prefix := key + "="
+	out := r.String(prefix + value)
+	if rest, ok := strings.CutPrefix(out, prefix); ok {
+		return rest
+	}
+	if out != prefix+value {
+		return redactedText
+	}
+	return value
+}
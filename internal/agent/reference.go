@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// contextFiles returns the reference documents a run requested through the
+// context_files key of its context object.
+func contextFiles(runCtx json.RawMessage) ([]string, error) {
+	if len(runCtx) == 0 {
+		return nil, nil
+	}
+	var parsed struct {
+		ContextFiles json.RawMessage `json:"context_files"`
+	}
+	if err := json.Unmarshal(runCtx, &parsed); err != nil || len(parsed.ContextFiles) == 0 {
+		// Non-object contexts carry no file references.
+		return nil, nil
+	}
+	var files []string
+	if err := json.Unmarshal(parsed.ContextFiles, &files); err != nil {
+		return nil, fmt.Errorf("context_files must be an array of strings")
+	}
+	return files, nil
+}
+
+// loadReferenceDocs reads the requested files from refDir and renders them for
+// the {{.ReferenceDocs}} prompt variable. Paths must stay inside refDir (also
+// after resolving symlinks) and the combined size may not exceed maxBytes.
+func loadReferenceDocs(refDir string, files []string, maxBytes int) (string, error) {
+	if len(files) == 0 {
+		return "", nil
+	}
+	if refDir == "" {
+		return "", fmt.Errorf("context_files requires agent.reference_dir to be configured")
+	}
+	root, err := filepath.Abs(refDir)
+	if err != nil {
+		return "", fmt.Errorf("resolve reference dir: %w", err)
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", fmt.Errorf("resolve reference dir: %w", err)
+	}
+
+	var b strings.Builder
+	total := 0
+	for _, name := range files {
+		if name == "" || filepath.IsAbs(name) || !filepath.IsLocal(name) {
+			return "", fmt.Errorf("context file %q must be a relative path inside the reference dir", name)
+		}
+		path, err := filepath.EvalSymlinks(filepath.Join(root, name))
+		if err != nil {
+			return "", fmt.Errorf("context file %q: %w", name, err)
+		}
+		if rel, err := filepath.Rel(root, path); err != nil || !filepath.IsLocal(rel) {
+			return "", fmt.Errorf("context file %q escapes the reference dir", name)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("context file %q: %w", name, err)
+		}
+		if !info.Mode().IsRegular() {
+			return "", fmt.Errorf("context file %q is not a regular file", name)
+		}
+		if total+int(info.Size()) > maxBytes {
+			return "", fmt.Errorf("context files exceed agent.max_reference_bytes (%d bytes)", maxBytes)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("context file %q: %w", name, err)
+		}
+		total += len(data)
+		fmt.Fprintf(&b, "<reference_doc path=%q>\n%s\n</reference_doc>\n", filepath.ToSlash(filepath.Clean(name)), strings.TrimRight(string(data), "\n"))
+	}
+	return strings.TrimSpace(b.String()), nil
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadReferenceDocs(t *testing.T) {
+	refDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(refDir, "specs"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	os.WriteFile(filepath.Join(refDir, "specs", "spec.md"), []byte("# Spec\nbuild it\n"), 0o644)
+	os.WriteFile(filepath.Join(refDir, "notes.txt"), []byte("remember this"), 0o644)
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	os.WriteFile(outside, []byte("secret"), 0o644)
+	if err := os.Symlink(outside, filepath.Join(refDir, "link.txt")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	files, err := contextFiles(json.RawMessage(`{"ticket":"X-1","context_files":["specs/spec.md","notes.txt"]}`))
+	if err != nil {
+		t.Fatalf("contextFiles: %v", err)
+	}
+	docs, err := loadReferenceDocs(refDir, files, 1024)
+	if err != nil {
+		t.Fatalf("loadReferenceDocs: %v", err)
+	}
+	want := "<reference_doc path=\"specs/spec.md\">\n# Spec\nbuild it\n</reference_doc>\n<reference_doc path=\"notes.txt\">\nremember this\n</reference_doc>"
+	if docs != want {
+		t.Fatalf("docs = %q, want %q", docs, want)
+	}
+
+	for name, tc := range map[string]struct {
+		refDir  string
+		files   []string
+		maxSize int
+		wantErr string
+	}{
+		"parent escape":    {refDir, []string{"../secret.txt"}, 1024, "relative path inside the reference dir"},
+		"absolute path":    {refDir, []string{outside}, 1024, "relative path inside the reference dir"},
+		"symlink escape":   {refDir, []string{"link.txt"}, 1024, "escapes the reference dir"},
+		"missing file":     {refDir, []string{"nope.md"}, 1024, "nope.md"},
+		"directory":        {refDir, []string{"specs"}, 1024, "not a regular file"},
+		"size cap":         {refDir, []string{"specs/spec.md", "notes.txt"}, 20, "agent.max_reference_bytes"},
+		"no reference dir": {"", []string{"notes.txt"}, 1024, "agent.reference_dir"},
+	} {
+		if _, err := loadReferenceDocs(tc.refDir, tc.files, tc.maxSize); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Fatalf("%s: expected error containing %q, got %v", name, tc.wantErr, err)
+		}
+	}
+
+	if _, err := contextFiles(json.RawMessage(`{"context_files":"spec.md"}`)); err == nil {
+		t.Fatalf("expected error for non-array context_files")
+	}
+	if files, err := contextFiles(json.RawMessage(`"just a string"`)); err != nil || files != nil {
+		t.Fatalf("expected no files for non-object context, got %v, %v", files, err)
+	}
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// repairJSON attempts to fix the malformations weaker models commonly put in
+// tool arguments: a ```json fence, single-quoted strings, unquoted object
+// keys, Python True/False/None, trailing commas, and closing brackets left
+// off the end. It returns the repaired text and true when the result is
+// valid JSON, or "" and false when it is still not.
+func repairJSON(raw string) (string, bool) {
+	text := strings.TrimSpace(raw)
+	if fenced, ok := strings.CutPrefix(text, "```"); ok {
+		fenced = strings.TrimPrefix(fenced, "json")
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(fenced), "```"))
+	}
+
+	var out strings.Builder
+	var closers []byte
+	var quote rune // the open string's quote character, or 0 outside strings
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		if quote != 0 {
+			switch {
+			case c == '\\' && i+1 < len(runes):
+				i++
+				if runes[i] == '\'' {
+					out.WriteRune('\'')
+				} else {
+					out.WriteRune(c)
+					out.WriteRune(runes[i])
+				}
+			case c == quote:
+				out.WriteByte('"')
+				quote = 0
+			case c == '"':
+				out.WriteString(`\"`)
+			case c == '\n':
+				out.WriteString(`\n`)
+			default:
+				out.WriteRune(c)
+			}
+			continue
+		}
+
+		switch {
+		case c == '"' || c == '\'':
+			quote = c
+			out.WriteByte('"')
+		case c == '{':
+			closers = append(closers, '}')
+			out.WriteRune(c)
+		case c == '[':
+			closers = append(closers, ']')
+			out.WriteRune(c)
+		case c == '}' || c == ']':
+			if len(closers) > 0 {
+				closers = closers[:len(closers)-1]
+			}
+			out.WriteRune(c)
+		case c == ',':
+			next := nextNonSpace(runes, i+1)
+			if next == '}' || next == ']' || next == 0 {
+				continue
+			}
+			out.WriteRune(c)
+		case isIdentStart(c):
+			j := i
+			for j < len(runes) && isIdentPart(runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			i = j - 1
+			if nextNonSpace(runes, j) == ':' {
+				out.WriteString(`"` + word + `"`)
+				continue
+			}
+			switch word {
+			case "True":
+				word = "true"
+			case "False":
+				word = "false"
+			case "None":
+				word = "null"
+			}
+			out.WriteString(word)
+		default:
+			out.WriteRune(c)
+		}
+	}
+	if quote != 0 {
+		out.WriteByte('"')
+	}
+	for i := len(closers) - 1; i >= 0; i-- {
+		out.WriteByte(closers[i])
+	}
+
+	repaired := out.String()
+	if !json.Valid([]byte(repaired)) {
+		return "", false
+	}
+	return repaired, true
+}
+
+// nextNonSpace returns the first non-whitespace rune at or after i, or 0.
+func nextNonSpace(runes []rune, i int) rune {
+	for ; i < len(runes); i++ {
+		switch runes[i] {
+		case ' ', '\t', '\n', '\r':
+		default:
+			return runes[i]
+		}
+	}
+	return 0
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c rune) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
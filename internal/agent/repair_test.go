@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/config"
+)
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name, raw, want string
+		ok              bool
+	}{
+		{"trailing comma", `{"path": "a.txt", "limit": 10,}`, `{"path": "a.txt", "limit": 10}`, true},
+		{"trailing comma in array", `{"tags": ["a", "b",],}`, `{"tags": ["a", "b"]}`, true},
+		{"single quotes", `{'path': 'it\'s "here".txt'}`, `{"path": "it's \"here\".txt"}`, true},
+		{"unquoted keys", `{path: "a.txt", recursive: True, filter: None}`, `{"path": "a.txt", "recursive": true, "filter": null}`, true},
+		{"fenced", "```json\n{\"path\": \"a.txt\",}\n```", `{"path": "a.txt"}`, true},
+		{"unclosed", `{"items": [1, 2`, `{"items": [1, 2]}`, true},
+		{"newline in string", "{'text': 'line one\nline two'}", `{"text": "line one\nline two"}`, true},
+		{"bare value", `{"path": a.txt}`, "", false},
+		{"prose", `please read the file`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := repairJSON(tt.raw)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("repairJSON(%q) = %q, %v; want %q, %v", tt.raw, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestToolArgumentsRepairsOnlyWhenEnabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	raw := `{'path': 'a.txt',}`
+
+	off := NewLoop(nil, nil, config.AgentConfig{}, nil, nil, nil, logger)
+	if got := string(off.toolArguments("read_file", raw)); got != `{"raw":"{'path': 'a.txt',}"}` {
+		t.Fatalf("without repair_tool_args = %s", got)
+	}
+
+	on := NewLoop(nil, nil, config.AgentConfig{RepairToolArgs: true}, nil, nil, nil, logger)
+	if got := string(on.toolArguments("read_file", raw)); got != `{"path": "a.txt"}` {
+		t.Fatalf("with repair_tool_args = %s", got)
+	}
+	if got := string(on.toolArguments("read_file", `{"path":"a.txt"}`)); got != `{"path":"a.txt"}` {
+		t.Fatalf("valid arguments changed to %s", got)
+	}
+}
+
+func TestToolArgumentsRedactsLoggedOriginal(t *testing.T) {
+	var logs bytes.Buffer
+	loop := NewLoop(nil, nil, config.AgentConfig{RepairToolArgs: true, RedactPatterns: []string{`sk-[a-z0-9]+`}}, nil, nil, nil,
+		slog.New(slog.NewTextHandler(&logs, nil)))
+
+	loop.toolArguments("fetch", `{'token': 'sk-abc123',}`)
+	loop.toolArguments("fetch", `token sk-abc123 please`)
+	if strings.Contains(logs.String(), "sk-abc123") {
+		t.Fatalf("secret logged with malformed arguments:\n%s", logs.String())
+	}
+	if strings.Count(logs.String(), "malformed tool arguments") != 2 {
+		t.Fatalf("expected both arguments to be logged:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mattjoyce/agenticloop/internal/config"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// WorkspaceReaper periodically deletes workspaces for runs that completed
+// longer ago than agent.workspace_retention.
+type WorkspaceReaper struct {
+	runStore  *store.RunStore
+	baseDir   string
+	retention time.Duration
+	interval  time.Duration
+	logger    *slog.Logger
+}
+
+// NewWorkspaceReaper creates a WorkspaceReaper from agent config.
+func NewWorkspaceReaper(runStore *store.RunStore, cfg config.AgentConfig, logger *slog.Logger) *WorkspaceReaper {
+	interval := cfg.WorkspaceGCInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &WorkspaceReaper{
+		runStore:  runStore,
+		baseDir:   cfg.WorkspaceDir,
+		retention: cfg.WorkspaceRetention,
+		interval:  interval,
+		logger:    logger,
+	}
+}
+
+// Start sweeps immediately and then on every interval until ctx is cancelled.
+func (r *WorkspaceReaper) Start(ctx context.Context) {
+	r.logger.Info("workspace reaper started", "retention", r.retention, "interval", r.interval)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Sweep(ctx); err != nil {
+			r.logger.Error("workspace sweep failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			r.logger.Info("workspace reaper stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep removes expired workspaces and returns how many were deleted.
+// Directories are only removed when they match a done or failed run whose
+// completed_at is older than the retention period; anything else is left alone.
+func (r *WorkspaceReaper) Sweep(ctx context.Context) (int, error) {
+	entries, err := os.ReadDir(r.baseDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	cutoff := time.Now().UTC().Add(-r.retention)
+	removed := 0
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return removed, ctx.Err()
+		}
+		if !entry.IsDir() {
+			continue
+		}
+		runID := entry.Name()
+		run, err := r.runStore.GetByID(ctx, runID)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				r.logger.Warn("workspace sweep: failed to look up run", "run_id", runID, "error", err)
+			}
+			continue
+		}
+		if run.Status != store.RunStatusDone && run.Status != store.RunStatusFailed {
+			continue
+		}
+		if run.CompletedAt == nil || run.CompletedAt.After(cutoff) {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(r.baseDir, runID)); err != nil {
+			r.logger.Error("failed to remove expired workspace", "run_id", runID, "error", err)
+			continue
+		}
+		removed++
+		r.logger.Info("removed expired workspace", "run_id", runID, "status", run.Status, "completed_at", run.CompletedAt.Format(time.RFC3339))
+	}
+	if removed > 0 {
+		r.logger.Info("workspace sweep completed", "removed", removed)
+	}
+	return removed, nil
+}
+
+// discardWorkspace applies agent.keep_workspace once Execute returns. The
+// run's stored status decides: "never" removes done and failed workspaces,
+// "on_failure" removes only done ones. Runs requeued on shutdown are still
+// queued, so their workspace is always kept for the resumed execution.
+// External workspaces belong to the caller and are never removed.
+func (l *Loop) discardWorkspace(runID string, ws *Workspace) {
+	if l.cfg.KeepWorkspace != "on_failure" && l.cfg.KeepWorkspace != "never" {
+		return
+	}
+	if ws.External() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	run, err := l.runStore.GetByID(ctx, runID)
+	if err != nil {
+		l.logger.Warn("keep_workspace: failed to look up run", "run_id", runID, "error", err)
+		return
+	}
+	switch run.Status {
+	case store.RunStatusDone:
+	case store.RunStatusFailed:
+		if l.cfg.KeepWorkspace != "never" {
+			return
+		}
+	default:
+		return
+	}
+	if err := os.RemoveAll(ws.Dir()); err != nil {
+		l.logger.Error("failed to remove run workspace", "run_id", runID, "error", err)
+		return
+	}
+	l.logger.Info("removed run workspace", "run_id", runID, "status", run.Status, "keep_workspace", l.cfg.KeepWorkspace)
+}
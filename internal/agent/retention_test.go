@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattjoyce/agenticloop/internal/config"
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestWorkspaceReaperSweepRemovesOnlyExpiredCompletedRuns(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "agenticloop.db")
+	db, err := storage.OpenSQLite(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	baseDir := t.TempDir()
+
+	newRun := func(status store.RunStatus, completedAgo time.Duration) string {
+		t.Helper()
+		run, _, err := runStore.Create(ctx, "goal", nil, nil, nil, nil, 0)
+		if err != nil {
+			t.Fatalf("create run: %v", err)
+		}
+		if err := runStore.UpdateStatus(ctx, run.ID, status, nil, nil); err != nil {
+			t.Fatalf("update status: %v", err)
+		}
+		if completedAgo > 0 {
+			completedAt := time.Now().UTC().Add(-completedAgo).Format(time.RFC3339Nano)
+			if _, err := db.ExecContext(ctx, `UPDATE runs SET completed_at = ? WHERE id = ?`, completedAt, run.ID); err != nil {
+				t.Fatalf("backdate completed_at: %v", err)
+			}
+		}
+		if _, err := NewWorkspace(baseDir, run.ID); err != nil {
+			t.Fatalf("create workspace: %v", err)
+		}
+		return run.ID
+	}
+
+	expiredDone := newRun(store.RunStatusDone, 48*time.Hour)
+	expiredFailed := newRun(store.RunStatusFailed, 48*time.Hour)
+	recentDone := newRun(store.RunStatusDone, time.Minute)
+	running := newRun(store.RunStatusRunning, 0)
+	orphan := filepath.Join(baseDir, "not-a-run")
+	if err := os.MkdirAll(orphan, 0o755); err != nil {
+		t.Fatalf("create orphan dir: %v", err)
+	}
+
+	reaper := NewWorkspaceReaper(runStore, config.AgentConfig{
+		WorkspaceDir:       baseDir,
+		WorkspaceRetention: 24 * time.Hour,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	removed, err := reaper.Sweep(ctx)
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if removed != 2 {
+		t.Fatalf("removed = %d, want 2", removed)
+	}
+
+	for _, id := range []string{expiredDone, expiredFailed} {
+		if _, err := os.Stat(filepath.Join(baseDir, id)); !os.IsNotExist(err) {
+			t.Fatalf("expected workspace %s to be removed, stat err=%v", id, err)
+		}
+	}
+	for _, dir := range []string{filepath.Join(baseDir, recentDone), filepath.Join(baseDir, running), orphan} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Fatalf("expected %s to be kept: %v", dir, err)
+		}
+	}
+}
+
+func TestDiscardWorkspaceFollowsKeepWorkspacePolicy(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	runStore := store.NewRunStore(db)
+
+	tests := []struct {
+		policy string
+		status store.RunStatus
+		kept   bool
+	}{
+		{"always", store.RunStatusDone, true},
+		{"always", store.RunStatusFailed, true},
+		{"on_failure", store.RunStatusDone, false},
+		{"on_failure", store.RunStatusFailed, true},
+		{"on_failure", store.RunStatusQueued, true},
+		{"never", store.RunStatusDone, false},
+		{"never", store.RunStatusFailed, false},
+		{"never", store.RunStatusQueued, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+"/"+string(tt.status), func(t *testing.T) {
+			baseDir := t.TempDir()
+			run, _, err := runStore.Create(ctx, "goal", nil, nil, nil, nil, 0)
+			if err != nil {
+				t.Fatalf("create run: %v", err)
+			}
+			if err := runStore.UpdateStatus(ctx, run.ID, tt.status, nil, nil); err != nil {
+				t.Fatalf("update status: %v", err)
+			}
+			ws, err := NewWorkspace(baseDir, run.ID)
+			if err != nil {
+				t.Fatalf("create workspace: %v", err)
+			}
+
+			loop := NewLoop(nil, nil, config.AgentConfig{WorkspaceDir: baseDir, KeepWorkspace: tt.policy},
+				runStore, nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			loop.discardWorkspace(run.ID, ws)
+
+			_, err = os.Stat(ws.Dir())
+			if kept := err == nil; kept != tt.kept {
+				t.Fatalf("workspace kept = %v, want %v (stat error %v)", kept, tt.kept, err)
+			}
+		})
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
@@ -27,9 +30,29 @@ type Runner struct {
 	callback  string
 	logger    *slog.Logger
 
-	queue chan string
+	// stageOpts holds per-phase model options applied on top of run-level options.
+	stageOpts map[store.StepPhase][]model.Option
+	// stageModels holds per-phase models that replace chatModel.
+	stageModels map[store.StepPhase]model.ToolCallingChatModel
+	// models are the models a run's model constraint may select, by name.
+	models map[string]model.ToolCallingChatModel
+	// callbackPolicy sets how completion callbacks are retried.
+	callbackPolicy CallbackPolicy
+	// costs prices step token usage (llm.pricing).
+	costs costTable
+	// contextWindow sizes prompt clipping (llm.context_window).
+	contextWindow int
+
+	queue *runQueue
 	mu    sync.Mutex
 	done  chan struct{}
+
+	// activeMu guards active, the run the worker is executing, and inline,
+	// the subruns it is executing on that run's behalf, so the stale run
+	// reaper can tell a live run from an orphaned one.
+	activeMu sync.Mutex
+	active   string
+	inline   []string
 }
 
 var ErrQueueFull = errors.New("runner queue is full")
@@ -50,14 +73,53 @@ func NewRunner(runStore *store.RunStore, stepStore *store.StepStore, chatModel m
 		client:    client,
 		callback:  callbackURL,
 		logger:    logger,
-		queue:     make(chan string, capacity),
+		queue:     newRunQueue(capacity, cfg.PriorityAgingRate),
 		done:      make(chan struct{}),
 	}
 }
 
+// SetStageModelOptions registers model options applied to every Generate call
+// in the given phase, such as JSON mode for reflect.
+func (r *Runner) SetStageModelOptions(phase store.StepPhase, opts ...model.Option) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stageOpts == nil {
+		r.stageOpts = make(map[store.StepPhase][]model.Option)
+	}
+	r.stageOpts[phase] = opts
+}
+
+// SetStageModel makes every Generate call in the given phase use m instead
+// of the default model (agent.stage_models).
+func (r *Runner) SetStageModel(phase store.StepPhase, m model.ToolCallingChatModel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stageModels == nil {
+		r.stageModels = make(map[store.StepPhase]model.ToolCallingChatModel)
+	}
+	r.stageModels[phase] = m
+}
+
+// SetModel registers m as the model a run's model constraint selects with
+// name (llm.model or one of llm.allowed_models).
+func (r *Runner) SetModel(name string, m model.ToolCallingChatModel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.models == nil {
+		r.models = make(map[string]model.ToolCallingChatModel)
+	}
+	r.models[name] = m
+}
+
 // Create creates a run (delegates to RunStore) and satisfies the RunCreator interface.
-func (r *Runner) Create(ctx context.Context, goal string, wakeID *string, runCtx json.RawMessage, constraints json.RawMessage) (*store.Run, bool, error) {
-	return r.runStore.Create(ctx, goal, wakeID, runCtx, constraints)
+func (r *Runner) Create(ctx context.Context, goal string, wakeID *string, runCtx json.RawMessage, constraints json.RawMessage, labels map[string]string, priority int) (*store.Run, bool, error) {
+	return r.runStore.Create(ctx, goal, wakeID, runCtx, constraints, labels, priority)
+}
+
+// CreateDeduped creates a run unless an identical submission (same dedupKey)
+// arrived within window (delegates to RunStore).
+func (r *Runner) CreateDeduped(ctx context.Context, dedupKey string, window time.Duration, goal string, runCtx json.RawMessage, constraints json.RawMessage, labels map[string]string, priority int) (*store.Run, bool, error) {
+	return r.runStore.CreateDeduped(ctx, dedupKey, window, goal, runCtx, constraints, labels, priority)
 }
 
 // GetByID retrieves a run by ID (satisfies RunCreator interface).
@@ -65,28 +127,19 @@ func (r *Runner) GetByID(ctx context.Context, id string) (*store.Run, error) {
 	return r.runStore.GetByID(ctx, id)
 }
 
-// Enqueue adds a run ID to the processing queue.
+// Enqueue adds a run ID to the processing queue. Higher priority runs are
+// processed first; equal priorities are processed in enqueue order.
 // It returns ErrQueueFull when the queue cannot accept the run within EnqueueTimeout.
-func (r *Runner) Enqueue(runID string) error {
-	timeout := r.cfg.EnqueueTimeout
-	if timeout <= 0 {
-		select {
-		case r.queue <- runID:
-			return nil
-		default:
-			return ErrQueueFull
-		}
-	}
-
-	timer := time.NewTimer(timeout)
-	defer timer.Stop()
-
-	select {
-	case r.queue <- runID:
-		return nil
-	case <-timer.C:
+func (r *Runner) Enqueue(runID string, priority int) error {
+	if !r.queue.push(runID, priority, r.cfg.EnqueueTimeout) {
 		return ErrQueueFull
 	}
+	return nil
+}
+
+// QueueDepth returns the number of runs waiting in the queue.
+func (r *Runner) QueueDepth() int {
+	return r.queue.len()
 }
 
 // Start runs the serial worker loop. Blocks until context is cancelled.
@@ -94,14 +147,34 @@ func (r *Runner) Start(ctx context.Context) {
 	defer close(r.done)
 	r.logger.Info("agent runner started")
 	for {
-		select {
-		case <-ctx.Done():
+		// The run becomes active before it leaves the queue, so the stale
+		// run reaper never sees it in neither place.
+		runID, ok := r.queue.pop(ctx, r.setActive)
+		if !ok {
 			r.logger.Info("agent runner stopping")
 			return
-		case runID := <-r.queue:
-			r.processRun(ctx, runID)
 		}
+		r.processRun(ctx, runID)
+		r.setActive("")
+	}
+}
+
+func (r *Runner) setActive(runID string) {
+	r.activeMu.Lock()
+	r.active = runID
+	r.activeMu.Unlock()
+}
+
+// owns reports whether runID is being executed or waiting in the queue. The
+// queue is checked first: pop marks a run active before releasing the queue
+// lock, so a run taken after that check is already active.
+func (r *Runner) owns(runID string) bool {
+	if r.queue.has(runID) {
+		return true
 	}
+	r.activeMu.Lock()
+	defer r.activeMu.Unlock()
+	return r.active == runID || slices.Contains(r.inline, runID)
 }
 
 // Done returns a channel that is closed when the runner has finished processing
@@ -110,28 +183,59 @@ func (r *Runner) Done() <-chan struct{} {
 	return r.done
 }
 
-// RecoverRuns finds interrupted runs (status=running or queued) and re-enqueues them.
+// RecoverRuns finds interrupted runs (status=running, awaiting_approval, or
+// queued) and re-enqueues them.
+// Runs recovered more than MaxRecoveryAttempts times are marked failed instead.
 func (r *Runner) RecoverRuns(ctx context.Context) error {
 	running, err := r.runStore.ListByStatus(ctx, store.RunStatusRunning)
 	if err != nil {
 		return err
 	}
+	awaiting, err := r.runStore.ListByStatus(ctx, store.RunStatusAwaitingApproval)
+	if err != nil {
+		return err
+	}
 	queued, err := r.runStore.ListByStatus(ctx, store.RunStatusQueued)
 	if err != nil {
 		return err
 	}
 
-	seen := make(map[string]struct{}, len(running)+len(queued))
+	candidates := append(append(running, awaiting...), queued...)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Priority != candidates[j].Priority {
+			return candidates[i].Priority > candidates[j].Priority
+		}
+		return candidates[i].CreatedAt.Before(candidates[j].CreatedAt)
+	})
+
+	seen := make(map[string]struct{}, len(candidates))
 	enqueued := 0
+	deadLettered := 0
 
-	for _, run := range append(running, queued...) {
+	for _, run := range candidates {
 		if _, ok := seen[run.ID]; ok {
 			continue
 		}
 		seen[run.ID] = struct{}{}
 
-		r.logger.Info("recovering run", "run_id", run.ID, "status", run.Status)
-		if err := r.Enqueue(run.ID); err != nil {
+		attempts, err := r.runStore.IncrementRecoveryAttempts(ctx, run.ID)
+		if err != nil {
+			r.logger.Error("failed to record recovery attempt", "run_id", run.ID, "error", err)
+			continue
+		}
+		if max := r.maxRecoveryAttempts(); attempts > max {
+			r.logger.Error("dead-lettering poison run: recovery attempts exhausted",
+				"run_id", run.ID, "status", run.Status, "recovery_attempts", attempts, "max_recovery_attempts", max)
+			errMsg := fmt.Sprintf("recovery attempts exhausted (%d > %d); run was interrupted repeatedly", attempts, max)
+			if err := r.runStore.Fail(ctx, run.ID, store.FailureCodeRecoveryExhausted, errMsg); err != nil {
+				r.logger.Error("failed to dead-letter run", "run_id", run.ID, "error", err)
+			}
+			deadLettered++
+			continue
+		}
+
+		r.logger.Info("recovering run", "run_id", run.ID, "status", run.Status, "recovery_attempts", attempts)
+		if err := r.Enqueue(run.ID, run.Priority); err != nil {
 			r.logger.Warn("failed to enqueue recovered run", "run_id", run.ID, "status", run.Status, "error", err)
 			continue
 		}
@@ -139,11 +243,97 @@ func (r *Runner) RecoverRuns(ctx context.Context) error {
 	}
 
 	if len(seen) > 0 {
-		r.logger.Info("recovery scan complete", "candidates", len(seen), "enqueued", enqueued)
+		r.logger.Info("recovery scan complete", "candidates", len(seen), "enqueued", enqueued, "dead_lettered", deadLettered)
 	}
 	return nil
 }
 
+// StartStaleRunReaper reaps stale runs immediately and then every
+// agent.stale_run_check_interval until ctx is cancelled.
+func (r *Runner) StartStaleRunReaper(ctx context.Context) {
+	interval := r.cfg.StaleRunCheckInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	r.logger.Info("stale run reaper started", "threshold", r.cfg.StaleRunThreshold, "interval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.ReapStaleRuns(ctx); err != nil {
+			r.logger.Error("stale run sweep failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			r.logger.Info("stale run reaper stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReapStaleRuns handles runs stuck in running: runs the worker is not
+// executing or holding in the queue, last updated longer ago than
+// agent.stale_run_threshold. Each counts as a recovery attempt; the run is
+// re-enqueued while attempts remain and failed with failure_code=orphaned
+// once they are exhausted. It returns how many runs were reaped.
+func (r *Runner) ReapStaleRuns(ctx context.Context) (int, error) {
+	running, err := r.runStore.ListByStatus(ctx, store.RunStatusRunning)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().UTC().Add(-r.cfg.StaleRunThreshold)
+	reaped := 0
+	for _, run := range running {
+		if ctx.Err() != nil {
+			return reaped, ctx.Err()
+		}
+		if run.UpdatedAt.After(cutoff) || r.owns(run.ID) {
+			continue
+		}
+
+		attempts, err := r.runStore.IncrementRecoveryAttempts(ctx, run.ID)
+		if err != nil {
+			r.logger.Error("failed to record recovery attempt", "run_id", run.ID, "error", err)
+			continue
+		}
+		reaped++
+		if max := r.maxRecoveryAttempts(); attempts > max {
+			r.logger.Error("failing orphaned run: recovery attempts exhausted",
+				"run_id", run.ID, "recovery_attempts", attempts, "max_recovery_attempts", max)
+			errMsg := fmt.Sprintf("run orphaned in running with no active worker; recovery attempts exhausted (%d > %d)", attempts, max)
+			if err := r.runStore.Fail(ctx, run.ID, store.FailureCodeOrphaned, errMsg); err != nil {
+				r.logger.Error("failed to fail orphaned run", "run_id", run.ID, "error", err)
+			}
+			continue
+		}
+
+		// Mark it queued first so later sweeps do not pick it up again.
+		if ok, err := r.runStore.MarkQueued(ctx, run.ID); err != nil || !ok {
+			if err != nil {
+				r.logger.Error("failed to requeue orphaned run", "run_id", run.ID, "error", err)
+			}
+			continue
+		}
+		r.logger.Warn("re-enqueuing orphaned run", "run_id", run.ID, "updated_at", run.UpdatedAt.Format(time.RFC3339), "recovery_attempts", attempts)
+		if err := r.Enqueue(run.ID, run.Priority); err != nil {
+			r.logger.Warn("failed to enqueue orphaned run; it stays queued until the next restart", "run_id", run.ID, "error", err)
+		}
+	}
+	if reaped > 0 {
+		r.logger.Info("stale run sweep completed", "reaped", reaped)
+	}
+	return reaped, nil
+}
+
+func (r *Runner) maxRecoveryAttempts() int {
+	if r.cfg.MaxRecoveryAttempts <= 0 {
+		return 3
+	}
+	return r.cfg.MaxRecoveryAttempts
+}
+
 func (r *Runner) processRun(ctx context.Context, runID string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -154,17 +344,72 @@ func (r *Runner) processRun(ctx context.Context, runID string) {
 		return
 	}
 
-	if run.Status != store.RunStatusQueued && run.Status != store.RunStatusRunning {
+	if run.Status != store.RunStatusQueued && run.Status != store.RunStatusRunning && run.Status != store.RunStatusAwaitingApproval {
 		r.logger.Warn("skipping run with unexpected status", "run_id", runID, "status", run.Status)
 		return
 	}
 
-	loop := NewLoop(r.chatModel, r.tools, r.cfg, r.runStore, r.stepStore, r.client, r.logger)
+	loop := r.newLoop()
+
+	// Results of a run that waited too long are no longer wanted. Runs that
+	// already started once (requeued on shutdown or recovery) are resumed.
+	if wait := r.cfg.MaxQueueWait; wait > 0 && run.Status == store.RunStatusQueued && run.StartedAt == nil {
+		if queued := time.Since(run.CreatedAt); queued > wait {
+			r.logger.Warn("failing run that waited too long in the queue", "run_id", runID, "queued_for", queued, "max_queue_wait", wait)
+			_ = loop.failRun(ctx, r.callback, runID, fmt.Errorf("%w: queued for %s, agent.max_queue_wait is %s", ErrQueueExpired, queued.Round(time.Second), wait))
+			return
+		}
+	}
 
 	start := time.Now()
-	if err := loop.Execute(ctx, run, r.callback); err != nil {
+	err = loop.Execute(ctx, run, r.callback)
+	switch {
+	case errors.Is(err, ErrRunInterrupted):
+		r.logger.Info("run requeued on shutdown", "run_id", runID, "error", err, "duration", time.Since(start))
+	case err != nil:
 		r.logger.Error("run failed", "run_id", runID, "error", err, "duration", time.Since(start))
-	} else {
+	default:
 		r.logger.Info("run completed", "run_id", runID, "duration", time.Since(start))
 	}
 }
+
+// newLoop builds a Loop with the runner's models and settings. The caller
+// must hold r.mu, which processRun keeps for the whole run.
+func (r *Runner) newLoop() *Loop {
+	loop := NewLoop(r.chatModel, r.tools, r.cfg, r.runStore, r.stepStore, r.client, r.logger)
+	loop.stageOpts = r.stageOpts
+	loop.stageModels = r.stageModels
+	loop.models = r.models
+	loop.costs = r.costs
+	loop.contextWindow = r.contextWindow
+	loop.callbackPolicy = r.callbackPolicy
+	loop.subrunExec = r
+	return loop
+}
+
+// ExecuteSubrun runs a child run to completion on the calling goroutine. It
+// is only called from spawn_subrun inside a run processRun is executing, so
+// r.mu is already held and the child shares the worker with its parent.
+func (r *Runner) ExecuteSubrun(ctx context.Context, runID string) error {
+	run, err := r.runStore.GetByID(ctx, runID)
+	if err != nil {
+		return err
+	}
+	r.activeMu.Lock()
+	r.inline = append(r.inline, runID)
+	r.activeMu.Unlock()
+	defer func() {
+		r.activeMu.Lock()
+		r.inline = slices.DeleteFunc(r.inline, func(id string) bool { return id == runID })
+		r.activeMu.Unlock()
+	}()
+
+	start := time.Now()
+	err = r.newLoop().Execute(ctx, run, r.callback)
+	if err != nil {
+		r.logger.Error("subrun failed", "run_id", runID, "error", err, "duration", time.Since(start))
+		return err
+	}
+	r.logger.Info("subrun completed", "run_id", runID, "duration", time.Since(start))
+	return nil
+}
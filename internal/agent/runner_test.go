@@ -7,6 +7,9 @@ import (
 	"log/slog"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
 
 	"github.com/mattjoyce/agenticloop/internal/config"
 	"github.com/mattjoyce/agenticloop/internal/storage"
@@ -20,14 +23,75 @@ func TestRunnerEnqueueQueueFull(t *testing.T) {
 		EnqueueTimeout: 0,
 	}, nil, "", logger)
 
-	if err := runner.Enqueue("run-1"); err != nil {
+	if err := runner.Enqueue("run-1", 0); err != nil {
 		t.Fatalf("first enqueue should succeed: %v", err)
 	}
-	if err := runner.Enqueue("run-2"); !errors.Is(err, ErrQueueFull) {
+	if err := runner.Enqueue("run-2", 0); !errors.Is(err, ErrQueueFull) {
 		t.Fatalf("expected ErrQueueFull, got %v", err)
 	}
 }
 
+func TestRunnerQueueOrdersByPriorityThenFIFO(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runner := NewRunner(nil, nil, nil, nil, config.AgentConfig{QueueCapacity: 10}, nil, "", logger)
+
+	for _, item := range []struct {
+		id       string
+		priority int
+	}{
+		{"backlog-1", 0},
+		{"backlog-2", 0},
+		{"urgent", 10},
+		{"soon-1", 5},
+		{"soon-2", 5},
+		{"backlog-3", 0},
+	} {
+		if err := runner.Enqueue(item.id, item.priority); err != nil {
+			t.Fatalf("enqueue %s: %v", item.id, err)
+		}
+	}
+
+	want := []string{"urgent", "soon-1", "soon-2", "backlog-1", "backlog-2", "backlog-3"}
+	for i, id := range want {
+		got, ok := runner.queue.tryPop()
+		if !ok {
+			t.Fatalf("pop %d: queue empty", i)
+		}
+		if got != id {
+			t.Fatalf("pop %d = %s, want %s", i, got, id)
+		}
+	}
+	if _, ok := runner.queue.tryPop(); ok {
+		t.Fatalf("expected queue to be drained")
+	}
+}
+
+func TestRunQueueAgingLetsWaitingLowPriorityRunWin(t *testing.T) {
+	q := newRunQueue(10, time.Minute)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+
+	q.push("backlog", 0, 0)
+	// A steady stream of urgent runs keeps arriving while backlog waits.
+	for _, id := range []string{"urgent-1", "urgent-2"} {
+		now = now.Add(4 * time.Minute)
+		q.push(id, 10, 0)
+		if got, _ := q.tryPop(); got != id {
+			t.Fatalf("pop = %s, want %s while backlog is still young", got, id)
+		}
+	}
+
+	// After 12 minutes backlog's effective priority (0 + 12) beats a fresh 10.
+	now = now.Add(4 * time.Minute)
+	q.push("urgent-3", 10, 0)
+	want := []string{"backlog", "urgent-3"}
+	for i, id := range want {
+		if got, _ := q.tryPop(); got != id {
+			t.Fatalf("pop %d = %s, want %s", i, got, id)
+		}
+	}
+}
+
 func TestRunnerRecoverRunsIncludesQueuedAndRunning(t *testing.T) {
 	ctx := context.Background()
 	dbPath := filepath.Join(t.TempDir(), "agenticloop.db")
@@ -41,12 +105,12 @@ func TestRunnerRecoverRunsIncludesQueuedAndRunning(t *testing.T) {
 	stepStore := store.NewStepStore(db)
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
-	queuedRun, created, err := runStore.Create(ctx, "queued goal", nil, nil, nil)
+	queuedRun, created, err := runStore.Create(ctx, "queued goal", nil, nil, nil, nil, 0)
 	if err != nil || created {
 		t.Fatalf("create queued run: err=%v created=%v", err, created)
 	}
 
-	runningRun, created, err := runStore.Create(ctx, "running goal", nil, nil, nil)
+	runningRun, created, err := runStore.Create(ctx, "running goal", nil, nil, nil, nil, 0)
 	if err != nil || created {
 		t.Fatalf("create running run: err=%v created=%v", err, created)
 	}
@@ -65,12 +129,11 @@ func TestRunnerRecoverRunsIncludesQueuedAndRunning(t *testing.T) {
 
 	got := map[string]struct{}{}
 	for i := 0; i < 2; i++ {
-		select {
-		case runID := <-runner.queue:
-			got[runID] = struct{}{}
-		default:
+		runID, ok := runner.queue.tryPop()
+		if !ok {
 			t.Fatalf("expected 2 recovered run IDs, got %d", len(got))
 		}
+		got[runID] = struct{}{}
 	}
 
 	if _, ok := got[queuedRun.ID]; !ok {
@@ -80,3 +143,293 @@ func TestRunnerRecoverRunsIncludesQueuedAndRunning(t *testing.T) {
 		t.Fatalf("running run was not recovered")
 	}
 }
+
+func TestRunnerRecoverRunsDeadLettersAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "agenticloop.db")
+	db, err := storage.OpenSQLite(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	poison, _, err := runStore.Create(ctx, "crashes the process", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := runStore.UpdateStatus(ctx, poison.ID, store.RunStatusRunning, nil, nil); err != nil {
+		t.Fatalf("mark run running: %v", err)
+	}
+
+	// Each restart gets a fresh runner; the run never leaves "running" because
+	// the simulated process dies before the loop can finish it.
+	const maxAttempts = 2
+	for restart := 1; restart <= maxAttempts+1; restart++ {
+		runner := NewRunner(runStore, nil, nil, nil, config.AgentConfig{
+			QueueCapacity:       10,
+			MaxRecoveryAttempts: maxAttempts,
+		}, nil, "", logger)
+		if err := runner.RecoverRuns(ctx); err != nil {
+			t.Fatalf("restart %d: recover runs: %v", restart, err)
+		}
+
+		runID, ok := runner.queue.tryPop()
+		if ok && restart > maxAttempts {
+			t.Fatalf("restart %d: poison run %s should not be re-enqueued", restart, runID)
+		}
+		if !ok && restart <= maxAttempts {
+			t.Fatalf("restart %d: expected run to be re-enqueued", restart)
+		}
+	}
+
+	got, err := runStore.GetByID(ctx, poison.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got.Status != store.RunStatusFailed {
+		t.Fatalf("status = %s, want %s", got.Status, store.RunStatusFailed)
+	}
+	if got.FailureCode == nil || *got.FailureCode != store.FailureCodeRecoveryExhausted {
+		t.Fatalf("failure_code = %v, want %s", got.FailureCode, store.FailureCodeRecoveryExhausted)
+	}
+	if got.RecoveryAttempts != maxAttempts+1 {
+		t.Fatalf("recovery_attempts = %d, want %d", got.RecoveryAttempts, maxAttempts+1)
+	}
+}
+
+func TestRunnerReapStaleRunsRequeuesOrFailsOrphans(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runner := NewRunner(runStore, store.NewStepStore(db), nil, nil, config.AgentConfig{
+		QueueCapacity:       10,
+		MaxRecoveryAttempts: 2,
+		StaleRunThreshold:   10 * time.Minute,
+	}, nil, "", logger)
+
+	newRunning := func(goal string, updatedAgo time.Duration, attempts int) string {
+		t.Helper()
+		run, _, err := runStore.Create(ctx, goal, nil, nil, nil, nil, 0)
+		if err != nil {
+			t.Fatalf("create run: %v", err)
+		}
+		updatedAt := time.Now().UTC().Add(-updatedAgo).Format(time.RFC3339Nano)
+		if _, err := db.ExecContext(ctx, `UPDATE runs SET status = ?, recovery_attempts = ?, updated_at = ? WHERE id = ?`,
+			string(store.RunStatusRunning), attempts, updatedAt, run.ID); err != nil {
+			t.Fatalf("backdate run: %v", err)
+		}
+		return run.ID
+	}
+
+	orphan := newRunning("orphan", time.Hour, 0)
+	exhausted := newRunning("exhausted", time.Hour, 2)
+	active := newRunning("active", time.Hour, 0)
+	waiting := newRunning("waiting", time.Hour, 0)
+	fresh := newRunning("fresh", time.Minute, 0)
+
+	runner.setActive(active)
+	if err := runner.Enqueue(waiting, 0); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	reaped, err := runner.ReapStaleRuns(ctx)
+	if err != nil {
+		t.Fatalf("ReapStaleRuns: %v", err)
+	}
+	if reaped != 2 {
+		t.Fatalf("reaped = %d, want 2", reaped)
+	}
+
+	wantStatus := map[string]store.RunStatus{
+		orphan:    store.RunStatusQueued,
+		exhausted: store.RunStatusFailed,
+		active:    store.RunStatusRunning,
+		waiting:   store.RunStatusRunning,
+		fresh:     store.RunStatusRunning,
+	}
+	for id, want := range wantStatus {
+		got, err := runStore.GetByID(ctx, id)
+		if err != nil {
+			t.Fatalf("get run: %v", err)
+		}
+		if got.Status != want {
+			t.Fatalf("run %s (%s) status = %s, want %s", id, got.Goal, got.Status, want)
+		}
+	}
+	failed, _ := runStore.GetByID(ctx, exhausted)
+	if failed.FailureCode == nil || *failed.FailureCode != store.FailureCodeOrphaned {
+		t.Fatalf("failure code = %v, want orphaned", failed.FailureCode)
+	}
+
+	// A second sweep finds nothing: the orphan is queued now.
+	if reaped, err := runner.ReapStaleRuns(ctx); err != nil || reaped != 0 {
+		t.Fatalf("second sweep reaped %d (err %v), want 0", reaped, err)
+	}
+
+	var queued []string
+	for {
+		id, ok := runner.queue.tryPop()
+		if !ok {
+			break
+		}
+		queued = append(queued, id)
+	}
+	if len(queued) != 2 || queued[0] != waiting || queued[1] != orphan {
+		t.Fatalf("queue = %v, want [%s %s]", queued, waiting, orphan)
+	}
+}
+
+func TestRunnerOwnsRunWhileItLeavesTheQueue(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runner := NewRunner(nil, nil, nil, nil, config.AgentConfig{QueueCapacity: 1}, nil, "", logger)
+	if err := runner.Enqueue("run-1", 0); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	// The reaper runs concurrently with the worker; sample owns throughout
+	// the handoff from queue to active.
+	stop := make(chan struct{})
+	missed := make(chan bool, 1)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				missed <- false
+				return
+			default:
+			}
+			if !runner.owns("run-1") {
+				missed <- true
+				return
+			}
+		}
+	}()
+	runID, ok := runner.queue.pop(context.Background(), runner.setActive)
+	close(stop)
+	if !ok || runID != "run-1" {
+		t.Fatalf("pop = %q, %v", runID, ok)
+	}
+	if <-missed {
+		t.Fatal("owns reported false while the run moved from the queue to active")
+	}
+	if !runner.owns("run-1") {
+		t.Fatal("popped run is not active")
+	}
+}
+
+func TestRunnerProcessRunFailsRunPastMaxQueueWait(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runner := NewRunner(runStore, store.NewStepStore(db), nil, nil, config.AgentConfig{
+		QueueCapacity: 10,
+		MaxQueueWait:  time.Hour,
+	}, nil, "", logger)
+
+	run, _, err := runStore.Create(ctx, "stale request", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	createdAt := time.Now().UTC().Add(-2 * time.Hour).Format(time.RFC3339Nano)
+	if _, err := db.ExecContext(ctx, `UPDATE runs SET created_at = ? WHERE id = ?`, createdAt, run.ID); err != nil {
+		t.Fatalf("backdate run: %v", err)
+	}
+
+	// With no chat model, reaching Execute would panic; the run must be
+	// failed before that.
+	runner.processRun(ctx, run.ID)
+
+	got, err := runStore.GetByID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got.Status != store.RunStatusFailed || got.FailureCode == nil || *got.FailureCode != store.FailureCodeQueueExpired {
+		t.Fatalf("run = status %s failure_code %v, want failed/queue_expired", got.Status, got.FailureCode)
+	}
+	if got.StartedAt != nil {
+		t.Fatalf("expired run should never start, started_at = %v", got.StartedAt)
+	}
+}
+
+func TestRunnerExecutesSubrunInline(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	parent, _, err := runStore.Create(ctx, "survey two services", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	// The child's stages run between the parent's spawn_subrun call and the
+	// parent's next ACT round.
+	chatModel := &scriptedToolCallingModel{responses: []*schema.Message{
+		{Role: schema.Assistant, Content: `{"todo":[]}`},
+		{Role: schema.Assistant, Content: "1. delegate service A"},
+		{Role: schema.Assistant, ToolCalls: []schema.ToolCall{
+			{ID: "tc-1", Type: "function", Function: schema.FunctionCall{Name: "spawn_subrun", Arguments: `{"goal":"check service A"}`}},
+		}},
+		{Role: schema.Assistant, Content: `{"todo":[]}`},
+		{Role: schema.Assistant, Content: "1. check service A"},
+		{Role: schema.Assistant, Content: "service A is healthy"},
+		{Role: schema.Assistant, Content: `{"next_stage":"act"}`},
+		{Role: schema.Assistant, Content: "child finished"},
+		{Role: schema.Assistant, Content: `{"next_stage":"act"}`},
+	}}
+	runner := NewRunner(runStore, stepStore, chatModel, nil, config.AgentConfig{
+		DefaultMaxLoops:  1,
+		DefaultDeadline:  time.Minute,
+		MaxActRounds:     3,
+		MaxRetryPerStep:  1,
+		QueueCapacity:    10,
+		MaxSubrunDepth:   1,
+		MaxSubrunsPerRun: 5,
+		WorkspaceDir:     t.TempDir(),
+		Prompts:          config.AgentPrompts{Frame: "frame", Plan: "plan", Act: "act", Reflect: "reflect"},
+	}, nil, "", slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	done := make(chan struct{})
+	go func() {
+		runner.processRun(ctx, parent.ID)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("parent run did not finish; the subrun never ran")
+	}
+
+	children, err := runStore.List(ctx, store.RunFilter{ParentRunID: parent.ID})
+	if err != nil || len(children) != 1 {
+		t.Fatalf("children = %v, %v; want one", children, err)
+	}
+	if children[0].StartedAt == nil || (children[0].Status != store.RunStatusDone && children[0].Status != store.RunStatusFailed) {
+		t.Fatalf("child = status %s started_at %v, want a finished run", children[0].Status, children[0].StartedAt)
+	}
+	if chatModel.idx != len(chatModel.responses) {
+		t.Fatalf("model served %d of %d scripted responses", chatModel.idx, len(chatModel.responses))
+	}
+	if runner.owns(children[0].ID) {
+		t.Fatal("runner still reports the finished subrun as active")
+	}
+}
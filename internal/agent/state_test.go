@@ -2,7 +2,16 @@ package agent
 
 import (
 	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/mattjoyce/agenticloop/internal/config"
+	"github.com/mattjoyce/agenticloop/internal/store"
 )
 
 func TestNormalizeStateJSONFallback(t *testing.T) {
@@ -19,6 +28,27 @@ func TestNormalizeStateJSONFallback(t *testing.T) {
 	}
 }
 
+func TestResolvedNextStageUsesConfiguredRoutes(t *testing.T) {
+	routes := map[string]string{"plan": "plan", "act": "act", "done": "done", "replan": "frame", "escalate": "done"}
+	for _, tc := range []struct {
+		decision reflectDecision
+		want     string
+	}{
+		{reflectDecision{NextStage: "act"}, "act"},
+		{reflectDecision{NextStage: " Replan "}, "frame"},
+		{reflectDecision{NextStage: "escalate"}, "done"},
+		{reflectDecision{NextStage: "wander"}, "plan"},
+		{reflectDecision{Done: true}, "done"},
+	} {
+		if got := tc.decision.resolvedNextStage(routes); got != tc.want {
+			t.Fatalf("resolvedNextStage(%q) = %q, want %q", tc.decision.NextStage, got, tc.want)
+		}
+	}
+	if got := nextStageOptions(routes); got != "act|done|escalate|plan|replan" {
+		t.Fatalf("nextStageOptions = %q", got)
+	}
+}
+
 func TestMergeStateJSONUpdatedState(t *testing.T) {
 	existing := json.RawMessage(`{
 		"todo":[{"id":"T1","task":"first","done":false}],
@@ -73,3 +103,163 @@ func TestMergeStateJSONUpdatedState(t *testing.T) {
 		t.Fatalf("unexpected evidence order/content: %#v", evidence)
 	}
 }
+
+func TestResolveConstraintsSamplingOverrides(t *testing.T) {
+	loop := &Loop{
+		cfg:    config.AgentConfig{DefaultMaxLoops: 10, DefaultDeadline: 5 * time.Minute},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	got, err := loop.resolveConstraints("run-1", json.RawMessage(`{"max_loops":3,"deadline":"1m","temperature":0.2,"top_p":0.5}`))
+	if err != nil {
+		t.Fatalf("resolve constraints: %v", err)
+	}
+	if got.MaxLoops != 3 || got.Deadline != time.Minute {
+		t.Fatalf("unexpected limits: %+v", got)
+	}
+	opts := model.GetCommonOptions(&model.Options{}, got.ModelOptions...)
+	if opts.Temperature == nil || *opts.Temperature != 0.2 {
+		t.Fatalf("temperature override not applied: %v", opts.Temperature)
+	}
+	if opts.TopP == nil || *opts.TopP != 0.5 {
+		t.Fatalf("top_p override not applied: %v", opts.TopP)
+	}
+
+	if got, err = loop.resolveConstraints("run-2", json.RawMessage(`{"temperature":3,"top_p":-1}`)); err != nil {
+		t.Fatalf("resolve constraints: %v", err)
+	}
+	if len(got.ModelOptions) != 0 {
+		t.Fatalf("expected out-of-range overrides to be ignored, got %d options", len(got.ModelOptions))
+	}
+	if got.MaxLoops != 10 || got.Deadline != 5*time.Minute {
+		t.Fatalf("expected defaults, got %+v", got)
+	}
+
+	if _, err := loop.resolveConstraints("run-3", json.RawMessage(`{"allowed_tools":"workspace_read","denied_tools":["run_command"]}`)); err == nil {
+		t.Fatalf("expected malformed constraints to be rejected rather than dropping the tool policy")
+	}
+}
+
+func TestRenderStagePromptTrimsLowPriorityFieldsFirst(t *testing.T) {
+	tmpl := "GOAL {{.Goal}}\nFRAME {{.Frame}}\nMEMORY {{.Memory}}\nLOOP {{.LoopMemory}}"
+	state := stageState{
+		Goal:       "ship it",
+		Frame:      strings.Repeat("f", 200),
+		Memory:     strings.Repeat("m", 200),
+		LoopMemory: strings.Repeat("l", 1000),
+	}
+
+	loop := &Loop{
+		cfg:    config.AgentConfig{MaxPromptChars: 600},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	got := loop.renderStagePrompt("run-1", "act", tmpl, state)
+	if len(got) > 600 {
+		t.Fatalf("prompt length = %d, want <= 600", len(got))
+	}
+	if !strings.Contains(got, strings.Repeat("f", 200)) || !strings.Contains(got, strings.Repeat("m", 200)) {
+		t.Fatalf("expected frame and run memory to survive when trimming loop memory suffices")
+	}
+	if !strings.Contains(got, "truncated") {
+		t.Fatalf("expected truncation marker, got %q", got)
+	}
+
+	loop.cfg.MaxPromptChars = 300
+	got = loop.renderStagePrompt("run-1", "act", tmpl, state)
+	if len(got) > 300 {
+		t.Fatalf("prompt length = %d, want <= 300", len(got))
+	}
+	if strings.Contains(got, strings.Repeat("m", 200)) {
+		t.Fatalf("expected run memory to be trimmed once loop memory is exhausted")
+	}
+	if !strings.Contains(got, "GOAL ship it") {
+		t.Fatalf("expected goal to be preserved, got %q", got)
+	}
+
+	loop.cfg.MaxPromptChars = 0
+	if got := loop.renderStagePrompt("run-1", "act", tmpl, state); got != loop.renderPrompt(tmpl, state) {
+		t.Fatalf("expected unlimited prompt to render untouched")
+	}
+}
+
+func TestTrimForPromptKeepsValidUTF8(t *testing.T) {
+	s := strings.Repeat("é", 100) // 200 bytes of two-byte runes
+	for excess := 1; excess < 140; excess++ {
+		got := trimForPrompt(s, excess)
+		if !utf8.ValidString(got) {
+			t.Fatalf("excess %d: result is not valid UTF-8: %q", excess, got)
+		}
+		kept, _, _ := strings.Cut(got, "\n...[truncated")
+		if dropped := len(s) - len(kept); dropped < excess {
+			t.Fatalf("excess %d: dropped only %d bytes", excess, dropped)
+		}
+	}
+	if got := trimForPrompt("abc", 10); got != "...[truncated 3 bytes to fit max_prompt_chars]" {
+		t.Fatalf("trimForPrompt = %q", got)
+	}
+}
+
+func TestRenderStagePromptStampsClock(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := start.Add(90 * time.Second)
+	loop := &Loop{
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		now:        func() time.Time { return now },
+		startedAt:  start,
+		deadlineAt: start.Add(5 * time.Minute),
+	}
+	tmpl := "{{.CurrentTime}} elapsed={{.ElapsedSeconds}} remaining={{.RemainingSeconds}}"
+
+	if got := loop.renderStagePrompt("run-1", "act", tmpl, stageState{}); got != "2026-03-01T12:01:30Z elapsed=90 remaining=210" {
+		t.Fatalf("prompt = %q", got)
+	}
+
+	now = start.Add(10 * time.Minute)
+	if got := loop.renderStagePrompt("run-1", "act", tmpl, stageState{}); !strings.HasSuffix(got, "remaining=0") {
+		t.Fatalf("expected remaining to clamp at 0, got %q", got)
+	}
+}
+
+func TestGenerateOptionsAppliesStageOptions(t *testing.T) {
+	loop := &Loop{
+		modelOpts: []model.Option{model.WithTopP(0.5)},
+		stageOpts: map[store.StepPhase][]model.Option{
+			store.StepPhaseReflect: {model.WithTemperature(0)},
+		},
+	}
+
+	reflect := model.GetCommonOptions(&model.Options{}, loop.generateOptions(store.StepPhaseReflect)...)
+	if reflect.Temperature == nil || *reflect.Temperature != 0 {
+		t.Fatalf("expected reflect stage option, got %v", reflect.Temperature)
+	}
+	if reflect.TopP == nil || *reflect.TopP != 0.5 {
+		t.Fatalf("expected run-level option to be kept, got %v", reflect.TopP)
+	}
+
+	plan := model.GetCommonOptions(&model.Options{}, loop.generateOptions(store.StepPhasePlan)...)
+	if plan.Temperature != nil {
+		t.Fatalf("expected reflect-only option to be absent from plan, got %v", *plan.Temperature)
+	}
+}
+
+func TestGenerateOptionsAppliesStageMaxTokens(t *testing.T) {
+	loop := &Loop{
+		cfg: config.AgentConfig{StageMaxTokens: map[string]int{"reflect": 512}},
+		stageOpts: map[store.StepPhase][]model.Option{
+			store.StepPhaseReflect: {model.WithTemperature(0)},
+		},
+	}
+
+	reflect := model.GetCommonOptions(&model.Options{}, loop.generateOptions(store.StepPhaseReflect)...)
+	if reflect.MaxTokens == nil || *reflect.MaxTokens != 512 {
+		t.Fatalf("expected reflect max tokens 512, got %v", reflect.MaxTokens)
+	}
+	if reflect.Temperature == nil {
+		t.Fatalf("expected reflect stage options to be kept")
+	}
+
+	act := model.GetCommonOptions(&model.Options{}, loop.generateOptions(store.StepPhaseAct)...)
+	if act.MaxTokens != nil {
+		t.Fatalf("expected act to fall back to llm.max_tokens, got %d", *act.MaxTokens)
+	}
+}
@@ -0,0 +1,190 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/mattjoyce/agenticloop/internal/localtools"
+)
+
+// stateTool edits the run's state.json during ACT using the same merge rules
+// as reflect's updated_state, so the todo list can change mid-action.
+type stateTool struct {
+	name     string
+	desc     string
+	params   map[string]*schema.ParameterInfo
+	handler  func(ws *Workspace, args json.RawMessage) (map[string]any, error)
+	ws       *Workspace
+	observer localtools.Observer
+}
+
+var _ tool.InvokableTool = (*stateTool)(nil)
+
+// buildStateTools returns the todo tools bound to ws.
+func buildStateTools(ws *Workspace, observer localtools.Observer) []tool.BaseTool {
+	return []tool.BaseTool{
+		&stateTool{
+			name: "state_add_todo",
+			desc: "Add a todo item to the run's state.json todo list. Returns the updated list.",
+			params: map[string]*schema.ParameterInfo{
+				"task": {Type: schema.String, Desc: "What needs to be done", Required: true},
+				"id":   {Type: schema.String, Desc: "Optional todo id; defaults to the next free T<n>"},
+			},
+			handler:  addTodo,
+			ws:       ws,
+			observer: observer,
+		},
+		&stateTool{
+			name: "state_complete_todo",
+			desc: "Mark a todo item in the run's state.json as done. Returns the updated list.",
+			params: map[string]*schema.ParameterInfo{
+				"id": {Type: schema.String, Desc: "Id of the todo to complete", Required: true},
+			},
+			handler:  completeTodo,
+			ws:       ws,
+			observer: observer,
+		},
+	}
+}
+
+// Info returns tool metadata for model planning.
+func (t *stateTool) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name:        t.name,
+		Desc:        t.desc,
+		ParamsOneOf: schema.NewParamsOneOfByParams(t.params),
+	}, nil
+}
+
+// InvokableRun applies the edit and returns JSON output; failures are reported
+// to the model as a status "error" result.
+func (t *stateTool) InvokableRun(_ context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	resp, err := t.handler(t.ws, json.RawMessage(argumentsInJSON))
+	status := "ok"
+	if err != nil {
+		status = "error"
+		resp = map[string]any{"status": status, "error": err.Error()}
+	} else {
+		resp["status"] = status
+	}
+	out := string(mustJSON(resp))
+	if t.observer != nil {
+		t.observer(t.name, argumentsInJSON, out, status)
+	}
+	return out, nil
+}
+
+func addTodo(ws *Workspace, raw json.RawMessage) (map[string]any, error) {
+	var args struct {
+		Task string `json:"task"`
+		ID   string `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("parse arguments: %w", err)
+	}
+	args.Task = strings.TrimSpace(args.Task)
+	args.ID = strings.TrimSpace(args.ID)
+	if args.Task == "" {
+		return nil, fmt.Errorf("task is required")
+	}
+
+	todos, err := readTodos(ws)
+	if err != nil {
+		return nil, err
+	}
+	if args.ID == "" {
+		args.ID = nextTodoID(todos)
+	} else if findTodo(todos, args.ID) >= 0 {
+		return nil, fmt.Errorf("todo %s already exists", args.ID)
+	}
+
+	merged, err := writeTodoUpdate(ws, map[string]any{"id": args.ID, "task": args.Task, "done": false})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"id": args.ID, "todo": merged}, nil
+}
+
+func completeTodo(ws *Workspace, raw json.RawMessage) (map[string]any, error) {
+	var args struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("parse arguments: %w", err)
+	}
+	args.ID = strings.TrimSpace(args.ID)
+	if args.ID == "" {
+		return nil, fmt.Errorf("id is required")
+	}
+
+	todos, err := readTodos(ws)
+	if err != nil {
+		return nil, err
+	}
+	if findTodo(todos, args.ID) < 0 {
+		return nil, fmt.Errorf("todo %s not found", args.ID)
+	}
+
+	merged, err := writeTodoUpdate(ws, map[string]any{"id": args.ID, "done": true})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"id": args.ID, "todo": merged}, nil
+}
+
+// readTodos returns the todo list currently in state.json.
+func readTodos(ws *Workspace) ([]map[string]any, error) {
+	raw := ws.ReadState()
+	if raw == "" {
+		return nil, nil
+	}
+	var state map[string]any
+	if err := json.Unmarshal([]byte(raw), &state); err != nil {
+		return nil, fmt.Errorf("parse state.json: %w", err)
+	}
+	return toObjectList(state["todo"]), nil
+}
+
+// writeTodoUpdate merges one todo item into state.json and returns the
+// resulting todo list.
+func writeTodoUpdate(ws *Workspace, item map[string]any) ([]map[string]any, error) {
+	merged, err := mergeStateJSON(json.RawMessage(ws.ReadState()), mustJSON(map[string]any{"todo": []any{item}}))
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.WriteState(merged); err != nil {
+		return nil, err
+	}
+	var state map[string]any
+	if err := json.Unmarshal(merged, &state); err != nil {
+		return nil, fmt.Errorf("parse merged state: %w", err)
+	}
+	return toObjectList(state["todo"]), nil
+}
+
+func findTodo(todos []map[string]any, id string) int {
+	for i, item := range todos {
+		if itemID, _ := item["id"].(string); strings.TrimSpace(itemID) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// nextTodoID returns T<n> one past the highest numbered T-id in todos.
+func nextTodoID(todos []map[string]any) string {
+	highest := 0
+	for _, item := range todos {
+		id, _ := item["id"].(string)
+		if n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(id), "T")); err == nil && n > highest {
+			highest = n
+		}
+	}
+	return "T" + strconv.Itoa(highest+1)
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestStateToolsAddAndCompleteTodo(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir(), "run-1")
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+	if err := ws.WriteState(json.RawMessage(`{"todo":[{"id":"T1","task":"existing","done":false}],"notes":["keep"]}`)); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+
+	var observed []string
+	tools := buildStateTools(ws, func(name, _, _, status string) {
+		observed = append(observed, name+":"+status)
+	})
+	add := tools[0].(*stateTool)
+	complete := tools[1].(*stateTool)
+
+	out, err := add.InvokableRun(context.Background(), `{"task":"write report"}`)
+	if err != nil {
+		t.Fatalf("add todo: %v", err)
+	}
+	if !strings.Contains(out, `"id":"T2"`) {
+		t.Fatalf("expected generated id T2, got %s", out)
+	}
+
+	if _, err := complete.InvokableRun(context.Background(), `{"id":"T1"}`); err != nil {
+		t.Fatalf("complete todo: %v", err)
+	}
+
+	var state struct {
+		Todo  []map[string]any `json:"todo"`
+		Notes []string         `json:"notes"`
+	}
+	if err := json.Unmarshal([]byte(ws.ReadState()), &state); err != nil {
+		t.Fatalf("decode state: %v", err)
+	}
+	if len(state.Todo) != 2 || state.Todo[0]["done"] != true || state.Todo[0]["task"] != "existing" {
+		t.Fatalf("unexpected todo list: %+v", state.Todo)
+	}
+	if state.Todo[1]["task"] != "write report" || state.Todo[1]["done"] != false {
+		t.Fatalf("unexpected added todo: %+v", state.Todo[1])
+	}
+	if len(state.Notes) != 1 {
+		t.Fatalf("notes should be preserved, got %v", state.Notes)
+	}
+
+	out, _ = complete.InvokableRun(context.Background(), `{"id":"T9"}`)
+	if !strings.Contains(out, `"status":"error"`) || !strings.Contains(out, "todo T9 not found") {
+		t.Fatalf("expected not-found error, got %s", out)
+	}
+	if want := "state_add_todo:ok,state_complete_todo:ok,state_complete_todo:error"; strings.Join(observed, ",") != want {
+		t.Fatalf("observed = %v, want %s", observed, want)
+	}
+}
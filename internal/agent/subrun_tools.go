@@ -0,0 +1,205 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/mattjoyce/agenticloop/internal/localtools"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// subrunExecutor runs a stored child run to completion; Runner implements it.
+type subrunExecutor interface {
+	ExecuteSubrun(ctx context.Context, runID string) error
+}
+
+// subruns holds what the subrun tools share: the parent run, the depth limit
+// resolved from config and constraints, and how many children it may spawn.
+type subruns struct {
+	runs        *store.RunStore
+	exec        subrunExecutor
+	parent      *store.Run
+	maxDepth    int
+	maxChildren int
+}
+
+// subrunTool lets ACT split a goal into child runs and follow their progress.
+type subrunTool struct {
+	name     string
+	desc     string
+	params   map[string]*schema.ParameterInfo
+	handler  func(ctx context.Context, s *subruns, args json.RawMessage) (map[string]any, error)
+	subruns  *subruns
+	observer localtools.Observer
+}
+
+var _ tool.InvokableTool = (*subrunTool)(nil)
+
+// buildSubrunTools returns spawn_subrun and get_subrun_status bound to parent.
+func buildSubrunTools(runs *store.RunStore, exec subrunExecutor, parent *store.Run, maxDepth, maxChildren int, observer localtools.Observer) []tool.BaseTool {
+	s := &subruns{runs: runs, exec: exec, parent: parent, maxDepth: maxDepth, maxChildren: maxChildren}
+	return []tool.BaseTool{
+		&subrunTool{
+			name: "spawn_subrun",
+			desc: "Run a child run for a sub-goal and wait for it to finish. It inherits this run's constraints and labels; returns the child run_id, run_status, and summary or error.",
+			params: map[string]*schema.ParameterInfo{
+				"goal":     {Type: schema.String, Desc: "Goal for the child run", Required: true},
+				"context":  {Type: schema.Object, Desc: "Optional context object passed to the child run"},
+				"priority": {Type: schema.Integer, Desc: "Optional priority, at most this run's priority (the default)"},
+			},
+			handler:  spawnSubrun,
+			subruns:  s,
+			observer: observer,
+		},
+		&subrunTool{
+			name: "get_subrun_status",
+			desc: "Report the status and summary of this run's child runs, or of one child when run_id is given.",
+			params: map[string]*schema.ParameterInfo{
+				"run_id": {Type: schema.String, Desc: "Optional child run id"},
+			},
+			handler:  getSubrunStatus,
+			subruns:  s,
+			observer: observer,
+		},
+	}
+}
+
+// Info returns tool metadata for model planning.
+func (t *subrunTool) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name:        t.name,
+		Desc:        t.desc,
+		ParamsOneOf: schema.NewParamsOneOfByParams(t.params),
+	}, nil
+}
+
+// InvokableRun runs the handler and returns JSON output; failures are
+// reported to the model as a status "error" result.
+func (t *subrunTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	resp, err := t.handler(ctx, t.subruns, json.RawMessage(argumentsInJSON))
+	status := "ok"
+	if err != nil {
+		status = "error"
+		resp = map[string]any{"status": status, "error": err.Error()}
+	} else {
+		resp["status"] = status
+	}
+	out := string(mustJSON(resp))
+	if t.observer != nil {
+		t.observer(t.name, argumentsInJSON, out, status)
+	}
+	return out, nil
+}
+
+func spawnSubrun(ctx context.Context, s *subruns, raw json.RawMessage) (map[string]any, error) {
+	var args struct {
+		Goal     string          `json:"goal"`
+		Context  json.RawMessage `json:"context"`
+		Priority *int            `json:"priority"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("parse arguments: %w", err)
+	}
+	args.Goal = strings.TrimSpace(args.Goal)
+	if args.Goal == "" {
+		return nil, fmt.Errorf("goal is required")
+	}
+	if len(args.Context) > 0 && string(args.Context) != "null" {
+		var obj map[string]any
+		if err := json.Unmarshal(args.Context, &obj); err != nil {
+			return nil, fmt.Errorf("context must be a JSON object")
+		}
+	} else {
+		args.Context = nil
+	}
+	// A child may not outrank its parent, or spawning would be a way to jump
+	// the queue when the child is recovered after a restart.
+	priority := s.parent.Priority
+	if args.Priority != nil && *args.Priority < priority {
+		priority = *args.Priority
+	}
+
+	depth, err := s.runs.Depth(ctx, s.parent.ID)
+	if err != nil {
+		return nil, err
+	}
+	if depth+1 > s.maxDepth {
+		return nil, fmt.Errorf("subrun depth limit %d reached", s.maxDepth)
+	}
+	children, err := s.runs.List(ctx, store.RunFilter{ParentRunID: s.parent.ID})
+	if err != nil {
+		return nil, err
+	}
+	if len(children) >= s.maxChildren {
+		return nil, fmt.Errorf("subrun limit %d reached for this run", s.maxChildren)
+	}
+
+	child, err := s.runs.CreateChild(ctx, s.parent.ID, args.Goal, args.Context, s.parent.Constraints, s.parent.Labels, priority)
+	if err != nil {
+		return nil, err
+	}
+	// The child runs inline: the serial worker is busy with this run, so a
+	// queued child would not start until the parent had finished.
+	if err := s.exec.ExecuteSubrun(ctx, child.ID); err != nil && ctx.Err() != nil {
+		return nil, fmt.Errorf("subrun %s interrupted: %w", child.ID, err)
+	}
+	if child, err = s.runs.GetByID(ctx, child.ID); err != nil {
+		return nil, err
+	}
+	out := subrunStatus(child)
+	out["depth"] = depth + 1
+	return out, nil
+}
+
+func getSubrunStatus(ctx context.Context, s *subruns, raw json.RawMessage) (map[string]any, error) {
+	var args struct {
+		RunID string `json:"run_id"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("parse arguments: %w", err)
+	}
+	args.RunID = strings.TrimSpace(args.RunID)
+
+	if args.RunID != "" {
+		child, err := s.runs.GetByID(ctx, args.RunID)
+		if err != nil {
+			return nil, fmt.Errorf("subrun %s not found", args.RunID)
+		}
+		if child.ParentRunID == nil || *child.ParentRunID != s.parent.ID {
+			return nil, fmt.Errorf("run %s is not a subrun of this run", args.RunID)
+		}
+		return map[string]any{"subrun": subrunStatus(child)}, nil
+	}
+
+	children, err := s.runs.List(ctx, store.RunFilter{ParentRunID: s.parent.ID})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]map[string]any, 0, len(children))
+	for _, child := range children {
+		out = append(out, subrunStatus(child))
+	}
+	return map[string]any{"subruns": out}, nil
+}
+
+func subrunStatus(run *store.Run) map[string]any {
+	out := map[string]any{
+		"run_id":     run.ID,
+		"goal":       run.Goal,
+		"run_status": string(run.Status),
+	}
+	if run.Summary != nil {
+		out["summary"] = *run.Summary
+	} else if run.WorkingSummary != nil {
+		out["working_summary"] = *run.WorkingSummary
+	}
+	if run.Error != nil {
+		out["error"] = *run.Error
+	}
+	return out
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/tool"
+
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// finishingExecutor completes each subrun it is asked to run with a fixed
+// summary, standing in for the runner's inline execution.
+type finishingExecutor struct {
+	runs *store.RunStore
+	ids  []string
+}
+
+func (e *finishingExecutor) ExecuteSubrun(ctx context.Context, runID string) error {
+	e.ids = append(e.ids, runID)
+	summary := "service A is healthy"
+	return e.runs.UpdateStatus(ctx, runID, store.RunStatusDone, &summary, nil)
+}
+
+func TestSubrunToolsSpawnWithinDepthAndReportStatus(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	parent, _, err := runStore.Create(ctx, "survey three services", nil, nil, json.RawMessage(`{"max_loops":2}`), map[string]string{"team": "ops"}, 3)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	exec := &finishingExecutor{runs: runStore}
+	spawn, status := subrunToolPair(t, buildSubrunTools(runStore, exec, parent, 1, 2, nil))
+
+	out, _ := spawn.InvokableRun(ctx, `{"goal":"check service A","context":{"host":"a.internal"},"priority":9}`)
+	var spawned struct {
+		Status    string `json:"status"`
+		RunID     string `json:"run_id"`
+		RunStatus string `json:"run_status"`
+		Summary   string `json:"summary"`
+		Depth     int    `json:"depth"`
+	}
+	if err := json.Unmarshal([]byte(out), &spawned); err != nil || spawned.Status != "ok" || spawned.Depth != 1 {
+		t.Fatalf("spawn_subrun = %s", out)
+	}
+	if len(exec.ids) != 1 || exec.ids[0] != spawned.RunID {
+		t.Fatalf("executed = %v, want [%s]", exec.ids, spawned.RunID)
+	}
+	// The child ran before spawn_subrun returned, so its outcome is included.
+	if spawned.RunStatus != "done" || spawned.Summary != "service A is healthy" {
+		t.Fatalf("spawn_subrun did not report the finished child: %s", out)
+	}
+
+	child, err := runStore.GetByID(ctx, spawned.RunID)
+	if err != nil {
+		t.Fatalf("get child: %v", err)
+	}
+	if child.ParentRunID == nil || *child.ParentRunID != parent.ID {
+		t.Fatalf("child parent_run_id = %v, want %s", child.ParentRunID, parent.ID)
+	}
+	// A requested priority above the parent's is clamped to the parent's.
+	if child.Priority != 3 || child.Labels["team"] != "ops" || string(child.Constraints) != `{"max_loops":2}` {
+		t.Fatalf("child did not inherit parent settings: %+v", child)
+	}
+
+	// The child is already at the limit, so it cannot spawn its own subruns.
+	childSpawn, _ := subrunToolPair(t, buildSubrunTools(runStore, exec, child, 1, 2, nil))
+	if out, _ := childSpawn.InvokableRun(ctx, `{"goal":"go deeper"}`); !strings.Contains(out, "depth limit 1 reached") {
+		t.Fatalf("expected depth limit error, got %s", out)
+	}
+	if len(exec.ids) != 1 {
+		t.Fatalf("depth-limited spawn executed %v", exec.ids)
+	}
+
+	// The parent may spawn two children in total.
+	if out, _ := spawn.InvokableRun(ctx, `{"goal":"check service B","priority":1}`); !strings.Contains(out, `"status":"ok"`) {
+		t.Fatalf("second spawn_subrun = %s", out)
+	}
+	if second, err := runStore.GetByID(ctx, exec.ids[1]); err != nil || second.Priority != 1 {
+		t.Fatalf("second child priority = %+v, %v; want 1", second, err)
+	}
+	if out, _ := spawn.InvokableRun(ctx, `{"goal":"check service C"}`); !strings.Contains(out, "subrun limit 2 reached") {
+		t.Fatalf("expected subrun limit error, got %s", out)
+	}
+
+	out, _ = status.InvokableRun(ctx, `{}`)
+	if !strings.Contains(out, `"run_status":"done"`) || !strings.Contains(out, "service A is healthy") {
+		t.Fatalf("get_subrun_status = %s", out)
+	}
+	if out, _ := status.InvokableRun(ctx, `{"run_id":"`+parent.ID+`"}`); !strings.Contains(out, "not a subrun") {
+		t.Fatalf("expected non-child lookup to fail, got %s", out)
+	}
+}
+
+func subrunToolPair(t *testing.T, tools []tool.BaseTool) (spawn, status tool.InvokableTool) {
+	t.Helper()
+	if len(tools) != 2 {
+		t.Fatalf("got %d subrun tools, want 2", len(tools))
+	}
+	return tools[0].(tool.InvokableTool), tools[1].(tool.InvokableTool)
+}
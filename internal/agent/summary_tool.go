@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/mattjoyce/agenticloop/internal/localtools"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// maxWorkingSummaryChars bounds what set_summary stores on the run.
+const maxWorkingSummaryChars = 4000
+
+// summaryTool lets ACT record the run's current best summary. It is kept on
+// the run as working_summary and used as the summary if the run fails.
+type summaryTool struct {
+	runs     *store.RunStore
+	runID    string
+	redactor *Redactor
+	observer localtools.Observer
+}
+
+var _ tool.InvokableTool = (*summaryTool)(nil)
+
+func newSummaryTool(runs *store.RunStore, runID string, redactor *Redactor, observer localtools.Observer) *summaryTool {
+	return &summaryTool{runs: runs, runID: runID, redactor: redactor, observer: observer}
+}
+
+// Info returns tool metadata for model planning.
+func (t *summaryTool) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: "set_summary",
+		Desc: "Record your current best summary of the run's progress and findings. Replaces any earlier summary; it is reported if the run stops before finishing.",
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"summary": {Type: schema.String, Desc: "Summary of what has been done and found so far", Required: true},
+		}),
+	}, nil
+}
+
+// InvokableRun stores the summary and returns JSON output; failures are
+// reported to the model as a status "error" result.
+func (t *summaryTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	resp, err := t.set(ctx, json.RawMessage(argumentsInJSON))
+	status := "ok"
+	if err != nil {
+		status = "error"
+		resp = map[string]any{"status": status, "error": err.Error()}
+	} else {
+		resp["status"] = status
+	}
+	out := string(mustJSON(resp))
+	if t.observer != nil {
+		t.observer("set_summary", argumentsInJSON, out, status)
+	}
+	return out, nil
+}
+
+func (t *summaryTool) set(ctx context.Context, raw json.RawMessage) (map[string]any, error) {
+	var args struct {
+		Summary string `json:"summary"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("parse arguments: %w", err)
+	}
+	summary := strings.TrimSpace(args.Summary)
+	if summary == "" {
+		return nil, fmt.Errorf("summary is required")
+	}
+	summary = clipText(t.redactor.String(summary), maxWorkingSummaryChars)
+	if err := t.runs.UpdateWorkingSummary(ctx, t.runID, summary); err != nil {
+		return nil, err
+	}
+	return map[string]any{"chars": len(summary)}, nil
+}
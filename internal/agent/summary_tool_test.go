@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestSummaryToolKeepsWorkingSummaryForFailedRun(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "long investigation", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	summaryTool := newSummaryTool(runStore, run.ID, nil, nil)
+	if out, _ := summaryTool.InvokableRun(ctx, `{"summary":""}`); !strings.Contains(out, `"status":"error"`) {
+		t.Fatalf("expected empty summary to be rejected, got %s", out)
+	}
+	for _, s := range []string{"found the config", "found the config and the bug"} {
+		if out, _ := summaryTool.InvokableRun(ctx, `{"summary":"`+s+`"}`); !strings.Contains(out, `"status":"ok"`) {
+			t.Fatalf("set_summary: %s", out)
+		}
+	}
+
+	got, err := runStore.GetByID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got.WorkingSummary == nil || *got.WorkingSummary != "found the config and the bug" || got.Summary != nil {
+		t.Fatalf("working summary = %v summary = %v", got.WorkingSummary, got.Summary)
+	}
+
+	if err := runStore.Fail(ctx, run.ID, "", "deadline exceeded"); err != nil {
+		t.Fatalf("fail run: %v", err)
+	}
+	got, err = runStore.GetByID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got.Summary == nil || *got.Summary != "found the config and the bug" {
+		t.Fatalf("failed run summary = %v, want the working summary", got.Summary)
+	}
+}
@@ -2,11 +2,17 @@ package agent
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/mattjoyce/agenticloop/internal/localtools"
 )
 
 // Workspace manages a per-run directory with a memory file for inter-loop context.
@@ -16,21 +22,96 @@ type Workspace struct {
 	loopMemoryPath string
 	promptPath     string
 	statePath      string
+	checkpointPath string
+	// stateDir holds the run's manifests and replay snapshots, outside dir.
+	stateDir string
+	// loopDir holds the loop's own files: memory, prompt log, state.json,
+	// checkpoint, trace, decisions, and evidence. It is dir for a managed
+	// workspace and stateDir for an external one, so nothing is written into
+	// a caller's directory except by the agent's tools.
+	loopDir string
+	// external marks a pre-existing directory chosen with the workspace_path
+	// constraint; it is never deleted by the service.
+	external bool
+}
+
+// Evidence file names, one per supported agent.evidence_format.
+const (
+	EvidenceMarkdownFile = "evidence.md"
+	EvidenceJSONFile     = "evidence.json"
+)
+
+// EvidenceEntry is a single report_success record in the evidence trail.
+type EvidenceEntry struct {
+	Iteration  int    `json:"iteration"`
+	RecordedAt string `json:"recorded_at"`
+	Summary    string `json:"summary"`
+	Evidence   string `json:"evidence"`
 }
 
-// NewWorkspace creates a workspace directory for a run.
+// NewWorkspace creates a workspace directory for a run. Its state directory is
+// localtools.RunStateDir(baseDir, runID).
 func NewWorkspace(baseDir, runID string) (*Workspace, error) {
 	dir := filepath.Join(baseDir, runID)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return nil, fmt.Errorf("create workspace: %w", err)
 	}
+	return newWorkspaceAt(dir, localtools.RunStateDir(baseDir, runID), dir), nil
+}
+
+// NewExternalWorkspace uses an existing directory as a run's workspace. path
+// is absolute or relative to root, and must resolve, after following
+// symlinks, to a directory inside root. stateDir holds the run's manifests
+// and replay snapshots as well as the loop's own files.
+func NewExternalWorkspace(root, path, stateDir string) (*Workspace, error) {
+	if strings.TrimSpace(root) == "" {
+		return nil, errors.New("agent.external_workspace_root is not configured")
+	}
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("resolve external workspace root: %w", err)
+	}
+	rootReal, err := filepath.EvalSymlinks(rootAbs)
+	if err != nil {
+		return nil, fmt.Errorf("resolve external workspace root: %w", err)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(rootReal, path)
+	}
+	dir, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", path, err)
+	}
+	rel, err := filepath.Rel(rootReal, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return nil, fmt.Errorf("%s is outside agent.external_workspace_root", path)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", path)
+	}
+	if err := os.MkdirAll(stateDir, 0o755); err != nil {
+		return nil, fmt.Errorf("create run state dir: %w", err)
+	}
+	ws := newWorkspaceAt(dir, stateDir, stateDir)
+	ws.external = true
+	return ws, nil
+}
+
+func newWorkspaceAt(dir, stateDir, loopDir string) *Workspace {
 	return &Workspace{
 		dir:            dir,
-		runMemoryPath:  filepath.Join(dir, "run_memory.md"),
-		loopMemoryPath: filepath.Join(dir, "loop_memory.md"),
-		promptPath:     filepath.Join(dir, "prompt.md"),
-		statePath:      filepath.Join(dir, "state.json"),
-	}, nil
+		stateDir:       stateDir,
+		loopDir:        loopDir,
+		runMemoryPath:  filepath.Join(loopDir, "run_memory.md"),
+		loopMemoryPath: filepath.Join(loopDir, "loop_memory.md"),
+		promptPath:     filepath.Join(loopDir, "prompt.md"),
+		statePath:      filepath.Join(loopDir, "state.json"),
+		checkpointPath: filepath.Join(loopDir, "checkpoint.json"),
+	}
 }
 
 // AppendLoopToolCall records a tool invocation and its result to the per-loop memory file.
@@ -50,6 +131,26 @@ func (w *Workspace) AppendLoopToolCall(tool, input, output, status string) error
 	return nil
 }
 
+// AppendLoopAssistant records the assistant's text from one ACT round to the
+// per-loop memory file, so reasoning between tool calls is kept in order.
+func (w *Workspace) AppendLoopAssistant(round int, content string) error {
+	if strings.TrimSpace(content) == "" {
+		return nil
+	}
+	f, err := os.OpenFile(w.loopMemoryPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open loop memory file: %w", err)
+	}
+	defer f.Close()
+
+	entry := fmt.Sprintf("## %s — assistant (round %d)\n%s\n\n",
+		time.Now().UTC().Format(time.RFC3339), round, strings.TrimSpace(content))
+	if _, err := f.WriteString(entry); err != nil {
+		return fmt.Errorf("write loop memory entry: %w", err)
+	}
+	return nil
+}
+
 // ReadLoopMemory returns the full contents of loop memory.
 func (w *Workspace) ReadLoopMemory() string {
 	data, err := os.ReadFile(w.loopMemoryPath)
@@ -74,13 +175,34 @@ func (w *Workspace) ArchiveLoopMemory(iter int) error {
 	if err != nil || len(strings.TrimSpace(string(data))) == 0 {
 		return nil
 	}
-	dst := filepath.Join(w.dir, fmt.Sprintf("loop_memory_iter_%d.md", iter))
+	dst := filepath.Join(w.loopDir, fmt.Sprintf("loop_memory_iter_%d.md", iter))
 	if err := os.WriteFile(dst, data, 0o644); err != nil {
 		return fmt.Errorf("archive loop memory iter %d: %w", iter, err)
 	}
 	return nil
 }
 
+// ReadRecentLoopMemories concatenates the archived loop memories for up to
+// window iterations before iter, oldest first. Missing archives are skipped.
+func (w *Workspace) ReadRecentLoopMemories(iter, window int) string {
+	if window <= 0 {
+		return ""
+	}
+	first := iter - window
+	if first < 1 {
+		first = 1
+	}
+	var b strings.Builder
+	for i := first; i < iter; i++ {
+		data, err := os.ReadFile(filepath.Join(w.loopDir, fmt.Sprintf("loop_memory_iter_%d.md", i)))
+		if err != nil || len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "# Iteration %d\n\n%s\n\n", i, strings.TrimSpace(string(data)))
+	}
+	return strings.TrimSpace(b.String())
+}
+
 // AppendRunMemory appends distilled reflective memory for cross-loop context.
 func (w *Workspace) AppendRunMemory(iteration int, text string) error {
 	if strings.TrimSpace(text) == "" {
@@ -138,6 +260,64 @@ func (w *Workspace) WritePromptSnapshot(goal string, runContext, constraints jso
 	return nil
 }
 
+// LLMTraceFile is the workspace file agent.debug_capture_llm writes to.
+const LLMTraceFile = "llm_trace.jsonl"
+
+// LLMTraceEntry is one model call recorded in llm_trace.jsonl.
+type LLMTraceEntry struct {
+	Iteration  int               `json:"iteration"`
+	Phase      string            `json:"phase"`
+	StartedAt  string            `json:"started_at"`
+	DurationMS int64             `json:"duration_ms"`
+	Messages   []*schema.Message `json:"messages"`
+	Response   *schema.Message   `json:"response,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// AppendLLMTrace appends one JSON line to llm_trace.jsonl.
+func (w *Workspace) AppendLLMTrace(line json.RawMessage) error {
+	f, err := os.OpenFile(filepath.Join(w.loopDir, LLMTraceFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open llm trace file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write llm trace entry: %w", err)
+	}
+	return nil
+}
+
+// DecisionsFile is the workspace file log_decision appends to.
+const DecisionsFile = "decisions.jsonl"
+
+// DecisionEntry is one decision recorded in decisions.jsonl.
+type DecisionEntry struct {
+	Iteration              int      `json:"iteration"`
+	RecordedAt             string   `json:"recorded_at"`
+	Decision               string   `json:"decision"`
+	Rationale              string   `json:"rationale"`
+	AlternativesConsidered []string `json:"alternatives_considered,omitempty"`
+}
+
+// AppendDecision appends one entry to decisions.jsonl.
+func (w *Workspace) AppendDecision(entry DecisionEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal decision: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(w.loopDir, DecisionsFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open decisions file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write decision entry: %w", err)
+	}
+	return nil
+}
+
 // AppendStagePrompt appends a rendered stage prompt for an iteration.
 func (w *Workspace) AppendStagePrompt(iteration int, stage, prompt string) error {
 	f, err := os.OpenFile(w.promptPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
@@ -153,6 +333,62 @@ func (w *Workspace) AppendStagePrompt(iteration int, stage, prompt string) error
 	return nil
 }
 
+// AppendEvidence records report_success evidence in the workspace evidence trail.
+// format is "markdown" (default) or "json"; "none" disables recording.
+func (w *Workspace) AppendEvidence(format string, iteration int, summary, evidence string) error {
+	entry := EvidenceEntry{
+		Iteration:  iteration,
+		RecordedAt: time.Now().UTC().Format(time.RFC3339),
+		Summary:    strings.TrimSpace(summary),
+		Evidence:   strings.TrimSpace(evidence),
+	}
+
+	switch format {
+	case "none":
+		return nil
+	case "json":
+		path := filepath.Join(w.loopDir, EvidenceJSONFile)
+		var entries []EvidenceEntry
+		if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+			if err := json.Unmarshal(data, &entries); err != nil {
+				return fmt.Errorf("parse evidence file: %w", err)
+			}
+		}
+		entries = append(entries, entry)
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal evidence: %w", err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return fmt.Errorf("write evidence file: %w", err)
+		}
+		return nil
+	default:
+		f, err := os.OpenFile(filepath.Join(w.loopDir, EvidenceMarkdownFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("open evidence file: %w", err)
+		}
+		defer f.Close()
+
+		text := fmt.Sprintf("## Iteration %d — %s\n**Summary:** %s\n\n**Evidence:**\n%s\n\n", entry.Iteration, entry.RecordedAt, entry.Summary, entry.Evidence)
+		if _, err := f.WriteString(text); err != nil {
+			return fmt.Errorf("write evidence entry: %w", err)
+		}
+		return nil
+	}
+}
+
+// ReadEvidence returns the recorded evidence trail, preferring evidence.md
+// over evidence.json. It returns "" when nothing has been recorded.
+func (w *Workspace) ReadEvidence() string {
+	for _, name := range []string{EvidenceMarkdownFile, EvidenceJSONFile} {
+		if data, err := os.ReadFile(filepath.Join(w.loopDir, name)); err == nil && len(data) > 0 {
+			return string(data)
+		}
+	}
+	return ""
+}
+
 // ReadState returns the persisted structured loop state payload.
 func (w *Workspace) ReadState() string {
 	data, err := os.ReadFile(w.statePath)
@@ -173,7 +409,139 @@ func (w *Workspace) WriteState(state json.RawMessage) error {
 	return nil
 }
 
+// Checkpoint is the resumable loop position persisted after every stage so a
+// recovered run can continue where it stopped instead of restarting at frame.
+type Checkpoint struct {
+	Iteration       int       `json:"iteration"`
+	NextStage       string    `json:"next_stage"`
+	Frame           string    `json:"frame,omitempty"`
+	Plan            string    `json:"plan,omitempty"`
+	Act             string    `json:"act,omitempty"`
+	Observe         string    `json:"observe,omitempty"`
+	RecentErrors    string    `json:"recent_errors,omitempty"`
+	ActTruncated    bool      `json:"act_truncated,omitempty"`
+	NextFocus       string    `json:"next_focus,omitempty"`
+	LastReflection  string    `json:"last_reflection,omitempty"`
+	UserGuidance    string    `json:"user_guidance,omitempty"`
+	SuccessReported bool      `json:"success_reported,omitempty"`
+	SuccessSummary  string    `json:"success_summary,omitempty"`
+	LoopExtension   int       `json:"loop_extension,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ReadCheckpoint returns the persisted checkpoint, or nil when none exists or it is unreadable.
+func (w *Workspace) ReadCheckpoint() *Checkpoint {
+	data, err := os.ReadFile(w.checkpointPath)
+	if err != nil {
+		return nil
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil
+	}
+	return &cp
+}
+
+// WriteCheckpoint atomically replaces checkpoint.json with cp.
+func (w *Workspace) WriteCheckpoint(cp Checkpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal checkpoint: %w", err)
+	}
+	tmp := w.checkpointPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write checkpoint file: %w", err)
+	}
+	if err := os.Rename(tmp, w.checkpointPath); err != nil {
+		return fmt.Errorf("replace checkpoint file: %w", err)
+	}
+	return nil
+}
+
+// RemoveCheckpoint deletes checkpoint.json so a finished run leaves no
+// resumable position behind.
+func (w *Workspace) RemoveCheckpoint() error {
+	if err := os.Remove(w.checkpointPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove checkpoint file: %w", err)
+	}
+	return nil
+}
+
+// bookkeepingFiles are workspace files maintained by the loop itself rather
+// than by the agent's tools.
+var bookkeepingFiles = map[string]bool{
+	"run_memory.md":       true,
+	"loop_memory.md":      true,
+	"prompt.md":           true,
+	"state.json":          true,
+	"checkpoint.json":     true,
+	"checkpoint.json.tmp": true,
+	EvidenceMarkdownFile:  true,
+	EvidenceJSONFile:      true,
+	LLMTraceFile:          true,
+	DecisionsFile:         true,
+	StepArchiveFile:       true,
+}
+
+// isBookkeepingFile reports whether rel is a loop-maintained workspace file.
+func isBookkeepingFile(rel string) bool {
+	if bookkeepingFiles[rel] {
+		return true
+	}
+	return strings.HasPrefix(rel, "loop_memory_iter_") && strings.HasSuffix(rel, ".md")
+}
+
+// ContinuationCarryFiles are the bookkeeping files a continuation starts
+// from: the parent's run memory and todo state.
+var ContinuationCarryFiles = []string{"run_memory.md", "state.json"}
+
+// SkipOnContinuation reports whether rel is left behind when a continuation
+// copies its parent's workspace: bookkeeping that describes how the parent
+// ran rather than what it produced. The continuation starts its own
+// checkpoint, loop memory, prompt log, trace, step archive, decisions, and
+// evidence trail.
+func SkipOnContinuation(rel string) bool {
+	return isBookkeepingFile(rel) && !slices.Contains(ContinuationCarryFiles, rel)
+}
+
+// SnapshotFiles records the hashes of the agent's workspace files at the end
+// of iteration, for GET /v1/runs/{run_id}/workspace/diff, and copies the loop
+// state and memory a replay from the next iteration starts with.
+func (w *Workspace) SnapshotFiles(iteration int) error {
+	manifest, err := localtools.BuildWorkspaceManifest(w.dir, iteration, isBookkeepingFile)
+	if err != nil {
+		return err
+	}
+	if err := localtools.WriteWorkspaceManifest(w.stateDir, manifest); err != nil {
+		return err
+	}
+	return localtools.SnapshotReplaySeed(w.loopDir, w.stateDir, iteration, "state.json", "run_memory.md")
+}
+
+// SnapshotCheckpoint adds the checkpoint saved for the start of the next
+// iteration to iteration's replay snapshot.
+func (w *Workspace) SnapshotCheckpoint(iteration int) error {
+	return localtools.SnapshotReplaySeed(w.loopDir, w.stateDir, iteration, filepath.Base(w.checkpointPath))
+}
+
 // Dir returns the workspace directory path.
 func (w *Workspace) Dir() string {
 	return w.dir
 }
+
+// LoopDir returns the directory holding the loop's own files.
+func (w *Workspace) LoopDir() string {
+	return w.loopDir
+}
+
+// StateDir returns the directory holding the run's manifests and replay
+// snapshots.
+func (w *Workspace) StateDir() string {
+	return w.stateDir
+}
+
+// External reports whether the workspace is a pre-existing directory chosen
+// with the workspace_path constraint.
+func (w *Workspace) External() bool {
+	return w.external
+}
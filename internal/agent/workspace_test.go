@@ -2,6 +2,10 @@ package agent
 
 import (
 	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -22,3 +26,131 @@ func TestWorkspaceStateReadWrite(t *testing.T) {
 		t.Fatalf("state roundtrip mismatch: got %q want %q", got, string(state))
 	}
 }
+
+func TestWorkspaceAppendEvidence(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir(), "run-1")
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+
+	if err := ws.AppendEvidence("markdown", 1, "first", "file a.txt written"); err != nil {
+		t.Fatalf("append markdown evidence: %v", err)
+	}
+	if err := ws.AppendEvidence("markdown", 2, "second", "file b.txt written"); err != nil {
+		t.Fatalf("append markdown evidence: %v", err)
+	}
+	md, err := os.ReadFile(filepath.Join(ws.Dir(), EvidenceMarkdownFile))
+	if err != nil {
+		t.Fatalf("read evidence.md: %v", err)
+	}
+	if !strings.Contains(string(md), "## Iteration 1") || !strings.Contains(string(md), "file b.txt written") {
+		t.Fatalf("unexpected evidence.md content: %q", md)
+	}
+
+	if err := ws.AppendEvidence("json", 1, "first", "e1"); err != nil {
+		t.Fatalf("append json evidence: %v", err)
+	}
+	if err := ws.AppendEvidence("json", 3, "third", "e3"); err != nil {
+		t.Fatalf("append json evidence: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(ws.Dir(), EvidenceJSONFile))
+	if err != nil {
+		t.Fatalf("read evidence.json: %v", err)
+	}
+	var entries []EvidenceEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatalf("decode evidence.json: %v", err)
+	}
+	if len(entries) != 2 || entries[1].Iteration != 3 || entries[1].Evidence != "e3" {
+		t.Fatalf("unexpected evidence entries: %+v", entries)
+	}
+
+	other, err := NewWorkspace(t.TempDir(), "run-2")
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+	if err := other.AppendEvidence("none", 1, "s", "e"); err != nil {
+		t.Fatalf("append disabled evidence: %v", err)
+	}
+	if entries, _ := os.ReadDir(other.Dir()); len(entries) != 0 {
+		t.Fatalf("expected no evidence files when disabled, got %d entries", len(entries))
+	}
+}
+
+func TestWorkspaceReadRecentLoopMemories(t *testing.T) {
+	ws, err := NewWorkspace(t.TempDir(), "run-1")
+	if err != nil {
+		t.Fatalf("new workspace: %v", err)
+	}
+	for iter := 1; iter <= 4; iter++ {
+		if err := ws.ClearLoopMemory(); err != nil {
+			t.Fatalf("clear loop memory: %v", err)
+		}
+		if err := ws.AppendLoopAssistant(1, fmt.Sprintf("work from iteration %d", iter)); err != nil {
+			t.Fatalf("append loop memory: %v", err)
+		}
+		if err := ws.ArchiveLoopMemory(iter); err != nil {
+			t.Fatalf("archive loop memory: %v", err)
+		}
+	}
+
+	got := ws.ReadRecentLoopMemories(5, 2)
+	if strings.Contains(got, "iteration 2") {
+		t.Fatalf("expected only the last 2 iterations, got:\n%s", got)
+	}
+	i3 := strings.Index(got, "# Iteration 3")
+	i4 := strings.Index(got, "# Iteration 4")
+	if i3 < 0 || i4 < 0 || i4 < i3 || !strings.Contains(got, "work from iteration 4") {
+		t.Fatalf("expected iterations 3 and 4 oldest first, got:\n%s", got)
+	}
+	if clipped := clipTextTail(got, len("work from iteration 4")); clipped != "...[truncated]\nwork from iteration 4" {
+		t.Fatalf("clipped recent loops = %q, want the newest iteration kept", clipped)
+	}
+
+	if got := ws.ReadRecentLoopMemories(1, 3); got != "" {
+		t.Fatalf("expected no recent loops on the first iteration, got %q", got)
+	}
+	if got := ws.ReadRecentLoopMemories(5, 0); got != "" {
+		t.Fatalf("expected window 0 to disable recent loops, got %q", got)
+	}
+}
+
+func TestNewExternalWorkspaceStaysInsideRoot(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	if err := os.MkdirAll(repo, 0o755); err != nil {
+		t.Fatalf("mkdir repo: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "file.txt"), nil, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	for _, path := range []string{repo, "repo", "./repo/"} {
+		ws, err := NewExternalWorkspace(root, path, t.TempDir())
+		if err != nil {
+			t.Fatalf("NewExternalWorkspace(%q): %v", path, err)
+		}
+		if want, _ := filepath.EvalSymlinks(repo); ws.Dir() != want || !ws.External() {
+			t.Fatalf("NewExternalWorkspace(%q) = %s external=%v, want %s external", path, ws.Dir(), ws.External(), want)
+		}
+	}
+
+	for path, want := range map[string]string{
+		outside:    "outside",
+		"../":      "outside",
+		"escape":   "outside",
+		"missing":  "no such file",
+		"file.txt": "not a directory",
+	} {
+		if _, err := NewExternalWorkspace(root, path, t.TempDir()); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("NewExternalWorkspace(%q) error = %v, want %q", path, err, want)
+		}
+	}
+	if _, err := NewExternalWorkspace("", repo, t.TempDir()); err == nil {
+		t.Error("NewExternalWorkspace without a root succeeded")
+	}
+}
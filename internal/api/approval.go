@@ -0,0 +1,80 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// ApprovalDecisionRequest is the optional body of POST
+// /v1/runs/{run_id}/approve and /reject.
+type ApprovalDecisionRequest struct {
+	Note string `json:"note,omitempty"`
+}
+
+// ApprovalDecisionResponse reports the decided approval request.
+type ApprovalDecisionResponse struct {
+	RunID    string          `json:"run_id"`
+	Approval *store.Approval `json:"approval"`
+}
+
+// handleRunApprove handles POST /v1/runs/{run_id}/approve.
+func (s *Server) handleRunApprove(w http.ResponseWriter, r *http.Request) {
+	s.decideApproval(w, r, true)
+}
+
+// handleRunReject handles POST /v1/runs/{run_id}/reject.
+func (s *Server) handleRunReject(w http.ResponseWriter, r *http.Request) {
+	s.decideApproval(w, r, false)
+}
+
+// decideApproval records an operator's decision on the action a run paused
+// for with request_approval. The paused loop picks the decision up on its
+// next poll: an approval resumes the run with the decision as
+// {{.UserGuidance}}, a rejection fails it with failure_code
+// "approval_rejected".
+func (s *Server) decideApproval(w http.ResponseWriter, r *http.Request, approved bool) {
+	runID := chi.URLParam(r, "run_id")
+
+	var req ApprovalDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if len(req.Note) > maxRunMessageChars {
+		s.writeError(w, http.StatusRequestEntityTooLarge, "note exceeds 4000 characters")
+		return
+	}
+
+	run, err := s.runs.GetByID(r.Context(), runID)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	if run.Status != store.RunStatusAwaitingApproval {
+		s.writeError(w, http.StatusConflict, "run is "+string(run.Status)+"; only awaiting_approval runs can be approved or rejected")
+		return
+	}
+
+	approval, err := s.runs.DecideApproval(r.Context(), runID, approved, req.Note)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.writeError(w, http.StatusConflict, "the run's approval request has already been decided")
+			return
+		}
+		s.logger.Error("failed to record approval decision", "run_id", runID, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "failed to record decision")
+		return
+	}
+
+	s.logger.Info("approval decided", "run_id", runID, "decision", approval.Decision)
+	respondJSON(w, http.StatusOK, ApprovalDecisionResponse{RunID: runID, Approval: approval})
+}
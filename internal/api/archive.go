@@ -0,0 +1,141 @@
+package api
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// handleRunWorkspaceArchive handles GET /v1/runs/{run_id}/workspace.tar.gz.
+// It streams the run's workspace as a gzip tar with entry names relative to
+// the run directory. Only directories and regular files are archived:
+// symlinks and other special files are skipped so nothing outside the
+// workspace can be pulled in.
+func (s *Server) handleRunWorkspaceArchive(w http.ResponseWriter, r *http.Request) {
+	runID := chi.URLParam(r, "run_id")
+	run, err := s.runs.GetByID(r.Context(), runID)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	runDir, status, msg := s.runWorkspaceDir(run)
+	if status != 0 {
+		s.writeError(w, status, msg)
+		return
+	}
+	info, err := os.Lstat(runDir)
+	if err != nil || !info.IsDir() {
+		s.writeError(w, http.StatusNotFound, "run has no workspace")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", runID+"-workspace.tar.gz"))
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are sent, so a failure from here on can only cut the stream
+	// short; the client sees a truncated archive.
+	if err := writeWorkspaceArchive(w, runDir); err != nil {
+		s.logger.Error("failed to stream workspace archive", "run_id", runID, "path", runDir, "error", err)
+	}
+}
+
+// writeWorkspaceArchive writes runDir to out as a gzip tar.
+func writeWorkspaceArchive(out io.Writer, runDir string) error {
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	err := filepath.WalkDir(runDir, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if path == runDir || !(d.IsDir() || d.Type().IsRegular()) {
+			return nil
+		}
+		rel, err := filepath.Rel(runDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     name + "/",
+				Mode:     int64(info.Mode().Perm()),
+				ModTime:  info.ModTime(),
+			})
+		}
+		return addArchiveFile(tw, path, name)
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// addArchiveFile copies one regular file into tw. The file is checked again
+// after opening, so one swapped for a symlink during the walk is skipped.
+func addArchiveFile(tw *tar.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	opened, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	linkInfo, err := os.Lstat(path)
+	if err != nil || !linkInfo.Mode().IsRegular() || !os.SameFile(opened, linkInfo) {
+		return nil
+	}
+
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(opened.Mode().Perm()),
+		Size:     opened.Size(),
+		ModTime:  opened.ModTime(),
+	}); err != nil {
+		return err
+	}
+	return copyArchiveEntry(tw, f, opened.Size())
+}
+
+// copyArchiveEntry writes exactly size bytes of r to the current tar entry.
+// A file that grows after Stat is cut at size; one that shrinks, as a running
+// run's workspace can, is padded with zeros so the rest of the stream stays
+// valid.
+func copyArchiveEntry(tw *tar.Writer, r io.Reader, size int64) error {
+	n, err := io.CopyN(tw, r, size)
+	if errors.Is(err, io.EOF) {
+		_, err = io.CopyN(tw, zeroReader{}, size-n)
+	}
+	return err
+}
+
+// zeroReader is an endless stream of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
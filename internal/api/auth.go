@@ -1,11 +1,29 @@
 package api
 
 import (
+	"context"
 	"crypto/subtle"
 	"net/http"
 	"strings"
 )
 
+// Scope is a permission granted to an API token.
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+)
+
+// Token is an API bearer token and the scopes it grants.
+type Token struct {
+	Name   string
+	Value  string
+	Scopes []Scope
+}
+
+type scopesContextKey struct{}
+
 // bearerAuth is middleware that validates Bearer token authentication.
 func (s *Server) bearerAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -27,15 +45,54 @@ func (s *Server) bearerAuth(next http.Handler) http.Handler {
 			return
 		}
 
-		if !constantTimeEqual(token, s.config.Token) {
+		matched, ok := s.matchToken(token)
+		if !ok {
 			s.writeError(w, http.StatusUnauthorized, "invalid token")
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		ctx := context.WithValue(r.Context(), scopesContextKey{}, matched.Scopes)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// requireScope is middleware that rejects tokens lacking scope with 403.
+// It must run after bearerAuth.
+func (s *Server) requireScope(scope Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, _ := r.Context().Value(scopesContextKey{}).([]Scope)
+			for _, granted := range scopes {
+				if granted == scope {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			s.writeError(w, http.StatusForbidden, "token lacks required scope: "+string(scope))
+		})
+	}
+}
+
+// matchToken compares the presented token against every configured token so
+// the comparison time does not reveal which candidate matched. The legacy
+// single Token grants all scopes.
+func (s *Server) matchToken(presented string) (Token, bool) {
+	candidates := s.config.Tokens
+	if s.config.Token != "" {
+		candidates = append([]Token{{Name: "default", Value: s.config.Token, Scopes: []Scope{ScopeRead, ScopeWrite}}}, candidates...)
+	}
+
+	var matched Token
+	found := false
+	for _, candidate := range candidates {
+		if constantTimeEqual(presented, candidate.Value) && !found {
+			matched = candidate
+			found = true
+		}
+	}
+	return matched, found
+}
+
 func constantTimeEqual(a, b string) bool {
 	if a == "" || b == "" {
 		return false
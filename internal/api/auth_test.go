@@ -0,0 +1,66 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestBearerAuthEnforcesTokenScopes(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := New(Config{
+		Token: "legacy-token",
+		Tokens: []Token{
+			{Name: "dashboard", Value: "read-token", Scopes: []Scope{ScopeRead}},
+			{Name: "automation", Value: "write-token", Scopes: []Scope{ScopeWrite}},
+		},
+	}, runStore, &testCreator{runStore: runStore}, logger)
+	router := srv.setupRoutes()
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		want   int
+	}{
+		{"read token lists runs", "read-token", http.MethodGet, "/v1/runs", http.StatusOK},
+		{"read token cannot wake", "read-token", http.MethodPost, "/v1/wake", http.StatusForbidden},
+		{"write token wakes", "write-token", http.MethodPost, "/v1/wake", http.StatusAccepted},
+		{"write token cannot read", "write-token", http.MethodGet, "/v1/runs", http.StatusForbidden},
+		{"legacy token reads", "legacy-token", http.MethodGet, "/v1/runs", http.StatusOK},
+		{"legacy token wakes", "legacy-token", http.MethodPost, "/v1/wake", http.StatusAccepted},
+		{"unknown token", "nope", http.MethodGet, "/v1/runs", http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var body io.Reader
+			if tc.method == http.MethodPost {
+				body = bytes.NewReader([]byte(`{"goal":"do thing"}`))
+			}
+			req := httptest.NewRequest(tc.method, tc.path, body)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != tc.want {
+				t.Fatalf("status = %d, want %d (body %s)", rr.Code, tc.want, rr.Body.String())
+			}
+		})
+	}
+}
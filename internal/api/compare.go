@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// maxCompareRuns caps how many runs one comparison may include.
+const maxCompareRuns = 10
+
+// RunComparison holds the outcome metrics of one run in a comparison.
+type RunComparison struct {
+	RunID          string               `json:"run_id"`
+	Goal           string               `json:"goal"`
+	Status         string               `json:"status"`
+	FailureCode    *string              `json:"failure_code,omitempty"`
+	Summary        *string              `json:"summary,omitempty"`
+	Error          *string              `json:"error,omitempty"`
+	Labels         map[string]string    `json:"labels,omitempty"`
+	DurationMS     *int64               `json:"duration_ms,omitempty"`
+	StepCount      int                  `json:"step_count"`
+	StepsByPhase   map[string]int       `json:"steps_by_phase"`
+	StageDurations store.PhaseDurations `json:"stage_durations"`
+	TokenUsage     store.TokenUsage     `json:"token_usage"`
+}
+
+// CompareResponse is returned by GET /v1/runs/compare, with runs in the
+// order their IDs were requested.
+type CompareResponse struct {
+	Runs []RunComparison `json:"runs"`
+}
+
+// handleCompareRuns handles GET /v1/runs/compare?ids=a,b. It reports side by
+// side metrics for runs of the same goal, for example under different
+// prompt configurations. Runs and their steps are loaded with one query each.
+func (s *Server) handleCompareRuns(w http.ResponseWriter, r *http.Request) {
+	var ids []string
+	seen := map[string]bool{}
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		id = strings.TrimSpace(id)
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < 2 || len(ids) > maxCompareRuns {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("ids must list between 2 and %d distinct run IDs", maxCompareRuns))
+		return
+	}
+
+	runs, err := s.runs.GetByIDs(r.Context(), ids)
+	if err != nil {
+		s.logger.Error("failed to get runs for comparison", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "failed to read runs")
+		return
+	}
+	byID := make(map[string]*store.Run, len(runs))
+	for _, run := range runs {
+		byID[run.ID] = run
+	}
+	var missing []string
+	for _, id := range ids {
+		if byID[id] == nil {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		s.writeError(w, http.StatusNotFound, "runs not found: "+strings.Join(missing, ", "))
+		return
+	}
+
+	stats, err := store.NewStepStore(s.runs.DB()).StatsByRuns(r.Context(), ids)
+	if err != nil {
+		s.logger.Error("failed to get step stats for comparison", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "failed to read steps")
+		return
+	}
+
+	resp := CompareResponse{Runs: make([]RunComparison, 0, len(ids))}
+	for _, id := range ids {
+		run, st := byID[id], stats[id]
+		cmp := RunComparison{
+			RunID:          run.ID,
+			Goal:           run.Goal,
+			Status:         string(run.Status),
+			FailureCode:    run.FailureCode,
+			Summary:        run.Summary,
+			Error:          run.Error,
+			Labels:         run.Labels,
+			StepCount:      st.StepCount,
+			StepsByPhase:   make(map[string]int, len(st.StepsByPhase)),
+			StageDurations: st.StageDurations,
+			TokenUsage:     st.TokenUsage,
+		}
+		for phase, n := range st.StepsByPhase {
+			cmp.StepsByPhase[string(phase)] = n
+		}
+		if run.StartedAt != nil && run.CompletedAt != nil {
+			ms := run.CompletedAt.Sub(*run.StartedAt).Milliseconds()
+			cmp.DurationMS = &ms
+		}
+		resp.Runs = append(resp.Runs, cmp)
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mattjoyce/agenticloop/internal/agent"
+	"github.com/mattjoyce/agenticloop/internal/localtools"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// ContinueRequest is the body of POST /v1/runs/{run_id}/continue. Context,
+// constraints, and priority default to the parent run's.
+type ContinueRequest struct {
+	Goal        string          `json:"goal"`
+	Context     json.RawMessage `json:"context,omitempty"`
+	Constraints json.RawMessage `json:"constraints,omitempty"`
+	Priority    *int            `json:"priority,omitempty"`
+}
+
+// ContinueResponse is returned when a follow-up run is created.
+type ContinueResponse struct {
+	RunID         string `json:"run_id"`
+	Status        string `json:"status"`
+	ContinuedFrom string `json:"continued_from"`
+}
+
+// handleRunContinue handles POST /v1/runs/{run_id}/continue. It creates a
+// follow-up run, linked through continued_from, whose workspace starts as a
+// copy of the finished run's, including its run memory and state.json.
+func (s *Server) handleRunContinue(w http.ResponseWriter, r *http.Request) {
+	runID := chi.URLParam(r, "run_id")
+
+	var req ContinueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+	req.Goal = strings.TrimSpace(req.Goal)
+	if req.Goal == "" {
+		s.writeError(w, http.StatusBadRequest, "goal is required")
+		return
+	}
+	if limit := s.config.MaxContextBytes; limit > 0 {
+		if len(req.Context) > limit {
+			s.writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("context is %d bytes; limit is %d", len(req.Context), limit))
+			return
+		}
+		if len(req.Constraints) > limit {
+			s.writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("constraints is %d bytes; limit is %d", len(req.Constraints), limit))
+			return
+		}
+	}
+	if msg := s.checkConstraints(req.Constraints); msg != "" {
+		s.writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	parent, err := s.runs.GetByID(r.Context(), runID)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	if parent.Status != store.RunStatusDone && parent.Status != store.RunStatusFailed {
+		s.writeError(w, http.StatusConflict, "run is "+string(parent.Status)+"; only finished runs can be continued")
+		return
+	}
+	parentDir, status, msg := s.runWorkspaceDir(parent)
+	if status != 0 {
+		s.writeError(w, status, msg)
+		return
+	}
+	if _, err := os.Stat(parentDir); err != nil {
+		s.writeError(w, http.StatusConflict, "run workspace no longer exists; nothing to continue from")
+		return
+	}
+	parentLoopDir, status, msg := s.runLoopDir(parent)
+	if status != 0 {
+		s.writeError(w, status, msg)
+		return
+	}
+
+	runCtx := parent.Context
+	if len(req.Context) > 0 {
+		runCtx = req.Context
+	}
+	constraints := parent.Constraints
+	if len(req.Constraints) > 0 {
+		constraints = req.Constraints
+	}
+	priority := parent.Priority
+	if req.Priority != nil {
+		priority = *req.Priority
+	}
+	labels := make(map[string]string, len(parent.Labels)+1)
+	for k, v := range parent.Labels {
+		labels[k] = v
+	}
+	labels["continuation_of"] = parent.ID
+
+	run, err := s.runs.CreateContinuation(r.Context(), parent.ID, req.Goal, runCtx, constraints, labels, priority)
+	if err != nil {
+		s.logger.Error("failed to create continuation run", "run_id", runID, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "failed to create run")
+		return
+	}
+	if err := s.seedContinuation(run, parentDir, parentLoopDir); err != nil {
+		s.logger.Error("failed to seed continuation workspace", "run_id", run.ID, "continued_from", runID, "error", err)
+		_ = s.runs.Fail(r.Context(), run.ID, "continuation_seed_failed", err.Error())
+		if errors.Is(err, os.ErrNotExist) {
+			s.writeError(w, http.StatusConflict, "run workspace no longer exists; nothing to continue from")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, "failed to seed continuation workspace")
+		return
+	}
+	if err := s.creator.Enqueue(run.ID, run.Priority); err != nil {
+		s.logger.Warn("failed to enqueue continuation run", "run_id", run.ID, "error", err)
+		s.writeError(w, http.StatusServiceUnavailable, "runner queue is full; retry later")
+		return
+	}
+
+	s.logger.Info("continuation run created", "run_id", run.ID, "continued_from", runID)
+	respondJSON(w, http.StatusAccepted, ContinueResponse{
+		RunID:         run.ID,
+		Status:        string(run.Status),
+		ContinuedFrom: parent.ID,
+	})
+}
+
+// seedContinuation copies the parent workspace parentDir into run's, unless
+// run works in an external workspace, then carries the parent's run memory
+// and state.json from parentLoopDir into run's loop directory. For a run in
+// an external workspace that is its state dir, so nothing is written into
+// the caller's directory.
+func (s *Server) seedContinuation(run *store.Run, parentDir, parentLoopDir string) error {
+	if !agent.UsesExternalWorkspace(run.Constraints) {
+		runDir, status, msg := s.runWorkspaceDir(run)
+		if status != 0 {
+			return errors.New(msg)
+		}
+		if err := localtools.SeedContinuation(parentDir, runDir, agent.SkipOnContinuation); err != nil {
+			return err
+		}
+	}
+	loopDir, status, msg := s.runLoopDir(run)
+	if status != 0 {
+		return errors.New(msg)
+	}
+	return localtools.CopyFiles(parentLoopDir, loopDir, agent.ContinuationCarryFiles...)
+}
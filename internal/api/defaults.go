@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ValidateDefaults checks the configured default constraints the way a wake's
+// constraints are checked, so a bad default fails at startup rather than
+// failing every run. The allowed_constraints list does not apply to defaults.
+func (s *Server) ValidateDefaults() error {
+	if len(s.config.DefaultConstraints) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(s.config.DefaultConstraints)
+	if err != nil {
+		return fmt.Errorf("api.default_constraints: %w", err)
+	}
+	if msg := s.checkConstraintValues(raw); msg != "" {
+		return fmt.Errorf("api.default_constraints: %s", msg)
+	}
+	return nil
+}
+
+// mergeDefaults deep-merges a wake's context or constraints over the
+// configured defaults. Nested objects merge key by key; for any other value
+// the request wins. raw is returned unchanged when there are no defaults.
+func mergeDefaults(defaults map[string]any, raw json.RawMessage) (json.RawMessage, error) {
+	if len(defaults) == 0 {
+		return raw, nil
+	}
+	request := map[string]any{}
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &request); err != nil {
+			return nil, fmt.Errorf("must be a JSON object to merge with the configured defaults")
+		}
+	}
+	merged, err := json.Marshal(deepMerge(defaults, request))
+	if err != nil {
+		return nil, fmt.Errorf("encode merged defaults: %w", err)
+	}
+	return merged, nil
+}
+
+// deepMerge returns base overlaid with override without modifying either.
+func deepMerge(base, override map[string]any) map[string]any {
+	out := make(map[string]any, len(base)+len(override))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range override {
+		baseObj, baseOK := out[k].(map[string]any)
+		overObj, overOK := v.(map[string]any)
+		if baseOK && overOK {
+			out[k] = deepMerge(baseObj, overObj)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
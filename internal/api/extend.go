@@ -0,0 +1,83 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// ExtendRequest is the body of POST /v1/runs/{run_id}/extend.
+type ExtendRequest struct {
+	AdditionalSeconds int `json:"additional_seconds"`
+}
+
+// ExtendResponse reports the deadline extension granted to a run so far.
+type ExtendResponse struct {
+	RunID                     string `json:"run_id"`
+	ExtensionSeconds          int    `json:"extension_seconds"`
+	RemainingExtensionSeconds int    `json:"remaining_extension_seconds"`
+}
+
+// handleRunExtend handles POST /v1/runs/{run_id}/extend. It adds time to a
+// running run's deadline; the loop picks the extension up before the
+// original deadline cancels the run. The total added to one run is capped
+// by agent.max_deadline_extension.
+func (s *Server) handleRunExtend(w http.ResponseWriter, r *http.Request) {
+	runID := chi.URLParam(r, "run_id")
+
+	var req ExtendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+	if req.AdditionalSeconds <= 0 {
+		s.writeError(w, http.StatusBadRequest, "additional_seconds must be > 0")
+		return
+	}
+	limit := int(s.config.MaxDeadlineExtension.Seconds())
+	if limit <= 0 {
+		s.writeError(w, http.StatusConflict, "deadline extension is disabled; set agent.max_deadline_extension")
+		return
+	}
+
+	run, err := s.runs.GetByID(r.Context(), runID)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	if run.Status != store.RunStatusRunning && run.Status != store.RunStatusAwaitingApproval {
+		s.writeError(w, http.StatusConflict, "run is "+string(run.Status)+"; only running or awaiting_approval runs can be extended")
+		return
+	}
+
+	total, err := s.runs.ExtendDeadline(r.Context(), runID, req.AdditionalSeconds, limit)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			s.logger.Error("failed to extend run deadline", "run_id", runID, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "failed to extend deadline")
+			return
+		}
+		// The update matched no row: either the cap was reached or the run
+		// finished since it was read.
+		granted, lookupErr := s.runs.DeadlineExtension(r.Context(), runID)
+		if lookupErr == nil && int(granted.Seconds())+req.AdditionalSeconds > limit {
+			s.writeError(w, http.StatusConflict, fmt.Sprintf("extension would exceed agent.max_deadline_extension: %ds of %ds already granted", int(granted.Seconds()), limit))
+			return
+		}
+		s.writeError(w, http.StatusConflict, "run finished before the deadline was extended")
+		return
+	}
+
+	s.logger.Info("run deadline extended", "run_id", runID, "additional_seconds", req.AdditionalSeconds, "extension_seconds", total)
+	respondJSON(w, http.StatusOK, ExtendResponse{
+		RunID:                     runID,
+		ExtensionSeconds:          total,
+		RemainingExtensionSeconds: limit - total,
+	})
+}
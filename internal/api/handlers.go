@@ -1,28 +1,40 @@
 package api
 
 import (
+	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/mattjoyce/agenticloop/internal/agent"
+	"github.com/mattjoyce/agenticloop/internal/localtools"
 	"github.com/mattjoyce/agenticloop/internal/store"
 )
 
 // WakeRequest is the JSON body for POST /v1/wake.
+// Priority orders the queue: higher runs first, 0 (default) keeps FIFO.
 type WakeRequest struct {
-	WakeID      *string         `json:"wake_id,omitempty"`
-	Goal        string          `json:"goal"`
-	Context     json.RawMessage `json:"context,omitempty"`
-	Constraints json.RawMessage `json:"constraints,omitempty"`
+	WakeID      *string           `json:"wake_id,omitempty"`
+	Goal        string            `json:"goal"`
+	Context     json.RawMessage   `json:"context,omitempty"`
+	Constraints json.RawMessage   `json:"constraints,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Priority    int               `json:"priority,omitempty"`
 }
 
 // WakeResponse is returned on successful wake.
@@ -32,40 +44,130 @@ type WakeResponse struct {
 	Existing bool   `json:"existing"`
 }
 
+// maxWakeBatchSize caps the number of wake requests in one POST /v1/wake/batch.
+const maxWakeBatchSize = 100
+
+// WakeBatchResult is the outcome of one item in POST /v1/wake/batch.
+// StatusCode is the status POST /v1/wake would have returned for it.
+type WakeBatchResult struct {
+	Index      int    `json:"index"`
+	StatusCode int    `json:"status_code"`
+	RunID      string `json:"run_id,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Existing   bool   `json:"existing"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WakeBatchResponse is returned by POST /v1/wake/batch.
+type WakeBatchResponse struct {
+	Results []WakeBatchResult `json:"results"`
+}
+
 // RunResponse is returned by GET /v1/runs/{run_id}.
 type RunResponse struct {
-	ID          string          `json:"id"`
-	WakeID      *string         `json:"wake_id,omitempty"`
-	Goal        string          `json:"goal"`
-	Status      string          `json:"status"`
-	Summary     *string         `json:"summary,omitempty"`
-	Error       *string         `json:"error,omitempty"`
-	Steps       []*store.Step   `json:"steps,omitempty"`
-	Context     json.RawMessage `json:"context,omitempty"`
-	Constraints json.RawMessage `json:"constraints,omitempty"`
-	StartedAt   *time.Time      `json:"started_at,omitempty"`
-	CompletedAt *time.Time      `json:"completed_at,omitempty"`
-	CreatedAt   time.Time       `json:"created_at"`
+	ID               string               `json:"id"`
+	WakeID           *string              `json:"wake_id,omitempty"`
+	ParentRunID      *string              `json:"parent_run_id,omitempty"`
+	ContinuedFrom    *string              `json:"continued_from,omitempty"`
+	Goal             string               `json:"goal"`
+	Status           string               `json:"status"`
+	Summary          *string              `json:"summary,omitempty"`
+	WorkingSummary   *string              `json:"working_summary,omitempty"`
+	PendingApproval  *store.Approval      `json:"pending_approval,omitempty"`
+	Error            *string              `json:"error,omitempty"`
+	FailureCode      *string              `json:"failure_code,omitempty"`
+	RecoveryAttempts int                  `json:"recovery_attempts"`
+	Steps            []*store.Step        `json:"steps,omitempty"`
+	StageDurations   store.PhaseDurations `json:"stage_durations,omitempty"`
+	EstimatedCost    *float64             `json:"estimated_cost"`
+	Context          json.RawMessage      `json:"context,omitempty"`
+	Constraints      json.RawMessage      `json:"constraints,omitempty"`
+	Labels           map[string]string    `json:"labels,omitempty"`
+	Priority         int                  `json:"priority"`
+	StartedAt        *time.Time           `json:"started_at,omitempty"`
+	CompletedAt      *time.Time           `json:"completed_at,omitempty"`
+	CreatedAt        time.Time            `json:"created_at"`
 }
 
 type WorkspaceFileResponse struct {
-	Path      string `json:"path"`
-	SizeBytes int64  `json:"size_bytes"`
+	Path        string `json:"path"`
+	SizeBytes   int64  `json:"size_bytes"`
+	ContentType string `json:"content_type"`
+	Category    string `json:"category"`
 }
 
 type WorkspaceResponse struct {
 	RunID          string                  `json:"run_id"`
 	FileCount      int                     `json:"file_count"`
 	TotalSizeBytes int64                   `json:"total_size_bytes"`
+	HasEvidence    bool                    `json:"has_evidence"`
 	Files          []WorkspaceFileResponse `json:"files"`
 }
 
+// WorkspaceDiffResponse is returned by GET /v1/runs/{run_id}/workspace/diff.
+type WorkspaceDiffResponse struct {
+	RunID   string                       `json:"run_id"`
+	From    int                          `json:"from"`
+	To      int                          `json:"to"`
+	Changes []localtools.WorkspaceChange `json:"changes"`
+}
+
+// RunExportResponse is returned by GET /v1/runs/{run_id}/export.
+type RunExportResponse struct {
+	ExportedAt  time.Time             `json:"exported_at"`
+	Run         RunResponse           `json:"run"`
+	TokenTotals store.TokenUsage      `json:"token_totals"`
+	Workspace   ExportWorkspace       `json:"workspace"`
+	Decisions   []agent.DecisionEntry `json:"decisions"`
+}
+
+// ExportWorkspace is the workspace manifest in a run export. Text files up to
+// MaxInlineBytes carry content; other small files carry content_base64.
+// ContentsTruncated is set when files were listed without contents because
+// the export had already inlined maxExportInlineTotalBytes.
+type ExportWorkspace struct {
+	FileCount         int                   `json:"file_count"`
+	TotalSizeBytes    int64                 `json:"total_size_bytes"`
+	ContentsInlined   bool                  `json:"contents_inlined"`
+	MaxInlineBytes    int64                 `json:"max_inline_bytes,omitempty"`
+	ContentsTruncated bool                  `json:"contents_truncated,omitempty"`
+	Files             []ExportWorkspaceFile `json:"files"`
+}
+
+type ExportWorkspaceFile struct {
+	Path          string  `json:"path"`
+	SizeBytes     int64   `json:"size_bytes"`
+	Content       *string `json:"content,omitempty"`
+	ContentBase64 *string `json:"content_base64,omitempty"`
+}
+
+// Export inline size limits: default and ceiling for max_inline_bytes, and
+// the most file content one export inlines in total.
+const (
+	defaultExportInlineBytes  = 64 << 10
+	maxExportInlineBytes      = 1 << 20
+	maxExportInlineTotalBytes = 32 << 20
+)
+
+// evidenceFiles are the workspace-root evidence trail files written on report_success.
+var evidenceFiles = map[string]bool{
+	agent.EvidenceMarkdownFile: true,
+	agent.EvidenceJSONFile:     true,
+}
+
 // HealthzResponse is returned by GET /healthz.
 type HealthzResponse struct {
 	Status        string `json:"status"`
 	UptimeSeconds int64  `json:"uptime_seconds"`
 }
 
+// ReadyzResponse is returned by GET /readyz. Checks maps each probe to "ok"
+// or its error message.
+type ReadyzResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
 // ErrorResponse is returned on errors.
 type ErrorResponse struct {
 	Error string `json:"error"`
@@ -79,33 +181,207 @@ func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleReadyz handles GET /readyz. It returns 503 when the database or any
+// configured readiness check fails.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	checks := map[string]string{}
+	ready := true
+	record := func(name string, err error) {
+		if err != nil {
+			checks[name] = err.Error()
+			ready = false
+			return
+		}
+		checks[name] = "ok"
+	}
+
+	var one int
+	record("database", s.runs.DB().QueryRowContext(ctx, `SELECT 1`).Scan(&one))
+	for _, c := range s.config.ReadinessChecks {
+		record(c.Name, c.Check(ctx))
+	}
+
+	if !ready {
+		s.logger.Warn("readiness check failed", "checks", checks)
+		respondJSON(w, http.StatusServiceUnavailable, ReadyzResponse{Status: "unavailable", Checks: checks})
+		return
+	}
+	respondJSON(w, http.StatusOK, ReadyzResponse{Status: "ready", Checks: checks})
+}
+
 // handleWake handles POST /v1/wake.
 func (s *Server) handleWake(w http.ResponseWriter, r *http.Request) {
 	var req WakeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.writeError(w, http.StatusBadRequest, "invalid JSON body")
+		s.writeDecodeError(w, err, "invalid JSON body")
 		return
 	}
 
-	if req.Goal == "" {
-		s.writeError(w, http.StatusBadRequest, "goal is required")
+	resp, status, errMsg := s.wake(r.Context(), req)
+	if errMsg != "" {
+		s.writeError(w, status, errMsg)
+		return
+	}
+	respondJSON(w, status, resp)
+}
+
+// handleWakeBatch handles POST /v1/wake/batch. Each request is created and
+// enqueued independently; per-item outcomes are reported in request order.
+func (s *Server) handleWakeBatch(w http.ResponseWriter, r *http.Request) {
+	var reqs []WakeRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		s.writeDecodeError(w, err, "invalid JSON body: expected an array of wake requests")
+		return
+	}
+	if len(reqs) == 0 {
+		s.writeError(w, http.StatusBadRequest, "batch must contain at least one wake request")
+		return
+	}
+	if len(reqs) > maxWakeBatchSize {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("batch exceeds %d wake requests", maxWakeBatchSize))
 		return
 	}
 
-	run, existing, err := s.creator.Create(r.Context(), req.Goal, req.WakeID, req.Context, req.Constraints)
+	results := make([]WakeBatchResult, len(reqs))
+	for i, req := range reqs {
+		resp, status, errMsg := s.wake(r.Context(), req)
+		results[i] = WakeBatchResult{
+			Index:      i,
+			StatusCode: status,
+			RunID:      resp.RunID,
+			Status:     resp.Status,
+			Existing:   resp.Existing,
+			Error:      errMsg,
+		}
+	}
+	respondJSON(w, http.StatusOK, WakeBatchResponse{Results: results})
+}
+
+// wakeDedupKey hashes goal and context for wake_id-less deduplication.
+// Context is re-encoded first so key order and whitespace do not matter.
+func wakeDedupKey(goal string, runCtx json.RawMessage) string {
+	canonical := []byte(runCtx)
+	var v any
+	if len(runCtx) > 0 && json.Unmarshal(runCtx, &v) == nil {
+		if b, err := json.Marshal(v); err == nil {
+			canonical = b
+		}
+	}
+	h := sha256.New()
+	h.Write([]byte(goal))
+	h.Write([]byte{0})
+	h.Write(canonical)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// checkConstraints returns an error message when raw does not decode as run
+// constraints, names a model that is not configured, or sets a key that is
+// not in the allowed_constraints list, or "" when the constraints are
+// accepted. An empty list allows every key.
+func (s *Server) checkConstraints(raw json.RawMessage) string {
+	if msg := s.checkConstraintValues(raw); msg != "" {
+		return msg
+	}
+	allowed := s.config.AllowedConstraints
+	if len(allowed) == 0 || len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return "constraints must be a JSON object"
+	}
+	var rejected []string
+	for key := range fields {
+		if !slices.Contains(allowed, key) {
+			rejected = append(rejected, key)
+		}
+	}
+	if len(rejected) == 0 {
+		return ""
+	}
+	sort.Strings(rejected)
+	return fmt.Sprintf("constraints keys not allowed: %s (allowed: %s)", strings.Join(rejected, ", "), strings.Join(allowed, ", "))
+}
+
+// checkConstraintValues returns an error message when raw does not decode as
+// run constraints or names a model that is not configured, or "" otherwise.
+func (s *Server) checkConstraintValues(raw json.RawMessage) string {
+	if err := agent.ValidateConstraints(raw); err != nil {
+		return err.Error()
+	}
+	if len(s.config.Models) > 0 && len(raw) > 0 && string(raw) != "null" {
+		var c struct {
+			Model string `json:"model"`
+		}
+		if err := json.Unmarshal(raw, &c); err == nil && strings.TrimSpace(c.Model) != "" && !slices.Contains(s.config.Models, strings.TrimSpace(c.Model)) {
+			return fmt.Sprintf("constraints.model %q is not llm.model or one of llm.allowed_models (%s)", c.Model, strings.Join(s.config.Models, ", "))
+		}
+	}
+	return ""
+}
+
+// wake validates, creates, and enqueues a single wake request. It returns the
+// response, its HTTP status, and an error message when the wake failed; a
+// failed enqueue still reports the created run.
+func (s *Server) wake(ctx context.Context, req WakeRequest) (WakeResponse, int, string) {
+	if req.Goal == "" {
+		return WakeResponse{}, http.StatusBadRequest, "goal is required"
+	}
+	for k := range req.Labels {
+		if strings.TrimSpace(k) == "" {
+			return WakeResponse{}, http.StatusBadRequest, "label keys must be non-empty"
+		}
+	}
+	if limit := s.config.MaxContextBytes; limit > 0 {
+		if len(req.Context) > limit {
+			return WakeResponse{}, http.StatusRequestEntityTooLarge, fmt.Sprintf("context is %d bytes; limit is %d", len(req.Context), limit)
+		}
+		if len(req.Constraints) > limit {
+			return WakeResponse{}, http.StatusRequestEntityTooLarge, fmt.Sprintf("constraints is %d bytes; limit is %d", len(req.Constraints), limit)
+		}
+	}
+	if msg := s.checkConstraints(req.Constraints); msg != "" {
+		return WakeResponse{}, http.StatusBadRequest, msg
+	}
+
+	// Defaults are merged after the size and key checks, which apply to
+	// what the caller sent rather than to operator policy.
+	var err error
+	if req.Context, err = mergeDefaults(s.config.DefaultContext, req.Context); err != nil {
+		return WakeResponse{}, http.StatusBadRequest, "context " + err.Error()
+	}
+	if req.Constraints, err = mergeDefaults(s.config.DefaultConstraints, req.Constraints); err != nil {
+		return WakeResponse{}, http.StatusBadRequest, "constraints " + err.Error()
+	}
+
+	var (
+		run      *store.Run
+		existing bool
+	)
+	if req.WakeID == nil && s.config.DedupIdenticalGoals {
+		run, existing, err = s.creator.CreateDeduped(ctx, wakeDedupKey(req.Goal, req.Context), s.config.DedupWindow, req.Goal, req.Context, req.Constraints, req.Labels, req.Priority)
+	} else {
+		run, existing, err = s.creator.Create(ctx, req.Goal, req.WakeID, req.Context, req.Constraints, req.Labels, req.Priority)
+	}
 	if err != nil {
 		s.logger.Error("failed to create run", "error", err)
-		s.writeError(w, http.StatusInternalServerError, "failed to create run")
-		return
+		return WakeResponse{}, http.StatusInternalServerError, "failed to create run"
+	}
+	resp := WakeResponse{
+		RunID:    run.ID,
+		Status:   string(run.Status),
+		Existing: existing,
 	}
 
 	// Always try to enqueue queued runs. This allows retries to re-enqueue a run
 	// if an earlier wake created it but enqueueing failed due backpressure.
 	if run.Status == store.RunStatusQueued {
-		if err := s.creator.Enqueue(run.ID); err != nil {
+		if err := s.creator.Enqueue(run.ID, run.Priority); err != nil {
 			s.logger.Warn("failed to enqueue run", "run_id", run.ID, "existing", existing, "error", err)
-			s.writeError(w, http.StatusServiceUnavailable, "runner queue is full; retry later")
-			return
+			return resp, http.StatusServiceUnavailable, "runner queue is full; retry later"
 		}
 	}
 
@@ -115,35 +391,42 @@ func (s *Server) handleWake(w http.ResponseWriter, r *http.Request) {
 		"goal", req.Goal,
 	)
 
-	status := http.StatusAccepted
 	if existing {
-		status = http.StatusOK
+		return resp, http.StatusOK, ""
 	}
-	respondJSON(w, status, WakeResponse{
-		RunID:    run.ID,
-		Status:   string(run.Status),
-		Existing: existing,
-	})
+	return resp, http.StatusAccepted, ""
 }
 
-// handleListRuns handles GET /v1/runs?status=<status>.
-// status defaults to "running" if not supplied.
+// handleListRuns handles GET /v1/runs?status=<status>&label=<key>:<value>.
+// status defaults to "running" if not supplied. label may be repeated; all must match.
+// parent_run_id restricts the listing to subruns of that run.
 func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
 	statusParam := r.URL.Query().Get("status")
 	if statusParam == "" {
 		statusParam = "running"
 	}
-	runs, err := s.runs.ListByStatus(r.Context(), store.RunStatus(statusParam))
+	labels, err := parseLabelFilters(r.URL.Query()["label"])
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	runs, err := s.runs.List(r.Context(), store.RunFilter{
+		Status:      store.RunStatus(statusParam),
+		Labels:      labels,
+		ParentRunID: r.URL.Query().Get("parent_run_id"),
+	})
 	if err != nil {
 		s.logger.Error("failed to list runs", "status", statusParam, "error", err)
 		s.writeError(w, http.StatusInternalServerError, "failed to list runs")
 		return
 	}
 	type runSummary struct {
-		ID        string    `json:"id"`
-		Goal      string    `json:"goal"`
-		Status    string    `json:"status"`
-		CreatedAt time.Time `json:"created_at"`
+		ID        string            `json:"id"`
+		Goal      string            `json:"goal"`
+		Status    string            `json:"status"`
+		Labels    map[string]string `json:"labels,omitempty"`
+		Priority  int               `json:"priority"`
+		CreatedAt time.Time         `json:"created_at"`
 	}
 	out := make([]runSummary, len(runs))
 	for i, run := range runs {
@@ -151,12 +434,30 @@ func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
 			ID:        run.ID,
 			Goal:      run.Goal,
 			Status:    string(run.Status),
+			Labels:    run.Labels,
+			Priority:  run.Priority,
 			CreatedAt: run.CreatedAt,
 		}
 	}
 	respondJSON(w, http.StatusOK, out)
 }
 
+// parseLabelFilters converts repeated "key:value" query values into a label filter.
+func parseLabelFilters(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(values))
+	for _, v := range values {
+		key, value, ok := strings.Cut(v, ":")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid label filter %q; expected key:value", v)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
 // handleGetRun handles GET /v1/runs/{run_id}.
 func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
 	runID := chi.URLParam(r, "run_id")
@@ -174,21 +475,40 @@ func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
 		s.logger.Error("failed to get steps", "run_id", runID, "error", err)
 		steps = nil
 	}
+	durations, err := stepStore.DurationsByRun(r.Context(), runID)
+	if err != nil {
+		s.logger.Error("failed to get stage durations", "run_id", runID, "error", err)
+		durations = nil
+	}
 
-	respondJSON(w, http.StatusOK, RunResponse{
-		ID:          run.ID,
-		WakeID:      run.WakeID,
-		Goal:        run.Goal,
-		Status:      string(run.Status),
-		Summary:     run.Summary,
-		Error:       run.Error,
-		Steps:       steps,
-		Context:     run.Context,
-		Constraints: run.Constraints,
-		StartedAt:   run.StartedAt,
-		CompletedAt: run.CompletedAt,
-		CreatedAt:   run.CreatedAt,
-	})
+	respondJSON(w, http.StatusOK, newRunResponse(run, steps, durations))
+}
+
+func newRunResponse(run *store.Run, steps []*store.Step, durations store.PhaseDurations) RunResponse {
+	return RunResponse{
+		ID:               run.ID,
+		WakeID:           run.WakeID,
+		ParentRunID:      run.ParentRunID,
+		ContinuedFrom:    run.ContinuedFrom,
+		Goal:             run.Goal,
+		Status:           string(run.Status),
+		Summary:          run.Summary,
+		WorkingSummary:   run.WorkingSummary,
+		PendingApproval:  run.PendingApproval,
+		Error:            run.Error,
+		FailureCode:      run.FailureCode,
+		RecoveryAttempts: run.RecoveryAttempts,
+		Steps:            steps,
+		StageDurations:   durations,
+		EstimatedCost:    store.SumEstimatedCost(steps),
+		Context:          run.Context,
+		Constraints:      run.Constraints,
+		Labels:           run.Labels,
+		Priority:         run.Priority,
+		StartedAt:        run.StartedAt,
+		CompletedAt:      run.CompletedAt,
+		CreatedAt:        run.CreatedAt,
+	}
 }
 
 func (s *Server) handleRunWorkspace(w http.ResponseWriter, r *http.Request) {
@@ -198,52 +518,374 @@ func (s *Server) handleRunWorkspace(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	run, err := s.runs.GetByID(r.Context(), runID)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+
+	runDir, status, msg := s.runWorkspaceDir(run)
+	if status != 0 {
+		s.writeError(w, status, msg)
+		return
+	}
+
+	files, totalSize, hasEvidence, err := listWorkspaceFiles(runDir)
+	if err != nil {
+		s.logger.Error("failed to walk run workspace", "run_id", runID, "path", runDir, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "failed to read workspace files")
+		return
+	}
+	if agent.UsesExternalWorkspace(run.Constraints) {
+		hasEvidence = s.hasStateDirEvidence(runID)
+	}
+
+	respondJSON(w, http.StatusOK, WorkspaceResponse{
+		RunID:          runID,
+		FileCount:      len(files),
+		TotalSizeBytes: totalSize,
+		HasEvidence:    hasEvidence,
+		Files:          files,
+	})
+}
+
+// handleRunWorkspaceDiff handles GET /v1/runs/{run_id}/workspace/diff?from=A&to=B.
+// It compares the workspace manifests snapshotted at the end of iterations A
+// and B. from defaults to 0 (the empty workspace) and to to the latest iteration.
+func (s *Server) handleRunWorkspaceDiff(w http.ResponseWriter, r *http.Request) {
+	runID := chi.URLParam(r, "run_id")
 	if _, err := s.runs.GetByID(r.Context(), runID); err != nil {
 		s.writeError(w, http.StatusNotFound, "run not found")
 		return
 	}
+	stateDir, status, msg := s.runStateDir(runID)
+	if status != 0 {
+		s.writeError(w, status, msg)
+		return
+	}
 
-	baseDir := strings.TrimSpace(s.config.WorkspaceDir)
-	if baseDir == "" {
-		s.writeError(w, http.StatusServiceUnavailable, "workspace directory is not configured")
+	parseIter := func(name string, fallback int) (int, bool) {
+		raw := r.URL.Query().Get(name)
+		if raw == "" {
+			return fallback, true
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			s.writeError(w, http.StatusBadRequest, name+" must be a non-negative integer")
+			return 0, false
+		}
+		return n, true
+	}
+	from, ok := parseIter("from", 0)
+	if !ok {
+		return
+	}
+	to, ok := parseIter("to", localtools.LatestManifestIteration(stateDir))
+	if !ok {
+		return
+	}
+	if from > to {
+		s.writeError(w, http.StatusBadRequest, "from must not be greater than to")
 		return
 	}
 
-	baseAbs, err := filepath.Abs(baseDir)
+	load := func(iter int) (*localtools.WorkspaceManifest, bool) {
+		if iter == 0 {
+			return nil, true
+		}
+		m, err := localtools.ReadWorkspaceManifest(stateDir, iter)
+		if err != nil {
+			if os.IsNotExist(err) {
+				s.writeError(w, http.StatusNotFound, fmt.Sprintf("no workspace snapshot for iteration %d", iter))
+			} else {
+				s.logger.Error("failed to read workspace manifest", "run_id", runID, "iteration", iter, "error", err)
+				s.writeError(w, http.StatusInternalServerError, "failed to read workspace snapshot")
+			}
+			return nil, false
+		}
+		return m, true
+	}
+	before, ok := load(from)
+	if !ok {
+		return
+	}
+	after, ok := load(to)
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, WorkspaceDiffResponse{
+		RunID:   runID,
+		From:    from,
+		To:      to,
+		Changes: localtools.DiffWorkspaceManifests(before, after),
+	})
+}
+
+// handleRunExport returns the run, its steps, token totals, and workspace
+// manifest as one JSON document. With include_file_contents=true, files no
+// larger than max_inline_bytes are inlined.
+func (s *Server) handleRunExport(w http.ResponseWriter, r *http.Request) {
+	runID := chi.URLParam(r, "run_id")
+
+	inline := false
+	if v := r.URL.Query().Get("include_file_contents"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "include_file_contents must be a boolean")
+			return
+		}
+		inline = b
+	}
+	maxInline := int64(defaultExportInlineBytes)
+	if v := r.URL.Query().Get("max_inline_bytes"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 || n > maxExportInlineBytes {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("max_inline_bytes must be between 1 and %d", maxExportInlineBytes))
+			return
+		}
+		maxInline = n
+	}
+
+	run, err := s.runs.GetByID(r.Context(), runID)
 	if err != nil {
-		s.logger.Error("failed to resolve workspace base path", "workspace_dir", baseDir, "error", err)
-		s.writeError(w, http.StatusInternalServerError, "failed to resolve workspace directory")
+		s.writeError(w, http.StatusNotFound, "run not found")
 		return
 	}
-	runDir := filepath.Join(baseAbs, runID)
-	relToBase, err := filepath.Rel(baseAbs, runDir)
-	if err != nil || relToBase == ".." || strings.HasPrefix(relToBase, ".."+string(os.PathSeparator)) {
-		s.writeError(w, http.StatusBadRequest, "invalid run workspace path")
+
+	stepStore := store.NewStepStore(s.runs.DB())
+	steps, err := stepStore.GetByRunID(r.Context(), runID)
+	if err != nil {
+		s.logger.Error("failed to get steps for export", "run_id", runID, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "failed to read steps")
 		return
 	}
+	durations, err := stepStore.DurationsByRun(r.Context(), runID)
+	if err != nil {
+		s.logger.Error("failed to get stage durations", "run_id", runID, "error", err)
+		durations = nil
+	}
+
+	workspace := ExportWorkspace{Files: []ExportWorkspaceFile{}}
+	decisions := []agent.DecisionEntry{}
+	if loopDir, status, _ := s.runLoopDir(run); status == 0 {
+		decisions = s.readDecisions(runID, loopDir)
+	}
+	if runDir, status, _ := s.runWorkspaceDir(run); status == 0 {
+		files, totalSize, _, err := listWorkspaceFiles(runDir)
+		if err != nil {
+			s.logger.Error("failed to walk run workspace", "run_id", runID, "path", runDir, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "failed to read workspace files")
+			return
+		}
+		workspace.FileCount = len(files)
+		workspace.TotalSizeBytes = totalSize
+		workspace.ContentsInlined = inline
+		if inline {
+			workspace.MaxInlineBytes = maxInline
+		}
+		if inline {
+			workspace.Files, workspace.ContentsTruncated = s.inlineExportFiles(runID, runDir, files, maxInline, maxExportInlineTotalBytes)
+		} else {
+			for _, f := range files {
+				workspace.Files = append(workspace.Files, ExportWorkspaceFile{Path: f.Path, SizeBytes: f.SizeBytes})
+			}
+		}
+	}
+
+	respondJSON(w, http.StatusOK, RunExportResponse{
+		ExportedAt:  time.Now().UTC(),
+		Run:         newRunResponse(run, steps, durations),
+		TokenTotals: store.SumTokenUsage(steps),
+		Workspace:   workspace,
+		Decisions:   decisions,
+	})
+}
+
+// inlineExportFiles returns the export entries for files under runDir with
+// the contents of regular files up to maxInline bytes inlined, until budget
+// bytes have been inlined in total. Symlinks are listed without contents so
+// nothing outside the workspace is read. It reports whether any file was left
+// out because the budget ran out.
+func (s *Server) inlineExportFiles(runID, runDir string, files []WorkspaceFileResponse, maxInline, budget int64) ([]ExportWorkspaceFile, bool) {
+	entries := make([]ExportWorkspaceFile, 0, len(files))
+	truncated := false
+	for _, f := range files {
+		entry := ExportWorkspaceFile{Path: f.Path, SizeBytes: f.SizeBytes}
+		switch {
+		case f.SizeBytes > maxInline:
+		case f.SizeBytes > budget:
+			truncated = true
+		default:
+			data, err := readRegularFile(filepath.Join(runDir, filepath.FromSlash(f.Path)), min(maxInline, budget))
+			if err != nil {
+				s.logger.Warn("failed to read workspace file for export", "run_id", runID, "path", f.Path, "error", err)
+			} else if data != nil {
+				budget -= int64(len(data))
+				if utf8.Valid(data) {
+					content := string(data)
+					entry.Content = &content
+				} else {
+					encoded := base64.StdEncoding.EncodeToString(data)
+					entry.ContentBase64 = &encoded
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, truncated
+}
+
+// readRegularFile returns the contents of path when it is a regular file of
+// at most limit bytes. It returns nil, without an error, for a symlink or
+// other special file, or for one that has grown past limit. As in
+// addArchiveFile, the file is checked again after opening.
+func readRegularFile(path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	opened, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	linkInfo, err := os.Lstat(path)
+	if err != nil || !linkInfo.Mode().IsRegular() || !os.SameFile(opened, linkInfo) {
+		return nil, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// readDecisions returns the entries of the run's decisions.jsonl in the order
+// they were recorded. Lines that do not parse are skipped.
+func (s *Server) readDecisions(runID, loopDir string) []agent.DecisionEntry {
+	decisions := []agent.DecisionEntry{}
+	data, err := os.ReadFile(filepath.Join(loopDir, agent.DecisionsFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.logger.Warn("failed to read decisions for export", "run_id", runID, "error", err)
+		}
+		return decisions
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var d agent.DecisionEntry
+		if err := json.Unmarshal([]byte(line), &d); err != nil {
+			s.logger.Warn("skipping malformed decision entry", "run_id", runID, "error", err)
+			continue
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions
+}
+
+// runWorkspaceDir resolves the workspace directory of a run: the path the
+// loop recorded when the run started, which for an external workspace lies
+// outside agent.workspace_dir, or else the run's directory under it. On
+// failure it returns a non-zero HTTP status and the message to report.
+func (s *Server) runWorkspaceDir(run *store.Run) (string, int, string) {
+	if run.WorkspacePath != nil && *run.WorkspacePath != "" {
+		return *run.WorkspacePath, 0, ""
+	}
+	baseAbs, status, msg := s.workspaceBase()
+	if status != 0 {
+		return "", status, msg
+	}
+	runDir := filepath.Join(baseAbs, run.ID)
+	relToBase, err := filepath.Rel(baseAbs, runDir)
+	if err != nil || relToBase == ".." || strings.HasPrefix(relToBase, ".."+string(os.PathSeparator)) ||
+		relToBase == localtools.StateDirName {
+		return "", http.StatusBadRequest, "invalid run workspace path"
+	}
+	return runDir, 0, ""
+}
+
+// runStateDir resolves the directory holding a run's workspace manifests and
+// replay snapshots. Failures are reported as by runWorkspaceDir.
+func (s *Server) runStateDir(runID string) (string, int, string) {
+	baseAbs, status, msg := s.workspaceBase()
+	if status != 0 {
+		return "", status, msg
+	}
+	stateBase := filepath.Join(baseAbs, localtools.StateDirName)
+	stateDir := localtools.RunStateDir(baseAbs, runID)
+	rel, err := filepath.Rel(stateBase, stateDir)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", http.StatusBadRequest, "invalid run state path"
+	}
+	return stateDir, 0, ""
+}
+
+// runLoopDir resolves the directory holding the loop's own files for a run,
+// such as decisions.jsonl and the evidence trail: the state dir for an
+// external workspace, otherwise the workspace itself.
+func (s *Server) runLoopDir(run *store.Run) (string, int, string) {
+	if agent.UsesExternalWorkspace(run.Constraints) {
+		return s.runStateDir(run.ID)
+	}
+	return s.runWorkspaceDir(run)
+}
+
+// hasStateDirEvidence reports whether a run in an external workspace has
+// written its evidence trail, which the loop keeps in the run's state dir.
+func (s *Server) hasStateDirEvidence(runID string) bool {
+	stateDir, status, _ := s.runStateDir(runID)
+	if status != 0 {
+		return false
+	}
+	for name := range evidenceFiles {
+		if info, err := os.Lstat(filepath.Join(stateDir, name)); err == nil && info.Mode().IsRegular() {
+			return true
+		}
+	}
+	return false
+}
+
+// workspaceBase returns the absolute agent.workspace_dir.
+func (s *Server) workspaceBase() (string, int, string) {
+	baseDir := strings.TrimSpace(s.config.WorkspaceDir)
+	if baseDir == "" {
+		return "", http.StatusServiceUnavailable, "workspace directory is not configured"
+	}
+	baseAbs, err := filepath.Abs(baseDir)
+	if err != nil {
+		s.logger.Error("failed to resolve workspace base path", "workspace_dir", baseDir, "error", err)
+		return "", http.StatusInternalServerError, "failed to resolve workspace directory"
+	}
+	return baseAbs, 0, ""
+}
 
+// listWorkspaceFiles walks runDir and returns its files sorted by path, their
+// total size, and whether an evidence file is present. A missing directory
+// yields an empty listing.
+func listWorkspaceFiles(runDir string) ([]WorkspaceFileResponse, int64, bool, error) {
+	files := make([]WorkspaceFileResponse, 0, 32)
 	info, err := os.Stat(runDir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			respondJSON(w, http.StatusOK, WorkspaceResponse{
-				RunID:          runID,
-				FileCount:      0,
-				TotalSizeBytes: 0,
-				Files:          []WorkspaceFileResponse{},
-			})
-			return
+			return files, 0, false, nil
 		}
-		s.logger.Error("failed to stat run workspace", "run_id", runID, "path", runDir, "error", err)
-		s.writeError(w, http.StatusInternalServerError, "failed to read workspace")
-		return
+		return nil, 0, false, err
 	}
 	if !info.IsDir() {
-		s.writeError(w, http.StatusInternalServerError, "workspace path is not a directory")
-		return
+		return nil, 0, false, fmt.Errorf("workspace path is not a directory")
 	}
 
-	files := make([]WorkspaceFileResponse, 0, 32)
 	var totalSize int64
+	hasEvidence := false
 	if err := filepath.WalkDir(runDir, func(path string, d fs.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
@@ -260,31 +902,31 @@ func (s *Server) handleRunWorkspace(w http.ResponseWriter, r *http.Request) {
 			return err
 		}
 		rel = filepath.ToSlash(rel)
+		if evidenceFiles[rel] {
+			hasEvidence = true
+		}
+		contentType, category := localtools.DetectContentType(path, fileInfo.Size())
 		files = append(files, WorkspaceFileResponse{
-			Path:      rel,
-			SizeBytes: fileInfo.Size(),
+			Path:        rel,
+			SizeBytes:   fileInfo.Size(),
+			ContentType: contentType,
+			Category:    category,
 		})
 		totalSize += fileInfo.Size()
 		return nil
 	}); err != nil {
-		s.logger.Error("failed to walk run workspace", "run_id", runID, "path", runDir, "error", err)
-		s.writeError(w, http.StatusInternalServerError, "failed to read workspace files")
-		return
+		return nil, 0, false, err
 	}
 
 	sort.Slice(files, func(i, j int) bool {
 		return files[i].Path < files[j].Path
 	})
-
-	respondJSON(w, http.StatusOK, WorkspaceResponse{
-		RunID:          runID,
-		FileCount:      len(files),
-		TotalSizeBytes: totalSize,
-		Files:          files,
-	})
+	return files, totalSize, hasEvidence, nil
 }
 
 // handleRunEvents handles GET /v1/runs/{run_id}/events using Server-Sent Events.
+// Besides run and step changes it emits workspace.updated with the workspace
+// summary whenever the run's file listing changes.
 func (s *Server) handleRunEvents(w http.ResponseWriter, r *http.Request) {
 	runID := chi.URLParam(r, "run_id")
 
@@ -300,6 +942,14 @@ func (s *Server) handleRunEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	open := s.activeStreams.Add(1)
+	defer s.activeStreams.Add(-1)
+	if limit := s.config.MaxConcurrentStreams; limit > 0 && open > int64(limit) {
+		w.Header().Set("Retry-After", "5")
+		s.writeError(w, http.StatusServiceUnavailable, "too many open event streams; retry later")
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
@@ -312,12 +962,22 @@ func (s *Server) handleRunEvents(w http.ResponseWriter, r *http.Request) {
 		steps = nil
 	}
 
+	// Long runs can have thousands of steps; only the most recent ones are sent
+	// up front. Older steps remain available from GET /v1/runs/{run_id}.
+	snapshotSteps := steps
+	truncated := false
+	if limit := s.config.SnapshotMaxSteps; limit > 0 && len(steps) > limit {
+		snapshotSteps = steps[len(steps)-limit:]
+		truncated = true
+	}
 	if err := writeSSEEvent(w, flusher, "snapshot", map[string]any{
-		"type":      "snapshot",
-		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
-		"run_id":    runID,
-		"run":       run,
-		"steps":     steps,
+		"type":        "snapshot",
+		"timestamp":   time.Now().UTC().Format(time.RFC3339Nano),
+		"run_id":      runID,
+		"run":         run,
+		"steps":       snapshotSteps,
+		"truncated":   truncated,
+		"total_steps": len(steps),
 	}); err != nil {
 		return
 	}
@@ -327,6 +987,47 @@ func (s *Server) handleRunEvents(w http.ResponseWriter, r *http.Request) {
 	for _, step := range steps {
 		stepSigs[step.ID] = stepStreamSignature(step)
 	}
+
+	workspaceSig := ""
+	emitWorkspace := func(run *store.Run) error {
+		runDir, status, _ := s.runWorkspaceDir(run)
+		if status != 0 {
+			return nil
+		}
+		sig, err := workspaceListingSignature(runDir)
+		if err != nil {
+			s.logger.Error("failed to hash run workspace", "run_id", runID, "path", runDir, "error", err)
+			return nil
+		}
+		if sig == workspaceSig {
+			return nil
+		}
+		files, totalSize, hasEvidence, err := listWorkspaceFiles(runDir)
+		if err != nil {
+			s.logger.Error("failed to walk run workspace", "run_id", runID, "path", runDir, "error", err)
+			return nil
+		}
+		if agent.UsesExternalWorkspace(run.Constraints) {
+			hasEvidence = s.hasStateDirEvidence(runID)
+		}
+		workspaceSig = sig
+		return writeSSEEvent(w, flusher, "workspace.updated", map[string]any{
+			"type":      "workspace.updated",
+			"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+			"run_id":    runID,
+			"workspace": WorkspaceResponse{
+				RunID:          runID,
+				FileCount:      len(files),
+				TotalSizeBytes: totalSize,
+				HasEvidence:    hasEvidence,
+				Files:          files,
+			},
+		})
+	}
+	if err := emitWorkspace(run); err != nil {
+		return
+	}
+
 	if run.Status == store.RunStatusDone || run.Status == store.RunStatusFailed {
 		_ = writeSSEEvent(w, flusher, "stream.closed", map[string]any{
 			"type":      "stream.closed",
@@ -351,10 +1052,27 @@ func (s *Server) handleRunEvents(w http.ResponseWriter, r *http.Request) {
 	defer pollTicker.Stop()
 	defer heartbeatTicker.Stop()
 
+	// A nil channel never fires, so streams without a maximum age run until
+	// the run finishes or the client disconnects.
+	var expired <-chan time.Time
+	if maxAge := s.config.MaxStreamDuration; maxAge > 0 {
+		maxAgeTimer := time.NewTimer(maxAge)
+		defer maxAgeTimer.Stop()
+		expired = maxAgeTimer.C
+	}
+
 	for {
 		select {
 		case <-r.Context().Done():
 			return
+		case <-expired:
+			_ = writeSSEEvent(w, flusher, "stream.closed", map[string]any{
+				"type":      "stream.closed",
+				"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+				"run_id":    runID,
+				"status":    "timeout",
+			})
+			return
 		case <-heartbeatTicker.C:
 			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
 				return
@@ -417,6 +1135,10 @@ func (s *Server) handleRunEvents(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 
+			if err := emitWorkspace(currentRun); err != nil {
+				return
+			}
+
 			if currentRun.Status == store.RunStatusDone || currentRun.Status == store.RunStatusFailed {
 				_ = writeSSEEvent(w, flusher, "stream.closed", map[string]any{
 					"type":      "stream.closed",
@@ -450,6 +1172,37 @@ func writeSSEEvent(w http.ResponseWriter, flusher http.Flusher, event string, pa
 	return nil
 }
 
+// workspaceListingSignature hashes the path, size, and modification time of
+// every file under runDir. A missing directory hashes as an empty listing.
+func workspaceListingSignature(runDir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(runDir, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if path == runDir && os.IsNotExist(walkErr) {
+				return filepath.SkipDir
+			}
+			return walkErr
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(runDir, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s|%d|%d\n", filepath.ToSlash(rel), info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 func runStreamSignature(run *store.Run) string {
 	if run == nil {
 		return ""
@@ -510,3 +1263,14 @@ func respondJSON(w http.ResponseWriter, statusCode int, data any) {
 func (s *Server) writeError(w http.ResponseWriter, statusCode int, message string) {
 	respondJSON(w, statusCode, ErrorResponse{Error: message})
 }
+
+// writeDecodeError reports a request body that failed to decode: 413 when it
+// exceeded MaxRequestBytes, otherwise 400 with message.
+func (s *Server) writeDecodeError(w http.ResponseWriter, err error, message string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		s.writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+		return
+	}
+	s.writeError(w, http.StatusBadRequest, message)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestHandleRunApproveAndReject(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "delete old backups", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	srv := New(Config{Token: "test-token"}, runStore, &testCreator{runStore: runStore}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/runs/"+run.ID+path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post("/approve", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("queued run approve status = %d, want 409", rr.Code)
+	}
+
+	if err := runStore.UpdateStatus(ctx, run.ID, store.RunStatusRunning, nil, nil); err != nil {
+		t.Fatalf("mark running: %v", err)
+	}
+	if err := runStore.RequestApproval(ctx, run.ID, store.Approval{Action: "rm -r backups/2023", RequestedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("request approval: %v", err)
+	}
+	got, err := runStore.GetByID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got.Status != store.RunStatusAwaitingApproval || got.PendingApproval == nil || got.PendingApproval.Action != "rm -r backups/2023" {
+		t.Fatalf("run = status %s, pending %+v; want awaiting_approval with the action", got.Status, got.PendingApproval)
+	}
+
+	if rr := post("/reject", `{"note":`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad body status = %d, want 400", rr.Code)
+	}
+	rr := post("/approve", `{"note":"only the 2023 folder"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("approve status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var resp ApprovalDecisionResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Approval == nil || resp.Approval.Decision != store.ApprovalApproved || resp.Approval.Note != "only the 2023 folder" || resp.Approval.DecidedAt == nil {
+		t.Fatalf("approval = %+v, want approved with note", resp.Approval)
+	}
+
+	if rr := post("/reject", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("second decision status = %d, want 409", rr.Code)
+	}
+	pending, err := runStore.PendingApproval(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("pending approval: %v", err)
+	}
+	if pending == nil || pending.Decision != store.ApprovalApproved {
+		t.Fatalf("stored approval = %+v, want the first decision kept", pending)
+	}
+}
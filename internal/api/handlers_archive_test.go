@@ -0,0 +1,145 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestHandleRunWorkspaceArchiveStreamsTarGz(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "archive workspace", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	bare, _, err := runStore.Create(ctx, "no workspace", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	workspaceBase := t.TempDir()
+	runDir := filepath.Join(workspaceBase, run.ID)
+	if err := os.MkdirAll(filepath.Join(runDir, "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir run workspace: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(runDir, "a.txt"), []byte("abc"), 0o644); err != nil {
+		t.Fatalf("write a.txt: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(runDir, "sub", "b.md"), []byte("hello"), 0o644); err != nil {
+		t.Fatalf("write b.md: %v", err)
+	}
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(secret, []byte("outside"), 0o644); err != nil {
+		t.Fatalf("write secret: %v", err)
+	}
+	if err := os.Symlink(secret, filepath.Join(runDir, "link.txt")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	srv := New(Config{Token: "test-token", WorkspaceDir: workspaceBase}, runStore, &testCreator{runStore: runStore}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	get := func(runID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/runs/"+runID+"/workspace.tar.gz", nil)
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get(run.ID)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("archive = %d %q, want 200 application/gzip", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	gz, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	got := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read tar: %v", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("read %s: %v", hdr.Name, err)
+		}
+		got[hdr.Name] = string(data)
+	}
+	want := map[string]string{"a.txt": "abc", "sub/": "", "sub/b.md": "hello"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("archive entries = %v, want %v", got, want)
+	}
+
+	if rr := get(bare.ID); rr.Code != http.StatusNotFound {
+		t.Fatalf("archive without workspace = %d, want 404", rr.Code)
+	}
+	if rr := get("missing"); rr.Code != http.StatusNotFound {
+		t.Fatalf("archive of unknown run = %d, want 404", rr.Code)
+	}
+}
+
+func TestCopyArchiveEntryPadsFileThatShrank(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	// The header was written from a Stat of 8 bytes; only 3 are left to read.
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "shrunk.txt", Mode: 0o644, Size: 8}); err != nil {
+		t.Fatalf("write header: %v", err)
+	}
+	if err := copyArchiveEntry(tw, strings.NewReader("abc"), 8); err != nil {
+		t.Fatalf("copyArchiveEntry: %v", err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "next.txt", Mode: 0o644, Size: 4}); err != nil {
+		t.Fatalf("write next header: %v", err)
+	}
+	if err := copyArchiveEntry(tw, strings.NewReader("next and more"), 4); err != nil {
+		t.Fatalf("copyArchiveEntry: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar: %v", err)
+	}
+
+	tr := tar.NewReader(&buf)
+	got := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read tar: %v", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("read %s: %v", hdr.Name, err)
+		}
+		got[hdr.Name] = string(data)
+	}
+	want := map[string]string{"shrunk.txt": "abc\x00\x00\x00\x00\x00", "next.txt": "next"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("entries = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestHandleCompareRuns(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	newRun := func(status store.RunStatus, summary string, phases ...store.StepPhase) string {
+		run, _, err := runStore.Create(ctx, "same goal", nil, nil, nil, nil, 0)
+		if err != nil {
+			t.Fatalf("create run: %v", err)
+		}
+		for i, phase := range phases {
+			step, err := stepStore.Append(ctx, run.ID, i+1, phase, nil, nil)
+			if err != nil {
+				t.Fatalf("append step: %v", err)
+			}
+			output := json.RawMessage(`{"content":"ok","token_usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`)
+			if err := stepStore.UpdateStatusWithAttempt(ctx, step.ID, store.StepStatusOK, output, nil, 1); err != nil {
+				t.Fatalf("complete step: %v", err)
+			}
+		}
+		if err := runStore.UpdateStatus(ctx, run.ID, store.RunStatusRunning, nil, nil); err != nil {
+			t.Fatalf("start run: %v", err)
+		}
+		if err := runStore.UpdateStatus(ctx, run.ID, status, &summary, nil); err != nil {
+			t.Fatalf("finish run: %v", err)
+		}
+		return run.ID
+	}
+	a := newRun(store.RunStatusDone, "prompt A won", store.StepPhaseFrame, store.StepPhasePlan, store.StepPhaseAct, store.StepPhaseReflect)
+	b := newRun(store.RunStatusFailed, "prompt B stalled", store.StepPhaseFrame, store.StepPhaseAct, store.StepPhaseAct)
+
+	srv := New(Config{Token: "test-token"}, runStore, &testCreator{runStore: runStore}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/runs/compare"+query, nil)
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("?ids=" + b + "," + a)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("compare = %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp CompareResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Runs) != 2 || resp.Runs[0].RunID != b || resp.Runs[1].RunID != a {
+		t.Fatalf("runs = %+v, want %s then %s", resp.Runs, b, a)
+	}
+	gotB, gotA := resp.Runs[0], resp.Runs[1]
+	if gotA.Status != "done" || gotA.StepCount != 4 || gotA.TokenUsage.TotalTokens != 60 || *gotA.Summary != "prompt A won" || gotA.DurationMS == nil {
+		t.Fatalf("run A = %+v", gotA)
+	}
+	if gotB.Status != "failed" || gotB.StepCount != 3 || gotB.StepsByPhase["act"] != 2 || gotB.StepsByPhase["plan"] != 0 || gotB.TokenUsage.PromptTokens != 30 {
+		t.Fatalf("run B = %+v", gotB)
+	}
+
+	for query, want := range map[string]int{
+		"?ids=" + a:              http.StatusBadRequest,
+		"?ids=" + a + "," + a:    http.StatusBadRequest,
+		"?ids=" + a + ",missing": http.StatusNotFound,
+		"":                       http.StatusBadRequest,
+	} {
+		if rr := get(query); rr.Code != want {
+			t.Errorf("GET /v1/runs/compare%s = %d, want %d", query, rr.Code, want)
+		}
+	}
+}
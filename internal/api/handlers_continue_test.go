@@ -0,0 +1,199 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/localtools"
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestHandleRunContinueSeedsChildFromParentWorkspace(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	parent, _, err := runStore.Create(ctx, "draft the report", nil, json.RawMessage(`{"k":"v"}`), json.RawMessage(`{"max_loops":4}`), map[string]string{"team": "a"}, 2)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	workspaceDir := t.TempDir()
+	parentDir := filepath.Join(workspaceDir, parent.ID)
+	seed := map[string]string{
+		"run_memory.md":    "## Iteration 1\nlearned\n",
+		"state.json":       `{"todo":[]}`,
+		"drafts/report.md": "draft",
+		"checkpoint.json":  `{"iteration":3}`,
+		"loop_memory.md":   "loop",
+		"evidence.md":      "evidence",
+		"decisions.jsonl":  `{"decision":"draft first"}`,
+	}
+	for name, content := range seed {
+		path := filepath.Join(parentDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	creator := &testCreator{runStore: runStore}
+	srv := New(Config{Token: "test-token", WorkspaceDir: workspaceDir}, runStore, creator, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/runs/"+parent.ID+"/continue", bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post(`{"goal":"now publish it"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("queued parent status = %d, want 409", rr.Code)
+	}
+	summary := "report drafted"
+	if err := runStore.UpdateStatus(ctx, parent.ID, store.RunStatusDone, &summary, nil); err != nil {
+		t.Fatalf("complete parent: %v", err)
+	}
+	if rr := post(`{"goal":"  "}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("empty goal status = %d, want 400", rr.Code)
+	}
+
+	rr := post(`{"goal":"now publish it","constraints":{"max_loops":2}}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("continue status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var resp ContinueResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.ContinuedFrom != parent.ID || resp.RunID == parent.ID || resp.Status != string(store.RunStatusQueued) {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	child, err := runStore.GetByID(ctx, resp.RunID)
+	if err != nil {
+		t.Fatalf("get child: %v", err)
+	}
+	// A continuation is not a subrun, so it leaves parent_run_id unset.
+	if child.ContinuedFrom == nil || *child.ContinuedFrom != parent.ID || child.ParentRunID != nil || child.Goal != "now publish it" {
+		t.Fatalf("child = continued_from %v parent %v goal %q", child.ContinuedFrom, child.ParentRunID, child.Goal)
+	}
+	if string(child.Context) != `{"k":"v"}` || string(child.Constraints) != `{"max_loops":2}` || child.Priority != 2 {
+		t.Fatalf("child inputs = %s %s priority %d", child.Context, child.Constraints, child.Priority)
+	}
+	if child.Labels["continuation_of"] != parent.ID || child.Labels["team"] != "a" {
+		t.Fatalf("child labels = %v", child.Labels)
+	}
+
+	childDir := filepath.Join(workspaceDir, resp.RunID)
+	for _, name := range []string{"run_memory.md", "state.json", "drafts/report.md"} {
+		got, err := os.ReadFile(filepath.Join(childDir, name))
+		if err != nil || string(got) != seed[name] {
+			t.Fatalf("seeded %s = %q, %v", name, got, err)
+		}
+	}
+	for _, name := range []string{"checkpoint.json", "loop_memory.md", "evidence.md", "decisions.jsonl"} {
+		if _, err := os.Stat(filepath.Join(childDir, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s not to be copied, stat err = %v", name, err)
+		}
+	}
+	if creator.enqueueCount() != 1 {
+		t.Fatalf("expected continuation run to be enqueued")
+	}
+}
+
+func TestHandleRunContinueFromExternalWorkspaceSeedsStateDir(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	parent, _, err := runStore.Create(ctx, "fix the repo", nil, nil, json.RawMessage(`{"workspace_path":"repo"}`), nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	repo := filepath.Join(t.TempDir(), "repo")
+	if err := os.MkdirAll(repo, 0o755); err != nil {
+		t.Fatalf("mkdir repo: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main"), 0o644); err != nil {
+		t.Fatalf("write repo file: %v", err)
+	}
+	if err := runStore.SetWorkspacePath(ctx, parent.ID, repo); err != nil {
+		t.Fatalf("set workspace path: %v", err)
+	}
+	summary := "fixed"
+	if err := runStore.UpdateStatus(ctx, parent.ID, store.RunStatusDone, &summary, nil); err != nil {
+		t.Fatalf("complete parent: %v", err)
+	}
+
+	workspaceDir := t.TempDir()
+	parentState := localtools.RunStateDir(workspaceDir, parent.ID)
+	if err := os.MkdirAll(parentState, 0o755); err != nil {
+		t.Fatalf("mkdir state: %v", err)
+	}
+	for name, content := range map[string]string{"run_memory.md": "learned", "state.json": `{"todo":[]}`, "checkpoint.json": `{}`} {
+		if err := os.WriteFile(filepath.Join(parentState, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	srv := New(Config{Token: "test-token", WorkspaceDir: workspaceDir}, runStore, &testCreator{runStore: runStore}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do(http.MethodGet, "/v1/runs/"+parent.ID+"/workspace", "")
+	var listing WorkspaceResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &listing); err != nil || rr.Code != http.StatusOK || listing.FileCount != 1 || listing.Files[0].Path != "main.go" {
+		t.Fatalf("workspace listing = %d %s, want the external repo", rr.Code, rr.Body.String())
+	}
+
+	rr = do(http.MethodPost, "/v1/runs/"+parent.ID+"/continue", `{"goal":"now add tests"}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("continue status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var resp ContinueResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	childState := localtools.RunStateDir(workspaceDir, resp.RunID)
+	for _, name := range []string{"run_memory.md", "state.json"} {
+		if _, err := os.Stat(filepath.Join(childState, name)); err != nil {
+			t.Fatalf("expected %s carried into the child state dir: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(childState, "checkpoint.json")); !os.IsNotExist(err) {
+		t.Fatalf("expected checkpoint.json not to be carried, stat err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "run_memory.md")); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing seeded into the external repo, stat err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workspaceDir, resp.RunID)); !os.IsNotExist(err) {
+		t.Fatalf("expected no managed workspace for an external continuation, stat err = %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestHandleRunExportBundlesRunStepsTokensAndWorkspace(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	run, _, err := runStore.Create(ctx, "export me", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	for i, usage := range []string{
+		`{"content":"frame","token_usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+		`{"content":"plan","token_usage":{"prompt_tokens":20,"completion_tokens":7,"total_tokens":27}}`,
+	} {
+		step, err := stepStore.Append(ctx, run.ID, i+1, store.StepPhaseFrame, nil, nil)
+		if err != nil {
+			t.Fatalf("append step: %v", err)
+		}
+		if err := stepStore.UpdateStatus(ctx, step.ID, store.StepStatusOK, json.RawMessage(usage), nil); err != nil {
+			t.Fatalf("update step: %v", err)
+		}
+	}
+
+	workspaceBase := t.TempDir()
+	runDir := filepath.Join(workspaceBase, run.ID)
+	if err := os.MkdirAll(runDir, 0o755); err != nil {
+		t.Fatalf("mkdir run workspace: %v", err)
+	}
+	os.WriteFile(filepath.Join(runDir, "notes.md"), []byte("hello"), 0o644)
+	os.WriteFile(filepath.Join(runDir, "image.bin"), []byte{0xff, 0x00, 0xfe}, 0o644)
+	os.WriteFile(filepath.Join(runDir, "big.txt"), []byte(strings.Repeat("x", 32)), 0o644)
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(secret, []byte("outside"), 0o644); err != nil {
+		t.Fatalf("write secret: %v", err)
+	}
+	if err := os.Symlink(secret, filepath.Join(runDir, "link.txt")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	srv := New(Config{
+		Token:        "test-token",
+		WorkspaceDir: workspaceBase,
+	}, runStore, &testCreator{runStore: runStore}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/runs/"+run.ID+"/export"+query, nil)
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("export status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var resp RunExportResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Run.ID != run.ID || len(resp.Run.Steps) != 2 {
+		t.Fatalf("unexpected run in export: id=%s steps=%d", resp.Run.ID, len(resp.Run.Steps))
+	}
+	if resp.TokenTotals != (store.TokenUsage{PromptTokens: 30, CompletionTokens: 12, TotalTokens: 42}) {
+		t.Fatalf("token_totals = %+v", resp.TokenTotals)
+	}
+	if resp.Workspace.FileCount != 4 || resp.Workspace.ContentsInlined {
+		t.Fatalf("unexpected workspace manifest: %+v", resp.Workspace)
+	}
+	for _, f := range resp.Workspace.Files {
+		if f.Content != nil || f.ContentBase64 != nil {
+			t.Fatalf("contents should not be inlined by default: %+v", f)
+		}
+	}
+
+	rr = get("?include_file_contents=true&max_inline_bytes=16")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("export status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	resp = RunExportResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	byPath := map[string]ExportWorkspaceFile{}
+	for _, f := range resp.Workspace.Files {
+		byPath[f.Path] = f
+	}
+	if f := byPath["notes.md"]; f.Content == nil || *f.Content != "hello" {
+		t.Fatalf("notes.md should be inlined as text: %+v", f)
+	}
+	if f := byPath["image.bin"]; f.ContentBase64 == nil || *f.ContentBase64 != base64.StdEncoding.EncodeToString([]byte{0xff, 0x00, 0xfe}) {
+		t.Fatalf("image.bin should be inlined as base64: %+v", f)
+	}
+	if f := byPath["big.txt"]; f.Content != nil || f.ContentBase64 != nil || f.SizeBytes != 32 {
+		t.Fatalf("big.txt should be listed but not inlined: %+v", f)
+	}
+	if f := byPath["link.txt"]; f.Content != nil || f.ContentBase64 != nil {
+		t.Fatalf("symlink contents must not be inlined: %+v", f)
+	}
+	if resp.Workspace.ContentsTruncated {
+		t.Fatalf("contents_truncated should be unset: %+v", resp.Workspace)
+	}
+
+	if rr := get("?max_inline_bytes=0"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid max_inline_bytes status = %d, want 400", rr.Code)
+	}
+}
+
+func TestInlineExportFilesStopsAtBudget(t *testing.T) {
+	runDir := t.TempDir()
+	os.WriteFile(filepath.Join(runDir, "a.txt"), []byte("aaaa"), 0o644)
+	os.WriteFile(filepath.Join(runDir, "b.txt"), []byte("bbbb"), 0o644)
+	os.WriteFile(filepath.Join(runDir, "c.txt"), []byte("c"), 0o644)
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(secret, []byte("s"), 0o644); err != nil {
+		t.Fatalf("write secret: %v", err)
+	}
+	if err := os.Symlink(secret, filepath.Join(runDir, "link.txt")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	files := []WorkspaceFileResponse{
+		{Path: "link.txt", SizeBytes: 1},
+		{Path: "a.txt", SizeBytes: 4},
+		{Path: "b.txt", SizeBytes: 4},
+		{Path: "c.txt", SizeBytes: 1},
+	}
+
+	srv := &Server{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	entries, truncated := srv.inlineExportFiles("run", runDir, files, 16, 6)
+	if !truncated {
+		t.Fatal("expected the budget to be reported as exhausted")
+	}
+	if entries[0].Content != nil || entries[0].ContentBase64 != nil {
+		t.Fatalf("symlink contents must not be inlined: %+v", entries[0])
+	}
+	if entries[1].Content == nil || *entries[1].Content != "aaaa" {
+		t.Fatalf("a.txt should be inlined: %+v", entries[1])
+	}
+	if entries[2].Content != nil || entries[2].SizeBytes != 4 {
+		t.Fatalf("b.txt should be listed without contents: %+v", entries[2])
+	}
+	if entries[3].Content == nil || *entries[3].Content != "c" {
+		t.Fatalf("c.txt should still fit in the budget: %+v", entries[3])
+	}
+}
+
+func TestHandleRunExportIncludesDecisions(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "decide things", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	workspaceBase := t.TempDir()
+	runDir := filepath.Join(workspaceBase, run.ID)
+	if err := os.MkdirAll(runDir, 0o755); err != nil {
+		t.Fatalf("mkdir run workspace: %v", err)
+	}
+	decisions := `{"iteration":1,"recorded_at":"2026-01-02T03:04:05Z","decision":"use sqlite","rationale":"no server","alternatives_considered":["postgres"]}
+not json
+{"iteration":2,"recorded_at":"2026-01-02T03:05:00Z","decision":"skip caching","rationale":"inputs are small"}
+`
+	if err := os.WriteFile(filepath.Join(runDir, "decisions.jsonl"), []byte(decisions), 0o644); err != nil {
+		t.Fatalf("write decisions: %v", err)
+	}
+
+	srv := New(Config{Token: "test-token", WorkspaceDir: workspaceBase}, runStore, &testCreator{runStore: runStore}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	req := httptest.NewRequest(http.MethodGet, "/v1/runs/"+run.ID+"/export", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	rr := httptest.NewRecorder()
+	srv.setupRoutes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("export status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var resp RunExportResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Decisions) != 2 {
+		t.Fatalf("expected 2 decisions, got %+v", resp.Decisions)
+	}
+	if d := resp.Decisions[0]; d.Iteration != 1 || d.Decision != "use sqlite" || len(d.AlternativesConsidered) != 1 {
+		t.Fatalf("unexpected first decision: %+v", d)
+	}
+	if resp.Decisions[1].Decision != "skip caching" {
+		t.Fatalf("unexpected second decision: %+v", resp.Decisions[1])
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestHandleRunExtendCapsTotalExtension(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "slow goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	post := func(limit time.Duration, body string) *httptest.ResponseRecorder {
+		srv := New(Config{Token: "test-token", MaxDeadlineExtension: limit}, runStore, &testCreator{runStore: runStore}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		req := httptest.NewRequest(http.MethodPost, "/v1/runs/"+run.ID+"/extend", bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post(0, `{"additional_seconds":60}`); rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "disabled") {
+		t.Fatalf("disabled status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	if rr := post(2*time.Minute, `{"additional_seconds":60}`); rr.Code != http.StatusConflict {
+		t.Fatalf("queued run status = %d, want 409", rr.Code)
+	}
+	if err := runStore.UpdateStatus(ctx, run.ID, store.RunStatusRunning, nil, nil); err != nil {
+		t.Fatalf("mark running: %v", err)
+	}
+	if rr := post(2*time.Minute, `{"additional_seconds":0}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("zero seconds status = %d, want 400", rr.Code)
+	}
+
+	rr := post(2*time.Minute, `{"additional_seconds":60}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("extend status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var resp ExtendResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.ExtensionSeconds != 60 || resp.RemainingExtensionSeconds != 60 {
+		t.Fatalf("response = %+v, want 60s granted and 60s left", resp)
+	}
+
+	if rr := post(2*time.Minute, `{"additional_seconds":90}`); rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "60s of 120s already granted") {
+		t.Fatalf("over-limit status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	extension, err := runStore.DeadlineExtension(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get extension: %v", err)
+	}
+	if extension != time.Minute {
+		t.Fatalf("stored extension = %v, want 1m", extension)
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestHandleRunMessageQueuesGuidanceForActiveRuns(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	active, _, err := runStore.Create(ctx, "steerable goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	finished, _, err := runStore.Create(ctx, "finished goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := runStore.UpdateStatus(ctx, finished.ID, store.RunStatusDone, nil, nil); err != nil {
+		t.Fatalf("finish run: %v", err)
+	}
+
+	srv := New(Config{Token: "test-token"}, runStore, &testCreator{runStore: runStore}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	post := func(runID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/runs/"+runID+"/message", bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i, msg := range []string{"skip the staging hosts", "prefer the v2 API"} {
+		rr := post(active.ID, `{"message":"`+msg+`"}`)
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("message %d status = %d, body %s", i, rr.Code, rr.Body.String())
+		}
+		var resp RunMessageResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.RunID != active.ID || resp.Pending != i+1 {
+			t.Fatalf("message %d response = %s", i, rr.Body.String())
+		}
+	}
+
+	for _, tc := range []struct {
+		runID, body string
+		want        int
+	}{
+		{active.ID, `{"message":"  "}`, http.StatusBadRequest},
+		{active.ID, `not json`, http.StatusBadRequest},
+		{"missing", `{"message":"hello"}`, http.StatusNotFound},
+		{finished.ID, `{"message":"too late"}`, http.StatusConflict},
+	} {
+		if rr := post(tc.runID, tc.body); rr.Code != tc.want {
+			t.Fatalf("POST %s %s status = %d, want %d", tc.runID, tc.body, rr.Code, tc.want)
+		}
+	}
+
+	messages, err := runStore.TakeMessages(ctx, active.ID)
+	if err != nil {
+		t.Fatalf("take messages: %v", err)
+	}
+	if len(messages) != 2 || messages[0].Message != "skip the staging hosts" || messages[1].Message != "prefer the v2 API" || messages[0].ReceivedAt.IsZero() {
+		t.Fatalf("inbox = %+v", messages)
+	}
+	if again, err := runStore.TakeMessages(ctx, active.ID); err != nil || len(again) != 0 {
+		t.Fatalf("inbox after take = %+v (err %v), want empty", again, err)
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestHandleReadyz(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	providerErr := errors.New("provider returned HTTP 401")
+
+	readyz := func(srv *Server) (int, ReadyzResponse) {
+		req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		var resp ReadyzResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode readyz response: %v", err)
+		}
+		return rr.Code, resp
+	}
+
+	healthy := New(Config{Token: "test-token", ReadinessChecks: []ReadinessCheck{
+		{Name: "llm_provider", Check: func(context.Context) error { return nil }},
+	}}, runStore, nil, logger)
+	code, resp := readyz(healthy)
+	if code != http.StatusOK || resp.Status != "ready" {
+		t.Fatalf("readyz = %d %+v, want 200 ready", code, resp)
+	}
+	if resp.Checks["database"] != "ok" || resp.Checks["llm_provider"] != "ok" {
+		t.Fatalf("unexpected checks: %+v", resp.Checks)
+	}
+
+	failingProvider := New(Config{Token: "test-token", ReadinessChecks: []ReadinessCheck{
+		{Name: "llm_provider", Check: func(context.Context) error { return providerErr }},
+	}}, runStore, nil, logger)
+	code, resp = readyz(failingProvider)
+	if code != http.StatusServiceUnavailable || resp.Checks["llm_provider"] != providerErr.Error() {
+		t.Fatalf("readyz = %d %+v, want 503 with provider error", code, resp)
+	}
+
+	_ = db.Close()
+	code, resp = readyz(New(Config{Token: "test-token"}, runStore, nil, logger))
+	if code != http.StatusServiceUnavailable || resp.Checks["database"] == "ok" {
+		t.Fatalf("readyz = %d %+v, want 503 with database error", code, resp)
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/localtools"
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestHandleRunReplaySeedsNewRunFromSnapshot(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	src, _, err := runStore.Create(ctx, "original goal", nil, json.RawMessage(`{"k":"v"}`), json.RawMessage(`{"max_loops":4}`), map[string]string{"team": "a"}, 2)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	workspaceDir := t.TempDir()
+	snapDir := localtools.ReplaySnapshotDir(localtools.RunStateDir(workspaceDir, src.ID), 1)
+	if err := os.MkdirAll(snapDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(snapDir, "state.json"), []byte(`{"todo":[]}`), 0o644); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(snapDir, "run_memory.md"), []byte("## Iteration 1\nlearned\n"), 0o644); err != nil {
+		t.Fatalf("write memory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(snapDir, "checkpoint.json"), []byte(`{"iteration":2,"next_stage":"act"}`), 0o644); err != nil {
+		t.Fatalf("write checkpoint: %v", err)
+	}
+
+	creator := &testCreator{runStore: runStore}
+	srv := New(Config{Token: "test-token", WorkspaceDir: workspaceDir, Models: []string{"gpt-4o", "gpt-4o-mini"}}, runStore, creator, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	post := func(query, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/runs/"+src.ID+"/replay"+query, bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post("?from_iteration=3", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("missing snapshot status = %d, want 404", rr.Code)
+	}
+	if rr := post("", ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("missing from_iteration status = %d, want 400", rr.Code)
+	}
+
+	rr := post("?from_iteration=2", `{"constraints":{"temperature":0}}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("replay status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var resp ReplayResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.ReplayOf != src.ID || resp.FromIteration != 2 || resp.RunID == src.ID {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	replay, err := runStore.GetByID(ctx, resp.RunID)
+	if err != nil {
+		t.Fatalf("get replay run: %v", err)
+	}
+	if replay.Goal != src.Goal || string(replay.Context) != `{"k":"v"}` || string(replay.Constraints) != `{"temperature":0}` {
+		t.Fatalf("replay inputs = %q %s %s", replay.Goal, replay.Context, replay.Constraints)
+	}
+	if replay.Labels["replay_of"] != src.ID || replay.Labels["replay_from_iteration"] != "2" || replay.Labels["team"] != "a" {
+		t.Fatalf("replay labels = %v", replay.Labels)
+	}
+	memory, err := os.ReadFile(filepath.Join(workspaceDir, resp.RunID, "run_memory.md"))
+	if err != nil || string(memory) != "## Iteration 1\nlearned\n" {
+		t.Fatalf("seeded run memory = %q, %v", memory, err)
+	}
+	if _, err := os.Stat(filepath.Join(workspaceDir, resp.RunID, "state.json")); err != nil {
+		t.Fatalf("expected seeded state.json: %v", err)
+	}
+	if cp, err := os.ReadFile(filepath.Join(workspaceDir, resp.RunID, "checkpoint.json")); err != nil || !strings.Contains(string(cp), `"iteration":2`) {
+		t.Fatalf("seeded checkpoint = %q, %v", cp, err)
+	}
+	if creator.enqueueCount() != 1 {
+		t.Fatalf("expected replay run to be enqueued")
+	}
+
+	if rr := post("?from_iteration=2", `{"model":"unknown-model"}`); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "llm.allowed_models") {
+		t.Fatalf("unknown model status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	rr = post("?from_iteration=2", `{"model":"gpt-4o-mini"}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("replay with model status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if replay, err = runStore.GetByID(ctx, resp.RunID); err != nil {
+		t.Fatalf("get replay run: %v", err)
+	}
+	if string(replay.Constraints) != `{"max_loops":4,"model":"gpt-4o-mini"}` {
+		t.Fatalf("replay constraints = %s, want the original plus model", replay.Constraints)
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestHandleStatsAggregatesRunsTokensAndQueue(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	done, _, err := runStore.Create(ctx, "finished", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := runStore.UpdateStatus(ctx, done.ID, store.RunStatusRunning, nil, nil); err != nil {
+		t.Fatalf("mark running: %v", err)
+	}
+	if err := runStore.UpdateStatus(ctx, done.ID, store.RunStatusDone, nil, nil); err != nil {
+		t.Fatalf("mark done: %v", err)
+	}
+	if _, _, err := runStore.Create(ctx, "waiting", nil, nil, nil, nil, 0); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	step, err := stepStore.Append(ctx, done.ID, 1, store.StepPhaseFrame, nil, nil)
+	if err != nil {
+		t.Fatalf("append step: %v", err)
+	}
+	usage := `{"token_usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`
+	if err := stepStore.UpdateStatus(ctx, step.ID, store.StepStatusOK, json.RawMessage(usage), nil); err != nil {
+		t.Fatalf("update step: %v", err)
+	}
+
+	creator := &testCreator{runStore: runStore}
+	_ = creator.Enqueue("queued-run", 0)
+	srv := New(Config{Token: "test-token"}, runStore, creator, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	get := func() StatsResponse {
+		req := httptest.NewRequest(http.MethodGet, "/v1/stats", nil)
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("stats status = %d, body %s", rr.Code, rr.Body.String())
+		}
+		var resp StatsResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp
+	}
+
+	resp := get()
+	if resp.TotalRuns != 2 || resp.RunsByStatus[store.RunStatusDone] != 1 || resp.RunsByStatus[store.RunStatusQueued] != 1 {
+		t.Fatalf("unexpected run counts: %+v", resp)
+	}
+	if resp.FinishedRuns != 1 {
+		t.Fatalf("finished_runs = %d, want 1", resp.FinishedRuns)
+	}
+	if resp.TokensToday != (store.TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}) {
+		t.Fatalf("tokens_today = %+v", resp.TokensToday)
+	}
+	if resp.QueueDepth != 1 {
+		t.Fatalf("queue_depth = %d, want 1", resp.QueueDepth)
+	}
+
+	// Aggregates are cached briefly; live values are not.
+	if _, _, err := runStore.Create(ctx, "another", nil, nil, nil, nil, 0); err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	_ = creator.Enqueue("queued-run-2", 0)
+	cached := get()
+	if cached.TotalRuns != 2 || !cached.ComputedAt.Equal(resp.ComputedAt) {
+		t.Fatalf("expected cached aggregates, got total_runs=%d computed_at=%s", cached.TotalRuns, cached.ComputedAt)
+	}
+	if cached.QueueDepth != 2 {
+		t.Fatalf("queue_depth = %d, want live value 2", cached.QueueDepth)
+	}
+}
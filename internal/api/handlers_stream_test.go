@@ -1,9 +1,19 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/mattjoyce/agenticloop/internal/storage"
 	"github.com/mattjoyce/agenticloop/internal/store"
 )
 
@@ -73,3 +83,192 @@ func TestStepStreamSignatureChangesOnOutput(t *testing.T) {
 		t.Fatalf("expected stable signature for identical step values")
 	}
 }
+
+func TestHandleRunEventsTruncatesSnapshot(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "long run", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	stepStore := store.NewStepStore(db)
+	for i := 1; i <= 5; i++ {
+		if _, err := stepStore.Append(ctx, run.ID, i, store.StepPhaseAct, nil, nil); err != nil {
+			t.Fatalf("append step: %v", err)
+		}
+	}
+	summary := "finished"
+	if err := runStore.UpdateStatus(ctx, run.ID, store.RunStatusDone, &summary, nil); err != nil {
+		t.Fatalf("mark done: %v", err)
+	}
+
+	srv := New(Config{Token: "test-token", SnapshotMaxSteps: 2}, runStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	req := httptest.NewRequest(http.MethodGet, "/v1/runs/"+run.ID+"/events", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	rr := httptest.NewRecorder()
+	srv.setupRoutes().ServeHTTP(rr, req)
+
+	var snapshot struct {
+		Steps      []store.Step `json:"steps"`
+		Truncated  bool         `json:"truncated"`
+		TotalSteps int          `json:"total_steps"`
+	}
+	for _, line := range strings.Split(rr.Body.String(), "\n") {
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			if err := json.Unmarshal([]byte(data), &snapshot); err != nil {
+				t.Fatalf("decode snapshot: %v", err)
+			}
+			break
+		}
+	}
+	if !snapshot.Truncated || snapshot.TotalSteps != 5 {
+		t.Fatalf("expected truncated snapshot of 5 steps, got truncated=%v total=%d", snapshot.Truncated, snapshot.TotalSteps)
+	}
+	if len(snapshot.Steps) != 2 || snapshot.Steps[0].StepNum != 4 || snapshot.Steps[1].StepNum != 5 {
+		t.Fatalf("expected the 2 most recent steps, got %+v", snapshot.Steps)
+	}
+}
+
+func TestHandleRunEventsRejectsStreamsPastLimit(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "stream me", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	srv := New(Config{Token: "test-token", MaxConcurrentStreams: 1}, runStore, &testCreator{runStore: runStore}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv.activeStreams.Store(1) // one stream already open
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/runs/"+run.ID+"/events", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	rr := httptest.NewRecorder()
+	srv.setupRoutes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("events status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected Retry-After header")
+	}
+	if got := srv.activeStreams.Load(); got != 1 {
+		t.Fatalf("active streams = %d after rejection, want 1", got)
+	}
+}
+
+func TestHandleRunEventsEmitsWorkspaceUpdates(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "write files", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := runStore.UpdateStatus(ctx, run.ID, store.RunStatusRunning, nil, nil); err != nil {
+		t.Fatalf("mark running: %v", err)
+	}
+
+	workspaceDir := t.TempDir()
+	runDir := filepath.Join(workspaceDir, run.ID)
+	srv := New(Config{Token: "test-token", WorkspaceDir: workspaceDir, StreamPollInterval: 10 * time.Millisecond}, runStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.MkdirAll(runDir, 0o755)
+		_ = os.WriteFile(filepath.Join(runDir, "notes.md"), []byte("hello"), 0o644)
+		summary := "done"
+		_ = runStore.UpdateStatus(context.Background(), run.ID, store.RunStatusDone, &summary, nil)
+	}()
+
+	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/v1/runs/"+run.ID+"/events", nil).WithContext(reqCtx)
+	req.Header.Set("Authorization", "Bearer test-token")
+	rr := httptest.NewRecorder()
+	srv.setupRoutes().ServeHTTP(rr, req)
+
+	var updates []WorkspaceResponse
+	event := ""
+	for _, line := range strings.Split(rr.Body.String(), "\n") {
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			event = name
+			continue
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok && event == "workspace.updated" {
+			var payload struct {
+				Workspace WorkspaceResponse `json:"workspace"`
+			}
+			if err := json.Unmarshal([]byte(data), &payload); err != nil {
+				t.Fatalf("decode workspace.updated: %v", err)
+			}
+			updates = append(updates, payload.Workspace)
+		}
+	}
+	if len(updates) != 2 {
+		t.Fatalf("expected initial and changed workspace events, got %d: %s", len(updates), rr.Body.String())
+	}
+	if updates[0].FileCount != 0 {
+		t.Fatalf("initial workspace should be empty, got %+v", updates[0])
+	}
+	if updates[1].FileCount != 1 || updates[1].Files[0].Path != "notes.md" {
+		t.Fatalf("expected notes.md in updated workspace, got %+v", updates[1])
+	}
+	if !strings.Contains(rr.Body.String(), "event: stream.closed") {
+		t.Fatalf("expected stream to close after run finished")
+	}
+}
+
+func TestHandleRunEventsClosesStreamAtMaxDuration(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "long running", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := runStore.UpdateStatus(ctx, run.ID, store.RunStatusRunning, nil, nil); err != nil {
+		t.Fatalf("mark running: %v", err)
+	}
+
+	srv := New(Config{Token: "test-token", StreamPollInterval: 10 * time.Millisecond, MaxStreamDuration: 50 * time.Millisecond}, runStore, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/v1/runs/"+run.ID+"/events", nil).WithContext(reqCtx)
+	req.Header.Set("Authorization", "Bearer test-token")
+	rr := httptest.NewRecorder()
+	srv.setupRoutes().ServeHTTP(rr, req)
+
+	if reqCtx.Err() != nil {
+		t.Fatalf("stream was not closed by max_stream_duration")
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, "event: stream.closed") || !strings.Contains(body, `"status":"timeout"`) {
+		t.Fatalf("expected stream.closed with status timeout, got %s", body)
+	}
+	if got := srv.activeStreams.Load(); got != 0 {
+		t.Fatalf("active streams = %d after close, want 0", got)
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+func TestHandleRunTimeline(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	stepStore := store.NewStepStore(db)
+	run, _, err := runStore.Create(ctx, "trace me", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := runStore.UpdateStatus(ctx, run.ID, store.RunStatusRunning, nil, nil); err != nil {
+		t.Fatalf("start run: %v", err)
+	}
+	addStep := func(num int, phase store.StepPhase, status store.StepStatus, output string, errMsg *string) {
+		step, err := stepStore.Append(ctx, run.ID, num, phase, nil, nil)
+		if err != nil {
+			t.Fatalf("append step: %v", err)
+		}
+		if err := stepStore.UpdateStatusWithAttempt(ctx, step.ID, store.StepStatusRunning, nil, nil, 1); err != nil {
+			t.Fatalf("start step: %v", err)
+		}
+		if status == store.StepStatusRunning {
+			return
+		}
+		var out json.RawMessage
+		if output != "" {
+			out = json.RawMessage(output)
+		}
+		if err := stepStore.UpdateStatusWithAttempt(ctx, step.ID, status, out, errMsg, 1); err != nil {
+			t.Fatalf("finish step: %v", err)
+		}
+	}
+	addStep(1, store.StepPhasePlan, store.StepStatusOK, `{"content":"plan"}`, nil)
+	addStep(2, store.StepPhaseAct, store.StepStatusOK, `{"content":"acted","tool_token_usage":{"read_file":{"calls":2},"write_file":{"calls":1}}}`, nil)
+	boom := "model timeout"
+	addStep(3, store.StepPhaseReflect, store.StepStatusError, "", &boom)
+	if err := runStore.Fail(ctx, run.ID, "llm_error", "model timeout"); err != nil {
+		t.Fatalf("fail run: %v", err)
+	}
+
+	srv := New(Config{Token: "test-token"}, runStore, &testCreator{runStore: runStore}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	req := httptest.NewRequest(http.MethodGet, "/v1/runs/"+run.ID+"/timeline", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	rr := httptest.NewRecorder()
+	srv.setupRoutes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("timeline status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	var resp RunTimelineResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode timeline: %v", err)
+	}
+	var types []string
+	for i, e := range resp.Entries {
+		types = append(types, e.Type)
+		if i > 0 && e.At.Before(resp.Entries[i-1].At) {
+			t.Fatalf("entry %d (%s) is out of order", i, e.Type)
+		}
+	}
+	want := []string{"run.queued", "run.started", "step.started", "step.finished", "step.started", "step.finished", "step.started", "step.finished", "run.finished"}
+	if len(types) != len(want) {
+		t.Fatalf("entry types = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("entry types = %v, want %v", types, want)
+		}
+	}
+
+	act := resp.Entries[5]
+	if act.Phase != "act" || act.ToolCalls["read_file"] != 2 || act.ToolCalls["write_file"] != 1 || act.DurationMS == nil {
+		t.Fatalf("act finished entry = %+v", act)
+	}
+	reflect := resp.Entries[7]
+	if reflect.Status != "error" || reflect.Error == nil || *reflect.Error != boom {
+		t.Fatalf("reflect finished entry = %+v", reflect)
+	}
+	last := resp.Entries[8]
+	if last.Status != "failed" || last.FailureCode == nil || *last.FailureCode != "llm_error" {
+		t.Fatalf("run finished entry = %+v", last)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/runs/missing/timeline", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	rr = httptest.NewRecorder()
+	srv.setupRoutes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("missing run status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
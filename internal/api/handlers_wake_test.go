@@ -10,8 +10,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/mattjoyce/agenticloop/internal/storage"
 	"github.com/mattjoyce/agenticloop/internal/store"
@@ -20,29 +22,42 @@ import (
 type testCreator struct {
 	runStore   *store.RunStore
 	enqueueErr error
+	// capacity makes Enqueue fail once this many runs are queued (0 = unlimited).
+	capacity int
 
 	mu       sync.Mutex
 	enqueued []string
 }
 
-func (t *testCreator) Create(ctx context.Context, goal string, wakeID *string, runCtx json.RawMessage, constraints json.RawMessage) (*store.Run, bool, error) {
-	return t.runStore.Create(ctx, goal, wakeID, runCtx, constraints)
+func (t *testCreator) Create(ctx context.Context, goal string, wakeID *string, runCtx json.RawMessage, constraints json.RawMessage, labels map[string]string, priority int) (*store.Run, bool, error) {
+	return t.runStore.Create(ctx, goal, wakeID, runCtx, constraints, labels, priority)
+}
+
+func (t *testCreator) CreateDeduped(ctx context.Context, dedupKey string, window time.Duration, goal string, runCtx json.RawMessage, constraints json.RawMessage, labels map[string]string, priority int) (*store.Run, bool, error) {
+	return t.runStore.CreateDeduped(ctx, dedupKey, window, goal, runCtx, constraints, labels, priority)
 }
 
 func (t *testCreator) GetByID(ctx context.Context, id string) (*store.Run, error) {
 	return t.runStore.GetByID(ctx, id)
 }
 
-func (t *testCreator) Enqueue(runID string) error {
+func (t *testCreator) Enqueue(runID string, priority int) error {
 	if t.enqueueErr != nil {
 		return t.enqueueErr
 	}
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	if t.capacity > 0 && len(t.enqueued) >= t.capacity {
+		return errors.New("queue full")
+	}
 	t.enqueued = append(t.enqueued, runID)
 	return nil
 }
 
+func (t *testCreator) QueueDepth() int {
+	return t.enqueueCount()
+}
+
 func (t *testCreator) enqueueCount() int {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -107,6 +122,53 @@ func TestHandleWakeIdempotentWakeID(t *testing.T) {
 	}
 }
 
+func TestHandleWakeDedupsIdenticalGoalsWithoutWakeID(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "agenticloop.db")
+	db, err := storage.OpenSQLite(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	creator := &testCreator{runStore: runStore}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := New(Config{Token: "test-token", DedupIdenticalGoals: true, DedupWindow: time.Minute}, runStore, creator, logger)
+	router := srv.setupRoutes()
+
+	doWake := func(body string) (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/wake", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-token")
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var resp map[string]any
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode wake response: %v", err)
+		}
+		return rr.Code, resp
+	}
+
+	firstCode, first := doWake(`{"goal":"do thing","context":{"a":1,"b":2}}`)
+	if firstCode != http.StatusAccepted || first["existing"] != false {
+		t.Fatalf("first wake = %d %v, want 202 existing=false", firstCode, first)
+	}
+
+	// Same goal, context keys reordered: still a duplicate.
+	secondCode, second := doWake(`{"goal":"do thing","context":{ "b":2, "a":1 }}`)
+	if secondCode != http.StatusOK || second["existing"] != true || second["run_id"] != first["run_id"] {
+		t.Fatalf("second wake = %d %v, want 200 existing=true run %v", secondCode, second, first["run_id"])
+	}
+
+	// Different context creates a new run.
+	thirdCode, third := doWake(`{"goal":"do thing","context":{"a":1}}`)
+	if thirdCode != http.StatusAccepted || third["run_id"] == first["run_id"] {
+		t.Fatalf("third wake = %d %v, want a new run", thirdCode, third)
+	}
+}
+
 func TestHandleWakeQueueBackpressureReturns503(t *testing.T) {
 	ctx := context.Background()
 	dbPath := filepath.Join(t.TempDir(), "agenticloop.db")
@@ -144,3 +206,286 @@ func TestHandleWakeQueueBackpressureReturns503(t *testing.T) {
 		t.Fatalf("expected non-empty error message")
 	}
 }
+
+func TestHandleWakeBatchReportsPerItemResults(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	creator := &testCreator{runStore: runStore, capacity: 3}
+	srv := New(Config{Token: "test-token"}, runStore, creator, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/wake/batch", bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer test-token")
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := post(`[
+		{"wake_id":"batch-a","goal":"first"},
+		{"wake_id":"batch-a","goal":"first again"},
+		{"goal":""},
+		{"goal":"second"},
+		{"goal":"third"}
+	]`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("batch status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var resp WakeBatchResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Results) != 5 {
+		t.Fatalf("results = %d, want 5", len(resp.Results))
+	}
+
+	wantCodes := []int{http.StatusAccepted, http.StatusOK, http.StatusBadRequest, http.StatusAccepted, http.StatusServiceUnavailable}
+	for i, want := range wantCodes {
+		if got := resp.Results[i]; got.Index != i || got.StatusCode != want {
+			t.Fatalf("result %d = %+v, want status_code %d", i, got, want)
+		}
+	}
+	if resp.Results[0].RunID == "" || resp.Results[1].RunID != resp.Results[0].RunID || !resp.Results[1].Existing {
+		t.Fatalf("expected wake_id idempotency per item, got %+v and %+v", resp.Results[0], resp.Results[1])
+	}
+	if resp.Results[2].Error != "goal is required" {
+		t.Fatalf("expected validation error, got %+v", resp.Results[2])
+	}
+	if resp.Results[4].RunID == "" || resp.Results[4].Error == "" {
+		t.Fatalf("expected backpressure result to carry the created run and an error, got %+v", resp.Results[4])
+	}
+
+	if rr := post(`{"goal":"not an array"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("object body status = %d, want 400", rr.Code)
+	}
+	if rr := post(`[]`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("empty batch status = %d, want 400", rr.Code)
+	}
+}
+
+func TestHandleWakeRejectsOversizedContext(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	creator := &testCreator{runStore: runStore}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := New(Config{Token: "test-token", MaxContextBytes: 32}, runStore, creator, logger)
+
+	body := []byte(`{"goal":"do thing","context":{"notes":"` + strings.Repeat("x", 64) + `"}}`)
+	req := httptest.NewRequest(http.MethodPost, "/v1/wake", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer test-token")
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	srv.setupRoutes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("wake status = %d, want %d", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+	runs, err := runStore.ListByStatus(ctx, store.RunStatusQueued)
+	if err != nil {
+		t.Fatalf("list runs: %v", err)
+	}
+	if len(runs) != 0 {
+		t.Fatalf("expected no run to be created, got %d", len(runs))
+	}
+}
+
+func TestPostHandlersRejectOversizedBodies(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	creator := &testCreator{runStore: runStore}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := New(Config{Token: "test-token", MaxRequestBytes: 64}, runStore, creator, logger)
+
+	body := `{"goal":"do thing","notes":"` + strings.Repeat("x", 128) + `"}`
+	for _, path := range []string{"/v1/wake", "/v1/wake/batch", "/v1/runs/run-1/message", "/v1/runs/run-1/approve"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s status = %d, want %d (body %s)", path, rr.Code, http.StatusRequestEntityTooLarge, rr.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/wake", strings.NewReader(`{"goal":"small"}`))
+	req.Header.Set("Authorization", "Bearer test-token")
+	rr := httptest.NewRecorder()
+	srv.setupRoutes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("small wake status = %d, body %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleWakeMergesDefaults(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	creator := &testCreator{runStore: runStore}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := New(Config{
+		Token:              "test-token",
+		DefaultContext:     map[string]any{"preamble": "org policy", "owner": map[string]any{"team": "ops", "pager": "ops-oncall"}},
+		DefaultConstraints: map[string]any{"max_loops": 5, "denied_tools": []any{"ductile_shell_exec"}},
+	}, runStore, creator, logger)
+
+	wake := func(body string) (*httptest.ResponseRecorder, WakeResponse) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/v1/wake", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		var resp WakeResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr, resp
+	}
+
+	rr, resp := wake(`{"goal":"rotate logs","context":{"owner":{"team":"infra"},"host":"web-1"},"constraints":{"max_loops":2,"denied_tools":[]}}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("wake status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	run, err := runStore.GetByID(ctx, resp.RunID)
+	if err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got, want := string(run.Context), `{"host":"web-1","owner":{"pager":"ops-oncall","team":"infra"},"preamble":"org policy"}`; got != want {
+		t.Fatalf("context = %s, want %s", got, want)
+	}
+	if got, want := string(run.Constraints), `{"denied_tools":[],"max_loops":2}`; got != want {
+		t.Fatalf("constraints = %s, want %s", got, want)
+	}
+
+	rr, resp = wake(`{"goal":"no overrides"}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("bare wake status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	if run, err = runStore.GetByID(ctx, resp.RunID); err != nil {
+		t.Fatalf("get run: %v", err)
+	}
+	if got, want := string(run.Constraints), `{"denied_tools":["ductile_shell_exec"],"max_loops":5}`; got != want {
+		t.Fatalf("default constraints = %s, want %s", got, want)
+	}
+
+	if rr, _ := wake(`{"goal":"bad context","context":["not","an","object"]}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("array context status = %d, want 400", rr.Code)
+	}
+}
+
+func TestHandleWakeRejectsMalformedConstraints(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	srv := New(Config{Token: "test-token"}, runStore, &testCreator{runStore: runStore}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// A string allowed_tools would otherwise be dropped with the rest of the
+	// tool policy, leaving the run free to call every tool.
+	req := httptest.NewRequest(http.MethodPost, "/v1/wake", strings.NewReader(`{"goal":"do thing","constraints":{"allowed_tools":"workspace_read"}}`))
+	req.Header.Set("Authorization", "Bearer test-token")
+	rr := httptest.NewRecorder()
+	srv.setupRoutes().ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid constraints") {
+		t.Fatalf("wake status = %d, body %s; want 400 invalid constraints", rr.Code, rr.Body.String())
+	}
+}
+
+func TestValidateDefaultsRejectsBadDefaultConstraints(t *testing.T) {
+	newServer := func(defaults map[string]any) *Server {
+		return New(Config{
+			Token:              "test-token",
+			AllowedConstraints: []string{"deadline"},
+			DefaultConstraints: defaults,
+			Models:             []string{"base-model"},
+		}, nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}
+
+	if err := newServer(nil).ValidateDefaults(); err != nil {
+		t.Fatalf("no defaults: %v", err)
+	}
+	// allowed_constraints limits callers, not operator defaults.
+	if err := newServer(map[string]any{"max_loops": 8, "model": "base-model"}).ValidateDefaults(); err != nil {
+		t.Fatalf("valid defaults: %v", err)
+	}
+	if err := newServer(map[string]any{"max_loops": "8"}).ValidateDefaults(); err == nil || !strings.Contains(err.Error(), "api.default_constraints") {
+		t.Fatalf("string max_loops error = %v", err)
+	}
+	if err := newServer(map[string]any{"model": "other-model"}).ValidateDefaults(); err == nil || !strings.Contains(err.Error(), "other-model") {
+		t.Fatalf("unknown model error = %v", err)
+	}
+}
+
+func TestHandleWakeRejectsDisallowedConstraints(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	creator := &testCreator{runStore: runStore}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := New(Config{Token: "test-token", AllowedConstraints: []string{"max_loops", "deadline"}}, runStore, creator, logger)
+
+	wake := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/wake", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-token")
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := wake(`{"goal":"do thing","constraints":{"max_loops":2,"workspace_path":"/etc","allowed_tools":["run_command"]}}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("wake status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+	if !strings.Contains(rr.Body.String(), "allowed_tools, workspace_path") {
+		t.Fatalf("error should name the rejected keys, got %s", rr.Body.String())
+	}
+	if rr := wake(`{"goal":"do thing","constraints":["max_loops"]}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("non-object constraints status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+	runs, err := runStore.ListByStatus(ctx, store.RunStatusQueued)
+	if err != nil {
+		t.Fatalf("list runs: %v", err)
+	}
+	if len(runs) != 0 {
+		t.Fatalf("expected no run to be created, got %d", len(runs))
+	}
+
+	if rr := wake(`{"goal":"do thing","constraints":{"max_loops":2}}`); rr.Code != http.StatusAccepted {
+		t.Fatalf("allowed constraints status = %d, want %d: %s", rr.Code, http.StatusAccepted, rr.Body.String())
+	}
+	if rr := wake(`{"goal":"other thing"}`); rr.Code != http.StatusAccepted {
+		t.Fatalf("no constraints status = %d, want %d", rr.Code, http.StatusAccepted)
+	}
+}
@@ -9,8 +9,10 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 
+	"github.com/mattjoyce/agenticloop/internal/localtools"
 	"github.com/mattjoyce/agenticloop/internal/storage"
 	"github.com/mattjoyce/agenticloop/internal/store"
 )
@@ -25,7 +27,7 @@ func TestHandleRunWorkspaceListsFilesAndTotalSize(t *testing.T) {
 	t.Cleanup(func() { _ = db.Close() })
 
 	runStore := store.NewRunStore(db)
-	run, _, err := runStore.Create(ctx, "inspect workspace", nil, nil, nil)
+	run, _, err := runStore.Create(ctx, "inspect workspace", nil, nil, nil, nil, 0)
 	if err != nil {
 		t.Fatalf("create run: %v", err)
 	}
@@ -80,6 +82,53 @@ func TestHandleRunWorkspaceListsFilesAndTotalSize(t *testing.T) {
 	if resp.Files[1].Path != "sub/b.md" || resp.Files[1].SizeBytes != 5 {
 		t.Fatalf("unexpected second file: %+v", resp.Files[1])
 	}
+	if resp.HasEvidence {
+		t.Fatalf("expected has_evidence=false without an evidence file")
+	}
+}
+
+func TestHandleRunWorkspaceReportsEvidence(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "agenticloop.db")
+	db, err := storage.OpenSQLite(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "inspect workspace", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	workspaceBase := t.TempDir()
+	runDir := filepath.Join(workspaceBase, run.ID)
+	if err := os.MkdirAll(runDir, 0o755); err != nil {
+		t.Fatalf("mkdir run workspace: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(runDir, "evidence.md"), []byte("## Iteration 1"), 0o644); err != nil {
+		t.Fatalf("write evidence.md: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := New(Config{
+		Token:        "test-token",
+		WorkspaceDir: workspaceBase,
+	}, runStore, &testCreator{runStore: runStore}, logger)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/runs/"+run.ID+"/workspace", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	rr := httptest.NewRecorder()
+	srv.setupRoutes().ServeHTTP(rr, req)
+
+	var resp WorkspaceResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !resp.HasEvidence {
+		t.Fatalf("expected has_evidence=true, got %+v", resp)
+	}
 }
 
 func TestHandleRunWorkspaceReturnsEmptyForMissingRunDir(t *testing.T) {
@@ -92,7 +141,7 @@ func TestHandleRunWorkspaceReturnsEmptyForMissingRunDir(t *testing.T) {
 	t.Cleanup(func() { _ = db.Close() })
 
 	runStore := store.NewRunStore(db)
-	run, _, err := runStore.Create(ctx, "inspect workspace", nil, nil, nil)
+	run, _, err := runStore.Create(ctx, "inspect workspace", nil, nil, nil, nil, 0)
 	if err != nil {
 		t.Fatalf("create run: %v", err)
 	}
@@ -120,3 +169,95 @@ func TestHandleRunWorkspaceReturnsEmptyForMissingRunDir(t *testing.T) {
 		t.Fatalf("expected empty workspace response, got %+v", resp)
 	}
 }
+
+func TestHandleRunWorkspaceDiffBetweenIterations(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "edit files", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	workspaceBase := t.TempDir()
+	runDir := filepath.Join(workspaceBase, run.ID)
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(runDir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	snapshot := func(iter int) {
+		m, err := localtools.BuildWorkspaceManifest(runDir, iter, func(rel string) bool { return rel == "state.json" })
+		if err != nil {
+			t.Fatalf("build manifest: %v", err)
+		}
+		if err := localtools.WriteWorkspaceManifest(localtools.RunStateDir(workspaceBase, run.ID), m); err != nil {
+			t.Fatalf("write manifest: %v", err)
+		}
+	}
+	if err := os.MkdirAll(runDir, 0o755); err != nil {
+		t.Fatalf("mkdir run workspace: %v", err)
+	}
+	write("keep.txt", "same")
+	write("edit.go", "package v1")
+	write("gone.md", "temporary")
+	write("state.json", "{}")
+	snapshot(1)
+	write("edit.go", "package v2")
+	write("new.txt", "fresh")
+	write("state.json", `{"changed":true}`)
+	if err := os.Remove(filepath.Join(runDir, "gone.md")); err != nil {
+		t.Fatalf("remove gone.md: %v", err)
+	}
+	snapshot(2)
+
+	srv := New(Config{
+		Token:        "test-token",
+		WorkspaceDir: workspaceBase,
+	}, runStore, &testCreator{runStore: runStore}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/runs/"+run.ID+"/workspace/diff"+query, nil)
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		srv.setupRoutes().ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("?from=1")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("diff status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var resp WorkspaceDiffResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := []localtools.WorkspaceChange{
+		{Path: "edit.go", Change: "modified"},
+		{Path: "gone.md", Change: "deleted"},
+		{Path: "new.txt", Change: "created"},
+	}
+	if resp.From != 1 || resp.To != 2 || !reflect.DeepEqual(resp.Changes, want) {
+		t.Fatalf("unexpected diff: %+v", resp)
+	}
+
+	rr = get("?to=1")
+	resp = WorkspaceDiffResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Changes) != 3 || resp.Changes[0].Change != "created" {
+		t.Fatalf("expected every file created since iteration 0, got %+v", resp.Changes)
+	}
+
+	if rr := get("?from=1&to=5"); rr.Code != http.StatusNotFound {
+		t.Fatalf("missing snapshot status = %d, want 404", rr.Code)
+	}
+	if rr := get("?from=2&to=1"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("reversed range status = %d, want 400", rr.Code)
+	}
+}
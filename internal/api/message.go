@@ -0,0 +1,73 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// maxRunMessageChars bounds one steering message.
+const maxRunMessageChars = 4000
+
+// RunMessageRequest is the body of POST /v1/runs/{run_id}/message.
+type RunMessageRequest struct {
+	Message string `json:"message"`
+}
+
+// RunMessageResponse reports how many messages wait in the run's inbox.
+type RunMessageResponse struct {
+	RunID   string `json:"run_id"`
+	Pending int    `json:"pending"`
+}
+
+// handleRunMessage handles POST /v1/runs/{run_id}/message. The message is
+// queued in the run's inbox and shown to the agent as {{.UserGuidance}} from
+// the start of its next iteration.
+func (s *Server) handleRunMessage(w http.ResponseWriter, r *http.Request) {
+	runID := chi.URLParam(r, "run_id")
+
+	var req RunMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Message == "" {
+		s.writeError(w, http.StatusBadRequest, "message is required")
+		return
+	}
+	if len(req.Message) > maxRunMessageChars {
+		s.writeError(w, http.StatusRequestEntityTooLarge, "message exceeds 4000 characters")
+		return
+	}
+
+	run, err := s.runs.GetByID(r.Context(), runID)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	if run.Status != store.RunStatusQueued && run.Status != store.RunStatusRunning && run.Status != store.RunStatusAwaitingApproval {
+		s.writeError(w, http.StatusConflict, "run is "+string(run.Status)+"; messages are only accepted for queued, running, or awaiting_approval runs")
+		return
+	}
+
+	pending, err := s.runs.AppendMessage(r.Context(), runID, req.Message)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.writeError(w, http.StatusConflict, "run finished before the message was queued")
+			return
+		}
+		s.logger.Error("failed to queue run message", "run_id", runID, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "failed to queue message")
+		return
+	}
+
+	s.logger.Info("run message queued", "run_id", runID, "pending", pending)
+	respondJSON(w, http.StatusAccepted, RunMessageResponse{RunID: runID, Pending: pending})
+}
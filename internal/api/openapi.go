@@ -0,0 +1,19 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI 3 description of this API. openapi_test.go keeps
+// its schemas in sync with the request and response structs.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// handleOpenAPI handles GET /v1/openapi.json.
+func (s *Server) handleOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(openAPISpec)
+}
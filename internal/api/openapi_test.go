@@ -0,0 +1,326 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mattjoyce/agenticloop/internal/agent"
+	"github.com/mattjoyce/agenticloop/internal/localtools"
+	"github.com/mattjoyce/agenticloop/internal/storage"
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+type openAPIDoc struct {
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]map[string]any `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema map[string]any `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+func loadOpenAPIDoc(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("decode openapi.json: %v", err)
+	}
+	return doc
+}
+
+// TestOpenAPISchemasMatchStructs keeps each component schema's properties and
+// required list in step with the JSON fields of the struct it describes.
+func TestOpenAPISchemasMatchStructs(t *testing.T) {
+	doc := loadOpenAPIDoc(t)
+	types := map[string]any{
+		"WakeRequest":           WakeRequest{},
+		"WakeResponse":          WakeResponse{},
+		"WakeBatchResult":       WakeBatchResult{},
+		"WakeBatchResponse":     WakeBatchResponse{},
+		"RunResponse":           RunResponse{},
+		"TokenUsage":            store.TokenUsage{},
+		"RunComparison":         RunComparison{},
+		"CompareResponse":       CompareResponse{},
+		"TimelineEntry":         TimelineEntry{},
+		"RunTimelineResponse":   RunTimelineResponse{},
+		"Step":                  store.Step{},
+		"PhaseDuration":         store.PhaseDuration{},
+		"WorkspaceFileResponse": WorkspaceFileResponse{},
+		"WorkspaceResponse":     WorkspaceResponse{},
+		"ReplayRequest":         ReplayRequest{},
+		"ReplayResponse":        ReplayResponse{},
+		"ContinueRequest":       ContinueRequest{},
+		"ContinueResponse":      ContinueResponse{},
+		"RunMessageRequest":     RunMessageRequest{},
+		"RunMessageResponse":    RunMessageResponse{},
+		"ExtendRequest":         ExtendRequest{},
+		"ExtendResponse":        ExtendResponse{},
+		"HealthzResponse":       HealthzResponse{},
+		"ReadyzResponse":        ReadyzResponse{},
+		"ErrorResponse":         ErrorResponse{},
+
+		"Approval":                 store.Approval{},
+		"ApprovalDecisionRequest":  ApprovalDecisionRequest{},
+		"ApprovalDecisionResponse": ApprovalDecisionResponse{},
+
+		"StatsResponse":         StatsResponse{},
+		"WorkspaceChange":       localtools.WorkspaceChange{},
+		"WorkspaceDiffResponse": WorkspaceDiffResponse{},
+		"RunExportResponse":     RunExportResponse{},
+		"DecisionEntry":         agent.DecisionEntry{},
+		"ExportWorkspace":       ExportWorkspace{},
+		"ExportWorkspaceFile":   ExportWorkspaceFile{},
+	}
+	for name, v := range types {
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("openapi.json has no schema %s", name)
+			continue
+		}
+		fields, required := jsonFields(reflect.TypeOf(v))
+		props, _ := schema["properties"].(map[string]any)
+		if got := sortedKeys(props); !reflect.DeepEqual(got, fields) {
+			t.Errorf("%s properties = %v, struct fields = %v", name, got, fields)
+		}
+		var declared []string
+		for _, r := range asSlice(schema["required"]) {
+			declared = append(declared, r.(string))
+		}
+		sort.Strings(declared)
+		if !reflect.DeepEqual(declared, required) {
+			t.Errorf("%s required = %v, non-omitempty fields = %v", name, declared, required)
+		}
+	}
+}
+
+// TestOpenAPIDescribesHandlerResponses round-trips real handler output and a
+// sample wake request through the declared schemas.
+func TestOpenAPIDescribesHandlerResponses(t *testing.T) {
+	doc := loadOpenAPIDoc(t)
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := store.NewRunStore(db)
+	workspaceDir := t.TempDir()
+	srv := New(Config{Token: "test-token", WorkspaceDir: workspaceDir}, runStore, &testCreator{runStore: runStore}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	router := srv.setupRoutes()
+
+	do := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer test-token")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	wakeBody := []byte(`{"wake_id":"w-1","goal":"document the api","context":{"repo":"x"},"constraints":{"max_loops":2},"labels":{"team":"docs"},"priority":1}`)
+	checkSchema(t, doc, map[string]any{"$ref": "#/components/schemas/WakeRequest"}, wakeBody, "WakeRequest")
+
+	wake := do(http.MethodPost, "/v1/wake", wakeBody)
+	checkResponse(t, doc, "/v1/wake", "post", wake)
+	var woke WakeResponse
+	_ = json.Unmarshal(wake.Body.Bytes(), &woke)
+
+	stepStore := store.NewStepStore(db)
+	step, err := stepStore.Append(ctx, woke.RunID, 1, store.StepPhaseFrame, nil, nil)
+	if err != nil {
+		t.Fatalf("append step: %v", err)
+	}
+	if err := stepStore.UpdateStatusWithAttempt(ctx, step.ID, store.StepStatusOK, json.RawMessage(`{"content":"ok"}`), nil, 1); err != nil {
+		t.Fatalf("complete step: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(workspaceDir, woke.RunID), 0o755); err != nil {
+		t.Fatalf("mkdir workspace: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(workspaceDir, woke.RunID, "notes.md"), []byte("# notes\n"), 0o644); err != nil {
+		t.Fatalf("write workspace file: %v", err)
+	}
+	stateDir := localtools.RunStateDir(workspaceDir, woke.RunID)
+	for iter := 0; iter <= 1; iter++ {
+		m, err := localtools.BuildWorkspaceManifest(filepath.Join(workspaceDir, woke.RunID), iter, nil)
+		if err != nil {
+			t.Fatalf("build manifest: %v", err)
+		}
+		if iter == 0 {
+			m.Files = nil
+		}
+		if err := localtools.WriteWorkspaceManifest(stateDir, m); err != nil {
+			t.Fatalf("write manifest: %v", err)
+		}
+	}
+
+	checkResponse(t, doc, "/v1/wake/batch", "post", do(http.MethodPost, "/v1/wake/batch", []byte(`[{"goal":"a"},{"goal":""}]`)))
+	checkResponse(t, doc, "/v1/runs", "get", do(http.MethodGet, "/v1/runs?status=queued", nil))
+	checkResponse(t, doc, "/v1/runs/{run_id}", "get", do(http.MethodGet, "/v1/runs/"+woke.RunID, nil))
+	checkResponse(t, doc, "/v1/runs/{run_id}", "get", do(http.MethodGet, "/v1/runs/missing", nil))
+	second, _, err := runStore.Create(ctx, "document the api", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	checkResponse(t, doc, "/v1/runs/compare", "get", do(http.MethodGet, "/v1/runs/compare?ids="+woke.RunID+","+second.ID, nil))
+	checkResponse(t, doc, "/v1/runs/compare", "get", do(http.MethodGet, "/v1/runs/compare?ids="+woke.RunID+",missing", nil))
+	checkResponse(t, doc, "/v1/runs/{run_id}/timeline", "get", do(http.MethodGet, "/v1/runs/"+woke.RunID+"/timeline", nil))
+	checkResponse(t, doc, "/v1/runs/{run_id}/timeline", "get", do(http.MethodGet, "/v1/runs/missing/timeline", nil))
+	checkResponse(t, doc, "/v1/runs/{run_id}/workspace", "get", do(http.MethodGet, "/v1/runs/"+woke.RunID+"/workspace", nil))
+	checkResponse(t, doc, "/v1/runs/{run_id}/workspace/diff", "get", do(http.MethodGet, "/v1/runs/"+woke.RunID+"/workspace/diff", nil))
+	checkResponse(t, doc, "/v1/runs/{run_id}/workspace/diff", "get", do(http.MethodGet, "/v1/runs/"+woke.RunID+"/workspace/diff?to=5", nil))
+	checkResponse(t, doc, "/v1/runs/{run_id}/export", "get", do(http.MethodGet, "/v1/runs/"+woke.RunID+"/export?include_file_contents=true", nil))
+	checkResponse(t, doc, "/v1/runs/{run_id}/export", "get", do(http.MethodGet, "/v1/runs/"+woke.RunID+"/export?max_inline_bytes=0", nil))
+	checkResponse(t, doc, "/v1/stats", "get", do(http.MethodGet, "/v1/stats", nil))
+	checkResponse(t, doc, "/v1/runs/{run_id}/message", "post", do(http.MethodPost, "/v1/runs/"+woke.RunID+"/message", []byte(`{"message":"focus on docs"}`)))
+	checkResponse(t, doc, "/v1/runs/{run_id}/extend", "post", do(http.MethodPost, "/v1/runs/"+woke.RunID+"/extend", []byte(`{"additional_seconds":60}`)))
+	checkResponse(t, doc, "/v1/runs/{run_id}/approve", "post", do(http.MethodPost, "/v1/runs/"+woke.RunID+"/approve", nil))
+	checkResponse(t, doc, "/v1/runs/{run_id}/reject", "post", do(http.MethodPost, "/v1/runs/missing/reject", []byte(`{"note":"no"}`)))
+	checkResponse(t, doc, "/v1/runs/{run_id}/continue", "post", do(http.MethodPost, "/v1/runs/"+woke.RunID+"/continue", []byte(`{"goal":"follow up"}`)))
+	checkResponse(t, doc, "/healthz", "get", do(http.MethodGet, "/healthz", nil))
+
+	spec := do(http.MethodGet, "/v1/openapi.json", nil)
+	if spec.Code != http.StatusOK || !json.Valid(spec.Body.Bytes()) {
+		t.Fatalf("GET /v1/openapi.json = %d, valid JSON %v", spec.Code, json.Valid(spec.Body.Bytes()))
+	}
+}
+
+func checkResponse(t *testing.T, doc openAPIDoc, path, method string, rr *httptest.ResponseRecorder) {
+	t.Helper()
+	op, ok := doc.Paths[path][method]
+	if !ok {
+		t.Fatalf("openapi.json does not describe %s %s", strings.ToUpper(method), path)
+	}
+	resp, ok := op.Responses[fmt.Sprint(rr.Code)]
+	if !ok {
+		t.Fatalf("openapi.json does not declare status %d for %s %s", rr.Code, strings.ToUpper(method), path)
+	}
+	checkSchema(t, doc, resp.Content["application/json"].Schema, rr.Body.Bytes(), strings.ToUpper(method)+" "+path)
+}
+
+func checkSchema(t *testing.T, doc openAPIDoc, schema map[string]any, body []byte, label string) {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatalf("%s: decode body: %v", label, err)
+	}
+	for _, problem := range validateSchema(doc, schema, v, "$") {
+		t.Errorf("%s: %s", label, problem)
+	}
+}
+
+// validateSchema checks v against the subset of OpenAPI schema keywords the
+// spec uses: $ref, type, properties, required, items, additionalProperties, enum.
+func validateSchema(doc openAPIDoc, schema map[string]any, v any, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		return validateSchema(doc, doc.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")], v, at)
+	}
+	var problems []string
+	if enum := asSlice(schema["enum"]); enum != nil {
+		found := false
+		for _, e := range enum {
+			found = found || e == v
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s: %v not in enum %v", at, v, enum))
+		}
+	}
+	switch schema["type"] {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: want object, got %T", at, v))
+		}
+		props, _ := schema["properties"].(map[string]any)
+		for _, r := range asSlice(schema["required"]) {
+			if _, ok := obj[r.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required %q", at, r))
+			}
+		}
+		extra, _ := schema["additionalProperties"].(map[string]any)
+		for k, fv := range obj {
+			if p, ok := props[k].(map[string]any); ok {
+				problems = append(problems, validateSchema(doc, p, fv, at+"."+k)...)
+			} else if extra != nil {
+				problems = append(problems, validateSchema(doc, extra, fv, at+"."+k)...)
+			} else if props != nil {
+				problems = append(problems, fmt.Sprintf("%s: undeclared property %q", at, k))
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: want array, got %T", at, v))
+		}
+		items, _ := schema["items"].(map[string]any)
+		for i, item := range arr {
+			problems = append(problems, validateSchema(doc, items, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			problems = append(problems, fmt.Sprintf("%s: want string, got %T", at, v))
+		}
+	case "integer":
+		if n, ok := v.(float64); !ok || n != float64(int64(n)) {
+			problems = append(problems, fmt.Sprintf("%s: want integer, got %v", at, v))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: want boolean, got %T", at, v))
+		}
+	}
+	return problems
+}
+
+// jsonFields returns the sorted JSON names of t's fields and the subset
+// without omitempty.
+func jsonFields(t reflect.Type) (fields, required []string) {
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("json")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" || !t.Field(i).IsExported() {
+			continue
+		}
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		fields = append(fields, name)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(fields)
+	sort.Strings(required)
+	return fields, required
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
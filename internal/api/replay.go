@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mattjoyce/agenticloop/internal/localtools"
+)
+
+// ReplayRequest is the optional body of POST /v1/runs/{run_id}/replay.
+// Constraints, when set, replace the original run's constraints. Model sets
+// the model constraint, serving every stage with llm.model or one of
+// llm.allowed_models.
+type ReplayRequest struct {
+	Constraints json.RawMessage `json:"constraints,omitempty"`
+	Model       string          `json:"model,omitempty"`
+}
+
+// ReplayResponse is returned when a replay run is created.
+type ReplayResponse struct {
+	RunID         string `json:"run_id"`
+	Status        string `json:"status"`
+	ReplayOf      string `json:"replay_of"`
+	FromIteration int    `json:"from_iteration"`
+}
+
+// handleRunReplay handles POST /v1/runs/{run_id}/replay?from_iteration=N. It
+// creates a new run with the original goal and context, seeded with the
+// state.json, run memory, and checkpoint the original run had when iteration
+// N started, so the replay resumes at iteration N with the same loop budget.
+func (s *Server) handleRunReplay(w http.ResponseWriter, r *http.Request) {
+	runID := chi.URLParam(r, "run_id")
+	from, err := strconv.Atoi(r.URL.Query().Get("from_iteration"))
+	if err != nil || from < 1 {
+		s.writeError(w, http.StatusBadRequest, "from_iteration must be a positive integer")
+		return
+	}
+
+	var req ReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.writeDecodeError(w, err, "invalid JSON body")
+		return
+	}
+	if msg := s.checkConstraints(req.Constraints); msg != "" {
+		s.writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	src, err := s.runs.GetByID(r.Context(), runID)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	srcStateDir, status, msg := s.runStateDir(runID)
+	if status != 0 {
+		s.writeError(w, status, msg)
+		return
+	}
+	// Iteration N starts from the state snapshotted at the end of N-1.
+	seedIter := from - 1
+	if seedIter > 0 {
+		if _, err := os.Stat(localtools.ReplaySnapshotDir(srcStateDir, seedIter)); err != nil {
+			s.writeError(w, http.StatusNotFound, "no replay snapshot for iteration "+strconv.Itoa(from))
+			return
+		}
+	}
+
+	constraints := src.Constraints
+	if len(req.Constraints) > 0 {
+		constraints = req.Constraints
+	}
+	if model := strings.TrimSpace(req.Model); model != "" {
+		if constraints, err = setConstraint(constraints, "model", model); err != nil {
+			s.writeError(w, http.StatusBadRequest, "constraints must be a JSON object")
+			return
+		}
+		if msg := s.checkConstraints(constraints); msg != "" {
+			s.writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+	labels := make(map[string]string, len(src.Labels)+2)
+	for k, v := range src.Labels {
+		labels[k] = v
+	}
+	labels["replay_of"] = src.ID
+	labels["replay_from_iteration"] = strconv.Itoa(from)
+
+	run, _, err := s.creator.Create(r.Context(), src.Goal, nil, src.Context, constraints, labels, src.Priority)
+	if err != nil {
+		s.logger.Error("failed to create replay run", "run_id", runID, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "failed to create run")
+		return
+	}
+	// A replay in an external workspace keeps its loop files in its state
+	// dir, so the seed goes there rather than into the caller's directory.
+	loopDir, status, msg := s.runLoopDir(run)
+	if status != 0 {
+		_ = s.runs.Fail(r.Context(), run.ID, "replay_seed_failed", msg)
+		s.writeError(w, status, msg)
+		return
+	}
+	if err := localtools.SeedReplay(srcStateDir, seedIter, loopDir); err != nil {
+		s.logger.Error("failed to seed replay workspace", "run_id", run.ID, "replay_of", runID, "error", err)
+		_ = s.runs.Fail(r.Context(), run.ID, "replay_seed_failed", err.Error())
+		s.writeError(w, http.StatusInternalServerError, "failed to seed replay workspace")
+		return
+	}
+	if err := s.creator.Enqueue(run.ID, run.Priority); err != nil {
+		s.logger.Warn("failed to enqueue replay run", "run_id", run.ID, "error", err)
+		s.writeError(w, http.StatusServiceUnavailable, "runner queue is full; retry later")
+		return
+	}
+
+	s.logger.Info("replay run created", "run_id", run.ID, "replay_of", runID, "from_iteration", from)
+	respondJSON(w, http.StatusAccepted, ReplayResponse{
+		RunID:         run.ID,
+		Status:        string(run.Status),
+		ReplayOf:      src.ID,
+		FromIteration: from,
+	})
+}
+
+// setConstraint returns the constraints object raw with key set to value.
+func setConstraint(raw json.RawMessage, key string, value any) (json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, err
+		}
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	fields[key] = encoded
+	return json.Marshal(fields)
+}
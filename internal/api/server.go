@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -15,18 +16,71 @@ import (
 
 // RunCreator creates and enqueues runs.
 type RunCreator interface {
-	Create(ctx context.Context, goal string, wakeID *string, runCtx json.RawMessage, constraints json.RawMessage) (*store.Run, bool, error)
+	Create(ctx context.Context, goal string, wakeID *string, runCtx json.RawMessage, constraints json.RawMessage, labels map[string]string, priority int) (*store.Run, bool, error)
+	CreateDeduped(ctx context.Context, dedupKey string, window time.Duration, goal string, runCtx json.RawMessage, constraints json.RawMessage, labels map[string]string, priority int) (*store.Run, bool, error)
 	GetByID(ctx context.Context, id string) (*store.Run, error)
-	Enqueue(runID string) error
+	Enqueue(runID string, priority int) error
+	QueueDepth() int
 }
 
+// defaultMaxRequestBytes caps POST bodies when Config.MaxRequestBytes is 0.
+const defaultMaxRequestBytes = 1 << 20
+
 // Config holds API server configuration.
 type Config struct {
-	Listen                  string
-	Token                   string
-	WorkspaceDir            string
+	Listen string
+	// Token is the legacy single bearer token and grants every scope.
+	Token string
+	// Tokens adds bearer tokens with explicit scopes.
+	Tokens       []Token
+	WorkspaceDir string
+	// StreamPollInterval and StreamHeartbeatInterval pace event streams
+	// (0 = 700ms and 15s).
 	StreamPollInterval      time.Duration
 	StreamHeartbeatInterval time.Duration
+	// SnapshotMaxSteps limits the steps sent in the initial SSE snapshot (0 = all).
+	SnapshotMaxSteps int
+	// MaxContextBytes caps the context and constraints JSON of wake and
+	// continue requests; larger payloads are rejected with 413. The config
+	// loader requires it to be positive.
+	MaxContextBytes int
+	// MaxRequestBytes caps every POST body (0 = 1 MiB).
+	MaxRequestBytes int
+	// MaxConcurrentStreams caps open event streams (0 = unlimited).
+	MaxConcurrentStreams int
+	// MaxStreamDuration caps how long one event stream stays open (0 = unlimited).
+	MaxStreamDuration time.Duration
+	// ReadHeaderTimeout and IdleTimeout bound client connections (0 = 10s and 60s).
+	ReadHeaderTimeout time.Duration
+	IdleTimeout       time.Duration
+	H2C               bool
+	// HTTP2MaxStreams caps concurrent requests on one h2c connection
+	// (0 = Go's default of 250).
+	HTTP2MaxStreams int
+	// DedupIdenticalGoals treats a wake without wake_id as a duplicate of an
+	// identical goal and context submitted within DedupWindow.
+	DedupIdenticalGoals bool
+	DedupWindow         time.Duration
+	// MaxDeadlineExtension is agent.max_deadline_extension, the most
+	// POST /v1/runs/{run_id}/extend may add to one run (0 = disabled).
+	MaxDeadlineExtension time.Duration
+	ReadinessChecks      []ReadinessCheck
+	// AllowedConstraints, when non-empty, lists the only constraints keys
+	// wake, continue, and replay requests may set.
+	AllowedConstraints []string
+	// DefaultContext and DefaultConstraints are deep-merged under every
+	// wake's context and constraints, with the request winning on conflicts.
+	DefaultContext     map[string]any
+	DefaultConstraints map[string]any
+	// Models lists the values the model constraint may take (llm.model and
+	// llm.allowed_models).
+	Models []string
+}
+
+// ReadinessCheck is an extra dependency probe run by GET /readyz.
+type ReadinessCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
 }
 
 // Server represents the HTTP API server.
@@ -37,6 +91,10 @@ type Server struct {
 	logger    *slog.Logger
 	server    *http.Server
 	startedAt time.Time
+
+	// activeStreams counts open SSE event streams.
+	activeStreams atomic.Int64
+	stats         statsCache
 }
 
 // New creates a new API server instance.
@@ -55,14 +113,24 @@ func (s *Server) Start(ctx context.Context) error {
 	router := s.setupRoutes()
 
 	s.server = &http.Server{
-		Addr:         s.config.Listen,
-		Handler:      router,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 0, // SSE endpoints are long-lived streams.
-		IdleTimeout:  60 * time.Second,
+		Addr:              s.config.Listen,
+		Handler:           router,
+		ReadTimeout:       10 * time.Second,
+		ReadHeaderTimeout: orDuration(s.config.ReadHeaderTimeout, 10*time.Second),
+		WriteTimeout:      0, // SSE endpoints are long-lived streams.
+		IdleTimeout:       orDuration(s.config.IdleTimeout, 60*time.Second),
+	}
+	if s.config.H2C {
+		var protocols http.Protocols
+		protocols.SetHTTP1(true)
+		protocols.SetUnencryptedHTTP2(true)
+		s.server.Protocols = &protocols
+		if s.config.HTTP2MaxStreams > 0 {
+			s.server.HTTP2 = &http.HTTP2Config{MaxConcurrentStreams: s.config.HTTP2MaxStreams}
+		}
 	}
 
-	s.logger.Info("API server starting", "listen", s.config.Listen)
+	s.logger.Info("API server starting", "listen", s.config.Listen, "h2c", s.config.H2C)
 
 	errCh := make(chan error, 1)
 	go func() {
@@ -85,6 +153,26 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 }
 
+// limitRequestBody caps request bodies at MaxRequestBytes so an oversized
+// POST fails while decoding instead of being read into memory.
+func (s *Server) limitRequestBody(next http.Handler) http.Handler {
+	limit := int64(s.config.MaxRequestBytes)
+	if limit <= 0 {
+		limit = defaultMaxRequestBytes
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func orDuration(d, fallback time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return fallback
+}
+
 // setupRoutes configures the HTTP router.
 func (s *Server) setupRoutes() *chi.Mux {
 	r := chi.NewRouter()
@@ -96,15 +184,36 @@ func (s *Server) setupRoutes() *chi.Mux {
 
 	// Unauthenticated
 	r.Get("/healthz", s.handleHealthz)
+	r.Get("/readyz", s.handleReadyz)
+	r.Get("/v1/openapi.json", s.handleOpenAPI)
 
 	// Protected
 	r.Group(func(r chi.Router) {
 		r.Use(s.bearerAuth)
-		r.Post("/v1/wake", s.handleWake)
-		r.Get("/v1/runs", s.handleListRuns)
-		r.Get("/v1/runs/{run_id}", s.handleGetRun)
-		r.Get("/v1/runs/{run_id}/workspace", s.handleRunWorkspace)
-		r.Get("/v1/runs/{run_id}/events", s.handleRunEvents)
+		r.Use(s.limitRequestBody)
+
+		r.With(s.requireScope(ScopeWrite)).Post("/v1/wake", s.handleWake)
+		r.With(s.requireScope(ScopeWrite)).Post("/v1/wake/batch", s.handleWakeBatch)
+		r.With(s.requireScope(ScopeWrite)).Post("/v1/runs/{run_id}/replay", s.handleRunReplay)
+		r.With(s.requireScope(ScopeWrite)).Post("/v1/runs/{run_id}/continue", s.handleRunContinue)
+		r.With(s.requireScope(ScopeWrite)).Post("/v1/runs/{run_id}/message", s.handleRunMessage)
+		r.With(s.requireScope(ScopeWrite)).Post("/v1/runs/{run_id}/extend", s.handleRunExtend)
+		r.With(s.requireScope(ScopeWrite)).Post("/v1/runs/{run_id}/approve", s.handleRunApprove)
+		r.With(s.requireScope(ScopeWrite)).Post("/v1/runs/{run_id}/reject", s.handleRunReject)
+
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireScope(ScopeRead))
+			r.Get("/v1/stats", s.handleStats)
+			r.Get("/v1/runs", s.handleListRuns)
+			r.Get("/v1/runs/compare", s.handleCompareRuns)
+			r.Get("/v1/runs/{run_id}", s.handleGetRun)
+			r.Get("/v1/runs/{run_id}/workspace", s.handleRunWorkspace)
+			r.Get("/v1/runs/{run_id}/workspace.tar.gz", s.handleRunWorkspaceArchive)
+			r.Get("/v1/runs/{run_id}/workspace/diff", s.handleRunWorkspaceDiff)
+			r.Get("/v1/runs/{run_id}/export", s.handleRunExport)
+			r.Get("/v1/runs/{run_id}/events", s.handleRunEvents)
+			r.Get("/v1/runs/{run_id}/timeline", s.handleRunTimeline)
+		})
 	})
 
 	return r
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// statsCacheTTL bounds how often GET /v1/stats recomputes its SQL aggregates.
+const statsCacheTTL = 5 * time.Second
+
+// StatsResponse is returned by GET /v1/stats. Run and token aggregates may be
+// up to a few seconds old (see computed_at); queue_depth and active_streams are live.
+type StatsResponse struct {
+	RunsByStatus     map[store.RunStatus]int `json:"runs_by_status"`
+	TotalRuns        int                     `json:"total_runs"`
+	FinishedRuns     int                     `json:"finished_runs"`
+	AvgRunDurationMS int64                   `json:"avg_run_duration_ms"`
+	TokensToday      store.TokenUsage        `json:"tokens_today"`
+	QueueDepth       int                     `json:"queue_depth"`
+	ActiveStreams    int64                   `json:"active_streams"`
+	ComputedAt       time.Time               `json:"computed_at"`
+}
+
+// statsCache holds the most recent SQL aggregates for GET /v1/stats.
+type statsCache struct {
+	mu       sync.Mutex
+	response StatsResponse
+	valid    bool
+}
+
+// handleStats handles GET /v1/stats.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	resp, err := s.cachedStats(r.Context())
+	if err != nil {
+		s.logger.Error("failed to compute stats", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "failed to compute stats")
+		return
+	}
+	resp.QueueDepth = s.creator.QueueDepth()
+	resp.ActiveStreams = s.activeStreams.Load()
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// cachedStats returns the run and token aggregates, recomputing them once
+// they are older than statsCacheTTL.
+func (s *Server) cachedStats(ctx context.Context) (StatsResponse, error) {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	if s.stats.valid && time.Since(s.stats.response.ComputedAt) < statsCacheTTL {
+		return s.stats.response, nil
+	}
+
+	runStats, err := s.runs.Stats(ctx)
+	if err != nil {
+		return StatsResponse{}, err
+	}
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	tokens, err := store.NewStepStore(s.runs.DB()).TokenUsageSince(ctx, today)
+	if err != nil {
+		return StatsResponse{}, err
+	}
+
+	s.stats.response = StatsResponse{
+		RunsByStatus:     runStats.ByStatus,
+		TotalRuns:        runStats.Total,
+		FinishedRuns:     runStats.FinishedRuns,
+		AvgRunDurationMS: runStats.AvgDuration.Milliseconds(),
+		TokensToday:      tokens,
+		ComputedAt:       now,
+	}
+	s.stats.valid = true
+	return s.stats.response, nil
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mattjoyce/agenticloop/internal/store"
+)
+
+// TimelineEntry is one event in a run's timeline. Run events carry the run
+// status; step events carry the step's number, phase, and status, and a
+// finished step also its duration, error, and the tools an ACT step called
+// with their call counts.
+type TimelineEntry struct {
+	At         time.Time      `json:"at"`
+	Type       string         `json:"type"`
+	Status     string         `json:"status,omitempty"`
+	StepID     string         `json:"step_id,omitempty"`
+	StepNum    *int           `json:"step_num,omitempty"`
+	Phase      string         `json:"phase,omitempty"`
+	Attempt    int            `json:"attempt,omitempty"`
+	DurationMS *int64         `json:"duration_ms,omitempty"`
+	ToolCalls  map[string]int `json:"tool_calls,omitempty"`
+	Error      *string        `json:"error,omitempty"`
+	// FailureCode is set on the run.finished entry of a failed run.
+	FailureCode *string `json:"failure_code,omitempty"`
+}
+
+// RunTimelineResponse is returned by GET /v1/runs/{run_id}/timeline.
+type RunTimelineResponse struct {
+	RunID   string          `json:"run_id"`
+	Status  string          `json:"status"`
+	Entries []TimelineEntry `json:"entries"`
+}
+
+// handleRunTimeline handles GET /v1/runs/{run_id}/timeline. It returns the
+// run's lifecycle and every step start and finish as one chronological list,
+// so trace UIs need not stitch steps and SSE events together themselves.
+func (s *Server) handleRunTimeline(w http.ResponseWriter, r *http.Request) {
+	runID := chi.URLParam(r, "run_id")
+
+	run, err := s.runs.GetByID(r.Context(), runID)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	steps, err := store.NewStepStore(s.runs.DB()).GetByRunID(r.Context(), runID)
+	if err != nil {
+		s.logger.Error("failed to get steps for timeline", "run_id", runID, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "failed to read steps")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, RunTimelineResponse{
+		RunID:   run.ID,
+		Status:  string(run.Status),
+		Entries: buildTimeline(run, steps),
+	})
+}
+
+// buildTimeline derives the timeline entries of run from its steps, ordered
+// by time. Entries with the same timestamp keep their logical order: run
+// events around step events, and each step's start before its finish.
+func buildTimeline(run *store.Run, steps []*store.Step) []TimelineEntry {
+	entries := []TimelineEntry{{At: run.CreatedAt, Type: "run.queued", Status: string(store.RunStatusQueued)}}
+	if run.StartedAt != nil {
+		entries = append(entries, TimelineEntry{At: *run.StartedAt, Type: "run.started", Status: string(store.RunStatusRunning)})
+	}
+
+	for _, step := range steps {
+		stepNum := step.StepNum
+		started := step.CreatedAt
+		if step.StartedAt != nil {
+			started = *step.StartedAt
+		}
+		entries = append(entries, TimelineEntry{
+			At:      started,
+			Type:    "step.started",
+			StepID:  step.ID,
+			StepNum: &stepNum,
+			Phase:   string(step.Phase),
+			Attempt: step.Attempt,
+		})
+		if step.CompletedAt == nil {
+			continue
+		}
+		finished := TimelineEntry{
+			At:        *step.CompletedAt,
+			Type:      "step.finished",
+			Status:    string(step.Status),
+			StepID:    step.ID,
+			StepNum:   &stepNum,
+			Phase:     string(step.Phase),
+			Attempt:   step.Attempt,
+			ToolCalls: stepToolCalls(step.ToolOutput),
+			Error:     step.Error,
+		}
+		ms := step.CompletedAt.Sub(started).Milliseconds()
+		finished.DurationMS = &ms
+		entries = append(entries, finished)
+	}
+
+	if run.CompletedAt != nil && (run.Status == store.RunStatusDone || run.Status == store.RunStatusFailed) {
+		finished := TimelineEntry{
+			At:          *run.CompletedAt,
+			Type:        "run.finished",
+			Status:      string(run.Status),
+			Error:       run.Error,
+			FailureCode: run.FailureCode,
+		}
+		if run.StartedAt != nil {
+			ms := run.CompletedAt.Sub(*run.StartedAt).Milliseconds()
+			finished.DurationMS = &ms
+		}
+		entries = append(entries, finished)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].At.Before(entries[j].At) })
+	return entries
+}
+
+// stepToolCalls reads the per-tool call counts an ACT step recorded in its
+// tool_token_usage output, or nil when it called no tools.
+func stepToolCalls(output json.RawMessage) map[string]int {
+	if len(output) == 0 {
+		return nil
+	}
+	var parsed struct {
+		ToolTokenUsage map[string]struct {
+			Calls int `json:"calls"`
+		} `json:"tool_token_usage"`
+	}
+	if err := json.Unmarshal(output, &parsed); err != nil || len(parsed.ToolTokenUsage) == 0 {
+		return nil
+	}
+	calls := make(map[string]int, len(parsed.ToolTokenUsage))
+	for name, usage := range parsed.ToolTokenUsage {
+		calls[name] = usage.Calls
+	}
+	return calls
+}
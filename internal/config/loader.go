@@ -1,17 +1,62 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/mattjoyce/agenticloop/internal/ductile"
+	"github.com/mattjoyce/agenticloop/internal/localtools"
 )
 
 var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
 
+// DefaultRedactPatterns cover common credential formats: provider API keys,
+// cloud and SCM tokens, bearer tokens, JWTs, PEM private keys, and key=value
+// style secrets. A leading capture group is kept and only the rest is redacted.
+var DefaultRedactPatterns = []string{
+	`sk-[A-Za-z0-9_-]{20,}`,
+	`AKIA[0-9A-Z]{16}`,
+	`gh[pousr]_[A-Za-z0-9]{36,}`,
+	`github_pat_[A-Za-z0-9_]{22,}`,
+	`xox[abprs]-[A-Za-z0-9-]{10,}`,
+	`AIza[0-9A-Za-z_-]{35}`,
+	`eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`,
+	`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]{16,}`,
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+	`(?i)((?:api[_-]?key|access[_-]?token|auth[_-]?token|secret|password|passwd)["']?\s*[:=]\s*["']?)[^"'\s,}&]{6,}`,
+}
+
+// nextStageKey normalizes a next_stages key the way the loop normalizes
+// reflect's next_stage value before looking it up.
+func nextStageKey(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// DefaultNextStages are the built-in reflect next_stage values. Entries in
+// agent.next_stages are merged on top of them.
+var DefaultNextStages = map[string]string{
+	"plan": "plan",
+	"act":  "act",
+	"done": "done",
+}
+
+// nextStageTargets are the loop stages a reflect next_stage value can route to.
+var nextStageTargets = map[string]bool{"frame": true, "plan": true, "act": true, "done": true}
+
+// modelStages are the loop stages that call the model.
+var modelStages = map[string]bool{"frame": true, "plan": true, "act": true, "observe": true, "reflect": true, "summarize": true}
+
+// DefaultFinalIterationMessage is the grace message shown on a run's last iteration.
+const DefaultFinalIterationMessage = "This is the final iteration. No further loops will run. Finish the most important remaining work now and call report_success with your summary and evidence in this iteration; do not plan further steps."
+
 // Load reads and parses configuration from a YAML file.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
@@ -52,6 +97,12 @@ func resolvePaths(cfg *Config, configFilePath string) {
 	if !filepath.IsAbs(cfg.Agent.WorkspaceDir) {
 		cfg.Agent.WorkspaceDir = filepath.Join(base, cfg.Agent.WorkspaceDir)
 	}
+	if cfg.Service.LogFile != "" && !filepath.IsAbs(cfg.Service.LogFile) {
+		cfg.Service.LogFile = filepath.Join(base, cfg.Service.LogFile)
+	}
+	if cfg.Agent.ReferenceDir != "" && !filepath.IsAbs(cfg.Agent.ReferenceDir) {
+		cfg.Agent.ReferenceDir = filepath.Join(base, cfg.Agent.ReferenceDir)
+	}
 }
 
 func applyDefaults(cfg *Config) {
@@ -61,9 +112,21 @@ func applyDefaults(cfg *Config) {
 	if cfg.Service.LogLevel == "" {
 		cfg.Service.LogLevel = "info"
 	}
+	if cfg.Service.LogFormat == "" {
+		cfg.Service.LogFormat = "json"
+	}
 	if cfg.Database.Path == "" {
 		cfg.Database.Path = "./data/agenticloop.db"
 	}
+	if cfg.Database.MaxOpenConns == 0 {
+		cfg.Database.MaxOpenConns = 4
+	}
+	if cfg.Database.BusyTimeout == 0 {
+		cfg.Database.BusyTimeout = 5 * time.Second
+	}
+	if cfg.Database.WALCheckpointInterval == 0 {
+		cfg.Database.WALCheckpointInterval = 5 * time.Minute
+	}
 	if cfg.API.Listen == "" {
 		cfg.API.Listen = "127.0.0.1:8090"
 	}
@@ -73,9 +136,68 @@ func applyDefaults(cfg *Config) {
 	if cfg.API.StreamHeartbeatInterval == 0 {
 		cfg.API.StreamHeartbeatInterval = 15 * time.Second
 	}
+	if cfg.API.ReadHeaderTimeout == 0 {
+		cfg.API.ReadHeaderTimeout = 10 * time.Second
+	}
+	if cfg.API.IdleTimeout == 0 {
+		cfg.API.IdleTimeout = 60 * time.Second
+	}
+	if cfg.API.MaxContextBytes == 0 {
+		cfg.API.MaxContextBytes = 64 << 10
+	}
+	if cfg.API.MaxRequestBytes == 0 {
+		cfg.API.MaxRequestBytes = 1 << 20
+	}
+	if cfg.API.DedupWindow == 0 {
+		cfg.API.DedupWindow = 10 * time.Minute
+	}
 	if cfg.LLM.MaxTokens == 0 {
 		cfg.LLM.MaxTokens = 4096
 	}
+	if cfg.LLM.RequestTimeout == 0 {
+		cfg.LLM.RequestTimeout = 120 * time.Second
+	}
+	if cfg.LLM.FailoverRetries == 0 {
+		cfg.LLM.FailoverRetries = 2
+	}
+	if cfg.LLM.FailoverBackoff == 0 {
+		cfg.LLM.FailoverBackoff = time.Second
+	}
+	for i := range cfg.LLM.Fallbacks {
+		fb := &cfg.LLM.Fallbacks[i]
+		if fb.MaxTokens == 0 {
+			fb.MaxTokens = cfg.LLM.MaxTokens
+		}
+		if fb.RequestTimeout == 0 {
+			fb.RequestTimeout = cfg.LLM.RequestTimeout
+		}
+		if fb.ContextWindow == 0 {
+			fb.ContextWindow = cfg.LLM.ContextWindow
+		}
+	}
+	if cfg.Ductile.RequestTimeout == 0 {
+		cfg.Ductile.RequestTimeout = 30 * time.Second
+	}
+	if cfg.Ductile.CallbackMaxRetries == 0 {
+		cfg.Ductile.CallbackMaxRetries = 3
+	}
+	if cfg.Ductile.CallbackBackoff == 0 {
+		cfg.Ductile.CallbackBackoff = time.Second
+	}
+	if cfg.Ductile.CallbackRetryInterval == 0 {
+		cfg.Ductile.CallbackRetryInterval = time.Minute
+	}
+	if cb := &cfg.Ductile.CircuitBreaker; cb.Threshold > 0 {
+		if cb.Window == 0 {
+			cb.Window = time.Minute
+		}
+		if cb.Cooldown == 0 {
+			cb.Cooldown = 30 * time.Second
+		}
+		if cb.MaxCooldown == 0 {
+			cb.MaxCooldown = 5 * time.Minute
+		}
+	}
 	if cfg.Agent.DefaultMaxLoops == 0 {
 		cfg.Agent.DefaultMaxLoops = 10
 	}
@@ -91,6 +213,12 @@ func applyDefaults(cfg *Config) {
 	if cfg.Agent.MaxActRounds == 0 {
 		cfg.Agent.MaxActRounds = 6
 	}
+	if cfg.Agent.ContextFraction == 0 {
+		cfg.Agent.ContextFraction = 0.1
+	}
+	if cfg.Agent.MaxRecoveryAttempts == 0 {
+		cfg.Agent.MaxRecoveryAttempts = 3
+	}
 	if cfg.Agent.QueueCapacity == 0 {
 		cfg.Agent.QueueCapacity = 100
 	}
@@ -100,6 +228,68 @@ func applyDefaults(cfg *Config) {
 	if cfg.Agent.WorkspaceDir == "" {
 		cfg.Agent.WorkspaceDir = "./data/workspaces"
 	}
+	if cfg.Agent.EvidenceFormat == "" {
+		cfg.Agent.EvidenceFormat = "markdown"
+	}
+	if cfg.Agent.FrameFormat == "" {
+		cfg.Agent.FrameFormat = "markdown"
+	}
+	if cfg.Agent.KeepWorkspace == "" {
+		cfg.Agent.KeepWorkspace = "always"
+	}
+	if cfg.Agent.MinIterations == 0 {
+		cfg.Agent.MinIterations = 1
+	}
+	if cfg.Agent.MaxReferenceBytes == 0 {
+		cfg.Agent.MaxReferenceBytes = 256 << 10
+	}
+	if cfg.Agent.MaxSubrunsPerRun == 0 {
+		cfg.Agent.MaxSubrunsPerRun = 5
+	}
+	if cfg.Agent.SysTools.Timeout == 0 {
+		cfg.Agent.SysTools.Timeout = localtools.DefaultSysToolTimeout
+	}
+	if cfg.Agent.SysTools.MaxOutputBytes == 0 {
+		cfg.Agent.SysTools.MaxOutputBytes = localtools.DefaultSysToolMaxOutputBytes
+	}
+	if cfg.Agent.SysTools.ExternalIPURL == "" {
+		cfg.Agent.SysTools.ExternalIPURL = localtools.DefaultExternalIPURL
+	}
+	if cfg.Agent.FetchURL.Timeout == 0 {
+		cfg.Agent.FetchURL.Timeout = localtools.DefaultFetchURLTimeout
+	}
+	if cfg.Agent.FetchURL.MaxChars == 0 {
+		cfg.Agent.FetchURL.MaxChars = localtools.DefaultFetchURLMaxChars
+	}
+	if cfg.Agent.Approval.Timeout == 0 {
+		cfg.Agent.Approval.Timeout = 15 * time.Minute
+	}
+	if cfg.Agent.Approval.PollInterval == 0 {
+		cfg.Agent.Approval.PollInterval = 2 * time.Second
+	}
+	if cfg.Agent.StaleRunCheckInterval == 0 {
+		cfg.Agent.StaleRunCheckInterval = time.Minute
+	}
+	if cfg.Agent.WorkspaceGCInterval == 0 {
+		cfg.Agent.WorkspaceGCInterval = time.Hour
+	}
+	if cfg.Agent.RedactPatterns == nil {
+		cfg.Agent.RedactPatterns = DefaultRedactPatterns
+	}
+	if cfg.Agent.FinalIterationMessage == "" {
+		cfg.Agent.FinalIterationMessage = DefaultFinalIterationMessage
+	}
+	nextStages := make(map[string]string, len(DefaultNextStages)+len(cfg.Agent.NextStages))
+	for value, target := range DefaultNextStages {
+		nextStages[value] = target
+	}
+	for value, target := range cfg.Agent.NextStages {
+		nextStages[nextStageKey(value)] = target
+	}
+	cfg.Agent.NextStages = nextStages
+	if cfg.Agent.MaxIdenticalActions > 0 && cfg.Agent.StuckLoopThreshold == 0 {
+		cfg.Agent.StuckLoopThreshold = 2 * cfg.Agent.MaxIdenticalActions
+	}
 }
 
 func validate(cfg *Config) error {
@@ -107,8 +297,17 @@ func validate(cfg *Config) error {
 	if !validLogLevels[cfg.Service.LogLevel] {
 		return fmt.Errorf("service.log_level must be one of: debug, info, warn, error (got %q)", cfg.Service.LogLevel)
 	}
-	if cfg.API.Token == "" {
-		return fmt.Errorf("api.token is required")
+	if cfg.Service.LogFormat != "json" && cfg.Service.LogFormat != "text" {
+		return fmt.Errorf("service.log_format must be one of: json, text (got %q)", cfg.Service.LogFormat)
+	}
+	if cfg.Database.MaxOpenConns <= 0 {
+		return fmt.Errorf("database.max_open_conns must be positive")
+	}
+	if cfg.Database.BusyTimeout <= 0 || cfg.Database.WALCheckpointInterval <= 0 {
+		return fmt.Errorf("database.busy_timeout and database.wal_checkpoint_interval must be positive")
+	}
+	if cfg.API.Token == "" && len(cfg.API.Tokens) == 0 {
+		return fmt.Errorf("api.token or api.tokens is required")
 	}
 	if envVarPattern.MatchString(cfg.API.Token) {
 		matches := envVarPattern.FindStringSubmatch(cfg.API.Token)
@@ -116,21 +315,45 @@ func validate(cfg *Config) error {
 			return fmt.Errorf("api.token: environment variable ${%s} is not set", matches[1])
 		}
 	}
-	if cfg.LLM.Provider == "" {
-		return fmt.Errorf("llm.provider is required")
-	}
-	// api_key required for anthropic/openai, not for ollama
-	if cfg.LLM.Provider != "ollama" {
-		if cfg.LLM.APIKey == "" {
-			return fmt.Errorf("llm.api_key is required for provider %q", cfg.LLM.Provider)
+	validScopes := map[string]bool{"read": true, "write": true}
+	for i, tok := range cfg.API.Tokens {
+		if tok.Token == "" {
+			return fmt.Errorf("api.tokens[%d].token is required", i)
 		}
-		if envVarPattern.MatchString(cfg.LLM.APIKey) {
-			matches := envVarPattern.FindStringSubmatch(cfg.LLM.APIKey)
+		if envVarPattern.MatchString(tok.Token) {
+			matches := envVarPattern.FindStringSubmatch(tok.Token)
 			if len(matches) > 1 {
-				return fmt.Errorf("llm.api_key: environment variable ${%s} is not set", matches[1])
+				return fmt.Errorf("api.tokens[%d].token: environment variable ${%s} is not set", i, matches[1])
+			}
+		}
+		if len(tok.Scopes) == 0 {
+			return fmt.Errorf("api.tokens[%d].scopes must not be empty", i)
+		}
+		for _, scope := range tok.Scopes {
+			if !validScopes[scope] {
+				return fmt.Errorf("api.tokens[%d].scopes: unknown scope %q (valid: read, write)", i, scope)
 			}
 		}
 	}
+	if err := validateLLM("llm", cfg.LLM); err != nil {
+		return err
+	}
+	for name, price := range cfg.LLM.Pricing {
+		if price.PromptPer1K < 0 || price.CompletionPer1K < 0 {
+			return fmt.Errorf("llm.pricing.%s prices must be >= 0", name)
+		}
+	}
+	if cfg.LLM.FailoverRetries < 0 || cfg.LLM.FailoverBackoff < 0 {
+		return fmt.Errorf("llm.failover_retries and failover_backoff must be >= 0")
+	}
+	for i, fb := range cfg.LLM.Fallbacks {
+		if len(fb.Fallbacks) > 0 {
+			return fmt.Errorf("llm.fallbacks[%d].fallbacks is not supported", i)
+		}
+		if err := validateLLM(fmt.Sprintf("llm.fallbacks[%d]", i), fb); err != nil {
+			return err
+		}
+	}
 	if cfg.Ductile.BaseURL == "" {
 		return fmt.Errorf("ductile.base_url is required")
 	}
@@ -140,6 +363,12 @@ func validate(cfg *Config) error {
 			return fmt.Errorf("ductile.token: environment variable ${%s} is not set", matches[1])
 		}
 	}
+	if cfg.Ductile.CallbackSecret != "" && envVarPattern.MatchString(cfg.Ductile.CallbackSecret) {
+		matches := envVarPattern.FindStringSubmatch(cfg.Ductile.CallbackSecret)
+		if len(matches) > 1 {
+			return fmt.Errorf("ductile.callback_secret: environment variable ${%s} is not set", matches[1])
+		}
+	}
 	if cfg.Agent.Prompts.Frame == "" {
 		return fmt.Errorf("agent.prompts.frame is required")
 	}
@@ -161,6 +390,180 @@ func validate(cfg *Config) error {
 	if cfg.Agent.StepTimeout <= 0 {
 		return fmt.Errorf("agent.step_timeout must be positive")
 	}
+	for name, timeout := range cfg.Agent.ToolTimeouts {
+		if timeout <= 0 {
+			return fmt.Errorf("agent.tool_timeouts.%s must be positive", name)
+		}
+	}
+	if cfg.Agent.SysTools.Timeout <= 0 {
+		return fmt.Errorf("agent.sys_tools.timeout must be positive")
+	}
+	if cfg.Agent.SysTools.MaxOutputBytes <= 0 {
+		return fmt.Errorf("agent.sys_tools.max_output_bytes must be positive")
+	}
+	if cfg.Agent.MaxActRoundsCeiling < 0 {
+		return fmt.Errorf("agent.max_act_rounds_ceiling must be >= 0")
+	}
+	if cfg.Agent.MaxActRoundsCeiling > 0 && cfg.Agent.MaxActRoundsCeiling < cfg.Agent.MaxActRounds {
+		return fmt.Errorf("agent.max_act_rounds_ceiling (%d) must be 0 or at least agent.max_act_rounds (%d)", cfg.Agent.MaxActRoundsCeiling, cfg.Agent.MaxActRounds)
+	}
+	if cfg.Agent.FinalizeRounds < 0 {
+		return fmt.Errorf("agent.finalize_rounds must be >= 0")
+	}
+	if cfg.Agent.PriorityAgingRate < 0 {
+		return fmt.Errorf("agent.priority_aging_rate must be >= 0")
+	}
+	if cfg.Agent.FetchURL.Timeout <= 0 {
+		return fmt.Errorf("agent.fetch_url.timeout must be positive")
+	}
+	if cfg.Agent.FetchURL.MaxChars <= 0 {
+		return fmt.Errorf("agent.fetch_url.max_chars must be positive")
+	}
+	for _, host := range cfg.Agent.FetchURL.AllowedHosts {
+		if strings.TrimSpace(host) == "" || strings.ContainsAny(host, "/:") {
+			return fmt.Errorf("agent.fetch_url.allowed_hosts entries must be bare host names, got %q", host)
+		}
+		if strings.Contains(host, "*") {
+			if domain, ok := strings.CutPrefix(strings.TrimSpace(host), "*."); !ok || domain == "" || strings.Contains(domain, "*") {
+				return fmt.Errorf("agent.fetch_url.allowed_hosts wildcards must have the form *.example.com, got %q", host)
+			}
+		}
+	}
+	if cfg.Agent.Approval.Timeout <= 0 {
+		return fmt.Errorf("agent.approval.timeout must be positive")
+	}
+	if cfg.Agent.Approval.PollInterval <= 0 {
+		return fmt.Errorf("agent.approval.poll_interval must be positive")
+	}
+	for _, entry := range cfg.Agent.ShellAllowlist {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			return fmt.Errorf("agent.shell_allowlist entries must not be empty")
+		}
+		if strings.Contains(fields[0], "/") {
+			return fmt.Errorf("agent.shell_allowlist entry %q must start with a bare command name, not a path", entry)
+		}
+	}
+	for _, name := range cfg.Agent.ShellEnv {
+		if name == "" || strings.ContainsAny(name, "= \t") {
+			return fmt.Errorf("agent.shell_env entry %q must be an environment variable name", name)
+		}
+	}
+	if cfg.Agent.MaxToolTimePerRun < 0 {
+		return fmt.Errorf("agent.max_tool_time_per_run must be >= 0")
+	}
+	if cfg.Agent.MaxStepsPerRun < 0 {
+		return fmt.Errorf("agent.max_steps_per_run must be >= 0")
+	}
+	if cfg.Agent.StaleRunThreshold < 0 {
+		return fmt.Errorf("agent.stale_run_threshold must be >= 0")
+	}
+	if cfg.Agent.StaleRunCheckInterval < 0 {
+		return fmt.Errorf("agent.stale_run_check_interval must be >= 0")
+	}
+	if cfg.Agent.MaxQueueWait < 0 {
+		return fmt.Errorf("agent.max_queue_wait must be >= 0")
+	}
+	if cfg.Agent.MaxDeadlineExtension < 0 {
+		return fmt.Errorf("agent.max_deadline_extension must be >= 0")
+	}
+	if cfg.Agent.MaxSubrunDepth < 0 {
+		return fmt.Errorf("agent.max_subrun_depth must be >= 0")
+	}
+	if cfg.Agent.MaxSubrunsPerRun <= 0 {
+		return fmt.Errorf("agent.max_subruns_per_run must be positive")
+	}
+	if cfg.Agent.WorkspaceRetention < 0 {
+		return fmt.Errorf("agent.workspace_retention must be >= 0")
+	}
+	if cfg.Agent.WorkspaceGCInterval < 0 {
+		return fmt.Errorf("agent.workspace_gc_interval must be >= 0")
+	}
+	if cfg.Agent.LoopMemoryWindow < 0 {
+		return fmt.Errorf("agent.loop_memory_window must be >= 0")
+	}
+	if cfg.Agent.LoopMemoryWindow > 0 && !cfg.Agent.SaveLoopMemory {
+		return fmt.Errorf("agent.loop_memory_window requires agent.save_loop_memory: true")
+	}
+	if cfg.Agent.MaxPromptChars < 0 {
+		return fmt.Errorf("agent.max_prompt_chars must be >= 0")
+	}
+	if f := cfg.Agent.ContextFraction; f <= 0 || f > 1 {
+		return fmt.Errorf("agent.context_fraction must be between 0 and 1 (got %g)", f)
+	}
+	for i, pattern := range cfg.Agent.RedactPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("agent.redact_patterns[%d]: %w", i, err)
+		}
+	}
+	nextStages := make(map[string]string, len(cfg.Agent.NextStages))
+	for value, target := range cfg.Agent.NextStages {
+		key := nextStageKey(value)
+		if key == "" {
+			return fmt.Errorf("agent.next_stages keys must be non-empty")
+		}
+		if !nextStageTargets[target] {
+			return fmt.Errorf("agent.next_stages.%s must route to one of: frame, plan, act, done (got %q)", value, target)
+		}
+		if prev, ok := nextStages[key]; ok && prev != target {
+			return fmt.Errorf("agent.next_stages.%s conflicts with another key that also normalizes to %q", value, key)
+		}
+		nextStages[key] = target
+	}
+	if cfg.Agent.NextStages != nil {
+		cfg.Agent.NextStages = nextStages
+	}
+	for stage, n := range cfg.Agent.StageMaxTokens {
+		if !modelStages[stage] {
+			return fmt.Errorf("agent.stage_max_tokens keys must be one of: frame, plan, act, observe, reflect, summarize (got %q)", stage)
+		}
+		if n <= 0 {
+			return fmt.Errorf("agent.stage_max_tokens.%s must be positive", stage)
+		}
+	}
+	for stage, name := range cfg.Agent.StageModels {
+		if !modelStages[stage] {
+			return fmt.Errorf("agent.stage_models keys must be one of: frame, plan, act, observe, reflect, summarize (got %q)", stage)
+		}
+		if name != cfg.LLM.Model && !slices.Contains(cfg.LLM.AllowedModels, name) {
+			return fmt.Errorf("agent.stage_models.%s: model %q is not llm.model or in llm.allowed_models", stage, name)
+		}
+	}
+	if cfg.Agent.MaxLoopExtension < 0 {
+		return fmt.Errorf("agent.max_loop_extension must be >= 0")
+	}
+	if cfg.Agent.MinIterations < 1 {
+		return fmt.Errorf("agent.min_iterations must be >= 1")
+	}
+	if cfg.Agent.MaxIdenticalActions < 0 {
+		return fmt.Errorf("agent.max_identical_actions must be >= 0")
+	}
+	if cfg.Agent.StuckLoopThreshold < 0 {
+		return fmt.Errorf("agent.stuck_loop_threshold must be >= 0")
+	}
+	if cfg.Agent.StuckLoopThreshold > 0 && cfg.Agent.StuckLoopThreshold <= cfg.Agent.MaxIdenticalActions {
+		return fmt.Errorf("agent.stuck_loop_threshold must be greater than agent.max_identical_actions")
+	}
+	if cfg.Agent.StuckLoopThreshold > 0 && cfg.Agent.MaxIdenticalActions == 0 {
+		return fmt.Errorf("agent.stuck_loop_threshold requires agent.max_identical_actions")
+	}
+	if cfg.Agent.MaxReferenceBytes <= 0 {
+		return fmt.Errorf("agent.max_reference_bytes must be positive")
+	}
+	if cfg.Agent.MaxRecoveryAttempts <= 0 {
+		return fmt.Errorf("agent.max_recovery_attempts must be positive")
+	}
+	validEvidenceFormats := map[string]bool{"markdown": true, "json": true, "none": true}
+	if !validEvidenceFormats[cfg.Agent.EvidenceFormat] {
+		return fmt.Errorf("agent.evidence_format must be one of: markdown, json, none (got %q)", cfg.Agent.EvidenceFormat)
+	}
+	if cfg.Agent.FrameFormat != "" && cfg.Agent.FrameFormat != "markdown" && cfg.Agent.FrameFormat != "json" {
+		return fmt.Errorf("agent.frame_format must be one of: markdown, json (got %q)", cfg.Agent.FrameFormat)
+	}
+	validKeepWorkspace := map[string]bool{"always": true, "on_failure": true, "never": true}
+	if !validKeepWorkspace[cfg.Agent.KeepWorkspace] {
+		return fmt.Errorf("agent.keep_workspace must be one of: always, on_failure, never (got %q)", cfg.Agent.KeepWorkspace)
+	}
 	if cfg.Agent.QueueCapacity <= 0 {
 		return fmt.Errorf("agent.queue_capacity must be positive")
 	}
@@ -170,11 +573,70 @@ func validate(cfg *Config) error {
 	if cfg.API.StreamPollInterval <= 0 {
 		return fmt.Errorf("api.stream_poll_interval must be positive")
 	}
+	if cfg.API.MaxConcurrentStreams < 0 {
+		return fmt.Errorf("api.max_concurrent_streams must be >= 0")
+	}
+	if cfg.API.MaxStreamDuration < 0 {
+		return fmt.Errorf("api.max_stream_duration must be >= 0")
+	}
+	if cfg.API.HTTP2MaxConcurrentStreams < 0 {
+		return fmt.Errorf("api.http2_max_concurrent_streams must be >= 0")
+	}
+	if cfg.API.ReadHeaderTimeout <= 0 || cfg.API.IdleTimeout <= 0 {
+		return fmt.Errorf("api.read_header_timeout and api.idle_timeout must be positive")
+	}
+	if cfg.API.MaxContextBytes <= 0 {
+		return fmt.Errorf("api.max_context_bytes must be positive")
+	}
+	if cfg.API.MaxRequestBytes <= 0 {
+		return fmt.Errorf("api.max_request_bytes must be positive")
+	}
+	if cfg.API.DedupWindow <= 0 {
+		return fmt.Errorf("api.dedup_window must be positive")
+	}
+	for _, key := range cfg.API.AllowedConstraints {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("api.allowed_constraints entries must be non-empty")
+		}
+	}
+	if _, err := json.Marshal(cfg.API.DefaultContext); err != nil {
+		return fmt.Errorf("api.default_context must be JSON-compatible: %w", err)
+	}
+	if _, err := json.Marshal(cfg.API.DefaultConstraints); err != nil {
+		return fmt.Errorf("api.default_constraints must be JSON-compatible: %w", err)
+	}
+	if cfg.API.SnapshotMaxSteps < 0 {
+		return fmt.Errorf("api.snapshot_max_steps must be >= 0")
+	}
 	if cfg.API.StreamHeartbeatInterval <= 0 {
 		return fmt.Errorf("api.stream_heartbeat_interval must be positive")
 	}
-	if cfg.LLM.MaxTokens <= 0 {
-		return fmt.Errorf("llm.max_tokens must be positive")
+	if cfg.Ductile.RequestTimeout <= 0 {
+		return fmt.Errorf("ductile.request_timeout must be positive")
+	}
+	for _, entry := range cfg.Ductile.Allowlist {
+		if _, _, _, err := ductile.ParseAllowlistEntry(entry); err != nil {
+			return fmt.Errorf("ductile.allowlist: %w", err)
+		}
+	}
+	if cfg.Ductile.MaxConcurrentCalls < 0 {
+		return fmt.Errorf("ductile.max_concurrent_calls must be >= 0")
+	}
+	if cfg.Ductile.CallbackMaxRetries < 0 {
+		return fmt.Errorf("ductile.callback_max_retries must be >= 0")
+	}
+	if cfg.Ductile.CallbackBackoff < 0 || cfg.Ductile.CallbackRetryInterval < 0 {
+		return fmt.Errorf("ductile.callback_backoff and callback_retry_interval must be >= 0")
+	}
+	if cb := cfg.Ductile.CircuitBreaker; cb.Threshold < 0 {
+		return fmt.Errorf("ductile.circuit_breaker.threshold must be >= 0")
+	} else if cb.Threshold > 0 {
+		if cb.Window <= 0 || cb.Cooldown <= 0 {
+			return fmt.Errorf("ductile.circuit_breaker.window and cooldown must be positive")
+		}
+		if cb.MaxCooldown < cb.Cooldown {
+			return fmt.Errorf("ductile.circuit_breaker.max_cooldown must be >= cooldown")
+		}
 	}
 	return nil
 }
@@ -189,3 +651,52 @@ func interpolateEnv(input string) string {
 		return match
 	})
 }
+
+// validateLLM checks one provider entry; prefix names it in errors.
+func validateLLM(prefix string, llm LLMConfig) error {
+	if llm.Provider == "" {
+		return fmt.Errorf("%s.provider is required", prefix)
+	}
+	// api_key required for anthropic/openai, not for ollama
+	if llm.Provider != "ollama" {
+		if llm.APIKey == "" {
+			return fmt.Errorf("%s.api_key is required for provider %q", prefix, llm.Provider)
+		}
+		if envVarPattern.MatchString(llm.APIKey) {
+			matches := envVarPattern.FindStringSubmatch(llm.APIKey)
+			if len(matches) > 1 {
+				return fmt.Errorf("%s.api_key: environment variable ${%s} is not set", prefix, matches[1])
+			}
+		}
+	}
+	if llm.Provider == "azure_openai" {
+		if llm.BaseURL == "" {
+			return fmt.Errorf("%s.base_url is required for provider \"azure_openai\" (https://{resource}.openai.azure.com)", prefix)
+		}
+		if llm.APIVersion == "" {
+			return fmt.Errorf("%s.api_version is required for provider \"azure_openai\"", prefix)
+		}
+		if llm.Deployment == "" && llm.Model == "" {
+			return fmt.Errorf("%s.deployment or %s.model is required for provider \"azure_openai\"", prefix, prefix)
+		}
+	}
+	if llm.MaxTokens <= 0 {
+		return fmt.Errorf("%s.max_tokens must be positive", prefix)
+	}
+	if llm.RequestTimeout <= 0 {
+		return fmt.Errorf("%s.request_timeout must be positive", prefix)
+	}
+	if llm.ContextWindow < 0 {
+		return fmt.Errorf("%s.context_window must be >= 0", prefix)
+	}
+	if llm.ContextWindow > 0 && llm.ContextWindow <= llm.MaxTokens {
+		return fmt.Errorf("%s.context_window must be greater than max_tokens", prefix)
+	}
+	if t := llm.Temperature; t != nil && (*t < 0 || *t > 2) {
+		return fmt.Errorf("%s.temperature must be between 0 and 2 (got %g)", prefix, *t)
+	}
+	if p := llm.TopP; p != nil && (*p < 0 || *p > 1) {
+		return fmt.Errorf("%s.top_p must be between 0 and 1 (got %g)", prefix, *p)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"math"
 	"os"
 	"strings"
 	"testing"
@@ -17,9 +18,50 @@ func TestApplyDefaultsSetsOperationalIntervals(t *testing.T) {
 	if cfg.API.StreamHeartbeatInterval != 15*time.Second {
 		t.Fatalf("stream heartbeat default = %v, want %v", cfg.API.StreamHeartbeatInterval, 15*time.Second)
 	}
+	if cfg.API.ReadHeaderTimeout != 10*time.Second || cfg.API.IdleTimeout != 60*time.Second {
+		t.Fatalf("server timeouts default = %v/%v, want 10s/60s", cfg.API.ReadHeaderTimeout, cfg.API.IdleTimeout)
+	}
+	if cfg.API.MaxContextBytes != 64<<10 {
+		t.Fatalf("max context bytes default = %d, want %d", cfg.API.MaxContextBytes, 64<<10)
+	}
+	if cfg.API.MaxRequestBytes != 1<<20 {
+		t.Fatalf("max request bytes default = %d, want %d", cfg.API.MaxRequestBytes, 1<<20)
+	}
 	if cfg.LLM.MaxTokens != 4096 {
 		t.Fatalf("llm.max_tokens default = %d, want 4096", cfg.LLM.MaxTokens)
 	}
+	if cfg.LLM.RequestTimeout != 120*time.Second {
+		t.Fatalf("llm.request_timeout default = %v, want %v", cfg.LLM.RequestTimeout, 120*time.Second)
+	}
+	if cfg.Ductile.RequestTimeout != 30*time.Second {
+		t.Fatalf("ductile.request_timeout default = %v, want %v", cfg.Ductile.RequestTimeout, 30*time.Second)
+	}
+
+	if len(cfg.Agent.RedactPatterns) != len(DefaultRedactPatterns) {
+		t.Fatalf("agent.redact_patterns default has %d patterns, want %d", len(cfg.Agent.RedactPatterns), len(DefaultRedactPatterns))
+	}
+	if cfg.Agent.FinalIterationMessage != DefaultFinalIterationMessage {
+		t.Fatalf("agent.final_iteration_message default = %q", cfg.Agent.FinalIterationMessage)
+	}
+	if cfg.Agent.MaxReferenceBytes != 256<<10 {
+		t.Fatalf("agent.max_reference_bytes default = %d, want %d", cfg.Agent.MaxReferenceBytes, 256<<10)
+	}
+
+	if cfg.Agent.NextStages["done"] != "done" || len(cfg.Agent.NextStages) != len(DefaultNextStages) {
+		t.Fatalf("agent.next_stages default = %v", cfg.Agent.NextStages)
+	}
+
+	cfg = &Config{Agent: AgentConfig{NextStages: map[string]string{"replan": "frame", "Act": "plan"}}}
+	applyDefaults(cfg)
+	if cfg.Agent.NextStages["replan"] != "frame" || cfg.Agent.NextStages["act"] != "plan" || cfg.Agent.NextStages["done"] != "done" {
+		t.Fatalf("agent.next_stages merge = %v", cfg.Agent.NextStages)
+	}
+
+	cfg = &Config{Agent: AgentConfig{MaxIdenticalActions: 3}}
+	applyDefaults(cfg)
+	if cfg.Agent.StuckLoopThreshold != 6 {
+		t.Fatalf("agent.stuck_loop_threshold default = %d, want 6", cfg.Agent.StuckLoopThreshold)
+	}
 }
 
 func TestValidateRejectsNonPositiveIntervals(t *testing.T) {
@@ -35,11 +77,430 @@ func TestValidateRejectsNonPositiveIntervals(t *testing.T) {
 		t.Fatalf("expected stream_heartbeat_interval validation error, got %v", err)
 	}
 
+	cfg = validTestConfig()
+	cfg.Agent.MaxToolTimePerRun = -1 * time.Second
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.max_tool_time_per_run") {
+		t.Fatalf("expected max_tool_time_per_run validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.ToolTimeouts = map[string]time.Duration{"sys_external_ip": 0}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.tool_timeouts.sys_external_ip") {
+		t.Fatalf("expected tool_timeouts validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.NextStages = map[string]string{"escalate": "observe"}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.next_stages.escalate") {
+		t.Fatalf("expected next_stages validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.NextStages = map[string]string{"Replan": "frame", "replan ": "plan"}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "conflicts") {
+		t.Fatalf("expected next_stages conflict error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.NextStages = map[string]string{" Replan ": "frame"}
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if cfg.Agent.NextStages["replan"] != "frame" || len(cfg.Agent.NextStages) != 1 {
+		t.Fatalf("agent.next_stages not normalized: %v", cfg.Agent.NextStages)
+	}
+
+	cfg = validTestConfig()
+	cfg.Ductile.CircuitBreaker = CircuitBreakerConfig{Threshold: 3, Window: time.Minute, Cooldown: time.Minute, MaxCooldown: time.Second}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "ductile.circuit_breaker.max_cooldown") {
+		t.Fatalf("expected circuit_breaker validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Service.LogFormat = "xml"
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "service.log_format") {
+		t.Fatalf("expected log_format validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.MaxLoopExtension = -1
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.max_loop_extension") {
+		t.Fatalf("expected max_loop_extension validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.SysTools.MaxOutputBytes = 0
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.sys_tools.max_output_bytes") {
+		t.Fatalf("expected sys_tools validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.ShellAllowlist = []string{"ls", "/bin/sh -c"}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.shell_allowlist") {
+		t.Fatalf("expected shell_allowlist validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.ShellEnv = []string{"GOCACHE", "TOKEN=x"}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.shell_env") {
+		t.Fatalf("expected shell_env validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.LLM.Pricing = map[string]ModelPricing{"gpt-4o": {PromptPer1K: 0.0025, CompletionPer1K: -1}}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "llm.pricing.gpt-4o") {
+		t.Fatalf("expected pricing validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Ductile.Allowlist = []string{"echo/poll", "echo/poll:data.value"}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "ductile.allowlist") {
+		t.Fatalf("expected ductile.allowlist validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.Approval.Timeout = 0
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.approval.timeout") {
+		t.Fatalf("expected approval timeout validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.MaxActRounds = 6
+	cfg.Agent.MaxActRoundsCeiling = 4
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.max_act_rounds_ceiling") {
+		t.Fatalf("expected max_act_rounds_ceiling below max_act_rounds to be rejected, got %v", err)
+	}
+	cfg.Agent.MaxActRoundsCeiling = 6
+	if err := validate(cfg); err != nil {
+		t.Fatalf("ceiling equal to max_act_rounds: %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.FetchURL.AllowedHosts = []string{"example.com", "https://example.org/"}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.fetch_url.allowed_hosts") {
+		t.Fatalf("expected fetch_url allowed_hosts validation error, got %v", err)
+	}
+
+	for _, host := range []string{"*", "*example.com", "*.", "docs.*.example.com"} {
+		cfg = validTestConfig()
+		cfg.Agent.FetchURL.AllowedHosts = []string{host}
+		if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "*.example.com") {
+			t.Fatalf("allowed_hosts %q: expected wildcard validation error, got %v", host, err)
+		}
+	}
+
+	cfg = validTestConfig()
+	cfg.LLM.Fallbacks = []LLMConfig{{Provider: "anthropic", Model: "claude", MaxTokens: 1024, RequestTimeout: time.Minute}}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "llm.fallbacks[0].api_key") {
+		t.Fatalf("expected fallback api_key validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.StageMaxTokens = map[string]int{"reflect": 0}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.stage_max_tokens.reflect") {
+		t.Fatalf("expected stage_max_tokens value validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.LLM.AllowedModels = []string{"big-model"}
+	cfg.Agent.StageModels = map[string]string{"act": "big-model", "reflect": cfg.LLM.Model}
+	if err := validate(cfg); err != nil {
+		t.Fatalf("expected stage_models on allowed models to validate, got %v", err)
+	}
+	cfg.Agent.StageModels = map[string]string{"act": "other-model"}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.stage_models.act") {
+		t.Fatalf("expected stage_models allow-list validation error, got %v", err)
+	}
+	cfg.Agent.StageModels = map[string]string{"done": "big-model"}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.stage_models keys") {
+		t.Fatalf("expected stage_models key validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.StageMaxTokens = map[string]int{"done": 100}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.stage_max_tokens keys") {
+		t.Fatalf("expected stage_max_tokens key validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.MaxStepsPerRun = -1
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.max_steps_per_run") {
+		t.Fatalf("expected max_steps_per_run validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.StaleRunThreshold = -time.Minute
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.stale_run_threshold") {
+		t.Fatalf("expected stale_run_threshold validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.MaxQueueWait = -time.Minute
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.max_queue_wait") {
+		t.Fatalf("expected max_queue_wait validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Ductile.MaxConcurrentCalls = -1
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "ductile.max_concurrent_calls") {
+		t.Fatalf("expected max_concurrent_calls validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Ductile.CallbackMaxRetries = -1
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "ductile.callback_max_retries") {
+		t.Fatalf("expected callback_max_retries validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Ductile.CallbackBackoff = -time.Second
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "ductile.callback_backoff") {
+		t.Fatalf("expected callback_backoff validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.MaxDeadlineExtension = -time.Minute
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.max_deadline_extension") {
+		t.Fatalf("expected max_deadline_extension validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.FrameFormat = "yaml"
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.frame_format") {
+		t.Fatalf("expected frame_format validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.KeepWorkspace = "sometimes"
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.keep_workspace") {
+		t.Fatalf("expected keep_workspace validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.MaxSubrunDepth = -1
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.max_subrun_depth") {
+		t.Fatalf("expected max_subrun_depth validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.MaxSubrunsPerRun = -1
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.max_subruns_per_run") {
+		t.Fatalf("expected max_subruns_per_run validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.API.DedupWindow = -time.Second
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "api.dedup_window") {
+		t.Fatalf("expected dedup_window validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Database.MaxOpenConns = -1
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "database.max_open_conns") {
+		t.Fatalf("expected max_open_conns validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.LLM.ContextWindow = 2048
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "llm.context_window must be greater than max_tokens") {
+		t.Fatalf("expected context_window validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.ContextFraction = 1.5
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.context_fraction") {
+		t.Fatalf("expected context_fraction validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.FinalizeRounds = -1
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.finalize_rounds") {
+		t.Fatalf("expected finalize_rounds validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.Approval.PollInterval = 0
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.approval.poll_interval") {
+		t.Fatalf("expected approval poll_interval validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.API.AllowedConstraints = []string{"max_loops", " "}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "api.allowed_constraints") {
+		t.Fatalf("expected allowed_constraints validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.API.MaxContextBytes = -1
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "api.max_context_bytes") {
+		t.Fatalf("expected max_context_bytes validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.API.MaxRequestBytes = -1
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "api.max_request_bytes") {
+		t.Fatalf("expected max_request_bytes validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.API.DefaultConstraints = map[string]any{"temperature": math.Inf(1)} // YAML .inf
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "api.default_constraints") {
+		t.Fatalf("expected default_constraints validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.API.MaxConcurrentStreams = -1
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "api.max_concurrent_streams") {
+		t.Fatalf("expected max_concurrent_streams validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.API.HTTP2MaxConcurrentStreams = -1
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "api.http2_max_concurrent_streams") {
+		t.Fatalf("expected http2_max_concurrent_streams validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.API.MaxStreamDuration = -time.Second
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "api.max_stream_duration") {
+		t.Fatalf("expected max_stream_duration validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.MinIterations = 0
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.min_iterations") {
+		t.Fatalf("expected min_iterations validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.API.Token = ""
+	cfg.API.Tokens = []APITokenConfig{{Name: "dashboard", Token: "ro", Scopes: []string{"read"}}}
+	if err := validate(cfg); err != nil {
+		t.Fatalf("expected scoped tokens alone to be valid, got %v", err)
+	}
+	cfg.API.Tokens[0].Scopes = []string{"admin"}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "api.tokens[0].scopes") {
+		t.Fatalf("expected api.tokens scope validation error, got %v", err)
+	}
+	cfg.API.Tokens = nil
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "api.token") {
+		t.Fatalf("expected missing token validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.LoopMemoryWindow = 2
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.save_loop_memory") {
+		t.Fatalf("expected loop_memory_window to require save_loop_memory, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.MaxPromptChars = -1
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.max_prompt_chars") {
+		t.Fatalf("expected max_prompt_chars validation error, got %v", err)
+	}
+
 	cfg = validTestConfig()
 	cfg.LLM.MaxTokens = 0
 	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "llm.max_tokens") {
 		t.Fatalf("expected llm.max_tokens validation error, got %v", err)
 	}
+
+	cfg = validTestConfig()
+	cfg.Agent.MaxIdenticalActions = 3
+	cfg.Agent.StuckLoopThreshold = 3
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.stuck_loop_threshold") {
+		t.Fatalf("expected stuck_loop_threshold validation error, got %v", err)
+	}
+	cfg.Agent.MaxIdenticalActions = 0
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "requires agent.max_identical_actions") {
+		t.Fatalf("expected stuck_loop_threshold to require max_identical_actions, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Agent.RedactPatterns = []string{`sk-[a-z`}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "agent.redact_patterns[0]") {
+		t.Fatalf("expected redact_patterns validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.LLM.RequestTimeout = -1 * time.Second
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "llm.request_timeout") {
+		t.Fatalf("expected llm.request_timeout validation error, got %v", err)
+	}
+
+	cfg = validTestConfig()
+	cfg.Ductile.RequestTimeout = 0
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "ductile.request_timeout") {
+		t.Fatalf("expected ductile.request_timeout validation error, got %v", err)
+	}
+}
+
+func TestValidateAzureOpenAI(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*LLMConfig)
+		wantErr string
+	}{
+		{name: "valid with deployment", mutate: func(c *LLMConfig) { c.Model = "" }},
+		{name: "missing endpoint", mutate: func(c *LLMConfig) { c.BaseURL = "" }, wantErr: "llm.base_url"},
+		{name: "missing api version", mutate: func(c *LLMConfig) { c.APIVersion = "" }, wantErr: "llm.api_version"},
+		{name: "missing deployment and model", mutate: func(c *LLMConfig) { c.Deployment, c.Model = "", "" }, wantErr: "llm.deployment or llm.model"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := validTestConfig()
+			cfg.LLM.Provider = "azure_openai"
+			cfg.LLM.BaseURL = "https://example.openai.azure.com"
+			cfg.LLM.APIVersion = "2024-06-01"
+			cfg.LLM.Deployment = "gpt-4o-prod"
+			cfg.LLM.Model = "gpt-4o"
+			tc.mutate(&cfg.LLM)
+			err := validate(cfg)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("validate() error = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSamplingRanges(t *testing.T) {
+	f := func(v float32) *float32 { return &v }
+	tests := []struct {
+		name        string
+		temperature *float32
+		topP        *float32
+		wantErr     string
+	}{
+		{"unset", nil, nil, ""},
+		{"in range", f(0.7), f(0.9), ""},
+		{"temperature bounds", f(2), f(0), ""},
+		{"temperature too high", f(2.1), nil, "llm.temperature"},
+		{"temperature negative", f(-0.1), nil, "llm.temperature"},
+		{"top_p too high", nil, f(1.5), "llm.top_p"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validTestConfig()
+			cfg.LLM.Temperature = tt.temperature
+			cfg.LLM.TopP = tt.topP
+			err := validate(cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected %s error, got %v", tt.wantErr, err)
+			}
+		})
+	}
 }
 
 func TestConfigTemplateUsesDynamicToolCatalog(t *testing.T) {
@@ -59,27 +520,50 @@ func TestConfigTemplateUsesDynamicToolCatalog(t *testing.T) {
 func validTestConfig() *Config {
 	return &Config{
 		Service: ServiceConfig{
-			LogLevel: "info",
+			LogLevel:  "info",
+			LogFormat: "json",
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:          4,
+			BusyTimeout:           time.Second,
+			WALCheckpointInterval: time.Minute,
 		},
 		API: APIConfig{
 			Token:                   "token",
 			StreamPollInterval:      700 * time.Millisecond,
 			StreamHeartbeatInterval: 15 * time.Second,
+			MaxContextBytes:         1024,
+			MaxRequestBytes:         1 << 20,
+			ReadHeaderTimeout:       time.Second,
+			IdleTimeout:             time.Second,
+			DedupWindow:             time.Minute,
 		},
 		Ductile: DuctileConfig{
-			BaseURL: "http://127.0.0.1:8080",
+			BaseURL:        "http://127.0.0.1:8080",
+			RequestTimeout: 30 * time.Second,
 		},
 		LLM: LLMConfig{
-			Provider:  "openai",
-			APIKey:    "key",
-			MaxTokens: 4096,
+			Provider:       "openai",
+			APIKey:         "key",
+			MaxTokens:      4096,
+			RequestTimeout: 2 * time.Minute,
 		},
 		Agent: AgentConfig{
-			DefaultMaxLoops: 1,
-			DefaultDeadline: time.Minute,
-			StepTimeout:     time.Second,
-			QueueCapacity:   1,
-			EnqueueTimeout:  time.Second,
+			DefaultMaxLoops:     1,
+			DefaultDeadline:     time.Minute,
+			StepTimeout:         time.Second,
+			QueueCapacity:       1,
+			EnqueueTimeout:      time.Second,
+			EvidenceFormat:      "markdown",
+			KeepWorkspace:       "always",
+			MaxRecoveryAttempts: 3,
+			MaxReferenceBytes:   1024,
+			MaxSubrunsPerRun:    5,
+			MinIterations:       1,
+			SysTools:            SysToolsConfig{Timeout: time.Second, MaxOutputBytes: 1024},
+			FetchURL:            FetchURLConfig{Timeout: time.Second, MaxChars: 1000},
+			ContextFraction:     0.1,
+			Approval:            ApprovalConfig{Timeout: time.Minute, PollInterval: time.Second},
 			Prompts: AgentPrompts{
 				Frame:   "frame",
 				Plan:    "plan",
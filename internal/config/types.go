@@ -16,39 +16,155 @@ type Config struct {
 }
 
 // ServiceConfig defines core service settings.
+// LogFormat is "json" (default) or "text". LogFile appends logs to a file
+// instead of stdout.
 type ServiceConfig struct {
-	Name     string `yaml:"name"`
-	LogLevel string `yaml:"log_level"`
+	Name      string `yaml:"name"`
+	LogLevel  string `yaml:"log_level"`
+	LogFormat string `yaml:"log_format"`
+	LogFile   string `yaml:"log_file"`
 }
 
 // DatabaseConfig defines SQLite storage settings.
 type DatabaseConfig struct {
 	Path string `yaml:"path"`
+	// MaxOpenConns caps pooled SQLite connections; with WAL, reads from
+	// concurrent runs and event streams proceed in parallel.
+	MaxOpenConns int `yaml:"max_open_conns"`
+	// BusyTimeout is how long a connection waits for another's lock.
+	BusyTimeout time.Duration `yaml:"busy_timeout"`
+	// WALCheckpointInterval is how often the WAL is checkpointed and
+	// truncated so it does not grow without bound.
+	WALCheckpointInterval time.Duration `yaml:"wal_checkpoint_interval"`
 }
 
 // APIConfig defines HTTP API server settings.
+// Token is the legacy full-access token; Tokens adds scoped tokens.
 type APIConfig struct {
-	Listen                  string        `yaml:"listen"`
-	Token                   string        `yaml:"token"`
-	StreamPollInterval      time.Duration `yaml:"stream_poll_interval"`
-	StreamHeartbeatInterval time.Duration `yaml:"stream_heartbeat_interval"`
+	Listen                  string           `yaml:"listen"`
+	Token                   string           `yaml:"token"`
+	Tokens                  []APITokenConfig `yaml:"tokens"`
+	StreamPollInterval      time.Duration    `yaml:"stream_poll_interval"`
+	StreamHeartbeatInterval time.Duration    `yaml:"stream_heartbeat_interval"`
+	// SnapshotMaxSteps limits the steps sent in the initial SSE snapshot (0 = all).
+	SnapshotMaxSteps int `yaml:"snapshot_max_steps"`
+	// MaxContextBytes caps the size of a wake request's context and
+	// constraints JSON; larger payloads are rejected with 413.
+	MaxContextBytes int `yaml:"max_context_bytes"`
+	// MaxRequestBytes caps the body of every POST request; larger bodies
+	// are rejected with 413 before they are decoded.
+	MaxRequestBytes int `yaml:"max_request_bytes"`
+	// MaxConcurrentStreams caps open /events streams; further connections
+	// get 503 (0 = unlimited).
+	MaxConcurrentStreams int `yaml:"max_concurrent_streams"`
+	// MaxStreamDuration closes an /events stream with a stream.closed event
+	// (status "timeout") once it has been open this long (0 = unlimited).
+	MaxStreamDuration time.Duration `yaml:"max_stream_duration"`
+	// ReadHeaderTimeout and IdleTimeout tune the HTTP server's keep-alive
+	// handling. H2C additionally serves HTTP/2 without TLS.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	H2C               bool          `yaml:"h2c"`
+	// HTTP2MaxConcurrentStreams caps concurrent requests on one h2c
+	// connection (0 = Go's default of 250).
+	HTTP2MaxConcurrentStreams int `yaml:"http2_max_concurrent_streams"`
+	// DedupIdenticalGoals makes a wake without wake_id return the existing
+	// run when the same goal and context arrived within DedupWindow.
+	DedupIdenticalGoals bool          `yaml:"dedup_identical_goals"`
+	DedupWindow         time.Duration `yaml:"dedup_window"`
+	// ReadinessProviderCheck makes /readyz also ping the LLM provider's model list.
+	ReadinessProviderCheck bool `yaml:"readiness_provider_check"`
+	// AllowedConstraints, when non-empty, lists the only constraints keys a
+	// wake, continue, or replay request may set; others are rejected with 400.
+	AllowedConstraints []string `yaml:"allowed_constraints"`
+	// DefaultContext and DefaultConstraints are deep-merged under every
+	// wake's context and constraints; the request wins on conflicts.
+	DefaultContext     map[string]any `yaml:"default_context"`
+	DefaultConstraints map[string]any `yaml:"default_constraints"`
+}
+
+// APITokenConfig defines a named bearer token and the scopes it grants
+// (read for GET endpoints, write for wake).
+type APITokenConfig struct {
+	Name   string   `yaml:"name"`
+	Token  string   `yaml:"token"`
+	Scopes []string `yaml:"scopes"`
 }
 
 // DuctileConfig defines the connection to the Ductile gateway.
 type DuctileConfig struct {
-	BaseURL     string   `yaml:"base_url"`
-	Token       string   `yaml:"token"`
-	Allowlist   []string `yaml:"allowlist"`
-	CallbackURL string   `yaml:"callback_url,omitempty"`
+	BaseURL        string               `yaml:"base_url"`
+	Token          string               `yaml:"token"`
+	Allowlist      []string             `yaml:"allowlist"`
+	CallbackURL    string               `yaml:"callback_url,omitempty"`
+	RequestTimeout time.Duration        `yaml:"request_timeout"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	// MaxConcurrentCalls bounds in-flight gateway requests across all runs
+	// (0 = unbounded).
+	MaxConcurrentCalls int `yaml:"max_concurrent_calls"`
+	// CallbackMaxRetries and CallbackBackoff retry a failed completion
+	// callback, doubling the backoff each time. Callbacks still undelivered
+	// are re-attempted every CallbackRetryInterval, also after a restart.
+	CallbackMaxRetries    int           `yaml:"callback_max_retries"`
+	CallbackBackoff       time.Duration `yaml:"callback_backoff"`
+	CallbackRetryInterval time.Duration `yaml:"callback_retry_interval"`
+	// CallbackSecret, when set, signs each completion callback with an
+	// HMAC-SHA256 over its timestamp and body.
+	CallbackSecret string `yaml:"callback_secret,omitempty"`
+}
+
+// CircuitBreakerConfig fails Ductile triggers fast once the gateway looks down.
+// Threshold consecutive failures within Window open the circuit for Cooldown
+// (0 = disabled); each failed probe doubles the cooldown up to MaxCooldown.
+type CircuitBreakerConfig struct {
+	Threshold   int           `yaml:"threshold"`
+	Window      time.Duration `yaml:"window"`
+	Cooldown    time.Duration `yaml:"cooldown"`
+	MaxCooldown time.Duration `yaml:"max_cooldown"`
 }
 
 // LLMConfig defines the LLM provider settings.
+// Temperature and TopP are optional; nil leaves the provider default in place.
+// JSONMode defaults to enabled on providers that support it; set false to opt out.
+// RequestTimeout caps each HTTP request to the provider.
+// APIVersion and Deployment apply to azure_openai only; Deployment defaults to Model.
+// Fallbacks are tried in order when a call to this provider fails with a
+// retryable error (rate limit, 5xx, timeout); unset MaxTokens and
+// RequestTimeout inherit the primary's values.
 type LLMConfig struct {
-	Provider  string `yaml:"provider"`
-	Model     string `yaml:"model"`
-	APIKey    string `yaml:"api_key"`
-	BaseURL   string `yaml:"base_url,omitempty"`
-	MaxTokens int    `yaml:"max_tokens,omitempty"`
+	Provider       string        `yaml:"provider"`
+	Model          string        `yaml:"model"`
+	APIKey         string        `yaml:"api_key"`
+	BaseURL        string        `yaml:"base_url,omitempty"`
+	MaxTokens      int           `yaml:"max_tokens,omitempty"`
+	Temperature    *float32      `yaml:"temperature,omitempty"`
+	TopP           *float32      `yaml:"top_p,omitempty"`
+	JSONMode       *bool         `yaml:"json_mode,omitempty"`
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	APIVersion     string        `yaml:"api_version,omitempty"`
+	Deployment     string        `yaml:"deployment,omitempty"`
+	Fallbacks      []LLMConfig   `yaml:"fallbacks,omitempty"`
+	// FailoverRetries retries a provider that fails with a retryable error
+	// this many times, waiting FailoverBackoff and doubling it after each
+	// attempt, before the call moves on to the next of Fallbacks.
+	FailoverRetries int           `yaml:"failover_retries,omitempty"`
+	FailoverBackoff time.Duration `yaml:"failover_backoff,omitempty"`
+	// AllowedModels lists further models of this provider that
+	// agent.stage_models and the model constraint may select.
+	AllowedModels []string `yaml:"allowed_models,omitempty"`
+	// ContextWindow is the model's context window in tokens. When set,
+	// memory and state clipping in prompts is sized from it
+	// (agent.context_fraction) instead of a fixed 12000 characters.
+	ContextWindow int `yaml:"context_window,omitempty"`
+	// Pricing maps model names to their token prices for cost estimates.
+	// A "provider/model" key prices one provider of a fallback chain.
+	Pricing map[string]ModelPricing `yaml:"pricing,omitempty"`
+}
+
+// ModelPricing is the price of 1000 prompt and completion tokens of a model.
+type ModelPricing struct {
+	PromptPer1K     float64 `yaml:"prompt_per_1k"`
+	CompletionPer1K float64 `yaml:"completion_per_1k"`
 }
 
 // AgentConfig defines default agent behavior.
@@ -58,17 +174,207 @@ type AgentConfig struct {
 	StepTimeout     time.Duration `yaml:"step_timeout"`
 	MaxRetryPerStep int           `yaml:"max_retry_per_step"`
 	MaxActRounds    int           `yaml:"max_act_rounds"`
-	QueueCapacity   int           `yaml:"queue_capacity"`
-	EnqueueTimeout  time.Duration `yaml:"enqueue_timeout"`
-	WorkspaceDir    string        `yaml:"workspace_dir"`
-	SaveLoopMemory  bool          `yaml:"save_loop_memory"`
-	Prompts         AgentPrompts  `yaml:"prompts"`
+	// MaxActRoundsCeiling lets a plan set its iteration's ACT round limit
+	// with an "act_rounds: N" line, up to this many rounds (0 = plans
+	// cannot override max_act_rounds).
+	MaxActRoundsCeiling int `yaml:"max_act_rounds_ceiling"`
+	// FinalizeRounds gives a run whose reflect says done before
+	// report_success was called one ACT-only stage of this many rounds to
+	// call it, instead of a full extra iteration (0 = disabled).
+	FinalizeRounds int `yaml:"finalize_rounds"`
+	// ActRequiresTool re-prompts an ACT stage once when its first reply calls
+	// no tool, before accepting the text as the ACT summary.
+	ActRequiresTool bool `yaml:"act_requires_tool"`
+	// RepairToolArgs fixes common JSON malformations in tool call arguments
+	// (trailing commas, single quotes, unquoted keys) before invoking a tool.
+	RepairToolArgs bool `yaml:"repair_tool_args"`
+	// ObservationEnvelope wraps every tool result sent to the model in
+	// {"ok", "tool", "result" or "error"}, so failures read the same across
+	// tools. Loop memory keeps the raw output.
+	ObservationEnvelope bool `yaml:"observation_envelope"`
+	// ToolCatalogVerbose lists each tool's parameters (name, type, required)
+	// under it in {{.AvailableTools}}, not just the name and description.
+	ToolCatalogVerbose bool `yaml:"tool_catalog_verbose"`
+	// DebugCaptureLLM writes every model call's full messages, response and
+	// timing to llm_trace.jsonl in the run workspace. Off by default: the
+	// trace holds complete prompts and grows with every call.
+	DebugCaptureLLM bool `yaml:"debug_capture_llm"`
+	// CompactCompletedRuns moves large step outputs of finished runs to
+	// step_outputs.jsonl in the run's state directory and keeps a clipped
+	// copy with token usage in the database.
+	CompactCompletedRuns bool `yaml:"compact_completed_runs"`
+	// MaxToolTimePerRun caps cumulative tool execution time across a run (0 = unlimited).
+	MaxToolTimePerRun time.Duration `yaml:"max_tool_time_per_run"`
+	// MaxStepsPerRun fails the run with failure_code=step_limit before it
+	// appends more than this many steps (0 = unlimited). Unlike max_loops it
+	// counts every stage step, including ACT rounds and retried stages.
+	MaxStepsPerRun int `yaml:"max_steps_per_run"`
+	// MaxSubrunDepth enables the spawn_subrun and get_subrun_status tools and
+	// caps how deeply subruns may nest (0 = tools disabled). Runs can lower it
+	// with the max_subrun_depth constraint.
+	MaxSubrunDepth int `yaml:"max_subrun_depth"`
+	// MaxSubrunsPerRun caps how many children one run may spawn (default 5).
+	MaxSubrunsPerRun int `yaml:"max_subruns_per_run"`
+	// MaxPromptChars caps the rendered stage prompt size (0 = unlimited).
+	// Oversized prompts are trimmed rather than sent to the provider.
+	MaxPromptChars int `yaml:"max_prompt_chars"`
+	// ContextFraction is the share of llm.context_window each memory, state,
+	// or evidence field may fill in a stage prompt.
+	ContextFraction float64 `yaml:"context_fraction"`
+	// MaxIdenticalActions warns the agent once the same tool call (name and
+	// arguments) recurs more than this many times in a run (0 = off).
+	// StuckLoopThreshold fails the run with failure_code=stuck_loop once it
+	// recurs more than that many times (default 2x MaxIdenticalActions).
+	MaxIdenticalActions int `yaml:"max_identical_actions"`
+	StuckLoopThreshold  int `yaml:"stuck_loop_threshold"`
+	// ToolTimeouts bounds a single call of the named tool; a call that runs
+	// longer returns a tool error to the model. Unlisted tools use StepTimeout.
+	ToolTimeouts map[string]time.Duration `yaml:"tool_timeouts"`
+	// SysTools bounds the built-in sys_* diagnostic commands.
+	SysTools SysToolsConfig `yaml:"sys_tools"`
+	// ShellAllowlist enables run_command for these commands, run in the
+	// workspace under the sys_tools timeout and output cap. An entry is a
+	// command name optionally followed by required leading arguments, e.g.
+	// "go test". Empty leaves run_command unbound.
+	ShellAllowlist []string `yaml:"shell_allowlist"`
+	// ShellEnv names environment variables run_command passes through besides
+	// PATH and HOME, e.g. GOCACHE. The rest of the service environment,
+	// including provider API keys, is withheld.
+	ShellEnv []string `yaml:"shell_env"`
+	// FetchURL enables fetch_url for its allowed hosts.
+	FetchURL FetchURLConfig `yaml:"fetch_url"`
+	// Approval enables request_approval, which pauses a run until an
+	// operator approves or rejects the action it names.
+	Approval ApprovalConfig `yaml:"approval"`
+	// RedactPatterns are regexes replaced with [REDACTED] in persisted step
+	// output, loop memory, and run memory. Unset uses DefaultRedactPatterns;
+	// an empty list disables redaction.
+	RedactPatterns []string `yaml:"redact_patterns"`
+	// MaxLoopExtension caps how many extra iterations reflect may add to a
+	// run in total via request_more_loops (0 = off).
+	MaxLoopExtension int `yaml:"max_loop_extension"`
+	// MinIterations defers a reflect "done" until at least this many
+	// iterations have run, even after report_success (default 1). It is
+	// capped at the run's max_loops.
+	MinIterations int `yaml:"min_iterations"`
+	// RequireReflectEvidence makes a reflect "done" also list evidence_refs
+	// (workspace files or "step:N") that exist; without them the run
+	// continues at PLAN.
+	RequireReflectEvidence bool `yaml:"require_reflect_evidence"`
+	// ReflectIncludeErrors exposes the last ACT stage's tool errors to
+	// prompts as {{.RecentErrors}}.
+	ReflectIncludeErrors bool `yaml:"reflect_include_errors"`
+	// AllowEmptyPlan lets the first FRAME output skip PLAN by setting
+	// "immediately_actionable": true, for goals that need no planning.
+	AllowEmptyPlan bool `yaml:"allow_empty_plan"`
+	// StageMaxTokens overrides llm.max_tokens for the named stage's model
+	// calls (frame, plan, act, observe, reflect, summarize). Unlisted stages
+	// use llm.max_tokens.
+	StageMaxTokens map[string]int `yaml:"stage_max_tokens"`
+	// StageModels serves the named stages with another model (llm.model or
+	// one of llm.allowed_models). Unlisted stages use llm.model.
+	StageModels map[string]string `yaml:"stage_models"`
+	// NextStages maps reflect next_stage values to the loop stage they route
+	// to (frame, plan, act, or done), e.g. replan: frame. Entries are merged
+	// over the built-in plan, act, and done values; unknown values route to plan.
+	// Keys are matched case-insensitively and trimmed.
+	NextStages map[string]string `yaml:"next_stages"`
+	// FinalIterationMessage is exposed to prompts as {{.GraceMessage}} on the
+	// last allowed iteration, when {{.FinalIteration}} is true.
+	FinalIterationMessage string `yaml:"final_iteration_message"`
+	// MaxRecoveryAttempts bounds how often a run is re-enqueued on startup
+	// before it is dead-lettered as failed with failure_code=recovery_exhausted.
+	MaxRecoveryAttempts int           `yaml:"max_recovery_attempts"`
+	QueueCapacity       int           `yaml:"queue_capacity"`
+	EnqueueTimeout      time.Duration `yaml:"enqueue_timeout"`
+	WorkspaceDir        string        `yaml:"workspace_dir"`
+	// StaleRunThreshold enables the stale run reaper: runs left in running
+	// with no active worker and not updated for this long are re-enqueued or
+	// failed as orphaned (0 = off). StaleRunCheckInterval sets how often it
+	// sweeps.
+	StaleRunThreshold     time.Duration `yaml:"stale_run_threshold"`
+	StaleRunCheckInterval time.Duration `yaml:"stale_run_check_interval"`
+	// MaxQueueWait fails a run that waited in the queue longer than this
+	// before it first started, with failure_code=queue_expired (0 = off).
+	MaxQueueWait time.Duration `yaml:"max_queue_wait"`
+	// PriorityAgingRate raises a queued run's effective priority by one for
+	// every PriorityAgingRate it has waited, so low priority runs are not
+	// starved (0 = off).
+	PriorityAgingRate time.Duration `yaml:"priority_aging_rate"`
+	// MaxDeadlineExtension caps the total time POST /v1/runs/{run_id}/extend
+	// may add to a running run's deadline (0 = extension disabled).
+	MaxDeadlineExtension time.Duration `yaml:"max_deadline_extension"`
+	// WorkspaceRetention enables deletion of workspaces for runs completed
+	// longer ago than this (0 = keep forever). WorkspaceGCInterval sets how
+	// often the sweep runs.
+	WorkspaceRetention  time.Duration `yaml:"workspace_retention"`
+	WorkspaceGCInterval time.Duration `yaml:"workspace_gc_interval"`
+	SaveLoopMemory      bool          `yaml:"save_loop_memory"`
+	// KeepWorkspace decides whether a run's workspace survives the run:
+	// "always" (default), "on_failure" (keep failed runs only), or "never".
+	KeepWorkspace string `yaml:"keep_workspace"`
+	// ExternalWorkspaceRoot is the directory under which a run may use an
+	// existing directory as its workspace via the workspace_path constraint
+	// (empty = not allowed).
+	ExternalWorkspaceRoot string `yaml:"external_workspace_root"`
+	// LoopMemoryWindow includes the last K archived loop memories in prompts
+	// as {{.RecentLoops}} (0 = off). Requires SaveLoopMemory.
+	LoopMemoryWindow int `yaml:"loop_memory_window"`
+	// ReferenceDir is a read-only directory of documents a run can pull into
+	// its prompts by listing them in context.context_files. MaxReferenceBytes
+	// caps the combined size of the files one run may load.
+	ReferenceDir      string `yaml:"reference_dir"`
+	MaxReferenceBytes int    `yaml:"max_reference_bytes"`
+	// EvidenceFormat selects how report_success evidence is recorded in the
+	// workspace: "markdown" (evidence.md), "json" (evidence.json), or "none".
+	EvidenceFormat string `yaml:"evidence_format"`
+	// FrameFormat selects how the FRAME reply becomes state.json: "markdown"
+	// (default, lenient parsing) or "json" (a strict structured frame, with
+	// JSON mode on providers that support it).
+	FrameFormat string       `yaml:"frame_format"`
+	Prompts     AgentPrompts `yaml:"prompts"`
+}
+
+// SysToolsConfig bounds the sys_* command tools: each command is killed after
+// Timeout, its output is truncated past MaxOutputBytes, and sys_external_ip
+// fetches ExternalIPURL.
+type SysToolsConfig struct {
+	Timeout        time.Duration `yaml:"timeout"`
+	MaxOutputBytes int           `yaml:"max_output_bytes"`
+	ExternalIPURL  string        `yaml:"external_ip_url"`
+}
+
+// FetchURLConfig bounds the fetch_url tool: only AllowedHosts may be fetched
+// ("*.example.com" matches subdomains), each request is abandoned after
+// Timeout, and the markdown returned is truncated past MaxChars. Hosts that
+// resolve to anything but a public unicast address are refused unless
+// AllowPrivateNetworks is set. Empty AllowedHosts leaves fetch_url unbound.
+type FetchURLConfig struct {
+	AllowedHosts         []string      `yaml:"allowed_hosts"`
+	Timeout              time.Duration `yaml:"timeout"`
+	MaxChars             int           `yaml:"max_chars"`
+	AllowPrivateNetworks bool          `yaml:"allow_private_networks"`
+}
+
+// ApprovalConfig binds the request_approval tool when Enabled. A paused run
+// checks for a decision every PollInterval; a request still undecided after
+// Timeout is rejected. The run keeps its worker while it waits, so Timeout
+// bounds how long it can hold up the queue.
+type ApprovalConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	Timeout      time.Duration `yaml:"timeout"`
+	PollInterval time.Duration `yaml:"poll_interval"`
 }
 
 // AgentPrompts defines stage-specific prompt templates.
+// Observe is optional; when empty the observe stage is skipped.
+// Summarize is optional; when set, a completed run makes one more call to
+// write the final summary instead of using the reflect/success summary as-is.
 type AgentPrompts struct {
-	Frame   string `yaml:"frame"`
-	Plan    string `yaml:"plan"`
-	Act     string `yaml:"act"`
-	Reflect string `yaml:"reflect"`
+	Frame     string `yaml:"frame"`
+	Plan      string `yaml:"plan"`
+	Act       string `yaml:"act"`
+	Observe   string `yaml:"observe,omitempty"`
+	Reflect   string `yaml:"reflect"`
+	Summarize string `yaml:"summarize,omitempty"`
 }
@@ -0,0 +1,145 @@
+package ductile
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by Trigger while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("ductile circuit open")
+
+// BreakerConfig configures the Trigger circuit breaker. Threshold consecutive
+// failures within Window open the circuit for Cooldown; each failed probe
+// after a cooldown doubles it, up to MaxCooldown.
+type BreakerConfig struct {
+	Threshold   int
+	Window      time.Duration
+	Cooldown    time.Duration
+	MaxCooldown time.Duration
+}
+
+type breakerState string
+
+const (
+	breakerClosed   breakerState = "closed"
+	breakerOpen     breakerState = "open"
+	breakerHalfOpen breakerState = "half_open"
+)
+
+// breaker is a consecutive-failure circuit breaker with exponential cooldown.
+type breaker struct {
+	cfg    BreakerConfig
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu           sync.Mutex
+	state        breakerState
+	failures     int
+	firstFailure time.Time
+	cooldown     time.Duration
+	openUntil    time.Time
+	probing      bool
+}
+
+func newBreaker(cfg BreakerConfig, logger *slog.Logger) *breaker {
+	if cfg.MaxCooldown < cfg.Cooldown {
+		cfg.MaxCooldown = cfg.Cooldown
+	}
+	return &breaker{cfg: cfg, logger: logger, now: time.Now, state: breakerClosed, cooldown: cfg.Cooldown}
+}
+
+// allow reports whether a request may proceed, and how long until the circuit
+// will accept a probe when it may not. Once the cooldown has elapsed a single
+// probe request is let through.
+func (b *breaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		now := b.now()
+		if now.Before(b.openUntil) {
+			return false, b.openUntil.Sub(now)
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		b.logger.Info("ductile circuit half-open, probing gateway")
+		return true, 0
+	case breakerHalfOpen:
+		if b.probing {
+			return false, 0
+		}
+		b.probing = true
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+// success records a healthy response and closes the circuit.
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != breakerClosed {
+		b.logger.Info("ductile circuit closed")
+	}
+	b.state = breakerClosed
+	b.failures = 0
+	b.probing = false
+	b.cooldown = b.cfg.Cooldown
+}
+
+// failure records a gateway failure, opening the circuit once the threshold
+// is reached within the window or when a half-open probe fails.
+func (b *breaker) failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+
+	if b.state == breakerHalfOpen {
+		b.probing = false
+		b.cooldown = min(b.cooldown*2, b.cfg.MaxCooldown)
+		b.open(now, err)
+		return
+	}
+
+	if b.failures == 0 || now.Sub(b.firstFailure) > b.cfg.Window {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+	if b.failures >= b.cfg.Threshold {
+		b.open(now, err)
+	}
+}
+
+func (b *breaker) open(now time.Time, err error) {
+	b.state = breakerOpen
+	b.openUntil = now.Add(b.cooldown)
+	b.logger.Warn("ductile circuit opened", "consecutive_failures", b.failures, "cooldown", b.cooldown, "error", err)
+}
+
+// release ends a probe without judging gateway health, e.g. when the caller's
+// context was cancelled mid-request.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.probing = false
+	}
+}
+
+// gatewayError marks Trigger failures that count against the circuit breaker:
+// transport errors and 5xx responses. 4xx responses are request problems.
+type gatewayError struct {
+	err error
+}
+
+func (e *gatewayError) Error() string { return e.err.Error() }
+func (e *gatewayError) Unwrap() error { return e.err }
+
+func isGatewayFailure(err error) bool {
+	var gwErr *gatewayError
+	return errors.As(err, &gwErr)
+}
@@ -0,0 +1,78 @@
+package ductile
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTriggerCircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/plugin/bad/run" {
+			http.Error(w, "bad payload", http.StatusBadRequest)
+			return
+		}
+		if !healthy.Load() {
+			http.Error(w, "gateway down", http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"job_id":"job-1","status":"queued"}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, "token", slog.New(slog.NewTextHandler(io.Discard, nil))).
+		WithCircuitBreaker(BreakerConfig{Threshold: 2, Window: time.Minute, Cooldown: 10 * time.Second, MaxCooldown: 15 * time.Second})
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// Client errors do not count against the gateway.
+	for range 3 {
+		if _, err := client.Trigger(ctx, "bad", "run", nil); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected plain 400 error, got %v", err)
+		}
+	}
+
+	for range 2 {
+		if _, err := client.Trigger(ctx, "echo", "run", nil); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected gateway error, got %v", err)
+		}
+	}
+	before := calls.Load()
+	if _, err := client.Trigger(ctx, "echo", "run", nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if calls.Load() != before {
+		t.Fatalf("open circuit should not reach the gateway")
+	}
+
+	// A failed probe reopens the circuit with a doubled (capped) cooldown.
+	now = now.Add(10 * time.Second)
+	if _, err := client.Trigger(ctx, "echo", "run", nil); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected probe to reach the gateway, got %v", err)
+	}
+	now = now.Add(10 * time.Second)
+	if _, err := client.Trigger(ctx, "echo", "run", nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected circuit to stay open for the longer cooldown, got %v", err)
+	}
+
+	// A successful probe closes the circuit.
+	now = now.Add(5 * time.Second)
+	healthy.Store(true)
+	if jobID, err := client.Trigger(ctx, "echo", "run", nil); err != nil || jobID != "job-1" {
+		t.Fatalf("expected probe success, got %q, %v", jobID, err)
+	}
+	if _, err := client.Trigger(ctx, "echo", "run", nil); err != nil {
+		t.Fatalf("expected closed circuit, got %v", err)
+	}
+}
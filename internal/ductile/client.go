@@ -2,15 +2,25 @@ package ductile
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// Headers carrying the completion callback signature. See SignCallback.
+const (
+	CallbackTimestampHeader = "X-AgenticLoop-Timestamp"
+	CallbackSignatureHeader = "X-AgenticLoop-Signature"
+)
+
 // TriggerResponse is the Ductile API response for POST /plugin/{plugin}/{command}.
 type TriggerResponse struct {
 	JobID   string `json:"job_id"`
@@ -36,6 +46,11 @@ type Client struct {
 	token      string
 	httpClient *http.Client
 	logger     *slog.Logger
+	breaker    *breaker
+	// callbackSecret signs completion callbacks when set.
+	callbackSecret string
+	// slots bounds in-flight gateway requests when non-nil.
+	slots chan struct{}
 }
 
 // NewClient creates a new Ductile API client.
@@ -50,8 +65,92 @@ func NewClient(baseURL, token string, logger *slog.Logger) *Client {
 	}
 }
 
+// WithTimeout sets the per-request HTTP timeout and returns the client.
+func (c *Client) WithTimeout(d time.Duration) *Client {
+	if d > 0 {
+		c.httpClient.Timeout = d
+	}
+	return c
+}
+
+// WithCircuitBreaker enables the Trigger circuit breaker and returns the
+// client. A Threshold <= 0 leaves it disabled.
+func (c *Client) WithCircuitBreaker(cfg BreakerConfig) *Client {
+	if cfg.Threshold > 0 {
+		c.breaker = newBreaker(cfg, c.logger)
+	}
+	return c
+}
+
+// WithMaxConcurrentCalls bounds how many gateway requests (triggers, job
+// polls, plugin lookups) are in flight at once across every caller of the
+// client, and returns the client. Callers beyond the limit wait for a free
+// slot or for their context to end. n <= 0 leaves calls unbounded.
+func (c *Client) WithMaxConcurrentCalls(n int) *Client {
+	if n > 0 {
+		c.slots = make(chan struct{}, n)
+	}
+	return c
+}
+
+// acquire waits for a gateway request slot. The returned func releases it.
+func (c *Client) acquire(ctx context.Context) (func(), error) {
+	if c.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case c.slots <- struct{}{}:
+		return func() { <-c.slots }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("wait for ductile call slot: %w", ctx.Err())
+	}
+}
+
+// WithCallbackSecret signs every completion callback with secret and returns
+// the client. An empty secret leaves callbacks unsigned.
+func (c *Client) WithCallbackSecret(secret string) *Client {
+	c.callbackSecret = secret
+	return c
+}
+
+// SignCallback returns the signature header value for a callback body sent
+// at timestamp (Unix seconds): "sha256=" followed by the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with secret. Receivers recompute it from the
+// timestamp header and the raw body, compare in constant time, and reject
+// stale timestamps to stop replays.
+func SignCallback(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
 // Trigger sends POST /plugin/{plugin}/{command} and returns the job ID.
+// While the circuit breaker is open it fails fast with ErrCircuitOpen.
 func (c *Client) Trigger(ctx context.Context, plugin, command string, payload json.RawMessage) (string, error) {
+	if c.breaker == nil {
+		return c.trigger(ctx, plugin, command, payload)
+	}
+	if ok, retryIn := c.breaker.allow(); !ok {
+		return "", fmt.Errorf("trigger %s/%s: %w (retry in %s)", plugin, command, ErrCircuitOpen, retryIn.Round(time.Second))
+	}
+	jobID, err := c.trigger(ctx, plugin, command, payload)
+	switch {
+	case err == nil:
+		c.breaker.success()
+	case ctx.Err() != nil:
+		// The caller gave up; that says nothing about gateway health.
+		c.breaker.release()
+	case isGatewayFailure(err):
+		c.breaker.failure(err)
+	default:
+		c.breaker.success()
+	}
+	return jobID, err
+}
+
+func (c *Client) trigger(ctx context.Context, plugin, command string, payload json.RawMessage) (string, error) {
 	url := fmt.Sprintf("%s/plugin/%s/%s", c.baseURL, plugin, command)
 
 	body := "{}"
@@ -66,15 +165,24 @@ func (c *Client) Trigger(ctx context.Context, plugin, command string, payload js
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.token)
 
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("trigger %s/%s: %w", plugin, command, err)
+		return "", &gatewayError{err: fmt.Errorf("trigger %s/%s: %w", plugin, command, err)}
 	}
 	defer resp.Body.Close()
 
 	respBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != http.StatusAccepted {
-		return "", fmt.Errorf("trigger %s/%s: status %d: %s", plugin, command, resp.StatusCode, string(respBody))
+		err := fmt.Errorf("trigger %s/%s: status %d: %s", plugin, command, resp.StatusCode, string(respBody))
+		if resp.StatusCode >= 500 {
+			return "", &gatewayError{err: err}
+		}
+		return "", err
 	}
 
 	var triggerResp TriggerResponse
@@ -131,6 +239,11 @@ func (c *Client) Callback(ctx context.Context, callbackURL string, payload map[s
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.token)
+	if c.callbackSecret != "" {
+		timestamp := time.Now().Unix()
+		req.Header.Set(CallbackTimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(CallbackSignatureHeader, SignCallback(c.callbackSecret, timestamp, body))
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -169,6 +282,11 @@ func (c *Client) GetPluginDetail(ctx context.Context, plugin string) (*PluginDet
 	}
 	req.Header.Set("Authorization", "Bearer "+c.token)
 
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("get plugin %s: %w", plugin, err)
@@ -197,6 +315,11 @@ func (c *Client) GetJob(ctx context.Context, jobID string) (*JobStatusResponse,
 	}
 	req.Header.Set("Authorization", "Bearer "+c.token)
 
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("get job %s: %w", jobID, err)
@@ -0,0 +1,113 @@
+package ductile
+
+import (
+	"context"
+	"crypto/hmac"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCallbackSignature(t *testing.T) {
+	type received struct {
+		timestamp, signature string
+		body                 []byte
+	}
+	got := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.Header.Get(CallbackTimestampHeader), r.Header.Get(CallbackSignatureHeader), body}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	payload := map[string]any{"run_id": "run-1", "status": "done"}
+
+	unsigned := NewClient(srv.URL, "token", logger)
+	if err := unsigned.Callback(context.Background(), srv.URL, payload); err != nil {
+		t.Fatalf("unsigned callback: %v", err)
+	}
+	if r := <-got; r.timestamp != "" || r.signature != "" {
+		t.Fatalf("unsigned callback carried signature headers %q, %q", r.timestamp, r.signature)
+	}
+
+	signed := NewClient(srv.URL, "token", logger).WithCallbackSecret("s3cret")
+	if err := signed.Callback(context.Background(), srv.URL, payload); err != nil {
+		t.Fatalf("signed callback: %v", err)
+	}
+	r := <-got
+	timestamp, err := strconv.ParseInt(r.timestamp, 10, 64)
+	if err != nil {
+		t.Fatalf("timestamp header %q: %v", r.timestamp, err)
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age < -time.Minute || age > time.Minute {
+		t.Fatalf("timestamp is %s old, want about now", age)
+	}
+	if want := SignCallback("s3cret", timestamp, r.body); !hmac.Equal([]byte(r.signature), []byte(want)) {
+		t.Fatalf("signature = %q, want %q", r.signature, want)
+	}
+	if SignCallback("other", timestamp, r.body) == r.signature {
+		t.Fatal("signature does not depend on the secret")
+	}
+	if SignCallback("s3cret", timestamp+1, r.body) == r.signature {
+		t.Fatal("signature does not cover the timestamp")
+	}
+}
+
+func TestMaxConcurrentCallsBoundsGatewayRequests(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"job_id":"job-1","status":"queued"}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, "token", slog.New(slog.NewTextHandler(io.Discard, nil))).WithMaxConcurrentCalls(2)
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Trigger(context.Background(), "echo", "poll", nil); err != nil {
+				t.Errorf("trigger: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := peak.Load(); got != 2 {
+		t.Fatalf("peak in-flight requests = %d, want 2", got)
+	}
+
+	// A caller waiting for a slot gives up with its context.
+	release, err := client.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	defer release()
+	release2, err := client.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	defer release2()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.Trigger(ctx, "echo", "poll", nil); err == nil || !strings.Contains(err.Error(), "wait for ductile call slot") {
+		t.Fatalf("trigger with no free slot = %v, want slot wait error", err)
+	}
+}
@@ -0,0 +1,65 @@
+package ductile
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// resultPathPattern matches a result selector: "$" followed by ".key" and
+// "[index]" segments, e.g. "$.data.items[0].value".
+var resultPathPattern = regexp.MustCompile(`^\$(\.[^.\[\]]+|\[\d+\])*$`)
+
+// resultPathSegment matches one segment of a valid result selector.
+var resultPathSegment = regexp.MustCompile(`\.[^.\[\]]+|\[\d+\]`)
+
+// ParseAllowlistEntry splits an allowlist entry of the form "plugin/command"
+// or "plugin/command:$.json.path" into its plugin, command, and optional
+// result selector.
+func ParseAllowlistEntry(entry string) (plugin, command, selector string, err error) {
+	name, selector, _ := strings.Cut(strings.TrimSpace(entry), ":")
+	plugin, command, ok := strings.Cut(name, "/")
+	if !ok || plugin == "" || command == "" {
+		return "", "", "", fmt.Errorf("allowlist entry %q: want plugin/command", entry)
+	}
+	if selector != "" && !resultPathPattern.MatchString(selector) {
+		return "", "", "", fmt.Errorf("allowlist entry %q: result selector must look like $.field.list[0]", entry)
+	}
+	return plugin, command, selector, nil
+}
+
+// selectResult returns the value at selector in a job result. Numeric keys
+// also index arrays, so "$.items.0" and "$.items[0]" are the same.
+func selectResult(result json.RawMessage, selector string) (any, error) {
+	var current any
+	if err := json.Unmarshal(result, &current); err != nil {
+		return nil, fmt.Errorf("result is not JSON: %w", err)
+	}
+	walked := "$"
+	for _, segment := range resultPathSegment.FindAllString(selector, -1) {
+		key := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(segment, "."), "["), "]")
+		switch node := current.(type) {
+		case map[string]any:
+			next, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("no %q at %s", key, walked)
+			}
+			current = next
+		case []any:
+			idx, err := strconv.Atoi(key)
+			if err != nil {
+				return nil, fmt.Errorf("%s is an array; %q is not an index", walked, key)
+			}
+			if idx < 0 || idx >= len(node) {
+				return nil, fmt.Errorf("index %d out of range at %s (length %d)", idx, walked, len(node))
+			}
+			current = node[idx]
+		default:
+			return nil, fmt.Errorf("cannot descend into %s", walked)
+		}
+		walked += segment
+	}
+	return current, nil
+}
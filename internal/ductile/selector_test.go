@@ -0,0 +1,115 @@
+package ductile
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseAllowlistEntry(t *testing.T) {
+	tests := []struct {
+		entry                     string
+		plugin, command, selector string
+		wantErr                   bool
+	}{
+		{entry: "echo/poll", plugin: "echo", command: "poll"},
+		{entry: "echo/poll:$.data.value", plugin: "echo", command: "poll", selector: "$.data.value"},
+		{entry: "jina-reader/handle:$.pages[0].text", plugin: "jina-reader", command: "handle", selector: "$.pages[0].text"},
+		{entry: "echo/poll:$", plugin: "echo", command: "poll", selector: "$"},
+		{entry: "echo", wantErr: true},
+		{entry: "/poll", wantErr: true},
+		{entry: "echo/poll:data.value", wantErr: true},
+		{entry: "echo/poll:$.data..value", wantErr: true},
+		{entry: "echo/poll:$.items[x]", wantErr: true},
+	}
+	for _, tt := range tests {
+		plugin, command, selector, err := ParseAllowlistEntry(tt.entry)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.entry)
+			}
+			continue
+		}
+		if err != nil || plugin != tt.plugin || command != tt.command || selector != tt.selector {
+			t.Errorf("%q = (%q, %q, %q, %v), want (%q, %q, %q)", tt.entry, plugin, command, selector, err, tt.plugin, tt.command, tt.selector)
+		}
+	}
+}
+
+// buildTool returns the tool BuildTools makes for a single allowlist entry.
+func buildTool(t *testing.T, client *Client, entry string) *DuctileTool {
+	t.Helper()
+	tools, err := BuildTools(client, []string{entry}, nil)
+	if err != nil {
+		t.Fatalf("BuildTools(%q): %v", entry, err)
+	}
+	return tools[0].(*DuctileTool)
+}
+
+func TestBuildToolsRejectsMalformedEntries(t *testing.T) {
+	tools, err := BuildTools(nil, []string{"alpha/one", "beta"}, nil)
+	if err == nil || !strings.Contains(err.Error(), `"beta"`) || tools != nil {
+		t.Fatalf("BuildTools() = %v, %v; want an error naming the malformed entry", tools, err)
+	}
+}
+
+func TestDuctileToolSelectsResultPath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/plugin/alpha/one":
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = io.WriteString(w, `{"job_id":"job-1"}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/job/job-1":
+			_, _ = io.WriteString(w, `{"job_id":"job-1","status":"succeeded","result":{"data":{"items":[{"value":"kept"},{"value":"other"}],"debug":"verbose trace"}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "token", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for _, tt := range []struct {
+		entry, want string
+	}{
+		{"alpha/one:$.data.items[0].value", `"kept"`},
+		{"alpha/one:$.data.items.1", `{"value":"other"}`},
+	} {
+		var logged string
+		dt := buildTool(t, client, tt.entry).
+			WithObserver(func(_, _, output, _ string) { logged = output })
+
+		out, err := dt.InvokableRun(context.Background(), `{}`)
+		if err != nil {
+			t.Fatalf("%s: invokable run: %v", tt.entry, err)
+		}
+		var resp struct {
+			Status     string          `json:"status"`
+			Result     json.RawMessage `json:"result"`
+			ResultPath string          `json:"result_path"`
+		}
+		if err := json.Unmarshal([]byte(out), &resp); err != nil {
+			t.Fatalf("%s: decode output: %v", tt.entry, err)
+		}
+		if resp.Status != "succeeded" || string(resp.Result) != tt.want || resp.ResultPath == "" {
+			t.Fatalf("%s: output = %s, want result %s", tt.entry, out, tt.want)
+		}
+		if strings.Contains(out, "verbose trace") || !strings.Contains(logged, "verbose trace") {
+			t.Fatalf("%s: model output %s, logged %s; want the full result only in the log", tt.entry, out, logged)
+		}
+	}
+
+	dt := buildTool(t, client, "alpha/one:$.data.missing")
+	out, err := dt.InvokableRun(context.Background(), `{}`)
+	if err != nil {
+		t.Fatalf("invokable run: %v", err)
+	}
+	if !strings.Contains(out, `"result_path_error":"no \"missing\" at $.data"`) || !strings.Contains(out, "verbose trace") {
+		t.Fatalf("missed selector output = %s, want the error and the full result", out)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/cloudwego/eino/components/tool"
@@ -20,6 +19,15 @@ type DuctileTool struct {
 	plugin   string
 	command  string
 	observer ToolCallObserver
+
+	// inputSchema is cached from discovery in Info so InvokableRun can
+	// validate arguments without a second round-trip.
+	inputSchema map[string]any
+
+	// selector, when set, narrows a succeeded job's result to the value at
+	// this JSON path before it is returned to the model. The observer still
+	// receives the full result.
+	selector string
 }
 
 var _ tool.InvokableTool = (*DuctileTool)(nil)
@@ -40,6 +48,7 @@ func (t *DuctileTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
 			if desc == "" {
 				desc = fmt.Sprintf("Execute Ductile plugin '%s' command '%s'.", t.plugin, t.command)
 			}
+			t.inputSchema = cmd.InputSchema
 			params := jsonSchemaToParams(cmd.InputSchema)
 			if params != nil {
 				return &schema.ToolInfo{
@@ -165,6 +174,20 @@ func (t *DuctileTool) InvokableRun(ctx context.Context, argumentsInJSON string,
 		}
 	}
 
+	if missing, invalid := validateArguments(t.inputSchema, rawPayload); len(missing) > 0 || len(invalid) > 0 {
+		outBytes, _ := json.Marshal(map[string]any{
+			"status":         "invalid_arguments",
+			"error":          "arguments do not match the tool input schema; fix the listed fields and retry",
+			"missing_fields": missing,
+			"invalid_fields": invalid,
+		})
+		out := string(outBytes)
+		if t.observer != nil {
+			t.observer(fmt.Sprintf("%s/%s", t.plugin, t.command), argumentsInJSON, out, "invalid_arguments")
+		}
+		return out, nil
+	}
+
 	jobID, err := t.client.Trigger(ctx, t.plugin, t.command, rawPayload)
 	if err != nil {
 		return "", fmt.Errorf("trigger %s/%s: %w", t.plugin, t.command, err)
@@ -175,9 +198,10 @@ func (t *DuctileTool) InvokableRun(ctx context.Context, argumentsInJSON string,
 		return "", fmt.Errorf("poll job %s: %w", jobID, err)
 	}
 
-	var out string
+	var out, full string
 	if result.Status != "succeeded" {
 		out = fmt.Sprintf(`{"status":"%s","job_id":"%s","error":"job did not succeed"}`, result.Status, jobID)
+		full = out
 	} else {
 		outBytes, _ := json.Marshal(map[string]any{
 			"status": result.Status,
@@ -185,42 +209,70 @@ func (t *DuctileTool) InvokableRun(ctx context.Context, argumentsInJSON string,
 			"result": result.Result,
 		})
 		out = string(outBytes)
+		full = out
+		if t.selector != "" {
+			out = t.selectedOutput(result.Status, jobID, result.Result)
+		}
 	}
 
 	if t.observer != nil {
 		toolName := fmt.Sprintf("%s/%s", t.plugin, t.command)
-		t.observer(toolName, argumentsInJSON, out, result.Status)
+		t.observer(toolName, argumentsInJSON, full, result.Status)
 	}
 
 	return out, nil
 }
 
+// selectedOutput returns the tool output with the result narrowed to the
+// entry's selector. When the selector finds nothing the full result is kept
+// and the miss is reported, so the model is never left without data.
+func (t *DuctileTool) selectedOutput(status, jobID string, result json.RawMessage) string {
+	out := map[string]any{
+		"status":      status,
+		"job_id":      jobID,
+		"result_path": t.selector,
+	}
+	if selected, err := selectResult(result, t.selector); err != nil {
+		out["result"] = result
+		out["result_path_error"] = err.Error()
+	} else {
+		out["result"] = selected
+	}
+	outBytes, _ := json.Marshal(out)
+	return string(outBytes)
+}
+
 // WithObserver returns a copy of the tool with the given observer attached.
 func (t *DuctileTool) WithObserver(obs ToolCallObserver) *DuctileTool {
 	return &DuctileTool{
-		client:   t.client,
-		plugin:   t.plugin,
-		command:  t.command,
-		observer: obs,
+		client:      t.client,
+		plugin:      t.plugin,
+		command:     t.command,
+		observer:    obs,
+		inputSchema: t.inputSchema,
+		selector:    t.selector,
 	}
 }
 
 // BuildTools creates Eino tools from the Ductile allowlist.
-// Each entry is "plugin/command" (e.g. "echo/poll").
+// Each entry is "plugin/command" (e.g. "echo/poll"), optionally followed by
+// a result selector (e.g. "echo/poll:$.data.value"); see ParseAllowlistEntry.
+// A malformed entry is an error rather than a silently missing tool.
 // If observer is non-nil, it is called after each tool invocation.
-func BuildTools(client *Client, allowlist []string, observer ToolCallObserver) []tool.BaseTool {
+func BuildTools(client *Client, allowlist []string, observer ToolCallObserver) ([]tool.BaseTool, error) {
 	var tools []tool.BaseTool
 	for _, entry := range allowlist {
-		parts := strings.SplitN(entry, "/", 2)
-		if len(parts) != 2 {
-			continue
+		plugin, command, selector, err := ParseAllowlistEntry(entry)
+		if err != nil {
+			return nil, err
 		}
 		tools = append(tools, &DuctileTool{
 			client:   client,
-			plugin:   parts[0],
-			command:  parts[1],
+			plugin:   plugin,
+			command:  command,
 			observer: observer,
+			selector: selector,
 		})
 	}
-	return tools
+	return tools, nil
 }
@@ -0,0 +1,128 @@
+package ductile
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// ArgumentError describes a single field that failed input_schema validation.
+type ArgumentError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// validateArguments checks payload against a plugin command's JSON Schema.
+// Only required fields and declared property types are enforced; unknown
+// properties are allowed. It returns the missing required fields and the
+// fields whose values do not match their declared type.
+func validateArguments(s map[string]any, payload json.RawMessage) (missing []string, invalid []ArgumentError) {
+	if s == nil {
+		return nil, nil
+	}
+	var value any = map[string]any{}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &value); err != nil {
+			return nil, []ArgumentError{{Field: "$", Reason: fmt.Sprintf("invalid JSON: %v", err)}}
+		}
+	}
+	obj, ok := value.(map[string]any)
+	if !ok {
+		return nil, []ArgumentError{{Field: "$", Reason: "expected object, got " + jsonTypeName(value)}}
+	}
+	validateObject(s, obj, "", &missing, &invalid)
+	sort.Strings(missing)
+	sort.Slice(invalid, func(i, j int) bool { return invalid[i].Field < invalid[j].Field })
+	return missing, invalid
+}
+
+func validateObject(s map[string]any, obj map[string]any, prefix string, missing *[]string, invalid *[]ArgumentError) {
+	for field := range schemaRequiredSet(s) {
+		if _, ok := obj[field]; !ok {
+			*missing = append(*missing, prefix+field)
+		}
+	}
+	props, _ := s["properties"].(map[string]any)
+	for field, v := range obj {
+		prop, ok := props[field].(map[string]any)
+		if !ok {
+			continue
+		}
+		validateValue(prop, v, prefix+field, missing, invalid)
+	}
+}
+
+func validateValue(prop map[string]any, v any, path string, missing *[]string, invalid *[]ArgumentError) {
+	want, _ := prop["type"].(string)
+	if want == "" {
+		return
+	}
+	if !jsonTypeMatches(want, v) {
+		*invalid = append(*invalid, ArgumentError{
+			Field:  path,
+			Reason: fmt.Sprintf("expected %s, got %s", want, jsonTypeName(v)),
+		})
+		return
+	}
+	switch want {
+	case "object":
+		validateObject(prop, v.(map[string]any), path+".", missing, invalid)
+	case "array":
+		items, ok := prop["items"].(map[string]any)
+		if !ok {
+			return
+		}
+		for i, elem := range v.([]any) {
+			validateValue(items, elem, fmt.Sprintf("%s[%d]", path, i), missing, invalid)
+		}
+	}
+}
+
+func jsonTypeMatches(want string, v any) bool {
+	switch want {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == float64(int64(f))
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "null":
+		return v == nil
+	default:
+		return true
+	}
+}
+
+func jsonTypeName(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if t == float64(int64(t)) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
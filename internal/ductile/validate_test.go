@@ -0,0 +1,116 @@
+package ductile
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestValidateArguments(t *testing.T) {
+	s := map[string]any{
+		"type":     "object",
+		"required": []any{"url", "options"},
+		"properties": map[string]any{
+			"url":   map[string]any{"type": "string"},
+			"limit": map[string]any{"type": "integer"},
+			"tags":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"options": map[string]any{
+				"type":     "object",
+				"required": []any{"mode"},
+				"properties": map[string]any{
+					"mode": map[string]any{"type": "string"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		payload     string
+		wantMissing []string
+		wantInvalid []string
+	}{
+		{"valid", `{"url":"https://x","options":{"mode":"fast"},"limit":3,"tags":["a"]}`, nil, nil},
+		{"unknown fields allowed", `{"url":"https://x","options":{"mode":"fast"},"extra":true}`, nil, nil},
+		{"missing top-level", `{"options":{"mode":"fast"}}`, []string{"url"}, nil},
+		{"missing nested", `{"url":"https://x","options":{}}`, []string{"options.mode"}, nil},
+		{"wrong type", `{"url":5,"options":{"mode":"fast"}}`, nil, []string{"url"}},
+		{"non-integer", `{"url":"u","options":{"mode":"fast"},"limit":1.5}`, nil, []string{"limit"}},
+		{"array element", `{"url":"u","options":{"mode":"fast"},"tags":["a",2]}`, nil, []string{"tags[1]"}},
+		{"empty payload", ``, []string{"options", "url"}, nil},
+		{"not an object", `[1,2]`, nil, []string{"$"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing, invalid := validateArguments(s, json.RawMessage(tt.payload))
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Fatalf("missing = %v, want %v", missing, tt.wantMissing)
+			}
+			var fields []string
+			for _, e := range invalid {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantInvalid) {
+				t.Fatalf("invalid = %v, want %v", invalid, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestDuctileToolRejectsInvalidArgumentsBeforeTrigger(t *testing.T) {
+	var triggers, discoveries int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/plugin/alpha":
+			discoveries++
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"name":"alpha","commands":[{"name":"one","input_schema":{"type":"object","required":["url"],"properties":{"url":{"type":"string"}}}}]}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/plugin/alpha/one":
+			triggers++
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = io.WriteString(w, `{"job_id":"job-1"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "token", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	dt := buildTool(t, client, "alpha/one")
+
+	if _, err := dt.Info(context.Background()); err != nil {
+		t.Fatalf("info: %v", err)
+	}
+	wrapped := dt.WithObserver(func(_, _, _, _ string) {})
+
+	out, err := wrapped.InvokableRun(context.Background(), `{"url":42}`)
+	if err != nil {
+		t.Fatalf("invokable run: %v", err)
+	}
+	if triggers != 0 {
+		t.Fatalf("expected no trigger for invalid arguments, got %d", triggers)
+	}
+	if discoveries != 1 {
+		t.Fatalf("expected schema to be cached after Info, got %d discovery calls", discoveries)
+	}
+
+	var resp struct {
+		Status        string          `json:"status"`
+		MissingFields []string        `json:"missing_fields"`
+		InvalidFields []ArgumentError `json:"invalid_fields"`
+	}
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+	if resp.Status != "invalid_arguments" {
+		t.Fatalf("status = %q, want invalid_arguments", resp.Status)
+	}
+	if len(resp.InvalidFields) != 1 || resp.InvalidFields[0].Field != "url" {
+		t.Fatalf("unexpected invalid fields: %+v", resp.InvalidFields)
+	}
+}
@@ -0,0 +1,77 @@
+package localtools
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SniffMaxBytes is the largest file DetectContentType opens; bigger files
+// are typed from their extension alone.
+const SniffMaxBytes = 64 << 10
+
+// Content categories reported alongside workspace listings.
+const (
+	CategoryText   = "text"
+	CategoryJSON   = "json"
+	CategoryImage  = "image"
+	CategoryBinary = "binary"
+)
+
+// DetectContentType returns the MIME type and category of the file at path.
+// Files up to SniffMaxBytes are sniffed from their first 512 bytes; larger
+// files, and files that cannot be read, fall back to the extension.
+func DetectContentType(path string, size int64) (contentType, category string) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if size <= SniffMaxBytes {
+		if head, err := readHead(path); err == nil {
+			contentType = http.DetectContentType(head)
+			if strings.HasPrefix(contentType, "text/plain") && (ext == ".json" || looksLikeJSON(head)) {
+				contentType = "application/json"
+			}
+			return contentType, contentCategory(contentType)
+		}
+	}
+	contentType = mime.TypeByExtension(ext)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return contentType, contentCategory(contentType)
+}
+
+func readHead(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func looksLikeJSON(head []byte) bool {
+	trimmed := strings.TrimSpace(string(head))
+	return strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")
+}
+
+func contentCategory(contentType string) string {
+	base, _, _ := strings.Cut(contentType, ";")
+	base = strings.TrimSpace(base)
+	switch {
+	case base == "application/json" || strings.HasSuffix(base, "+json"):
+		return CategoryJSON
+	case strings.HasPrefix(base, "image/"):
+		return CategoryImage
+	case strings.HasPrefix(base, "text/"), base == "application/xml", base == "application/javascript", base == "application/x-yaml":
+		return CategoryText
+	default:
+		return CategoryBinary
+	}
+}
@@ -0,0 +1,40 @@
+package localtools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectContentType(t *testing.T) {
+	dir := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	files := map[string][]byte{
+		"notes.md":   []byte("# Notes\nsome text\n"),
+		"data.json":  []byte(`{"ok": true}`),
+		"noext":      []byte(`[1, 2, 3]`),
+		"pic.bin":    png,
+		"blob.dat":   {0x00, 0x01, 0x02, 0xff},
+		"large.json": make([]byte, SniffMaxBytes+1),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	want := map[string]string{
+		"notes.md":   CategoryText,
+		"data.json":  CategoryJSON,
+		"noext":      CategoryJSON,
+		"pic.bin":    CategoryImage,
+		"blob.dat":   CategoryBinary,
+		"large.json": CategoryJSON, // too big to sniff; typed by extension
+	}
+	for name, category := range want {
+		contentType, got := DetectContentType(filepath.Join(dir, name), int64(len(files[name])))
+		if got != category {
+			t.Errorf("%s: category = %q (%s), want %q", name, got, contentType, category)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package localtools
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// SeedContinuation copies the parent workspace srcDir into dstDir for a
+// follow-up run, leaving behind the regular files for which skip reports
+// true (slash-separated paths relative to srcDir). srcDir must exist.
+func SeedContinuation(srcDir, dstDir string, skip func(rel string) bool) error {
+	if _, err := os.Stat(srcDir); err != nil {
+		return fmt.Errorf("parent workspace: %w", err)
+	}
+	if err := os.MkdirAll(dstDir, 0o755); err != nil {
+		return fmt.Errorf("create continuation workspace: %w", err)
+	}
+	return filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		slashRel := filepath.ToSlash(rel)
+		if d.IsDir() {
+			if slashRel == "." {
+				return nil
+			}
+			return os.MkdirAll(filepath.Join(dstDir, rel), 0o755)
+		}
+		if !d.Type().IsRegular() || (skip != nil && skip(slashRel)) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", slashRel, err)
+		}
+		if err := atomicWriteFile(filepath.Join(dstDir, rel), data, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("seed %s: %w", slashRel, err)
+		}
+		return nil
+	})
+}
+
+// CopyFiles copies the named files from srcDir into dstDir, creating dstDir.
+// Names missing from srcDir are skipped.
+func CopyFiles(srcDir, dstDir string, names ...string) error {
+	if err := os.MkdirAll(dstDir, 0o755); err != nil {
+		return fmt.Errorf("create %s: %w", dstDir, err)
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(srcDir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", name, err)
+		}
+		if err := atomicWriteFile(filepath.Join(dstDir, name), data, 0o644); err != nil {
+			return fmt.Errorf("seed %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,528 @@
+package localtools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Defaults applied by BuildFetchURLTool when FetchURLConfig fields are zero.
+const (
+	DefaultFetchURLTimeout  = 30 * time.Second
+	DefaultFetchURLMaxChars = 20000
+)
+
+// maxFetchBytes caps how much of a response body fetch_url reads before
+// converting it.
+const maxFetchBytes = 4 << 20
+
+// FetchURLConfig bounds the fetch_url tool.
+type FetchURLConfig struct {
+	// AllowedHosts lists the hosts that may be fetched. An entry matches
+	// that host exactly; a "*.example.com" entry matches its subdomains.
+	AllowedHosts []string
+	// Timeout bounds the whole request, including redirects.
+	Timeout time.Duration
+	// MaxChars caps the returned content.
+	MaxChars int
+	// AllowPrivateNetworks permits connections to non-public addresses such
+	// as loopback, private, and link-local ones. Otherwise an allowed host
+	// name that resolves to one is refused.
+	AllowPrivateNetworks bool
+}
+
+// FetchURLTool GETs an allowlisted URL and returns its content as markdown.
+type FetchURLTool struct {
+	allowedHosts []string
+	maxChars     int
+	client       *http.Client
+	observer     Observer
+}
+
+var _ tool.InvokableTool = (*FetchURLTool)(nil)
+
+// BuildFetchURLTool returns fetch_url for cfg. Redirects are followed only
+// to allowed hosts.
+func BuildFetchURLTool(cfg FetchURLConfig) *FetchURLTool {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultFetchURLTimeout
+	}
+	if cfg.MaxChars <= 0 {
+		cfg.MaxChars = DefaultFetchURLMaxChars
+	}
+	t := &FetchURLTool{maxChars: cfg.MaxChars}
+	for _, host := range cfg.AllowedHosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			t.allowedHosts = append(t.allowedHosts, host)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !cfg.AllowPrivateNetworks {
+		// The address is checked after DNS resolution, so a public name
+		// pointing at an internal service is refused too. A proxy would
+		// resolve the host itself, so none is used.
+		dialer := &net.Dialer{Timeout: cfg.Timeout, Control: checkDialAddress}
+		transport.DialContext = dialer.DialContext
+		transport.Proxy = nil
+	}
+	t.client = &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return t.check(req.URL)
+		},
+	}
+	return t
+}
+
+// WithObserver returns a copy of the tool with the given observer attached.
+func (t *FetchURLTool) WithObserver(obs Observer) *FetchURLTool {
+	cp := *t
+	cp.observer = obs
+	return &cp
+}
+
+// Info returns tool metadata for model planning.
+func (t *FetchURLTool) Info(_ context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{
+		Name: "fetch_url",
+		Desc: fmt.Sprintf("Fetch a web page with HTTP GET and return its readable content as markdown, truncated to %d characters. Allowed hosts: %s.", t.maxChars, strings.Join(t.allowedHosts, ", ")),
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"url": {Type: schema.String, Desc: "Absolute http or https URL to fetch", Required: true},
+		}),
+	}, nil
+}
+
+// InvokableRun fetches the URL. A rejected URL, failed request, or error
+// status is reported as a status "error" result.
+func (t *FetchURLTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	resp, err := t.run(ctx, json.RawMessage(argumentsInJSON))
+	status := "ok"
+	if err != nil {
+		status = "error"
+		if resp == nil {
+			resp = map[string]any{}
+		}
+		resp["error"] = err.Error()
+	}
+	resp["status"] = status
+
+	out, marshalErr := json.Marshal(resp)
+	if marshalErr != nil {
+		return "", fmt.Errorf("marshal tool output: %w", marshalErr)
+	}
+	if t.observer != nil {
+		t.observer("fetch_url", argumentsInJSON, string(out), status)
+	}
+	return string(out), nil
+}
+
+func (t *FetchURLTool) run(ctx context.Context, raw json.RawMessage) (map[string]any, error) {
+	var args struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("parse arguments: %w", err)
+	}
+	target, err := url.Parse(strings.TrimSpace(args.URL))
+	if err != nil {
+		return nil, fmt.Errorf("parse url: %w", err)
+	}
+	if err := t.check(target); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/html, text/plain;q=0.9, */*;q=0.5")
+	req.Header.Set("User-Agent", "AgenticLoop-fetch_url")
+	httpResp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	resp := map[string]any{
+		"url":         httpResp.Request.URL.String(),
+		"status_code": httpResp.StatusCode,
+	}
+	if httpResp.StatusCode >= 400 {
+		return resp, fmt.Errorf("GET %s returned %s", httpResp.Request.URL, httpResp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, maxFetchBytes))
+	if err != nil {
+		return resp, fmt.Errorf("read response: %w", err)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(httpResp.Header.Get("Content-Type"))
+	var content string
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		title, md, err := htmlToMarkdown(string(body), httpResp.Request.URL)
+		if err != nil {
+			return resp, err
+		}
+		if title != "" {
+			resp["title"] = title
+		}
+		content = md
+	case strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || mediaType == "":
+		content = string(body)
+	default:
+		return resp, fmt.Errorf("unsupported content type %q", mediaType)
+	}
+
+	if runes := []rune(content); len(runes) > t.maxChars {
+		content = string(runes[:t.maxChars])
+		resp["truncated"] = true
+		resp["total_chars"] = len(runes)
+	}
+	resp["content"] = content
+	return resp, nil
+}
+
+// check rejects URLs that are not http(s) or whose host is not allowed.
+func (t *FetchURLTool) check(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url %q must be an absolute http or https URL", u.String())
+	}
+	host := strings.ToLower(u.Hostname())
+	if !slices.ContainsFunc(t.allowedHosts, func(allowed string) bool {
+		if domain, ok := strings.CutPrefix(allowed, "*."); ok {
+			return strings.HasSuffix(host, "."+domain)
+		}
+		return host == allowed
+	}) {
+		return fmt.Errorf("host %q is not in agent.fetch_url.allowed_hosts", host)
+	}
+	return nil
+}
+
+// nonPublicPrefixes are global unicast ranges that are not publicly routed
+// and often reach internal services: "this network", carrier-grade NAT, IETF
+// protocol assignments, benchmarking, and the reserved class E range.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// checkDialAddress allows connections only to public unicast addresses:
+// loopback, private, link-local, multicast, unspecified, and the
+// nonPublicPrefixes ranges are refused. It runs as a net.Dialer Control
+// function, after the host name has been resolved.
+func checkDialAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || slices.ContainsFunc(nonPublicPrefixes, func(p netip.Prefix) bool { return p.Contains(addr) }) {
+		return fmt.Errorf("address %s is not a public unicast address; set agent.fetch_url.allow_private_networks to fetch it", addr)
+	}
+	return nil
+}
+
+// skippedElements are dropped with their content when rendering markdown.
+var skippedElements = []atom.Atom{
+	atom.Head, atom.Script, atom.Style, atom.Noscript, atom.Template,
+	atom.Svg, atom.Iframe, atom.Form, atom.Button, atom.Select,
+}
+
+// blockElements are rendered as their content separated by blank lines.
+var blockElements = []atom.Atom{
+	atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Header,
+	atom.Footer, atom.Nav, atom.Aside, atom.Figure, atom.Figcaption,
+	atom.Dl, atom.Dt, atom.Dd, atom.Address, atom.Details, atom.Summary,
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// htmlToMarkdown renders an HTML document as markdown, keeping headings,
+// paragraphs, lists, links, emphasis, code, quotes, and tables, and dropping
+// scripts, styles, and forms. Relative links are resolved against base. It
+// also returns the document title.
+func htmlToMarkdown(doc string, base *url.URL) (string, string, error) {
+	root, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		return "", "", fmt.Errorf("parse html: %w", err)
+	}
+	c := markdownConverter{base: base}
+	var title string
+	if n := findElement(root, atom.Title); n != nil {
+		title = collapseSpace(textContent(n))
+	}
+	return title, cleanMarkdown(c.children(root)), nil
+}
+
+type markdownConverter struct {
+	base *url.URL
+}
+
+func (c markdownConverter) children(n *html.Node) string {
+	var b strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		c.node(&b, ch)
+	}
+	return b.String()
+}
+
+func (c markdownConverter) node(b *strings.Builder, n *html.Node) {
+	if n.Type == html.TextNode {
+		text := collapseSpace(n.Data)
+		if s := b.String(); s == "" || strings.HasSuffix(s, "\n") || strings.HasSuffix(s, " ") {
+			text = strings.TrimLeft(text, " ")
+		}
+		b.WriteString(text)
+		return
+	}
+	if n.Type != html.ElementNode {
+		b.WriteString(c.children(n))
+		return
+	}
+
+	switch a := n.DataAtom; {
+	case slices.Contains(skippedElements, a):
+	case slices.Contains(blockElements, a):
+		writeBlock(b, c.children(n))
+	case a == atom.H1 || a == atom.H2 || a == atom.H3 || a == atom.H4 || a == atom.H5 || a == atom.H6:
+		if text := inline(c.children(n)); text != "" {
+			writeBlock(b, strings.Repeat("#", int(n.Data[1]-'0'))+" "+text)
+		}
+	case a == atom.Br:
+		b.WriteString("\n")
+	case a == atom.Hr:
+		writeBlock(b, "---")
+	case a == atom.Pre:
+		writeBlock(b, "```\n"+strings.Trim(textContent(n), "\n")+"\n```")
+	case a == atom.Code:
+		if text := collapseSpace(textContent(n)); strings.TrimSpace(text) != "" {
+			b.WriteString("`" + text + "`")
+		}
+	case a == atom.Strong || a == atom.B:
+		writeWrapped(b, "**", c.children(n))
+	case a == atom.Em || a == atom.I:
+		writeWrapped(b, "*", c.children(n))
+	case a == atom.A:
+		text := inline(c.children(n))
+		if href := c.link(attr(n, "href")); href != "" && text != "" {
+			text = "[" + text + "](" + href + ")"
+		}
+		b.WriteString(text)
+	case a == atom.Img:
+		if alt, src := inline(attr(n, "alt")), c.link(attr(n, "src")); alt != "" && src != "" {
+			b.WriteString("![" + alt + "](" + src + ")")
+		}
+	case a == atom.Ul || a == atom.Ol:
+		writeBlock(b, c.list(n))
+	case a == atom.Blockquote:
+		lines := strings.Split(cleanMarkdown(c.children(n)), "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		writeBlock(b, strings.Join(lines, "\n"))
+	case a == atom.Table:
+		writeBlock(b, c.table(n))
+	default:
+		b.WriteString(c.children(n))
+	}
+}
+
+// list renders ul or ol items one per line, indenting nested content under
+// its item.
+func (c markdownConverter) list(n *html.Node) string {
+	var items []string
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.DataAtom != atom.Li {
+			continue
+		}
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", len(items)+1)
+		}
+		var lines []string
+		for _, line := range strings.Split(cleanMarkdown(c.children(li)), "\n") {
+			if line == "" {
+				continue
+			}
+			if len(lines) == 0 {
+				lines = append(lines, marker+line)
+			} else {
+				lines = append(lines, strings.Repeat(" ", len(marker))+line)
+			}
+		}
+		if len(lines) > 0 {
+			items = append(items, strings.Join(lines, "\n"))
+		}
+	}
+	return strings.Join(items, "\n")
+}
+
+// table renders rows as a pipe table, treating the first row as the header.
+func (c markdownConverter) table(n *html.Node) string {
+	var rows []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			if ch.DataAtom != atom.Tr {
+				walk(ch)
+				continue
+			}
+			var cells []string
+			for cell := ch.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+					cells = append(cells, strings.ReplaceAll(inline(c.children(cell)), "|", `\|`))
+				}
+			}
+			if len(cells) == 0 {
+				continue
+			}
+			rows = append(rows, "| "+strings.Join(cells, " | ")+" |")
+			if len(rows) == 1 {
+				rows = append(rows, "|"+strings.Repeat(" --- |", len(cells)))
+			}
+		}
+	}
+	walk(n)
+	return strings.Join(rows, "\n")
+}
+
+// link resolves href against the page URL, keeping only http(s) targets.
+func (c markdownConverter) link(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" {
+		return ""
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if c.base != nil {
+		u = c.base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
+
+// writeBlock writes s as its own paragraph.
+func writeBlock(b *strings.Builder, s string) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return
+	}
+	b.WriteString("\n\n" + s + "\n\n")
+}
+
+// writeWrapped writes s between markers, keeping surrounding spaces outside.
+func writeWrapped(b *strings.Builder, marker, s string) {
+	text := strings.TrimSpace(s)
+	if text == "" {
+		b.WriteString(s)
+		return
+	}
+	if strings.HasPrefix(s, " ") {
+		b.WriteString(" ")
+	}
+	b.WriteString(marker + text + marker)
+	if strings.HasSuffix(s, " ") {
+		b.WriteString(" ")
+	}
+}
+
+// cleanMarkdown trims trailing spaces from each line and collapses runs of
+// blank lines.
+func cleanMarkdown(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// collapseSpace replaces each run of whitespace with one space.
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// inline flattens s to a single trimmed line.
+func inline(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		b.WriteString(textContent(ch))
+	}
+	return b.String()
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if found := findElement(ch, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package localtools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchURLReturnsMarkdown(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(`<html><head><title>Guide</title><style>p{}</style></head><body>
+<h1>Install</h1><p>Run the <b>installer</b> and see <a href="/docs">the docs</a>.</p>
+<script>alert(1)</script><ul><li>one</li><li>two</li></ul></body></html>`))
+		case "/long":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte(strings.Repeat("x", 50)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	fu := BuildFetchURLTool(FetchURLConfig{AllowedHosts: []string{"127.0.0.1"}, Timeout: 5 * time.Second, MaxChars: 20, AllowPrivateNetworks: true})
+	var resp struct {
+		Status     string `json:"status"`
+		URL        string `json:"url"`
+		Title      string `json:"title"`
+		Content    string `json:"content"`
+		Truncated  bool   `json:"truncated"`
+		TotalChars int    `json:"total_chars"`
+		Error      string `json:"error"`
+	}
+	fetch := func(target string) {
+		t.Helper()
+		resp.Truncated, resp.Error = false, ""
+		args, _ := json.Marshal(map[string]string{"url": target})
+		out, err := fu.InvokableRun(context.Background(), string(args))
+		if err != nil {
+			t.Fatalf("fetch_url: %v", err)
+		}
+		if err := json.Unmarshal([]byte(out), &resp); err != nil {
+			t.Fatalf("decode output: %v", err)
+		}
+	}
+
+	fu.maxChars = 1000
+	fetch(srv.URL + "/moved")
+	want := "# Install\n\nRun the **installer** and see [the docs](" + srv.URL + "/docs).\n\n- one\n- two"
+	if resp.Status != "ok" || resp.URL != srv.URL+"/page" || resp.Title != "Guide" || resp.Content != want {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	fu.maxChars = 20
+	fetch(srv.URL + "/long")
+	if !resp.Truncated || resp.TotalChars != 50 || resp.Content != strings.Repeat("x", 20) {
+		t.Fatalf("expected truncated content, got %+v", resp)
+	}
+
+	fetch(srv.URL + "/missing")
+	if resp.Status != "error" || !strings.Contains(resp.Error, "404") {
+		t.Fatalf("expected error status to be reported, got %+v", resp)
+	}
+}
+
+func TestFetchURLRejectsDisallowedURLs(t *testing.T) {
+	fu := BuildFetchURLTool(FetchURLConfig{AllowedHosts: []string{"docs.example.com", "*.wiki.example", "*", "*example.org"}})
+	cases := map[string]string{
+		"https://evil.example.com/":        "not in agent.fetch_url.allowed_hosts",
+		"https://example.com/":             "not in agent.fetch_url.allowed_hosts",
+		"https://wiki.example/":            "not in agent.fetch_url.allowed_hosts",
+		"https://evilwiki.example/":        "not in agent.fetch_url.allowed_hosts",
+		"https://evilexample.org/":         "not in agent.fetch_url.allowed_hosts",
+		"file:///etc/passwd":               "http or https",
+		"docs.example.com/page":            "http or https",
+		"ftp://docs.example.com/readme.md": "http or https",
+	}
+	for target, want := range cases {
+		args, _ := json.Marshal(map[string]string{"url": target})
+		out, _ := fu.InvokableRun(context.Background(), string(args))
+		if !strings.Contains(out, `"status":"error"`) || !strings.Contains(out, want) {
+			t.Fatalf("url %q: expected error containing %q, got %s", target, want, out)
+		}
+	}
+	for _, target := range []string{"https://docs.example.com/a", "http://en.wiki.example:8080/b"} {
+		u, _ := url.Parse(target)
+		if err := fu.check(u); err != nil {
+			t.Fatalf("url %q: expected allowed, got %v", target, err)
+		}
+	}
+}
+
+func TestFetchURLRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("internal"))
+	}))
+	defer srv.Close()
+
+	fu := BuildFetchURLTool(FetchURLConfig{AllowedHosts: []string{"127.0.0.1", "localhost"}, Timeout: 5 * time.Second})
+	u, _ := url.Parse(srv.URL)
+	for _, target := range []string{srv.URL, "http://localhost:" + u.Port()} {
+		args, _ := json.Marshal(map[string]string{"url": target})
+		out, _ := fu.InvokableRun(context.Background(), string(args))
+		if !strings.Contains(out, `"status":"error"`) || !strings.Contains(out, "allow_private_networks") {
+			t.Fatalf("url %q: expected private address to be refused, got %s", target, out)
+		}
+	}
+	for _, address := range []string{
+		"169.254.169.254:80", "10.0.0.1:443", "[::1]:80", "[::ffff:192.168.1.1]:80",
+		"100.64.0.1:80", "100.127.255.254:80", "198.18.0.1:80", "198.19.255.1:80",
+		"224.0.0.1:80", "239.255.255.250:1900", "[ff02::1]:80", "[fd00::1]:80",
+		"0.1.2.3:80", "192.0.0.8:80", "240.0.0.1:80", "255.255.255.255:80",
+	} {
+		if err := checkDialAddress("tcp", address, nil); err == nil {
+			t.Fatalf("checkDialAddress(%s) allowed a private address", address)
+		}
+	}
+	for _, address := range []string{"93.184.216.34:443", "100.128.0.1:443", "198.20.0.1:443", "[2606:2800:220:1::1]:443"} {
+		if err := checkDialAddress("tcp", address, nil); err != nil {
+			t.Fatalf("checkDialAddress(%s) = %v", address, err)
+		}
+	}
+}
+
+func TestHTMLToMarkdownKeepsStructure(t *testing.T) {
+	base, _ := url.Parse("https://example.com/guide/")
+	_, got, err := htmlToMarkdown(`<body><ol><li>first<ul><li>nested</li></ul></li><li>second</li></ol>
+<pre>line 1
+  line 2</pre><blockquote><p>quoted</p></blockquote>
+<table><tr><th>Name</th><th>Value</th></tr><tr><td>a</td><td>1</td></tr></table>
+<p>Use <code>go test</code> and <a href="javascript:void(0)">click</a> <img alt="logo" src="logo.png"></p></body>`, base)
+	if err != nil {
+		t.Fatalf("htmlToMarkdown: %v", err)
+	}
+	want := "1. first\n   - nested\n2. second\n\n```\nline 1\n  line 2\n```\n\n> quoted\n\n| Name | Value |\n| --- | --- |\n| a | 1 |\n\nUse `go test` and click ![logo](https://example.com/guide/logo.png)"
+	if got != want {
+		t.Fatalf("htmlToMarkdown =\n%s\nwant\n%s", got, want)
+	}
+}
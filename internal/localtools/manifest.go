@@ -0,0 +1,159 @@
+package localtools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// StateDirName is the directory under agent.workspace_dir holding each run's
+// manifests and replay snapshots. It sits outside every run workspace, so the
+// agent's workspace tools cannot rewrite a run's history and workspace cleanup
+// leaves it in place.
+const StateDirName = ".state"
+
+// ManifestDir is the state subdirectory holding per-iteration manifests.
+const ManifestDir = "manifests"
+
+// RunStateDir returns the state directory of runID under baseDir.
+func RunStateDir(baseDir, runID string) string {
+	return filepath.Join(baseDir, StateDirName, runID)
+}
+
+// WorkspaceManifest records the content hash of every workspace file at the
+// end of an iteration.
+type WorkspaceManifest struct {
+	Iteration int                     `json:"iteration"`
+	CreatedAt time.Time               `json:"created_at"`
+	Files     map[string]ManifestFile `json:"files"`
+}
+
+// ManifestFile is one file entry in a WorkspaceManifest.
+type ManifestFile struct {
+	SHA256    string `json:"sha256"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+// WorkspaceChange is a file difference between two manifests.
+type WorkspaceChange struct {
+	Path   string `json:"path"`
+	Change string `json:"change"` // "created" | "modified" | "deleted"
+}
+
+// BuildWorkspaceManifest hashes every regular file under dir, skipping any
+// relative path for which exclude returns true.
+func BuildWorkspaceManifest(dir string, iteration int, exclude func(rel string) bool) (*WorkspaceManifest, error) {
+	manifest := &WorkspaceManifest{
+		Iteration: iteration,
+		CreatedAt: time.Now().UTC(),
+		Files:     map[string]ManifestFile{},
+	}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			return nil
+		}
+		if !d.Type().IsRegular() || (exclude != nil && exclude(rel)) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		manifest.Files[rel] = ManifestFile{SHA256: sha256Hex(string(data)), SizeBytes: int64(len(data))}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("build workspace manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// ManifestPath returns where the manifest for iteration is stored under the
+// state directory stateDir.
+func ManifestPath(stateDir string, iteration int) string {
+	return filepath.Join(stateDir, ManifestDir, fmt.Sprintf("iter_%d.json", iteration))
+}
+
+// WriteWorkspaceManifest stores m under stateDir/manifests.
+func WriteWorkspaceManifest(stateDir string, m *WorkspaceManifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("marshal workspace manifest: %w", err)
+	}
+	path := ManifestPath(stateDir, m.Iteration)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create manifest dir: %w", err)
+	}
+	return atomicWriteFile(path, data, 0o644)
+}
+
+// ReadWorkspaceManifest loads the manifest for iteration from stateDir.
+func ReadWorkspaceManifest(stateDir string, iteration int) (*WorkspaceManifest, error) {
+	data, err := os.ReadFile(ManifestPath(stateDir, iteration))
+	if err != nil {
+		return nil, err
+	}
+	var m WorkspaceManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse workspace manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// DiffWorkspaceManifests lists files created, modified, or deleted going from
+// a to b, sorted by path. A nil manifest is treated as an empty workspace.
+func DiffWorkspaceManifests(a, b *WorkspaceManifest) []WorkspaceChange {
+	var before, after map[string]ManifestFile
+	if a != nil {
+		before = a.Files
+	}
+	if b != nil {
+		after = b.Files
+	}
+	changes := make([]WorkspaceChange, 0)
+	for path, file := range after {
+		prev, ok := before[path]
+		switch {
+		case !ok:
+			changes = append(changes, WorkspaceChange{Path: path, Change: "created"})
+		case prev.SHA256 != file.SHA256:
+			changes = append(changes, WorkspaceChange{Path: path, Change: "modified"})
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changes = append(changes, WorkspaceChange{Path: path, Change: "deleted"})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// LatestManifestIteration returns the highest iteration with a manifest under
+// stateDir, or 0 when there is none.
+func LatestManifestIteration(stateDir string) int {
+	entries, err := os.ReadDir(filepath.Join(stateDir, ManifestDir))
+	if err != nil {
+		return 0
+	}
+	latest := 0
+	for _, entry := range entries {
+		var iter int
+		if _, err := fmt.Sscanf(entry.Name(), "iter_%d.json", &iter); err == nil && iter > latest {
+			latest = iter
+		}
+	}
+	return latest
+}
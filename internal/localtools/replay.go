@@ -0,0 +1,76 @@
+package localtools
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ReplayDir is the state subdirectory holding per-iteration copies of the loop
+// state a replayed run is seeded from.
+const ReplayDir = "replay"
+
+// ReplaySeedFiles are the loop files snapshotted each iteration and copied
+// into a replayed run's workspace. checkpoint.json is the checkpoint saved
+// for the start of the next iteration, so a replay resumes with the original
+// iteration number, stage, and loop budget.
+var ReplaySeedFiles = []string{"state.json", "run_memory.md", "checkpoint.json"}
+
+// ReplaySnapshotDir returns where the seed snapshot for iteration is stored
+// under the state directory stateDir.
+func ReplaySnapshotDir(stateDir string, iteration int) string {
+	return filepath.Join(stateDir, ReplayDir, fmt.Sprintf("iter_%d", iteration))
+}
+
+// SnapshotReplaySeed copies the named seed files under the workspace dir into
+// the snapshot for iteration under stateDir. Files that do not exist yet are
+// skipped.
+func SnapshotReplaySeed(dir, stateDir string, iteration int, names ...string) error {
+	snapDir := ReplaySnapshotDir(stateDir, iteration)
+	if err := os.MkdirAll(snapDir, 0o755); err != nil {
+		return fmt.Errorf("create replay snapshot dir: %w", err)
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", name, err)
+		}
+		if err := atomicWriteFile(filepath.Join(snapDir, name), data, 0o644); err != nil {
+			return fmt.Errorf("write replay snapshot %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// SeedReplay copies the seed snapshot taken at the end of iteration under the
+// state directory srcStateDir into dstDir. Iteration 0 seeds nothing. A
+// missing snapshot returns an error wrapping os.ErrNotExist.
+func SeedReplay(srcStateDir string, iteration int, dstDir string) error {
+	if err := os.MkdirAll(dstDir, 0o755); err != nil {
+		return fmt.Errorf("create replay workspace: %w", err)
+	}
+	if iteration == 0 {
+		return nil
+	}
+	snapDir := ReplaySnapshotDir(srcStateDir, iteration)
+	if _, err := os.Stat(snapDir); err != nil {
+		return fmt.Errorf("replay snapshot for iteration %d: %w", iteration, err)
+	}
+	for _, name := range ReplaySeedFiles {
+		data, err := os.ReadFile(filepath.Join(snapDir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read replay snapshot %s: %w", name, err)
+		}
+		if err := atomicWriteFile(filepath.Join(dstDir, name), data, 0o644); err != nil {
+			return fmt.Errorf("seed %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package localtools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+)
+
+// shellMetacharacters are rejected anywhere in a run_command command line.
+// Commands are never passed to a shell, so these would not be interpreted;
+// rejecting them keeps the model from believing pipes or redirects work.
+const shellMetacharacters = "|&;<>()$`\\\"'*?[]{}~!#\n\r"
+
+// RunCommandTool runs an allowlisted command with the workspace as its
+// working directory, under the sys_tools timeout and output cap.
+type RunCommandTool struct {
+	allowlist [][]string
+	sandbox   commandSandbox
+	observer  Observer
+}
+
+var _ tool.InvokableTool = (*RunCommandTool)(nil)
+
+// BuildRunCommandTool returns run_command for baseDir. Each allowlist entry
+// is a command name, optionally followed by the leading arguments a command
+// must start with ("go test" allows "go test ./..." but not "go run").
+// Commands see only PATH, HOME, and the variables named in passEnv.
+func BuildRunCommandTool(baseDir string, allowlist, passEnv []string, cfg SysToolsConfig) *RunCommandTool {
+	cfg = cfg.withDefaults()
+	t := &RunCommandTool{
+		sandbox: commandSandbox{
+			timeout:        cfg.Timeout,
+			maxOutputBytes: cfg.MaxOutputBytes,
+			dir:            baseDir,
+			env:            commandEnv(passEnv),
+		},
+	}
+	for _, entry := range allowlist {
+		if fields := strings.Fields(entry); len(fields) > 0 {
+			t.allowlist = append(t.allowlist, fields)
+		}
+	}
+	return t
+}
+
+// commandEnv copies PATH, HOME, and the named variables that are set from the
+// service environment. The result is never nil, so nothing else is inherited.
+func commandEnv(names []string) []string {
+	env := []string{}
+	for _, name := range append([]string{"PATH", "HOME"}, names...) {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// WithObserver returns a copy of the tool with the given observer attached.
+func (t *RunCommandTool) WithObserver(obs Observer) *RunCommandTool {
+	cp := *t
+	cp.observer = obs
+	return &cp
+}
+
+// Info returns tool metadata for model planning.
+func (t *RunCommandTool) Info(_ context.Context) (*schema.ToolInfo, error) {
+	allowed := make([]string, 0, len(t.allowlist))
+	for _, fields := range t.allowlist {
+		allowed = append(allowed, strings.Join(fields, " "))
+	}
+	return &schema.ToolInfo{
+		Name: "run_command",
+		Desc: fmt.Sprintf("Run an approved command in the workspace directory. Allowed commands: %s. Arguments are split on spaces; no shell is used, so pipes, redirects, quotes, globs, and paths outside the workspace are rejected.", strings.Join(allowed, ", ")),
+		ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
+			"command": {Type: schema.String, Desc: "Command line to run, e.g. \"go test ./...\"", Required: true},
+		}),
+	}, nil
+}
+
+// InvokableRun checks the command against the allowlist and runs it. A
+// rejected command or non-zero exit is reported as a status "error" result.
+func (t *RunCommandTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
+	resp, err := t.run(ctx, json.RawMessage(argumentsInJSON))
+	status := "ok"
+	if err != nil {
+		status = "error"
+		if resp == nil {
+			resp = map[string]any{}
+		}
+		resp["error"] = err.Error()
+	}
+	resp["status"] = status
+
+	out, marshalErr := json.Marshal(resp)
+	if marshalErr != nil {
+		return "", fmt.Errorf("marshal tool output: %w", marshalErr)
+	}
+	if t.observer != nil {
+		t.observer("run_command", argumentsInJSON, string(out), status)
+	}
+	return string(out), nil
+}
+
+func (t *RunCommandTool) run(ctx context.Context, raw json.RawMessage) (map[string]any, error) {
+	var args struct {
+		Command string `json:"command"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("parse arguments: %w", err)
+	}
+	argv, err := t.parse(args.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	command := strings.Join(argv, " ")
+	out, err := t.sandbox.run(ctx, argv[0], argv[1:]...)
+	resp := map[string]any{
+		"command":   command,
+		"exit_code": 0,
+		"output":    out,
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		resp["exit_code"] = exitErr.ExitCode()
+	}
+	return resp, err
+}
+
+// parse splits command into argv and rejects anything outside the allowlist.
+func (t *RunCommandTool) parse(command string) ([]string, error) {
+	if strings.ContainsAny(command, shellMetacharacters) {
+		return nil, fmt.Errorf("command contains shell metacharacters; only plain arguments are allowed")
+	}
+	argv := strings.Fields(command)
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("command is required")
+	}
+	if strings.ContainsRune(argv[0], '/') {
+		return nil, fmt.Errorf("command %q must be a bare command name", argv[0])
+	}
+	if !slices.ContainsFunc(t.allowlist, func(prefix []string) bool {
+		return len(argv) >= len(prefix) && slices.Equal(argv[:len(prefix)], prefix)
+	}) {
+		return nil, fmt.Errorf("command %q is not in agent.shell_allowlist", command)
+	}
+	for _, arg := range argv[1:] {
+		// Check both "--flag=value" as a whole and its value.
+		_, value, _ := strings.Cut(arg, "=")
+		for _, p := range []string{arg, value} {
+			if filepath.IsAbs(p) || slices.Contains(strings.Split(filepath.ToSlash(p), "/"), "..") {
+				return nil, fmt.Errorf("argument %q refers outside the workspace", arg)
+			}
+		}
+	}
+	return argv, nil
+}
@@ -0,0 +1,86 @@
+package localtools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCommandRunsAllowlistedCommandInWorkspace(t *testing.T) {
+	base := t.TempDir()
+	if err := os.WriteFile(filepath.Join(base, "notes.md"), []byte("hi"), 0o644); err != nil {
+		t.Fatalf("seed file: %v", err)
+	}
+	rc := BuildRunCommandTool(base, []string{"ls", "cat notes.md"}, nil, SysToolsConfig{Timeout: 5 * time.Second})
+
+	out, err := rc.InvokableRun(context.Background(), `{"command":"ls -a"}`)
+	if err != nil {
+		t.Fatalf("run_command: %v", err)
+	}
+	var resp struct {
+		Status   string `json:"status"`
+		Command  string `json:"command"`
+		ExitCode int    `json:"exit_code"`
+		Output   string `json:"output"`
+	}
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+	if resp.Status != "ok" || resp.Command != "ls -a" || resp.ExitCode != 0 || !strings.Contains(resp.Output, "notes.md") {
+		t.Fatalf("unexpected response: %s", out)
+	}
+
+	// A non-zero exit is an error that still carries the exit code.
+	out, _ = rc.InvokableRun(context.Background(), `{"command":"ls missing.txt"}`)
+	if !strings.Contains(out, `"status":"error"`) || strings.Contains(out, `"exit_code":0`) {
+		t.Fatalf("expected failing exit to be reported, got %s", out)
+	}
+}
+
+func TestRunCommandPassesOnlyApprovedEnvironment(t *testing.T) {
+	t.Setenv("AGENTICLOOP_TEST_SECRET", "s3cret")
+	t.Setenv("AGENTICLOOP_TEST_PASSED", "visible")
+	rc := BuildRunCommandTool(t.TempDir(), []string{"env"}, []string{"AGENTICLOOP_TEST_PASSED"}, SysToolsConfig{Timeout: 5 * time.Second})
+
+	out, err := rc.InvokableRun(context.Background(), `{"command":"env"}`)
+	if err != nil {
+		t.Fatalf("run_command: %v", err)
+	}
+	if !strings.Contains(out, "PATH=") || !strings.Contains(out, "AGENTICLOOP_TEST_PASSED=visible") {
+		t.Fatalf("expected PATH and the passed variable, got %s", out)
+	}
+	if strings.Contains(out, "s3cret") {
+		t.Fatalf("unlisted variable leaked into the command environment: %s", out)
+	}
+}
+
+func TestRunCommandRejectsUnsafeCommands(t *testing.T) {
+	rc := BuildRunCommandTool(t.TempDir(), []string{"ls", "go test"}, nil, SysToolsConfig{})
+	cases := map[string]string{
+		"rm -rf notes":      "not in agent.shell_allowlist",
+		"go run main.go":    "not in agent.shell_allowlist",
+		"/bin/ls":           "bare command name",
+		"ls; rm -rf notes":  "shell metacharacters",
+		"ls | sh":           "shell metacharacters",
+		"ls $(whoami)":      "shell metacharacters",
+		"ls *.md":           "shell metacharacters",
+		"ls /etc":           "outside the workspace",
+		"ls ../other":       "outside the workspace",
+		"go test -o=/tmp/x": "outside the workspace",
+		"   ":               "command is required",
+	}
+	for command, want := range cases {
+		args, _ := json.Marshal(map[string]string{"command": command})
+		out, err := rc.InvokableRun(context.Background(), string(args))
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", command, err)
+		}
+		if !strings.Contains(out, `"status":"error"`) || !strings.Contains(out, want) {
+			t.Fatalf("%q: expected error containing %q, got %s", command, want, out)
+		}
+	}
+}
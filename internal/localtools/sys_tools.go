@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"os/exec"
+	"time"
 
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/schema"
@@ -14,11 +15,43 @@ import (
 // Observer is called after each tool invocation.
 type Observer func(tool, input, output, status string)
 
+// Defaults applied by BuildDefaultTools when SysToolsConfig fields are zero.
+// The config loader fills agent.sys_tools from the same values.
+const (
+	DefaultSysToolTimeout        = 15 * time.Second
+	DefaultSysToolMaxOutputBytes = 64 << 10
+	DefaultExternalIPURL         = "ifconfig.me/all.json"
+)
+
+// SysToolsConfig bounds the sys_* command tools.
+type SysToolsConfig struct {
+	// Timeout kills a command that runs longer than this.
+	Timeout time.Duration
+	// MaxOutputBytes caps the combined stdout/stderr kept from a command.
+	MaxOutputBytes int
+	// ExternalIPURL is the endpoint sys_external_ip fetches with curl.
+	ExternalIPURL string
+}
+
+func (c SysToolsConfig) withDefaults() SysToolsConfig {
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultSysToolTimeout
+	}
+	if c.MaxOutputBytes <= 0 {
+		c.MaxOutputBytes = DefaultSysToolMaxOutputBytes
+	}
+	if c.ExternalIPURL == "" {
+		c.ExternalIPURL = DefaultExternalIPURL
+	}
+	return c
+}
+
 // CommandTool executes a fixed local command as an Eino tool.
 type CommandTool struct {
 	name        string
 	description string
-	runner      func(ctx context.Context) (string, string, error)
+	runner      func(ctx context.Context, sb commandSandbox) (string, string, error)
+	sandbox     commandSandbox
 	observer    Observer
 }
 
@@ -31,17 +64,25 @@ type ReportSuccessTool struct {
 }
 
 // BuildDefaultTools returns the built-in local diagnostic tools.
-func BuildDefaultTools() []tool.BaseTool {
+func BuildDefaultTools(cfg SysToolsConfig) []tool.BaseTool {
+	cfg = cfg.withDefaults()
+	sb := commandSandbox{
+		timeout:        cfg.Timeout,
+		maxOutputBytes: cfg.MaxOutputBytes,
+		externalIPURL:  cfg.ExternalIPURL,
+	}
 	return []tool.BaseTool{
 		&CommandTool{
 			name:        "sys_internal_ip",
 			description: "Get internal network interfaces and IP addresses from this host.",
 			runner:      runInternalIP,
+			sandbox:     sb,
 		},
 		&CommandTool{
 			name:        "sys_external_ip",
-			description: "Get external/public IP info via curl ifconfig.me/all.json.",
+			description: fmt.Sprintf("Get external/public IP info via curl %s.", cfg.ExternalIPURL),
 			runner:      runExternalIP,
+			sandbox:     sb,
 		},
 		&ReportSuccessTool{},
 	}
@@ -53,6 +94,7 @@ func (t *CommandTool) WithObserver(obs Observer) *CommandTool {
 		name:        t.name,
 		description: t.description,
 		runner:      t.runner,
+		sandbox:     t.sandbox,
 		observer:    obs,
 	}
 }
@@ -73,7 +115,7 @@ func (t *CommandTool) Info(_ context.Context) (*schema.ToolInfo, error) {
 
 // InvokableRun executes the fixed command and returns JSON output.
 func (t *CommandTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...tool.Option) (string, error) {
-	command, output, err := t.runner(ctx)
+	command, output, err := t.runner(ctx, t.sandbox)
 	status := "ok"
 	resp := map[string]any{
 		"status":  status,
@@ -149,8 +191,8 @@ func (t *ReportSuccessTool) InvokableRun(_ context.Context, argumentsInJSON stri
 	return string(out), nil
 }
 
-func runInternalIP(ctx context.Context) (string, string, error) {
-	out, err := runCommand(ctx, "ip", "addr")
+func runInternalIP(ctx context.Context, sb commandSandbox) (string, string, error) {
+	out, err := sb.run(ctx, "ip", "addr")
 	if err == nil {
 		return "ip addr", out, nil
 	}
@@ -158,25 +200,84 @@ func runInternalIP(ctx context.Context) (string, string, error) {
 		return "ip addr", out, err
 	}
 
-	out, err = runCommand(ctx, "ifconfig")
+	out, err = sb.run(ctx, "ifconfig")
 	if err != nil {
 		return "ifconfig", out, err
 	}
 	return "ifconfig", out, nil
 }
 
-func runExternalIP(ctx context.Context) (string, string, error) {
-	out, err := runCommand(ctx, "curl", "-sS", "ifconfig.me/all.json")
+func runExternalIP(ctx context.Context, sb commandSandbox) (string, string, error) {
+	command := "curl -sS " + sb.externalIPURL
+	out, err := sb.run(ctx, "curl", "-sS", sb.externalIPURL)
 	if err != nil {
-		return "curl -sS ifconfig.me/all.json", out, err
+		return command, out, err
 	}
-	return "curl -sS ifconfig.me/all.json", out, nil
+	return command, out, nil
 }
 
-func runCommand(ctx context.Context, name string, args ...string) (string, error) {
+// commandSandbox runs sys_* commands under a timeout with bounded output.
+// A non-empty dir sets the command's working directory.
+type commandSandbox struct {
+	timeout        time.Duration
+	maxOutputBytes int
+	externalIPURL  string
+	dir            string
+	// env replaces the command environment; nil inherits the service's.
+	env []string
+}
+
+func (sb commandSandbox) run(parent context.Context, name string, args ...string) (string, error) {
+	ctx := parent
+	if sb.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sb.timeout)
+		defer cancel()
+	}
+
+	out := &cappedBuffer{max: sb.maxOutputBytes}
 	cmd := exec.CommandContext(ctx, name, args...)
-	out, err := cmd.CombinedOutput()
-	return string(out), err
+	cmd.Dir = sb.dir
+	cmd.Env = sb.env
+	cmd.Stdout = out
+	cmd.Stderr = out
+	// Don't let a grandchild holding the pipes keep Wait blocked past the kill.
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	if parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%s timed out after %s", name, sb.timeout)
+	}
+	return out.String(), err
+}
+
+// cappedBuffer keeps the first max bytes written and counts the rest.
+type cappedBuffer struct {
+	max     int
+	buf     []byte
+	dropped int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	room := b.max - len(b.buf)
+	if b.max <= 0 {
+		room = len(p)
+	}
+	if room >= len(p) {
+		b.buf = append(b.buf, p...)
+		return len(p), nil
+	}
+	if room > 0 {
+		b.buf = append(b.buf, p[:room]...)
+	}
+	b.dropped += len(p) - max(room, 0)
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() string {
+	if b.dropped == 0 {
+		return string(b.buf)
+	}
+	return string(b.buf) + fmt.Sprintf("\n...[truncated %d bytes]", b.dropped)
 }
 
 func isCmdNotFound(err error) bool {
@@ -0,0 +1,32 @@
+package localtools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandSandboxTruncatesOutput(t *testing.T) {
+	sb := commandSandbox{timeout: 5 * time.Second, maxOutputBytes: 16}
+	out, err := sb.run(context.Background(), "sh", "-c", "printf '%064d' 0")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	want := strings.Repeat("0", 16) + "\n...[truncated 48 bytes]"
+	if out != want {
+		t.Fatalf("output = %q, want %q", out, want)
+	}
+}
+
+func TestCommandSandboxTimesOut(t *testing.T) {
+	sb := commandSandbox{timeout: 100 * time.Millisecond, maxOutputBytes: 1024}
+	start := time.Now()
+	_, err := sb.run(context.Background(), "sleep", "5")
+	if err == nil || !strings.Contains(err.Error(), "sleep timed out after 100ms") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("command was not killed promptly: %s", elapsed)
+	}
+}
@@ -0,0 +1,60 @@
+package localtools
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiffFormatsHunks(t *testing.T) {
+	var before, after strings.Builder
+	for i := 1; i <= 20; i++ {
+		fmt.Fprintf(&before, "line %d\n", i)
+		switch i {
+		case 2:
+			after.WriteString("line two\n")
+		case 15:
+			// removed
+		default:
+			fmt.Fprintf(&after, "line %d\n", i)
+		}
+	}
+	after.WriteString("tail")
+
+	// Same output as `diff -u` for these inputs.
+	want := `--- a/notes.txt
++++ b/notes.txt
+@@ -1,5 +1,5 @@
+ line 1
+-line 2
++line two
+ line 3
+ line 4
+ line 5
+@@ -12,9 +12,9 @@
+ line 12
+ line 13
+ line 14
+-line 15
+ line 16
+ line 17
+ line 18
+ line 19
+ line 20
++tail
+\ No newline at end of file
+`
+	if got := unifiedDiff("notes.txt", before.String(), after.String()); got != want {
+		t.Fatalf("unified diff mismatch\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnifiedDiffEmptyAndPureInsert(t *testing.T) {
+	if got := unifiedDiff("a.txt", "same\n", "same\n"); got != "" {
+		t.Fatalf("expected empty diff for identical content, got %q", got)
+	}
+	want := "--- a/a.txt\n+++ b/a.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n"
+	if got := unifiedDiff("a.txt", "", "one\ntwo\n"); got != want {
+		t.Fatalf("insert diff = %q, want %q", got, want)
+	}
+}
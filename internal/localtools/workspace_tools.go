@@ -4,13 +4,17 @@ import (
 	"bufio"
 	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/schema"
@@ -24,6 +28,8 @@ type WorkspaceFileTool struct {
 	handler  func(baseDir string, args json.RawMessage) (string, error)
 	baseDir  string
 	observer Observer
+	// mutates marks tools that change a file; they hold its path lock.
+	mutates bool
 }
 
 var _ tool.InvokableTool = (*WorkspaceFileTool)(nil)
@@ -59,6 +65,13 @@ func (t *WorkspaceFileTool) InvokableRun(_ context.Context, argumentsInJSON stri
 	return out, nil
 }
 
+// ResolveWorkspacePath resolves relPath within baseDir with the same checks
+// the workspace tools apply, rejecting absolute paths and any path or
+// symlink that escapes baseDir.
+func ResolveWorkspacePath(baseDir, relPath string) (string, error) {
+	return sanitizePath(baseDir, relPath)
+}
+
 // sanitizePath validates and resolves a relative path within baseDir.
 func sanitizePath(baseDir, relPath string) (string, error) {
 	if relPath == "" {
@@ -145,10 +158,23 @@ func BuildWorkspaceTools(baseDir string) []*WorkspaceFileTool {
 			name: "workspace_write",
 			desc: "Create or overwrite a file in the workspace. Creates parent directories as needed.",
 			params: map[string]*schema.ParameterInfo{
-				"path":    {Type: schema.String, Desc: "Relative path within the workspace"},
-				"content": {Type: schema.String, Desc: "File content to write"},
+				"path":               {Type: schema.String, Desc: "Relative path within the workspace"},
+				"content":            {Type: schema.String, Desc: "File content to write"},
+				"normalize_newlines": {Type: schema.Boolean, Desc: "Convert CRLF line endings to LF before writing (default false)"},
+				"strip_bom":          {Type: schema.Boolean, Desc: "Remove a leading UTF-8 byte order mark before writing (default false)"},
 			},
 			handler: handleWrite,
+			mutates: true,
+		},
+		{
+			name: "workspace_write_base64",
+			desc: "Create or overwrite a file in the workspace from base64-encoded content, for binary artifacts such as images or PDFs. Creates parent directories as needed.",
+			params: map[string]*schema.ParameterInfo{
+				"path":    {Type: schema.String, Desc: "Relative path within the workspace"},
+				"content": {Type: schema.String, Desc: "Standard base64-encoded file content; whitespace is ignored"},
+			},
+			handler: handleWriteBase64,
+			mutates: true,
 		},
 		{
 			name: "workspace_read",
@@ -159,6 +185,16 @@ func BuildWorkspaceTools(baseDir string) []*WorkspaceFileTool {
 			},
 			handler: handleRead,
 		},
+		{
+			name: "workspace_read_json",
+			desc: "Read and parse a JSON file in the workspace, optionally selecting a value with a dotted path (e.g. results.items.0.name).",
+			params: map[string]*schema.ParameterInfo{
+				"path":      {Type: schema.String, Desc: "Relative path within the workspace"},
+				"selector":  {Type: schema.String, Desc: "Optional dotted path; numeric segments index arrays (default: whole document)"},
+				"max_bytes": {Type: schema.Integer, Desc: "Maximum bytes of JSON to return (default 32768)"},
+			},
+			handler: handleReadJSON,
+		},
 		{
 			name: "workspace_list",
 			desc: "List entries in a workspace directory.",
@@ -171,18 +207,22 @@ func BuildWorkspaceTools(baseDir string) []*WorkspaceFileTool {
 			name: "workspace_append",
 			desc: "Append content to a file in the workspace. Creates the file if it does not exist.",
 			params: map[string]*schema.ParameterInfo{
-				"path":    {Type: schema.String, Desc: "Relative path within the workspace"},
-				"content": {Type: schema.String, Desc: "Content to append"},
+				"path":               {Type: schema.String, Desc: "Relative path within the workspace"},
+				"content":            {Type: schema.String, Desc: "Content to append"},
+				"normalize_newlines": {Type: schema.Boolean, Desc: "Convert CRLF line endings to LF before writing (default false)"},
+				"strip_bom":          {Type: schema.Boolean, Desc: "Remove a leading UTF-8 byte order mark before writing (default false)"},
 			},
 			handler: handleAppend,
+			mutates: true,
 		},
 		{
 			name: "workspace_edit",
-			desc: "Edit an existing file using either a single-match regex replacement or a line-range replacement. Preview by default; apply requires explicit confirmation hash.",
+			desc: "Edit an existing file using either a single-match regex replacement or a line-range replacement. Preview by default, with a unified_diff of the change; apply requires explicit confirmation hash.",
 			params: map[string]*schema.ParameterInfo{
 				"path":                     {Type: schema.String, Desc: "Relative path within the workspace"},
 				"mode":                     {Type: schema.String, Desc: "Edit mode: regex_replace or line_replace"},
-				"search":                   {Type: schema.String, Desc: "Regex pattern for regex_replace mode; must match exactly once"},
+				"search":                   {Type: schema.String, Desc: "Regex pattern for regex_replace mode; must match exactly once unless replace_all is set"},
+				"replace_all":              {Type: schema.Boolean, Desc: "regex_replace only: replace every match instead of requiring exactly one (defaults to false)"},
 				"replace":                  {Type: schema.String, Desc: "Replacement content"},
 				"start_line":               {Type: schema.Integer, Desc: "1-based start line for line_replace mode"},
 				"end_line":                 {Type: schema.Integer, Desc: "1-based end line for line_replace mode (inclusive)"},
@@ -190,6 +230,7 @@ func BuildWorkspaceTools(baseDir string) []*WorkspaceFileTool {
 				"expected_original_sha256": {Type: schema.String, Desc: "Required when apply=true; must match preview original_sha256"},
 			},
 			handler: handleEdit,
+			mutates: true,
 		},
 		{
 			name: "workspace_delete",
@@ -198,6 +239,7 @@ func BuildWorkspaceTools(baseDir string) []*WorkspaceFileTool {
 				"path": {Type: schema.String, Desc: "Relative path within the workspace"},
 			},
 			handler: handleDelete,
+			mutates: true,
 		},
 		{
 			name: "workspace_mkdir",
@@ -208,35 +250,135 @@ func BuildWorkspaceTools(baseDir string) []*WorkspaceFileTool {
 			handler: handleMkdir,
 		},
 	}
+	locks := &pathLocks{}
 	for _, t := range tools {
 		t.baseDir = baseDir
+		if t.mutates {
+			t.handler = locks.wrap(t.handler)
+		}
 	}
 	return tools
 }
 
+// pathLocks serializes mutations of the same file among the tools built by
+// one BuildWorkspaceTools call, so parallel tool calls cannot interleave
+// workspace_edit's read, hash check, and write with another change.
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// wrap runs handler while holding the lock for the resolved args.path.
+func (l *pathLocks) wrap(handler func(baseDir string, args json.RawMessage) (string, error)) func(baseDir string, args json.RawMessage) (string, error) {
+	return func(baseDir string, args json.RawMessage) (string, error) {
+		var p struct {
+			Path string `json:"path"`
+		}
+		_ = json.Unmarshal(args, &p)
+		key := p.Path
+		if abs, err := sanitizePath(baseDir, p.Path); err == nil {
+			key = abs
+		}
+		unlock := l.lock(key)
+		defer unlock()
+		return handler(baseDir, args)
+	}
+}
+
+func (l *pathLocks) lock(key string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sync.Mutex)
+	}
+	m, ok := l.locks[key]
+	if !ok {
+		m = &sync.Mutex{}
+		l.locks[key] = m
+	}
+	l.mu.Unlock()
+	m.Lock()
+	return m.Unlock
+}
+
 func handleWrite(baseDir string, args json.RawMessage) (string, error) {
 	var p struct {
 		Path    string `json:"path"`
 		Content string `json:"content"`
+		textNormalization
 	}
 	if err := json.Unmarshal(args, &p); err != nil {
 		return "", fmt.Errorf("parse arguments: %w", err)
 	}
-	abs, err := sanitizePath(baseDir, p.Path)
+	content, report := p.apply(p.Content)
+	return writeWorkspaceFile(baseDir, p.Path, []byte(content), report)
+}
+
+// textNormalization holds the optional write/append cleanup flags.
+type textNormalization struct {
+	NormalizeNewlines bool `json:"normalize_newlines"`
+	StripBOM          bool `json:"strip_bom"`
+}
+
+// apply returns content with the requested normalization applied, plus the
+// result fields reporting it (nil when no normalization was requested).
+func (n textNormalization) apply(content string) (string, map[string]any) {
+	if !n.NormalizeNewlines && !n.StripBOM {
+		return content, nil
+	}
+	out := content
+	if n.StripBOM {
+		out = strings.TrimPrefix(out, "\uFEFF")
+	}
+	if n.NormalizeNewlines {
+		out = strings.ReplaceAll(out, "\r\n", "\n")
+	}
+	removed := len(content) - len(out)
+	return out, map[string]any{
+		"normalized":    removed > 0,
+		"bytes_removed": removed,
+	}
+}
+
+func handleWriteBase64(baseDir string, args json.RawMessage) (string, error) {
+	var p struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return "", fmt.Errorf("parse arguments: %w", err)
+	}
+	// Models often wrap long base64 payloads; drop whitespace before decoding.
+	encoded := strings.Join(strings.Fields(p.Content), "")
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("decode base64 content: %w", err)
+	}
+	return writeWorkspaceFile(baseDir, p.Path, data, nil)
+}
+
+// writeWorkspaceFile writes data to relPath inside the workspace, creating
+// parent directories, and reports the number of bytes written plus any extra
+// result fields.
+func writeWorkspaceFile(baseDir, relPath string, data []byte, extra map[string]any) (string, error) {
+	abs, err := sanitizePath(baseDir, relPath)
 	if err != nil {
 		return "", err
 	}
 	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
 		return "", fmt.Errorf("create parent dirs: %w", err)
 	}
-	if err := os.WriteFile(abs, []byte(p.Content), 0o644); err != nil {
+	if err := os.WriteFile(abs, data, 0o644); err != nil {
 		return "", fmt.Errorf("write file: %w", err)
 	}
-	out, _ := json.Marshal(map[string]any{
+	result := map[string]any{
 		"status":        "ok",
-		"path":          p.Path,
-		"bytes_written": len(p.Content),
-	})
+		"path":          relPath,
+		"bytes_written": len(data),
+	}
+	for k, v := range extra {
+		result[k] = v
+	}
+	out, _ := json.Marshal(result)
 	return string(out), nil
 }
 
@@ -284,6 +426,115 @@ func handleRead(baseDir string, args json.RawMessage) (string, error) {
 	return string(out), nil
 }
 
+// defaultReadJSONMaxBytes caps the selected value workspace_read_json
+// returns when the call sets no max_bytes.
+const defaultReadJSONMaxBytes = 32 << 10
+
+func handleReadJSON(baseDir string, args json.RawMessage) (string, error) {
+	var p struct {
+		Path     string `json:"path"`
+		Selector string `json:"selector"`
+		MaxBytes int    `json:"max_bytes"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return "", fmt.Errorf("parse arguments: %w", err)
+	}
+	if p.MaxBytes <= 0 {
+		p.MaxBytes = defaultReadJSONMaxBytes
+	}
+	abs, err := sanitizePath(baseDir, p.Path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return "", fmt.Errorf("read file: %w", err)
+	}
+
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return "", fmt.Errorf("parse JSON at offset %d: %v", syntaxErr.Offset, syntaxErr)
+		}
+		return "", fmt.Errorf("parse JSON: %w", err)
+	}
+
+	value, err := selectJSONPath(doc, p.Selector)
+	if err != nil {
+		return "", err
+	}
+	resp := map[string]any{
+		"status":    "ok",
+		"path":      p.Path,
+		"selector":  p.Selector,
+		"type":      jsonValueType(value),
+		"value":     value,
+		"truncated": false,
+	}
+	// An oversized value is returned as the leading max_bytes of its JSON
+	// text; narrow the selector to read the rest.
+	if encoded, _ := json.Marshal(value); len(encoded) > p.MaxBytes {
+		resp["value"] = strings.ToValidUTF8(string(encoded[:p.MaxBytes]), "")
+		resp["truncated"] = true
+		resp["bytes"] = len(encoded)
+	}
+	out, _ := json.Marshal(resp)
+	return string(out), nil
+}
+
+// selectJSONPath walks doc along a dotted selector. Numeric segments index arrays.
+func selectJSONPath(doc any, selector string) (any, error) {
+	selector = strings.TrimSpace(selector)
+	if selector == "" || selector == "." {
+		return doc, nil
+	}
+	current := doc
+	walked := make([]string, 0, strings.Count(selector, ".")+1)
+	for _, segment := range strings.Split(selector, ".") {
+		walked = append(walked, segment)
+		switch node := current.(type) {
+		case map[string]any:
+			v, ok := node[segment]
+			if !ok {
+				return nil, fmt.Errorf("selector %q: key %q not found", strings.Join(walked, "."), segment)
+			}
+			current = v
+		case []any:
+			idx, err := strconv.Atoi(segment)
+			if err != nil {
+				return nil, fmt.Errorf("selector %q: %q is not an array index", strings.Join(walked, "."), segment)
+			}
+			if idx < 0 || idx >= len(node) {
+				return nil, fmt.Errorf("selector %q: index %d out of range (length %d)", strings.Join(walked, "."), idx, len(node))
+			}
+			current = node[idx]
+		default:
+			return nil, fmt.Errorf("selector %q: cannot descend into %s", strings.Join(walked, "."), jsonValueType(current))
+		}
+	}
+	return current, nil
+}
+
+func jsonValueType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
 func handleList(baseDir string, args json.RawMessage) (string, error) {
 	var p struct {
 		Path string `json:"path"`
@@ -303,9 +554,11 @@ func handleList(baseDir string, args json.RawMessage) (string, error) {
 		return "", fmt.Errorf("read directory: %w", err)
 	}
 	type entry struct {
-		Name  string `json:"name"`
-		Size  int64  `json:"size"`
-		IsDir bool   `json:"is_dir"`
+		Name        string `json:"name"`
+		Size        int64  `json:"size"`
+		IsDir       bool   `json:"is_dir"`
+		ContentType string `json:"content_type,omitempty"`
+		Category    string `json:"category,omitempty"`
 	}
 	result := make([]entry, 0, len(entries))
 	for _, e := range entries {
@@ -314,11 +567,15 @@ func handleList(baseDir string, args json.RawMessage) (string, error) {
 		if infoErr == nil {
 			size = info.Size()
 		}
-		result = append(result, entry{
+		item := entry{
 			Name:  e.Name(),
 			Size:  size,
 			IsDir: e.IsDir(),
-		})
+		}
+		if !e.IsDir() {
+			item.ContentType, item.Category = DetectContentType(filepath.Join(abs, e.Name()), size)
+		}
+		result = append(result, item)
 	}
 	out, _ := json.Marshal(map[string]any{
 		"status":  "ok",
@@ -332,10 +589,12 @@ func handleAppend(baseDir string, args json.RawMessage) (string, error) {
 	var p struct {
 		Path    string `json:"path"`
 		Content string `json:"content"`
+		textNormalization
 	}
 	if err := json.Unmarshal(args, &p); err != nil {
 		return "", fmt.Errorf("parse arguments: %w", err)
 	}
+	content, report := p.apply(p.Content)
 	abs, err := sanitizePath(baseDir, p.Path)
 	if err != nil {
 		return "", err
@@ -348,15 +607,19 @@ func handleAppend(baseDir string, args json.RawMessage) (string, error) {
 		return "", fmt.Errorf("open file for append: %w", err)
 	}
 	defer f.Close()
-	n, err := f.WriteString(p.Content)
+	n, err := f.WriteString(content)
 	if err != nil {
 		return "", fmt.Errorf("append to file: %w", err)
 	}
-	out, _ := json.Marshal(map[string]any{
+	result := map[string]any{
 		"status":        "ok",
 		"path":          p.Path,
 		"bytes_written": n,
-	})
+	}
+	for k, v := range report {
+		result[k] = v
+	}
+	out, _ := json.Marshal(result)
 	return string(out), nil
 }
 
@@ -366,6 +629,7 @@ func handleEdit(baseDir string, args json.RawMessage) (string, error) {
 		Mode                 string `json:"mode"`
 		Search               string `json:"search"`
 		Replace              string `json:"replace"`
+		ReplaceAll           bool   `json:"replace_all"`
 		StartLine            int    `json:"start_line"`
 		EndLine              int    `json:"end_line"`
 		Apply                bool   `json:"apply"`
@@ -395,6 +659,7 @@ func handleEdit(baseDir string, args json.RawMessage) (string, error) {
 	var (
 		edited     string
 		matchCount int
+		matchLines []int
 	)
 	switch mode {
 	case "regex_replace":
@@ -407,8 +672,16 @@ func handleEdit(baseDir string, args json.RawMessage) (string, error) {
 		}
 		matches := re.FindAllStringIndex(original, -1)
 		matchCount = len(matches)
-		if matchCount != 1 {
-			return "", fmt.Errorf("regex must match exactly once; got %d matches", matchCount)
+		if p.ReplaceAll {
+			if matchCount == 0 {
+				return "", fmt.Errorf("regex matched nothing")
+			}
+			matchLines = make([]int, 0, matchCount)
+			for _, m := range matches {
+				matchLines = append(matchLines, strings.Count(original[:m[0]], "\n")+1)
+			}
+		} else if matchCount != 1 {
+			return "", fmt.Errorf("regex must match exactly once; got %d matches (set replace_all=true to replace every match)", matchCount)
 		}
 		edited = re.ReplaceAllString(original, p.Replace)
 	case "line_replace":
@@ -453,6 +726,16 @@ func handleEdit(baseDir string, args json.RawMessage) (string, error) {
 	}
 	if mode == "regex_replace" {
 		resp["match_count"] = matchCount
+		resp["replace_all"] = p.ReplaceAll
+	}
+	if len(matchLines) > 0 {
+		resp["match_lines"] = matchLines
+	}
+	if diff := unifiedDiff(p.Path, original, edited); len(diff) > maxUnifiedDiffBytes {
+		resp["unified_diff"] = clipPreview(diff, maxUnifiedDiffBytes)
+		resp["unified_diff_truncated"] = true
+	} else {
+		resp["unified_diff"] = diff
 	}
 
 	if !p.Apply || !changed {
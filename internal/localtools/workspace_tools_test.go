@@ -2,11 +2,13 @@ package localtools
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -100,6 +102,67 @@ func TestWorkspaceWriteAndRead(t *testing.T) {
 	}
 }
 
+func TestWorkspaceWriteBase64(t *testing.T) {
+	base := t.TempDir()
+	ctx := context.Background()
+
+	var writeB64 *WorkspaceFileTool
+	for _, tt := range BuildWorkspaceTools(base) {
+		if tt.name == "workspace_write_base64" {
+			writeB64 = tt
+		}
+	}
+	if writeB64 == nil {
+		t.Fatal("workspace_write_base64 not registered")
+	}
+
+	payload := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0x10}
+	encoded := base64.StdEncoding.EncodeToString(payload)
+	args, _ := json.Marshal(map[string]any{"path": "img/out.png", "content": encoded[:4] + "\n" + encoded[4:]})
+	out, err := writeB64.InvokableRun(ctx, string(args))
+	if err != nil {
+		t.Fatalf("InvokableRun() error = %v", err)
+	}
+	var resp map[string]any
+	json.Unmarshal([]byte(out), &resp)
+	if resp["status"] != "ok" {
+		t.Fatalf("status: %v", resp)
+	}
+	if int(resp["bytes_written"].(float64)) != len(payload) {
+		t.Fatalf("bytes_written = %v, want %d", resp["bytes_written"], len(payload))
+	}
+	got, err := os.ReadFile(filepath.Join(base, "img", "out.png"))
+	if err != nil {
+		t.Fatalf("read written file: %v", err)
+	}
+	if string(got) != string(payload) {
+		t.Fatalf("content = %v, want %v", got, payload)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		path    string
+		content string
+		wantErr string
+	}{
+		{name: "invalid base64", path: "bad.bin", content: "not*base64", wantErr: "decode base64"},
+		{name: "path traversal", path: "../escape.bin", content: encoded, wantErr: "escapes workspace"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			args, _ := json.Marshal(map[string]any{"path": tc.path, "content": tc.content})
+			out, err := writeB64.InvokableRun(ctx, string(args))
+			if err != nil {
+				t.Fatalf("InvokableRun() error = %v", err)
+			}
+			var resp map[string]any
+			json.Unmarshal([]byte(out), &resp)
+			if resp["status"] != "error" || !strings.Contains(resp["error"].(string), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %s", tc.wantErr, out)
+			}
+		})
+	}
+}
+
 func TestWorkspaceReadTruncation(t *testing.T) {
 	base := t.TempDir()
 	tools := BuildWorkspaceTools(base)
@@ -133,6 +196,91 @@ func TestWorkspaceReadTruncation(t *testing.T) {
 	}
 }
 
+func TestWorkspaceReadJSON(t *testing.T) {
+	base := t.TempDir()
+	ctx := context.Background()
+	os.WriteFile(filepath.Join(base, "data.json"), []byte(`{"results":{"items":[{"name":"first"},{"name":"second"}]}}`), 0o644)
+	os.WriteFile(filepath.Join(base, "broken.json"), []byte(`{"results": [1, 2,}`), 0o644)
+
+	var readJSON *WorkspaceFileTool
+	for _, tt := range BuildWorkspaceTools(base) {
+		if tt.name == "workspace_read_json" {
+			readJSON = tt
+		}
+	}
+	if readJSON == nil {
+		t.Fatal("workspace_read_json not registered")
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		selector  string
+		wantValue string
+		wantType  string
+		wantErr   string
+	}{
+		{name: "whole document", path: "data.json", wantType: "object", wantValue: `{"results":{"items":[{"name":"first"},{"name":"second"}]}}`},
+		{name: "nested index", path: "data.json", selector: "results.items.1.name", wantType: "string", wantValue: `"second"`},
+		{name: "array", path: "data.json", selector: "results.items", wantType: "array", wantValue: `[{"name":"first"},{"name":"second"}]`},
+		{name: "missing key", path: "data.json", selector: "results.missing", wantErr: `key "missing" not found`},
+		{name: "index out of range", path: "data.json", selector: "results.items.5", wantErr: "out of range"},
+		{name: "descend into scalar", path: "data.json", selector: "results.items.0.name.x", wantErr: "cannot descend into string"},
+		{name: "syntax error offset", path: "broken.json", wantErr: "offset 19"},
+		{name: "path traversal", path: "../outside.json", wantErr: "escapes workspace"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			args, _ := json.Marshal(map[string]any{"path": tc.path, "selector": tc.selector})
+			out, err := readJSON.InvokableRun(ctx, string(args))
+			if err != nil {
+				t.Fatalf("InvokableRun() error = %v", err)
+			}
+			var resp struct {
+				Status string          `json:"status"`
+				Error  string          `json:"error"`
+				Type   string          `json:"type"`
+				Value  json.RawMessage `json:"value"`
+			}
+			if err := json.Unmarshal([]byte(out), &resp); err != nil {
+				t.Fatalf("unmarshal output: %v", err)
+			}
+			if tc.wantErr != "" {
+				if resp.Status != "error" || !strings.Contains(resp.Error, tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %s", tc.wantErr, out)
+				}
+				return
+			}
+			if resp.Status != "ok" {
+				t.Fatalf("status = %q, output %s", resp.Status, out)
+			}
+			if resp.Type != tc.wantType {
+				t.Fatalf("type = %q, want %q", resp.Type, tc.wantType)
+			}
+			if string(resp.Value) != tc.wantValue {
+				t.Fatalf("value = %s, want %s", resp.Value, tc.wantValue)
+			}
+		})
+	}
+
+	args, _ := json.Marshal(map[string]any{"path": "data.json", "selector": "results.items", "max_bytes": 10})
+	out, err := readJSON.InvokableRun(ctx, string(args))
+	if err != nil {
+		t.Fatalf("InvokableRun() error = %v", err)
+	}
+	var capped struct {
+		Value     string `json:"value"`
+		Truncated bool   `json:"truncated"`
+		Bytes     int    `json:"bytes"`
+	}
+	if err := json.Unmarshal([]byte(out), &capped); err != nil {
+		t.Fatalf("unmarshal capped output: %v (%s)", err, out)
+	}
+	if !capped.Truncated || capped.Value != `[{"name":"` || capped.Bytes != 36 {
+		t.Fatalf("capped output = %s, want the first 10 bytes of 36", out)
+	}
+}
+
 func TestWorkspaceList(t *testing.T) {
 	base := t.TempDir()
 	tools := BuildWorkspaceTools(base)
@@ -200,6 +348,56 @@ func TestWorkspaceAppend(t *testing.T) {
 	}
 }
 
+func TestWorkspaceWriteNormalization(t *testing.T) {
+	base := t.TempDir()
+	tools := BuildWorkspaceTools(base)
+	ctx := context.Background()
+
+	var writeTool, appendTool *WorkspaceFileTool
+	for _, tt := range tools {
+		switch tt.name {
+		case "workspace_write":
+			writeTool = tt
+		case "workspace_append":
+			appendTool = tt
+		}
+	}
+
+	// Defaults leave content untouched and report nothing extra.
+	args, _ := json.Marshal(map[string]any{"path": "raw.txt", "content": "\uFEFFa\r\nb"})
+	out, _ := writeTool.InvokableRun(ctx, string(args))
+	var resp map[string]any
+	json.Unmarshal([]byte(out), &resp)
+	if _, ok := resp["normalized"]; ok {
+		t.Fatalf("expected no normalization report by default: %s", out)
+	}
+	data, _ := os.ReadFile(filepath.Join(base, "raw.txt"))
+	if string(data) != "\uFEFFa\r\nb" {
+		t.Fatalf("default write changed content: %q", data)
+	}
+
+	args, _ = json.Marshal(map[string]any{"path": "clean.txt", "content": "\uFEFFa\r\nb\r\n", "normalize_newlines": true, "strip_bom": true})
+	out, _ = writeTool.InvokableRun(ctx, string(args))
+	resp = nil
+	json.Unmarshal([]byte(out), &resp)
+	if resp["normalized"] != true || resp["bytes_removed"] != float64(5) || resp["bytes_written"] != float64(4) {
+		t.Fatalf("unexpected write result: %s", out)
+	}
+
+	args, _ = json.Marshal(map[string]any{"path": "clean.txt", "content": "c\n", "normalize_newlines": true})
+	out, _ = appendTool.InvokableRun(ctx, string(args))
+	resp = nil
+	json.Unmarshal([]byte(out), &resp)
+	if resp["normalized"] != false || resp["bytes_removed"] != float64(0) {
+		t.Fatalf("unexpected append result: %s", out)
+	}
+
+	data, _ = os.ReadFile(filepath.Join(base, "clean.txt"))
+	if string(data) != "a\nb\nc\n" {
+		t.Fatalf("unexpected normalized content: %q", data)
+	}
+}
+
 func TestWorkspaceEditRegexPreviewThenApply(t *testing.T) {
 	base := t.TempDir()
 	if err := os.WriteFile(filepath.Join(base, "doc.txt"), []byte("alpha\nbeta\n"), 0o644); err != nil {
@@ -268,6 +466,71 @@ func TestWorkspaceEditRegexPreviewThenApply(t *testing.T) {
 	}
 }
 
+func TestWorkspaceEditConcurrentAppliesSerialize(t *testing.T) {
+	base := t.TempDir()
+	if err := os.WriteFile(filepath.Join(base, "log.txt"), []byte("end\n"), 0o644); err != nil {
+		t.Fatalf("seed file: %v", err)
+	}
+	editTool := findWorkspaceTool(t, BuildWorkspaceTools(base), "workspace_edit")
+	ctx := context.Background()
+
+	// Each worker inserts its own line before "end" with preview then apply,
+	// retrying on a hash mismatch. Lost updates would drop lines.
+	const workers = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			line := fmt.Sprintf("worker-%02d", i)
+			for attempt := 0; attempt < 200; attempt++ {
+				args := map[string]any{"path": "log.txt", "search": "(?m)^end$", "replace": line + "\nend"}
+				previewArgs, _ := json.Marshal(args)
+				previewOut, _ := editTool.InvokableRun(ctx, string(previewArgs))
+				var preview struct {
+					OriginalHash string `json:"original_sha256"`
+				}
+				if err := json.Unmarshal([]byte(previewOut), &preview); err != nil || preview.OriginalHash == "" {
+					errs <- fmt.Errorf("%s preview: %s", line, previewOut)
+					return
+				}
+				args["apply"] = true
+				args["expected_original_sha256"] = preview.OriginalHash
+				applyArgs, _ := json.Marshal(args)
+				applyOut, _ := editTool.InvokableRun(ctx, string(applyArgs))
+				if strings.Contains(applyOut, `"applied":true`) {
+					return
+				}
+				if !strings.Contains(applyOut, "mismatch") {
+					errs <- fmt.Errorf("%s apply: %s", line, applyOut)
+					return
+				}
+			}
+			errs <- fmt.Errorf("%s: gave up after repeated hash mismatches", line)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(base, "log.txt"))
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	content := string(data)
+	for i := 0; i < workers; i++ {
+		if n := strings.Count(content, fmt.Sprintf("worker-%02d\n", i)); n != 1 {
+			t.Fatalf("worker-%02d appears %d times in:\n%s", i, n, content)
+		}
+	}
+	if !strings.HasSuffix(content, "\nend\n") || strings.Count(content, "end\n") != 1 {
+		t.Fatalf("unexpected file:\n%s", content)
+	}
+}
+
 func TestWorkspaceEditRegexRequiresSingleMatch(t *testing.T) {
 	base := t.TempDir()
 	if err := os.WriteFile(filepath.Join(base, "doc.txt"), []byte("dup dup\n"), 0o644); err != nil {
@@ -297,6 +560,97 @@ func TestWorkspaceEditRegexRequiresSingleMatch(t *testing.T) {
 	}
 }
 
+func TestWorkspaceEditRegexReplaceAll(t *testing.T) {
+	base := t.TempDir()
+	if err := os.WriteFile(filepath.Join(base, "doc.txt"), []byte("dup one\nkeep\ndup two\n"), 0o644); err != nil {
+		t.Fatalf("seed file: %v", err)
+	}
+	editTool := findWorkspaceTool(t, BuildWorkspaceTools(base), "workspace_edit")
+	ctx := context.Background()
+
+	previewArgs, _ := json.Marshal(map[string]any{
+		"path":        "doc.txt",
+		"mode":        "regex_replace",
+		"search":      "dup",
+		"replace":     "uniq",
+		"replace_all": true,
+	})
+	previewOut, err := editTool.InvokableRun(ctx, string(previewArgs))
+	if err != nil {
+		t.Fatalf("preview error: %v", err)
+	}
+	var previewResp struct {
+		Status       string `json:"status"`
+		Applied      bool   `json:"applied"`
+		MatchCount   int    `json:"match_count"`
+		MatchLines   []int  `json:"match_lines"`
+		OriginalHash string `json:"original_sha256"`
+		UnifiedDiff  string `json:"unified_diff"`
+		DiffPreview  struct {
+			LineStart     int    `json:"line_start"`
+			BeforeLineEnd int    `json:"before_line_end"`
+			AfterExcerpt  string `json:"after_excerpt"`
+		} `json:"diff_preview"`
+	}
+	if err := json.Unmarshal([]byte(previewOut), &previewResp); err != nil {
+		t.Fatalf("decode preview response: %v", err)
+	}
+	if previewResp.Status != "ok" || previewResp.Applied || previewResp.MatchCount != 2 {
+		t.Fatalf("unexpected preview response: %s", previewOut)
+	}
+	if fmt.Sprint(previewResp.MatchLines) != "[1 3]" {
+		t.Fatalf("match_lines = %v, want [1 3]", previewResp.MatchLines)
+	}
+	if previewResp.DiffPreview.LineStart != 1 || previewResp.DiffPreview.BeforeLineEnd != 3 || previewResp.DiffPreview.AfterExcerpt != "uniq one\nkeep\nuniq two" {
+		t.Fatalf("unexpected diff preview: %+v", previewResp.DiffPreview)
+	}
+	wantDiff := "--- a/doc.txt\n+++ b/doc.txt\n@@ -1,3 +1,3 @@\n-dup one\n+uniq one\n keep\n-dup two\n+uniq two\n"
+	if previewResp.UnifiedDiff != wantDiff {
+		t.Fatalf("unified_diff = %q, want %q", previewResp.UnifiedDiff, wantDiff)
+	}
+
+	// Apply still requires the preview hash.
+	applyArgs := map[string]any{
+		"path":        "doc.txt",
+		"mode":        "regex_replace",
+		"search":      "dup",
+		"replace":     "uniq",
+		"replace_all": true,
+		"apply":       true,
+	}
+	args, _ := json.Marshal(applyArgs)
+	out, _ := editTool.InvokableRun(ctx, string(args))
+	if !strings.Contains(out, "expected_original_sha256 is required") {
+		t.Fatalf("expected hash requirement, got %s", out)
+	}
+
+	applyArgs["expected_original_sha256"] = previewResp.OriginalHash
+	args, _ = json.Marshal(applyArgs)
+	out, err = editTool.InvokableRun(ctx, string(args))
+	if err != nil {
+		t.Fatalf("apply error: %v", err)
+	}
+	if !strings.Contains(out, `"applied":true`) {
+		t.Fatalf("expected applied response, got %s", out)
+	}
+	updated, _ := os.ReadFile(filepath.Join(base, "doc.txt"))
+	if string(updated) != "uniq one\nkeep\nuniq two\n" {
+		t.Fatalf("unexpected file after apply: %q", string(updated))
+	}
+
+	noMatchArgs, _ := json.Marshal(map[string]any{
+		"path":        "doc.txt",
+		"mode":        "regex_replace",
+		"search":      "absent",
+		"replace":     "x",
+		"replace_all": true,
+	})
+	out, _ = editTool.InvokableRun(ctx, string(noMatchArgs))
+	if !strings.Contains(out, "regex matched nothing") {
+		t.Fatalf("expected no-match error, got %s", out)
+	}
+}
+
 func TestWorkspaceEditLineReplace(t *testing.T) {
 	base := t.TempDir()
 	if err := os.WriteFile(filepath.Join(base, "doc.txt"), []byte("a\nb\nc\n"), 0o644); err != nil {
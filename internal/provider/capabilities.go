@@ -0,0 +1,32 @@
+package provider
+
+import (
+	"github.com/cloudwego/eino/components/model"
+
+	"github.com/cloudwego/eino-ext/components/model/openai"
+
+	"github.com/mattjoyce/agenticloop/internal/config"
+)
+
+// SupportsJSONMode reports whether the configured provider can constrain a
+// single call to emit a JSON object. llm.json_mode: false opts out, which is
+// useful for OpenAI-compatible endpoints that reject response_format.
+func SupportsJSONMode(cfg config.LLMConfig) bool {
+	if cfg.JSONMode != nil && !*cfg.JSONMode {
+		return false
+	}
+	return cfg.Provider == "openai" || cfg.Provider == "azure_openai"
+}
+
+// JSONModeOptions returns per-call options that enable JSON mode, or nil when
+// the provider does not support it.
+func JSONModeOptions(cfg config.LLMConfig) []model.Option {
+	if !SupportsJSONMode(cfg) {
+		return nil
+	}
+	return []model.Option{
+		openai.WithExtraFields(map[string]any{
+			"response_format": map[string]string{"type": "json_object"},
+		}),
+	}
+}
@@ -3,6 +3,7 @@ package provider
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	"github.com/cloudwego/eino/components/model"
 
@@ -13,25 +14,83 @@ import (
 	"github.com/mattjoyce/agenticloop/internal/config"
 )
 
-// NewChatModel creates an Eino ChatModel from config.
+// NewChatModel creates an Eino ChatModel from config. When llm.fallbacks is
+// set, the primary and its fallbacks are wrapped in a FallbackModel.
 func NewChatModel(ctx context.Context, cfg config.LLMConfig) (model.ToolCallingChatModel, error) {
+	primary, err := newProviderModel(ctx, cfg)
+	if err != nil || len(cfg.Fallbacks) == 0 {
+		return primary, err
+	}
+
+	candidates := []Candidate{{Name: candidateName(cfg), Model: primary}}
+	for i, fb := range cfg.Fallbacks {
+		m, err := newProviderModel(ctx, fb)
+		if err != nil {
+			return nil, fmt.Errorf("llm.fallbacks[%d]: %w", i, err)
+		}
+		candidates = append(candidates, Candidate{Name: candidateName(fb), Model: m})
+	}
+	return NewFallbackModel(candidates, cfg.FailoverRetries, cfg.FailoverBackoff, nil), nil
+}
+
+// NewModels builds a model for each of cfg.AllowedModels, with cfg's
+// provider settings and fallbacks, and returns them keyed by name together
+// with primary under cfg.Model. agent.stage_models and the model constraint
+// select from the result.
+func NewModels(ctx context.Context, cfg config.LLMConfig, primary model.ToolCallingChatModel) (map[string]model.ToolCallingChatModel, error) {
+	out := map[string]model.ToolCallingChatModel{cfg.Model: primary}
+	for _, name := range cfg.AllowedModels {
+		if _, ok := out[name]; ok {
+			continue
+		}
+		m, err := NewChatModel(ctx, withModel(cfg, name))
+		if err != nil {
+			return nil, fmt.Errorf("llm.allowed_models %s: %w", name, err)
+		}
+		out[name] = m
+	}
+	return out, nil
+}
+
+// withModel returns cfg serving name instead of cfg.Model. An Azure
+// deployment is taken from the model name.
+func withModel(cfg config.LLMConfig, name string) config.LLMConfig {
+	cfg.Model = name
+	cfg.Deployment = ""
+	return cfg
+}
+
+// candidateName labels a provider as provider/model for logs and step output.
+func candidateName(cfg config.LLMConfig) string {
+	if cfg.Provider == "azure_openai" {
+		return cfg.Provider + "/" + azureDeployment(cfg)
+	}
+	return cfg.Provider + "/" + cfg.Model
+}
+
+func newProviderModel(ctx context.Context, cfg config.LLMConfig) (model.ToolCallingChatModel, error) {
 	switch cfg.Provider {
 	case "anthropic":
 		return newAnthropicModel(ctx, cfg)
 	case "openai":
 		return newOpenAIModel(ctx, cfg)
+	case "azure_openai":
+		return newAzureOpenAIModel(ctx, cfg)
 	case "ollama":
 		return newOllamaModel(ctx, cfg)
 	default:
-		return nil, fmt.Errorf("unsupported llm provider: %q (supported: anthropic, openai, ollama)", cfg.Provider)
+		return nil, fmt.Errorf("unsupported llm provider: %q (supported: anthropic, openai, azure_openai, ollama)", cfg.Provider)
 	}
 }
 
 func newAnthropicModel(ctx context.Context, cfg config.LLMConfig) (model.ToolCallingChatModel, error) {
 	claudeCfg := &claude.Config{
-		APIKey:    cfg.APIKey,
-		Model:     cfg.Model,
-		MaxTokens: cfg.MaxTokens,
+		APIKey:      cfg.APIKey,
+		Model:       cfg.Model,
+		MaxTokens:   cfg.MaxTokens,
+		Temperature: cfg.Temperature,
+		TopP:        cfg.TopP,
+		HTTPClient:  &http.Client{Timeout: cfg.RequestTimeout},
 	}
 	if cfg.BaseURL != "" {
 		claudeCfg.BaseURL = &cfg.BaseURL
@@ -46,8 +105,12 @@ func newAnthropicModel(ctx context.Context, cfg config.LLMConfig) (model.ToolCal
 
 func newOpenAIModel(ctx context.Context, cfg config.LLMConfig) (model.ToolCallingChatModel, error) {
 	openAICfg := &openai.ChatModelConfig{
-		APIKey: cfg.APIKey,
-		Model:  cfg.Model,
+		APIKey:      cfg.APIKey,
+		Model:       cfg.Model,
+		MaxTokens:   maxTokens(cfg),
+		Temperature: cfg.Temperature,
+		TopP:        cfg.TopP,
+		Timeout:     cfg.RequestTimeout,
 	}
 	if cfg.BaseURL != "" {
 		openAICfg.BaseURL = cfg.BaseURL
@@ -60,6 +123,46 @@ func newOpenAIModel(ctx context.Context, cfg config.LLMConfig) (model.ToolCallin
 	return m, nil
 }
 
+// newAzureOpenAIModel targets an Azure OpenAI deployment. Requests go to
+// {base_url}/openai/deployments/{deployment}/chat/completions?api-version={api_version}.
+func newAzureOpenAIModel(ctx context.Context, cfg config.LLMConfig) (model.ToolCallingChatModel, error) {
+	deployment := azureDeployment(cfg)
+	m, err := openai.NewChatModel(ctx, &openai.ChatModelConfig{
+		APIKey:               cfg.APIKey,
+		ByAzure:              true,
+		BaseURL:              cfg.BaseURL,
+		APIVersion:           cfg.APIVersion,
+		Model:                deployment,
+		AzureModelMapperFunc: func(string) string { return deployment },
+		MaxTokens:            maxTokens(cfg),
+		Temperature:          cfg.Temperature,
+		TopP:                 cfg.TopP,
+		Timeout:              cfg.RequestTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create azure openai model: %w", err)
+	}
+	return m, nil
+}
+
+// maxTokens returns llm.max_tokens for the OpenAI-compatible configs, or nil
+// to leave the provider default in place.
+func maxTokens(cfg config.LLMConfig) *int {
+	if cfg.MaxTokens <= 0 {
+		return nil
+	}
+	n := cfg.MaxTokens
+	return &n
+}
+
+// azureDeployment returns the Azure deployment name, falling back to the model.
+func azureDeployment(cfg config.LLMConfig) string {
+	if cfg.Deployment != "" {
+		return cfg.Deployment
+	}
+	return cfg.Model
+}
+
 func newOllamaModel(ctx context.Context, cfg config.LLMConfig) (model.ToolCallingChatModel, error) {
 	baseURL := cfg.BaseURL
 	if baseURL == "" {
@@ -69,6 +172,17 @@ func newOllamaModel(ctx context.Context, cfg config.LLMConfig) (model.ToolCallin
 	ollamaCfg := &ollama.ChatModelConfig{
 		BaseURL: baseURL,
 		Model:   cfg.Model,
+		Timeout: cfg.RequestTimeout,
+	}
+	if cfg.MaxTokens > 0 || cfg.Temperature != nil || cfg.TopP != nil {
+		opts := &ollama.Options{NumPredict: cfg.MaxTokens}
+		if cfg.Temperature != nil {
+			opts.Temperature = *cfg.Temperature
+		}
+		if cfg.TopP != nil {
+			opts.TopP = *cfg.TopP
+		}
+		ollamaCfg.Options = opts
 	}
 
 	m, err := ollama.NewChatModel(ctx, ollamaCfg)
@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/mattjoyce/agenticloop/internal/config"
+)
+
+func TestNewChatModelSendsMaxTokens(t *testing.T) {
+	cases := map[string]string{
+		"openai":       `"max_tokens":321`,
+		"azure_openai": `"max_tokens":321`,
+		"ollama":       `"num_predict":321`,
+	}
+	for providerName, want := range cases {
+		t.Run(providerName, func(t *testing.T) {
+			bodies := make(chan string, 1)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				select {
+				case bodies <- string(body):
+				default:
+				}
+				http.Error(w, "stop here", http.StatusBadRequest)
+			}))
+			defer srv.Close()
+
+			m, err := NewChatModel(context.Background(), config.LLMConfig{
+				Provider:   providerName,
+				Model:      "test-model",
+				APIKey:     "test-key",
+				BaseURL:    srv.URL,
+				APIVersion: "2024-06-01",
+				MaxTokens:  321,
+			})
+			if err != nil {
+				t.Fatalf("NewChatModel: %v", err)
+			}
+			_, _ = m.Generate(context.Background(), []*schema.Message{schema.UserMessage("hi")})
+
+			select {
+			case body := <-bodies:
+				if !strings.Contains(body, want) {
+					t.Fatalf("request body %s does not contain %s", body, want)
+				}
+			default:
+				t.Fatalf("provider sent no request")
+			}
+		})
+	}
+}
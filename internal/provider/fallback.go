@@ -0,0 +1,194 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ServedByKey is the schema.Message Extra key naming the provider that
+// produced a response from a fallback chain.
+const ServedByKey = "agenticloop_served_by"
+
+// Candidate is one provider in a fallback chain.
+type Candidate struct {
+	// Name identifies the provider in logs and step output, e.g. "openai/gpt-4o".
+	Name  string
+	Model model.ToolCallingChatModel
+}
+
+// FallbackModel tries each candidate in order for every call, moving to the
+// next one when a provider keeps failing with a retryable error. A candidate
+// is retried up to retries times first, waiting backoff and doubling it after
+// each attempt; the last candidate is not retried, since callers retry the
+// whole chain. A non-retryable error (bad request, invalid key) is returned
+// as-is without retrying or failing over.
+type FallbackModel struct {
+	candidates []Candidate
+	retries    int
+	backoff    time.Duration
+	logger     *slog.Logger
+}
+
+var _ model.ToolCallingChatModel = (*FallbackModel)(nil)
+
+// NewFallbackModel chains candidates, primary first.
+func NewFallbackModel(candidates []Candidate, retries int, backoff time.Duration, logger *slog.Logger) *FallbackModel {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &FallbackModel{candidates: candidates, retries: retries, backoff: backoff, logger: logger}
+}
+
+// Generate returns the first successful response, tagged with ServedByKey.
+func (m *FallbackModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	var errs []error
+	for i, c := range m.candidates {
+		var resp *schema.Message
+		err := m.retry(ctx, i, c.Name, func() (err error) {
+			resp, err = c.Model.Generate(ctx, input, opts...)
+			return err
+		})
+		if err == nil {
+			return tagServedBy(resp, c.Name), nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", c.Name, err))
+		if !m.failOver(ctx, i, c.Name, err) {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// Stream fails over only while opening the stream; errors mid-stream are the
+// caller's to handle.
+func (m *FallbackModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	var errs []error
+	for i, c := range m.candidates {
+		var sr *schema.StreamReader[*schema.Message]
+		err := m.retry(ctx, i, c.Name, func() (err error) {
+			sr, err = c.Model.Stream(ctx, input, opts...)
+			return err
+		})
+		if err == nil {
+			return sr, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", c.Name, err))
+		if !m.failOver(ctx, i, c.Name, err) {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// WithTools binds tools on every candidate.
+func (m *FallbackModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	bound := make([]Candidate, 0, len(m.candidates))
+	for _, c := range m.candidates {
+		tm, err := c.Model.WithTools(tools)
+		if err != nil {
+			return nil, fmt.Errorf("bind tools on %s: %w", c.Name, err)
+		}
+		bound = append(bound, Candidate{Name: c.Name, Model: tm})
+	}
+	return &FallbackModel{candidates: bound, retries: m.retries, backoff: m.backoff, logger: m.logger}, nil
+}
+
+// retry calls candidate i through call until it succeeds, fails with a
+// non-retryable error, or has been retried m.retries times.
+func (m *FallbackModel) retry(ctx context.Context, i int, name string, call func() error) error {
+	backoff := m.backoff
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt > m.retries || i == len(m.candidates)-1 || ctx.Err() != nil || !IsRetryable(err) {
+			return err
+		}
+		m.logger.Warn("llm provider failed, retrying", "provider", name, "attempt", attempt, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// failOver reports whether the call should move past candidate i.
+func (m *FallbackModel) failOver(ctx context.Context, i int, name string, err error) bool {
+	if ctx.Err() != nil || i == len(m.candidates)-1 || !IsRetryable(err) {
+		return false
+	}
+	m.logger.Warn("llm provider failed, falling back", "provider", name, "next", m.candidates[i+1].Name, "error", err)
+	return true
+}
+
+func tagServedBy(resp *schema.Message, name string) *schema.Message {
+	if resp == nil {
+		return nil
+	}
+	extra := make(map[string]any, len(resp.Extra)+1)
+	for k, v := range resp.Extra {
+		extra[k] = v
+	}
+	extra[ServedByKey] = name
+	out := *resp
+	out.Extra = extra
+	return &out
+}
+
+// ServedBy returns the provider name a fallback chain recorded on msg, or ""
+// when the response did not come through a chain.
+func ServedBy(msg *schema.Message) string {
+	if msg == nil {
+		return ""
+	}
+	name, _ := msg.Extra[ServedByKey].(string)
+	return name
+}
+
+var retryableStatusPattern = regexp.MustCompile(`\b(408|429|500|502|503|504|529)\b`)
+
+var retryableMessages = []string{
+	"rate limit",
+	"overloaded",
+	"timeout",
+	"timed out",
+	"connection refused",
+	"connection reset",
+	"no such host",
+	"service unavailable",
+}
+
+// IsRetryable classifies provider errors that another provider might not
+// share: rate limits, 5xx responses, timeouts, and network failures.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	if retryableStatusPattern.MatchString(msg) {
+		return true
+	}
+	for _, s := range retryableMessages {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
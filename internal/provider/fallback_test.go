@@ -0,0 +1,124 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+type stubModel struct {
+	err   error
+	calls int
+	// failures, when set, limits err to the first failures calls.
+	failures int
+}
+
+func (m *stubModel) Generate(_ context.Context, _ []*schema.Message, _ ...model.Option) (*schema.Message, error) {
+	m.calls++
+	if m.err != nil && (m.failures == 0 || m.calls <= m.failures) {
+		return nil, m.err
+	}
+	return &schema.Message{Role: schema.Assistant, Content: "ok"}, nil
+}
+
+func (m *stubModel) Stream(_ context.Context, _ []*schema.Message, _ ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *stubModel) WithTools(_ []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+func TestFallbackModelFailsOverOnRetryableError(t *testing.T) {
+	primary := &stubModel{err: errors.New("error, status code: 429, message: rate limit reached")}
+	secondary := &stubModel{}
+	m := NewFallbackModel([]Candidate{
+		{Name: "openai/gpt-4o", Model: primary},
+		{Name: "anthropic/claude", Model: secondary},
+	}, 0, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	resp, err := m.Generate(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if got := ServedBy(resp); got != "anthropic/claude" {
+		t.Fatalf("served by = %q, want anthropic/claude", got)
+	}
+	if primary.calls != 1 || secondary.calls != 1 {
+		t.Fatalf("calls = %d/%d, want 1/1", primary.calls, secondary.calls)
+	}
+}
+
+func TestFallbackModelRetriesPrimaryBeforeFailingOver(t *testing.T) {
+	primary := &stubModel{err: errors.New("status code: 503"), failures: 2}
+	secondary := &stubModel{}
+	m := NewFallbackModel([]Candidate{
+		{Name: "openai/gpt-4o", Model: primary},
+		{Name: "anthropic/claude", Model: secondary},
+	}, 2, time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	resp, err := m.Generate(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if got := ServedBy(resp); got != "openai/gpt-4o" {
+		t.Fatalf("served by = %q, want openai/gpt-4o", got)
+	}
+	if primary.calls != 3 || secondary.calls != 0 {
+		t.Fatalf("calls = %d/%d, want 3/0", primary.calls, secondary.calls)
+	}
+
+	primary = &stubModel{err: errors.New("status code: 503")}
+	secondary = &stubModel{err: errors.New("status code: 503")}
+	m = NewFallbackModel([]Candidate{
+		{Name: "openai/gpt-4o", Model: primary},
+		{Name: "anthropic/claude", Model: secondary},
+	}, 2, time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if _, err := m.Generate(context.Background(), nil); err == nil {
+		t.Fatalf("expected error when every provider fails")
+	}
+	if primary.calls != 3 || secondary.calls != 1 {
+		t.Fatalf("calls = %d/%d, want 3/1 (last provider is not retried)", primary.calls, secondary.calls)
+	}
+}
+
+func TestFallbackModelStopsOnNonRetryableError(t *testing.T) {
+	primary := &stubModel{err: errors.New("error, status code: 400, message: invalid request")}
+	secondary := &stubModel{}
+	m := NewFallbackModel([]Candidate{
+		{Name: "openai/gpt-4o", Model: primary},
+		{Name: "anthropic/claude", Model: secondary},
+	}, 0, 0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	_, err := m.Generate(context.Background(), nil)
+	if err == nil || !strings.Contains(err.Error(), "openai/gpt-4o: error, status code: 400") {
+		t.Fatalf("expected primary error, got %v", err)
+	}
+	if secondary.calls != 0 {
+		t.Fatalf("fallback called %d times on non-retryable error", secondary.calls)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	cases := map[string]bool{
+		"status code: 503":                  true,
+		"anthropic: overloaded_error":       true,
+		"dial tcp: connection refused":      true,
+		"status code: 401, invalid api key": false,
+	}
+	for msg, want := range cases {
+		if got := IsRetryable(errors.New(msg)); got != want {
+			t.Errorf("IsRetryable(%q) = %v, want %v", msg, got, want)
+		}
+	}
+	if IsRetryable(context.Canceled) {
+		t.Errorf("context.Canceled should not be retryable")
+	}
+}
@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattjoyce/agenticloop/internal/config"
+)
+
+// Ping performs a lightweight authenticated request against the provider's
+// model listing endpoint. It does not call the model, so it costs no tokens.
+func Ping(ctx context.Context, cfg config.LLMConfig) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var url string
+	header := http.Header{}
+	switch cfg.Provider {
+	case "openai":
+		url = strings.TrimRight(orDefault(cfg.BaseURL, "https://api.openai.com/v1"), "/") + "/models"
+		header.Set("Authorization", "Bearer "+cfg.APIKey)
+	case "azure_openai":
+		url = strings.TrimRight(cfg.BaseURL, "/") + "/openai/models?api-version=" + cfg.APIVersion
+		header.Set("api-key", cfg.APIKey)
+	case "anthropic":
+		url = strings.TrimRight(orDefault(cfg.BaseURL, "https://api.anthropic.com"), "/") + "/v1/models"
+		header.Set("x-api-key", cfg.APIKey)
+		header.Set("anthropic-version", "2023-06-01")
+	case "ollama":
+		url = strings.TrimRight(orDefault(cfg.BaseURL, "http://localhost:11434"), "/") + "/api/tags"
+	default:
+		return fmt.Errorf("unsupported llm provider: %q", cfg.Provider)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("build provider ping: %w", err)
+	}
+	req.Header = header
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("provider unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("provider returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is one versioned schema change. Versions are applied in
+// ascending order, each in its own transaction, and recorded in
+// schema_migrations so they run once per database.
+//
+// Migrations must tolerate a schema that already has their change: databases
+// created before schema_migrations existed were kept current by
+// bootstrapping, so the first migrate on them records versions whose work is
+// already done.
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, tx *sql.Tx) error
+}
+
+// migrations is the ordered schema history. Append new entries with the next
+// version; never renumber or edit an applied one.
+var migrations = []migration{
+	{1, "create runs and steps", createTables},
+	{2, "add runs.labels", addColumn("runs", "labels", "JSON")},
+	{3, "add runs.failure_code", addColumn("runs", "failure_code", "TEXT")},
+	{4, "add runs.recovery_attempts", addColumn("runs", "recovery_attempts", "INTEGER NOT NULL DEFAULT 0")},
+	{5, "add runs.priority", addColumn("runs", "priority", "INTEGER NOT NULL DEFAULT 0")},
+	{6, "add runs.dedup_key", addColumn("runs", "dedup_key", "TEXT")},
+	{7, "index runs.dedup_key", execStmts(`CREATE INDEX IF NOT EXISTS runs_dedup_key_idx ON runs(dedup_key, created_at);`)},
+	{8, "add runs.working_summary", addColumn("runs", "working_summary", "TEXT")},
+	{9, "add runs.parent_run_id", addColumn("runs", "parent_run_id", "TEXT")},
+	{10, "index runs.parent_run_id", execStmts(`CREATE INDEX IF NOT EXISTS runs_parent_run_id_idx ON runs(parent_run_id);`)},
+	{11, "add runs.inbox", addColumn("runs", "inbox", "TEXT")},
+	{12, "add runs.deadline_extension_seconds", addColumn("runs", "deadline_extension_seconds", "INTEGER NOT NULL DEFAULT 0")},
+	{13, "add runs.callback_delivered", addColumn("runs", "callback_delivered", "INTEGER")},
+	{14, "unique steps.step_num per run", uniqueStepNums},
+	{15, "add runs.pending_approval", addColumn("runs", "pending_approval", "JSON")},
+	{16, "add runs.continued_from", addColumn("runs", "continued_from", "TEXT")},
+	{17, "add runs.workspace_path", addColumn("runs", "workspace_path", "TEXT")},
+}
+
+// dbtx is the query surface shared by *sql.DB and *sql.Tx.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// migrate brings the schema up to the latest version. It refuses to open a
+// database migrated by a newer build, whose schema this build may misread.
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	);`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	latest := migrations[len(migrations)-1].version
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than this build supports (%d)", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(ctx, db, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyMigration runs m and records it in one transaction. Another process
+// opening the same database may have applied m while this one waited for the
+// write lock, so the version is checked again inside the transaction.
+func applyMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("migration %d (%s): begin: %w", m.version, m.name, err)
+	}
+	defer tx.Rollback()
+
+	var applied int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, m.version).Scan(&applied); err != nil {
+		return fmt.Errorf("migration %d (%s): check applied: %w", m.version, m.name, err)
+	}
+	if applied > 0 {
+		return nil
+	}
+	if err := m.up(ctx, tx); err != nil {
+		return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		m.version, m.name, time.Now().UTC().Format(time.RFC3339Nano)); err != nil {
+		return fmt.Errorf("migration %d (%s): record: %w", m.version, m.name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migration %d (%s): commit: %w", m.version, m.name, err)
+	}
+	return nil
+}
+
+// addColumn returns a migration that adds column to table.
+func addColumn(table, column, decl string) func(context.Context, *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		return ensureColumn(ctx, tx, table, column, decl)
+	}
+}
+
+// execStmts returns a migration that executes stmts in order.
+func execStmts(stmts ...string) func(context.Context, *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// createTables creates the original runs and steps tables.
+func createTables(ctx context.Context, tx *sql.Tx) error {
+	return execStmts(
+		`CREATE TABLE IF NOT EXISTS runs (
+			id           TEXT PRIMARY KEY,
+			wake_id      TEXT UNIQUE,
+			goal         TEXT NOT NULL,
+			context      JSON,
+			constraints  JSON,
+			status       TEXT NOT NULL DEFAULT 'queued',
+			summary      TEXT,
+			error        TEXT,
+			started_at   TEXT,
+			completed_at TEXT,
+			updated_at   TEXT NOT NULL,
+			created_at   TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS steps (
+			id           TEXT PRIMARY KEY,
+			run_id       TEXT NOT NULL REFERENCES runs(id),
+			step_num     INTEGER NOT NULL,
+			phase        TEXT NOT NULL,
+			tool         TEXT,
+			tool_input   JSON,
+			tool_output  JSON,
+			status       TEXT NOT NULL,
+			attempt      INTEGER NOT NULL DEFAULT 1,
+			error        TEXT,
+			started_at   TEXT,
+			completed_at TEXT,
+			created_at   TEXT NOT NULL
+		);`,
+	)(ctx, tx)
+}
+
+// uniqueStepNums renumbers duplicate step_nums and replaces the plain run_id
+// index with a unique (run_id, step_num) one.
+func uniqueStepNums(ctx context.Context, tx *sql.Tx) error {
+	if err := renumberDuplicateSteps(ctx, tx); err != nil {
+		return err
+	}
+	return execStmts(
+		`CREATE UNIQUE INDEX IF NOT EXISTS steps_run_step_num_idx ON steps(run_id, step_num);`,
+		`DROP INDEX IF EXISTS steps_run_id_idx;`,
+	)(ctx, tx)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
 	"path/filepath"
 	"time"
@@ -11,83 +13,169 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-// OpenSQLite opens (and creates if needed) the SQLite database at path and
-// ensures required tables exist.
+// Options tunes the SQLite connection pool. Zero values fall back to
+// DefaultOptions.
+type Options struct {
+	// MaxOpenConns caps pooled connections. With WAL, readers run in
+	// parallel on separate connections while SQLite still admits one writer
+	// at a time.
+	MaxOpenConns int
+	// BusyTimeout is how long a connection waits for a lock held by another
+	// before failing with SQLITE_BUSY.
+	BusyTimeout time.Duration
+}
+
+// DefaultOptions are used by OpenSQLite.
+var DefaultOptions = Options{MaxOpenConns: 4, BusyTimeout: 5 * time.Second}
+
+// OpenSQLite opens (and creates if needed) the SQLite database at path with
+// DefaultOptions and migrates its schema to the latest version.
 func OpenSQLite(ctx context.Context, path string) (*sql.DB, error) {
+	return OpenSQLiteWithOptions(ctx, path, DefaultOptions)
+}
+
+// OpenSQLiteWithOptions is OpenSQLite with a tuned connection pool.
+// Per-connection pragmas are set in the DSN so every pooled connection gets
+// them, and transactions begin IMMEDIATE so a writer waits out busy_timeout
+// for the write lock instead of failing when it upgrades from a read.
+func OpenSQLiteWithOptions(ctx context.Context, path string, opts Options) (*sql.DB, error) {
 	if path == "" {
 		return nil, fmt.Errorf("sqlite path is empty")
 	}
+	if opts.MaxOpenConns <= 0 {
+		opts.MaxOpenConns = DefaultOptions.MaxOpenConns
+	}
+	if opts.BusyTimeout <= 0 {
+		opts.BusyTimeout = DefaultOptions.BusyTimeout
+	}
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return nil, fmt.Errorf("create sqlite directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite", path)
+	query := url.Values{}
+	query.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", opts.BusyTimeout.Milliseconds()))
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "synchronous(NORMAL)")
+	query.Set("_txlock", "immediate")
+	db, err := sql.Open("sqlite", path+"?"+query.Encode())
 	if err != nil {
 		return nil, fmt.Errorf("open sqlite: %w", err)
 	}
 
+	// journal_mode is stored in the database file, so setting it once
+	// covers every connection.
 	pctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	pragmas := []string{
-		"PRAGMA foreign_keys = ON;",
-		"PRAGMA busy_timeout = 5000;",
-		"PRAGMA journal_mode = WAL;",
-		"PRAGMA synchronous = NORMAL;",
-	}
-	for _, p := range pragmas {
-		if _, err := db.ExecContext(pctx, p); err != nil {
-			_ = db.Close()
-			return nil, fmt.Errorf("apply pragma %q: %w", p, err)
-		}
+	if _, err := db.ExecContext(pctx, "PRAGMA journal_mode = WAL;"); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("apply pragma %q: %w", "journal_mode = WAL", err)
 	}
 
-	db.SetMaxOpenConns(1)
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxOpenConns)
 
-	if err := bootstrap(ctx, db); err != nil {
+	if err := migrate(ctx, db); err != nil {
 		_ = db.Close()
 		return nil, err
 	}
 	return db, nil
 }
 
-func bootstrap(ctx context.Context, db *sql.DB) error {
-	stmts := []string{
-		`CREATE TABLE IF NOT EXISTS runs (
-			id           TEXT PRIMARY KEY,
-			wake_id      TEXT UNIQUE,
-			goal         TEXT NOT NULL,
-			context      JSON,
-			constraints  JSON,
-			status       TEXT NOT NULL DEFAULT 'queued',
-			summary      TEXT,
-			error        TEXT,
-			started_at   TEXT,
-			completed_at TEXT,
-			updated_at   TEXT NOT NULL,
-			created_at   TEXT NOT NULL
-		);`,
-		`CREATE TABLE IF NOT EXISTS steps (
-			id           TEXT PRIMARY KEY,
-			run_id       TEXT NOT NULL REFERENCES runs(id),
-			step_num     INTEGER NOT NULL,
-			phase        TEXT NOT NULL,
-			tool         TEXT,
-			tool_input   JSON,
-			tool_output  JSON,
-			status       TEXT NOT NULL,
-			attempt      INTEGER NOT NULL DEFAULT 1,
-			error        TEXT,
-			started_at   TEXT,
-			completed_at TEXT,
-			created_at   TEXT NOT NULL
-		);`,
-		`CREATE INDEX IF NOT EXISTS steps_run_id_idx ON steps(run_id, step_num);`,
-	}
-
-	for _, stmt := range stmts {
-		if _, err := db.ExecContext(ctx, stmt); err != nil {
-			return fmt.Errorf("bootstrap sqlite: %w", err)
+// CheckpointWAL copies the write-ahead log into the database file and
+// truncates it. It reports false when readers or a writer kept it from
+// checkpointing every frame; the rest is picked up by the next checkpoint.
+func CheckpointWAL(ctx context.Context, db *sql.DB) (bool, error) {
+	var busy, logFrames, checkpointed int
+	if err := db.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE);").Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return false, fmt.Errorf("wal checkpoint: %w", err)
+	}
+	return busy == 0, nil
+}
+
+// StartWALCheckpointer runs CheckpointWAL every interval until ctx is
+// cancelled, so the WAL file does not grow without bound between SQLite's
+// automatic passive checkpoints.
+func StartWALCheckpointer(ctx context.Context, db *sql.DB, interval time.Duration, logger *slog.Logger) {
+	logger.Info("wal checkpointer started", "interval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("wal checkpointer stopped")
+			return
+		case <-ticker.C:
 		}
+		complete, err := CheckpointWAL(ctx, db)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			logger.Error("wal checkpoint failed", "error", err)
+		case err == nil && !complete:
+			logger.Debug("wal checkpoint incomplete; database busy")
+		}
+	}
+}
+
+// renumberDuplicateSteps prepares a database created before step_num was
+// unique per run. Runs whose steps share a step_num are renumbered 1..n in
+// step_num, then created_at, order so the unique index can be built.
+func renumberDuplicateSteps(ctx context.Context, db dbtx) error {
+	var indexed int
+	if err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'steps_run_step_num_idx'`).Scan(&indexed); err != nil {
+		return fmt.Errorf("inspect steps indexes: %w", err)
+	}
+	if indexed > 0 {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, `
+		UPDATE steps SET step_num = (
+			SELECT ordered.n FROM (
+				SELECT id, ROW_NUMBER() OVER (ORDER BY step_num, created_at, rowid) AS n
+				FROM steps AS same_run WHERE same_run.run_id = steps.run_id
+			) AS ordered WHERE ordered.id = steps.id
+		)
+		WHERE run_id IN (SELECT run_id FROM steps GROUP BY run_id, step_num HAVING COUNT(*) > 1)`)
+	if err != nil {
+		return fmt.Errorf("renumber duplicate steps: %w", err)
+	}
+	return nil
+}
+
+// ensureColumn adds column to table when it is not already present.
+func ensureColumn(ctx context.Context, db dbtx, table, column, decl string) error {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("inspect %s columns: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("scan %s columns: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read %s columns: %w", table, err)
+	}
+	if err := rows.Close(); err != nil {
+		return fmt.Errorf("close %s columns: %w", table, err)
+	}
+
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl)); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
 	}
 	return nil
 }
@@ -0,0 +1,292 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenSQLiteAppliesPragmasToEveryPooledConnection(t *testing.T) {
+	ctx := context.Background()
+	db, err := OpenSQLiteWithOptions(ctx, filepath.Join(t.TempDir(), "agenticloop.db"), Options{MaxOpenConns: 3, BusyTimeout: 1500 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	// Hold every connection at once so each one is checked.
+	var conns []*sql.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("get conn %d: %v", i, err)
+		}
+		conns = append(conns, conn)
+	}
+	for i, conn := range conns {
+		var foreignKeys, busyTimeout int
+		if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys;").Scan(&foreignKeys); err != nil {
+			t.Fatalf("conn %d foreign_keys: %v", i, err)
+		}
+		if err := conn.QueryRowContext(ctx, "PRAGMA busy_timeout;").Scan(&busyTimeout); err != nil {
+			t.Fatalf("conn %d busy_timeout: %v", i, err)
+		}
+		if foreignKeys != 1 || busyTimeout != 1500 {
+			t.Fatalf("conn %d foreign_keys=%d busy_timeout=%d, want 1 and 1500", i, foreignKeys, busyTimeout)
+		}
+		_ = conn.Close()
+	}
+}
+
+func TestConcurrentWriteTransactionsWaitForTheLock(t *testing.T) {
+	ctx := context.Background()
+	db, err := OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	seedRuns(t, db, 1)
+
+	// Each transaction reads then writes, the pattern that fails with
+	// SQLITE_BUSY when a deferred transaction upgrades to a write lock.
+	errs := make(chan error, 8)
+	for w := 0; w < 8; w++ {
+		go func() {
+			var err error
+			for i := 0; i < 20 && err == nil; i++ {
+				err = func() error {
+					tx, err := db.BeginTx(ctx, nil)
+					if err != nil {
+						return err
+					}
+					defer tx.Rollback()
+					var n int
+					if err := tx.QueryRowContext(ctx, "SELECT priority FROM runs WHERE id = 'run-0'").Scan(&n); err != nil {
+						return err
+					}
+					time.Sleep(time.Millisecond) // let other transactions read too
+					if _, err := tx.ExecContext(ctx, "UPDATE runs SET priority = ? WHERE id = 'run-0'", n+1); err != nil {
+						return err
+					}
+					return tx.Commit()
+				}()
+			}
+			errs <- err
+		}()
+	}
+	for w := 0; w < 8; w++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("write transaction: %v", err)
+		}
+	}
+	var priority int
+	if err := db.QueryRowContext(ctx, "SELECT priority FROM runs WHERE id = 'run-0'").Scan(&priority); err != nil {
+		t.Fatalf("read priority: %v", err)
+	}
+	if priority != 160 {
+		t.Fatalf("priority = %d, want 160 (lost updates)", priority)
+	}
+}
+
+func TestOpenSQLiteMigratesOldSchema(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "agenticloop.db")
+
+	// Build a database as the first release left it: the original runs and
+	// steps tables, a plain run_id index, no schema_migrations, and steps
+	// from before step_num was unique.
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open old database: %v", err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE runs (
+			id TEXT PRIMARY KEY, wake_id TEXT UNIQUE, goal TEXT NOT NULL,
+			context JSON, constraints JSON, status TEXT NOT NULL DEFAULT 'queued',
+			summary TEXT, error TEXT, started_at TEXT, completed_at TEXT,
+			updated_at TEXT NOT NULL, created_at TEXT NOT NULL
+		)`,
+		`CREATE TABLE steps (
+			id TEXT PRIMARY KEY, run_id TEXT NOT NULL REFERENCES runs(id),
+			step_num INTEGER NOT NULL, phase TEXT NOT NULL, tool TEXT,
+			tool_input JSON, tool_output JSON, status TEXT NOT NULL,
+			attempt INTEGER NOT NULL DEFAULT 1, error TEXT, started_at TEXT,
+			completed_at TEXT, created_at TEXT NOT NULL
+		)`,
+		`CREATE INDEX steps_run_id_idx ON steps(run_id)`,
+	} {
+		if _, err := old.Exec(stmt); err != nil {
+			t.Fatalf("create old schema: %v", err)
+		}
+	}
+	seedRuns(t, old, 2)
+	for _, s := range []struct {
+		id, runID, createdAt string
+		stepNum              int
+	}{
+		{"a", "run-0", "2026-01-01T00:00:01Z", 1},
+		{"b", "run-0", "2026-01-01T00:00:02Z", 2},
+		{"c", "run-0", "2026-01-01T00:00:03Z", 2},
+		{"d", "run-0", "2026-01-01T00:00:04Z", 3},
+		{"e", "run-1", "2026-01-01T00:00:01Z", 5},
+	} {
+		if _, err := old.Exec(`INSERT INTO steps (id, run_id, step_num, phase, status, created_at) VALUES (?, ?, ?, 'act', 'ok', ?)`,
+			s.id, s.runID, s.stepNum, s.createdAt); err != nil {
+			t.Fatalf("insert step: %v", err)
+		}
+	}
+	_ = old.Close()
+
+	db, err := OpenSQLite(ctx, path)
+	if err != nil {
+		t.Fatalf("migrate old database: %v", err)
+	}
+
+	var (
+		goal, status string
+		priority     int
+		labels       sql.NullString
+	)
+	if err := db.QueryRow(`SELECT goal, status, priority, labels FROM runs WHERE id = 'run-0'`).Scan(&goal, &status, &priority, &labels); err != nil {
+		t.Fatalf("read migrated run: %v", err)
+	}
+	if goal != "goal 0" || status != "queued" || priority != 0 || labels.Valid {
+		t.Fatalf("migrated run = %q %q priority %d labels %v", goal, status, priority, labels)
+	}
+	if _, err := db.Exec(`UPDATE runs SET pending_approval = '{}', deadline_extension_seconds = 60 WHERE id = 'run-0'`); err != nil {
+		t.Fatalf("write added columns: %v", err)
+	}
+
+	want := map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+	for id, stepNum := range want {
+		var got int
+		if err := db.QueryRow(`SELECT step_num FROM steps WHERE id = ?`, id).Scan(&got); err != nil {
+			t.Fatalf("read step %s: %v", id, err)
+		}
+		if got != stepNum {
+			t.Errorf("step %s step_num = %d, want %d", id, got, stepNum)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO steps (id, run_id, step_num, phase, status, created_at) VALUES ('f', 'run-0', 4, 'act', 'ok', '2026-01-01T00:00:05Z')`); err == nil {
+		t.Fatalf("expected a duplicate step_num to be rejected")
+	}
+	var oldIndex int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'steps_run_id_idx'`).Scan(&oldIndex); err != nil || oldIndex != 0 {
+		t.Fatalf("steps_run_id_idx count = %d (%v), want it dropped", oldIndex, err)
+	}
+
+	versions := func(db *sql.DB) []int {
+		t.Helper()
+		rows, err := db.Query(`SELECT version FROM schema_migrations ORDER BY version`)
+		if err != nil {
+			t.Fatalf("read schema_migrations: %v", err)
+		}
+		defer rows.Close()
+		var got []int
+		for rows.Next() {
+			var v int
+			if err := rows.Scan(&v); err != nil {
+				t.Fatalf("scan version: %v", err)
+			}
+			got = append(got, v)
+		}
+		return got
+	}
+	applied := versions(db)
+	if len(applied) != len(migrations) || applied[len(applied)-1] != migrations[len(migrations)-1].version {
+		t.Fatalf("applied versions = %v, want all %d migrations", applied, len(migrations))
+	}
+	_ = db.Close()
+
+	db, err = OpenSQLite(ctx, path)
+	if err != nil {
+		t.Fatalf("reopen migrated database: %v", err)
+	}
+	if again := versions(db); len(again) != len(applied) {
+		t.Fatalf("reopen applied versions = %v, want %v", again, applied)
+	}
+
+	// A database migrated by a newer build is refused rather than misread.
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'from the future', '2026-01-01T00:00:00Z')`,
+		migrations[len(migrations)-1].version+1); err != nil {
+		t.Fatalf("record future migration: %v", err)
+	}
+	_ = db.Close()
+	if db, err := OpenSQLite(ctx, path); err == nil {
+		_ = db.Close()
+		t.Fatalf("expected a newer schema version to be refused")
+	}
+}
+
+func TestMigrationVersionsAscend(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 || m.name == "" || m.up == nil {
+			t.Fatalf("migration %d = version %d %q; want versions 1..n with names", i, m.version, m.name)
+		}
+	}
+}
+
+func TestCheckpointWALTruncatesLog(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "agenticloop.db")
+	db, err := OpenSQLite(ctx, path)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	seedRuns(t, db, 50)
+	if info, err := os.Stat(path + "-wal"); err != nil || info.Size() == 0 {
+		t.Fatalf("expected a non-empty WAL before checkpointing: %v", err)
+	}
+	complete, err := CheckpointWAL(ctx, db)
+	if err != nil || !complete {
+		t.Fatalf("CheckpointWAL = %v, %v; want complete", complete, err)
+	}
+	if info, err := os.Stat(path + "-wal"); err != nil || info.Size() != 0 {
+		t.Fatalf("expected the WAL to be truncated, got %v (err %v)", info.Size(), err)
+	}
+}
+
+// BenchmarkConcurrentReads compares read throughput of a single connection,
+// the previous fixed pool, with a pool that reads in parallel under WAL.
+func BenchmarkConcurrentReads(b *testing.B) {
+	for _, conns := range []int{1, 4} {
+		b.Run(fmt.Sprintf("max_open_conns=%d", conns), func(b *testing.B) {
+			ctx := context.Background()
+			db, err := OpenSQLiteWithOptions(ctx, filepath.Join(b.TempDir(), "agenticloop.db"), Options{MaxOpenConns: conns})
+			if err != nil {
+				b.Fatalf("open sqlite: %v", err)
+			}
+			defer db.Close()
+			seedRuns(b, db, 500)
+
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					var n int
+					if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM runs WHERE status = 'queued' AND goal LIKE '%7%'`).Scan(&n); err != nil {
+						b.Errorf("query: %v", err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func seedRuns(tb testing.TB, db *sql.DB, n int) {
+	tb.Helper()
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	for i := 0; i < n; i++ {
+		if _, err := db.Exec(`INSERT INTO runs (id, goal, status, updated_at, created_at) VALUES (?, ?, 'queued', ?, ?)`,
+			fmt.Sprintf("run-%d", i), fmt.Sprintf("goal %d", i), now, now); err != nil {
+			tb.Fatalf("seed run: %v", err)
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,24 +20,58 @@ const (
 	RunStatusRunning RunStatus = "running"
 	RunStatusDone    RunStatus = "done"
 	RunStatusFailed  RunStatus = "failed"
+	// RunStatusAwaitingApproval is a running run paused by request_approval
+	// until an operator approves or rejects the pending action.
+	RunStatusAwaitingApproval RunStatus = "awaiting_approval"
 )
 
 // Run represents an agent run.
 type Run struct {
-	ID          string          `json:"id"`
-	WakeID      *string         `json:"wake_id,omitempty"`
-	Goal        string          `json:"goal"`
-	Context     json.RawMessage `json:"context,omitempty"`
-	Constraints json.RawMessage `json:"constraints,omitempty"`
-	Status      RunStatus       `json:"status"`
-	Summary     *string         `json:"summary,omitempty"`
-	Error       *string         `json:"error,omitempty"`
-	StartedAt   *time.Time      `json:"started_at,omitempty"`
-	CompletedAt *time.Time      `json:"completed_at,omitempty"`
-	UpdatedAt   time.Time       `json:"updated_at"`
-	CreatedAt   time.Time       `json:"created_at"`
+	ID               string            `json:"id"`
+	WakeID           *string           `json:"wake_id,omitempty"`
+	ParentRunID      *string           `json:"parent_run_id,omitempty"`
+	ContinuedFrom    *string           `json:"continued_from,omitempty"`
+	WorkspacePath    *string           `json:"workspace_path,omitempty"`
+	Goal             string            `json:"goal"`
+	Context          json.RawMessage   `json:"context,omitempty"`
+	Constraints      json.RawMessage   `json:"constraints,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	Priority         int               `json:"priority"`
+	Status           RunStatus         `json:"status"`
+	Summary          *string           `json:"summary,omitempty"`
+	WorkingSummary   *string           `json:"working_summary,omitempty"`
+	PendingApproval  *Approval         `json:"pending_approval,omitempty"`
+	Error            *string           `json:"error,omitempty"`
+	FailureCode      *string           `json:"failure_code,omitempty"`
+	RecoveryAttempts int               `json:"recovery_attempts"`
+	StartedAt        *time.Time        `json:"started_at,omitempty"`
+	CompletedAt      *time.Time        `json:"completed_at,omitempty"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+	CreatedAt        time.Time         `json:"created_at"`
 }
 
+// RunFilter narrows run listings. Zero-valued fields are ignored.
+type RunFilter struct {
+	Status RunStatus
+	// Labels must all match (key and value) for a run to be included.
+	Labels map[string]string
+	// ParentRunID limits the listing to subruns of that run.
+	ParentRunID string
+}
+
+const runColumns = `id, wake_id, parent_run_id, continued_from, workspace_path, goal, context, constraints, labels, priority, status, summary, working_summary, pending_approval, error, failure_code, recovery_attempts, started_at, completed_at, updated_at, created_at`
+
+// Failure codes recorded on failed runs for machine-readable triage.
+const (
+	FailureCodeRecoveryExhausted = "recovery_exhausted"
+	FailureCodeToolTimeExceeded  = "tool_time_exceeded"
+	FailureCodeStuckLoop         = "stuck_loop"
+	FailureCodeStepLimit         = "step_limit"
+	FailureCodeOrphaned          = "orphaned"
+	FailureCodeQueueExpired      = "queue_expired"
+	FailureCodeApprovalRejected  = "approval_rejected"
+)
+
 // RunStore provides CRUD operations on the runs table.
 type RunStore struct {
 	db *sql.DB
@@ -52,31 +88,12 @@ func (s *RunStore) DB() *sql.DB {
 }
 
 // Create inserts a new run. If wakeID is non-nil and already exists, returns the existing run.
-func (s *RunStore) Create(ctx context.Context, goal string, wakeID *string, runCtx json.RawMessage, constraints json.RawMessage) (*Run, bool, error) {
-	now := time.Now().UTC()
-	run := &Run{
-		ID:          uuid.New().String(),
-		WakeID:      wakeID,
-		Goal:        goal,
-		Context:     runCtx,
-		Constraints: constraints,
-		Status:      RunStatusQueued,
-		UpdatedAt:   now,
-		CreatedAt:   now,
-	}
-
-	insertSQL := `INSERT INTO runs (id, wake_id, goal, context, constraints, status, updated_at, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
-	if wakeID != nil {
-		insertSQL += ` ON CONFLICT(wake_id) DO NOTHING`
-	}
-
-	res, err := s.db.ExecContext(ctx, insertSQL,
-		run.ID, run.WakeID, run.Goal, run.Context, run.Constraints,
-		string(run.Status), now.Format(time.RFC3339Nano), now.Format(time.RFC3339Nano),
-	)
+// Higher priority runs are dequeued first; 0 keeps FIFO order.
+func (s *RunStore) Create(ctx context.Context, goal string, wakeID *string, runCtx json.RawMessage, constraints json.RawMessage, labels map[string]string, priority int) (*Run, bool, error) {
+	run := newQueuedRun(goal, wakeID, runCtx, constraints, labels, priority)
+	res, err := insertRun(ctx, s.db, run, nil, wakeID != nil)
 	if err != nil {
-		return nil, false, fmt.Errorf("insert run: %w", err)
+		return nil, false, err
 	}
 
 	if wakeID != nil {
@@ -96,22 +113,195 @@ func (s *RunStore) Create(ctx context.Context, goal string, wakeID *string, runC
 	return run, false, nil
 }
 
+// CreateDeduped inserts a new run unless a run with the same dedupKey was
+// created within window, in which case that run is returned with existing
+// set. The lookup and insert share a transaction, so concurrent identical
+// submissions create a single run.
+func (s *RunStore) CreateDeduped(ctx context.Context, dedupKey string, window time.Duration, goal string, runCtx json.RawMessage, constraints json.RawMessage, labels map[string]string, priority int) (*Run, bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("begin dedup create: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	existing, err := scanRun(tx.QueryRowContext(ctx,
+		`SELECT `+runColumns+` FROM runs WHERE dedup_key = ? ORDER BY created_at DESC LIMIT 1`, dedupKey))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("find run by dedup_key: %w", err)
+	}
+	if err == nil && time.Since(existing.CreatedAt) <= window {
+		return existing, true, tx.Commit()
+	}
+
+	run := newQueuedRun(goal, nil, runCtx, constraints, labels, priority)
+	if _, err := insertRun(ctx, tx, run, &dedupKey, false); err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("commit dedup create: %w", err)
+	}
+	return run, false, nil
+}
+
+// CreateChild inserts a queued subrun linked to parentID.
+func (s *RunStore) CreateChild(ctx context.Context, parentID, goal string, runCtx json.RawMessage, constraints json.RawMessage, labels map[string]string, priority int) (*Run, error) {
+	run := newQueuedRun(goal, nil, runCtx, constraints, labels, priority)
+	run.ParentRunID = &parentID
+	if _, err := insertRun(ctx, s.db, run, nil, false); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// CreateContinuation inserts a queued follow-up run linked to the finished
+// run fromID through continued_from. Unlike a subrun it has no parent, so it
+// does not count toward subrun depth or child limits.
+func (s *RunStore) CreateContinuation(ctx context.Context, fromID, goal string, runCtx json.RawMessage, constraints json.RawMessage, labels map[string]string, priority int) (*Run, error) {
+	run := newQueuedRun(goal, nil, runCtx, constraints, labels, priority)
+	run.ContinuedFrom = &fromID
+	if _, err := insertRun(ctx, s.db, run, nil, false); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// Depth returns how many ancestors run id has through parent_run_id; a
+// top-level run has depth 0.
+func (s *RunStore) Depth(ctx context.Context, id string) (int, error) {
+	var depth int
+	err := s.db.QueryRowContext(ctx,
+		`WITH RECURSIVE chain(id, parent, depth) AS (
+			SELECT id, parent_run_id, 0 FROM runs WHERE id = ?
+			UNION ALL
+			SELECT runs.id, runs.parent_run_id, chain.depth + 1 FROM runs JOIN chain ON runs.id = chain.parent
+		) SELECT COALESCE(MAX(depth), 0) FROM chain`, id,
+	).Scan(&depth)
+	if err != nil {
+		return 0, fmt.Errorf("run depth: %w", err)
+	}
+	return depth, nil
+}
+
+func newQueuedRun(goal string, wakeID *string, runCtx json.RawMessage, constraints json.RawMessage, labels map[string]string, priority int) *Run {
+	now := time.Now().UTC()
+	return &Run{
+		ID:          uuid.New().String(),
+		WakeID:      wakeID,
+		Goal:        goal,
+		Context:     runCtx,
+		Constraints: constraints,
+		Labels:      labels,
+		Priority:    priority,
+		Status:      RunStatusQueued,
+		UpdatedAt:   now,
+		CreatedAt:   now,
+	}
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// insertRun writes run to the runs table. With ignoreWakeConflict an existing
+// wake_id leaves the table untouched and reports zero rows affected.
+func insertRun(ctx context.Context, db execer, run *Run, dedupKey *string, ignoreWakeConflict bool) (sql.Result, error) {
+	var labelsJSON *string
+	if len(run.Labels) > 0 {
+		b, err := json.Marshal(run.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("marshal labels: %w", err)
+		}
+		v := string(b)
+		labelsJSON = &v
+	}
+
+	insertSQL := `INSERT INTO runs (id, wake_id, parent_run_id, continued_from, dedup_key, goal, context, constraints, labels, priority, status, updated_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	if ignoreWakeConflict {
+		insertSQL += ` ON CONFLICT(wake_id) DO NOTHING`
+	}
+
+	created := run.CreatedAt.Format(time.RFC3339Nano)
+	res, err := db.ExecContext(ctx, insertSQL,
+		run.ID, run.WakeID, run.ParentRunID, run.ContinuedFrom, dedupKey, run.Goal, run.Context, run.Constraints, labelsJSON, run.Priority,
+		string(run.Status), created, created,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert run: %w", err)
+	}
+	return res, nil
+}
+
 // GetByID retrieves a run by its ID.
 func (s *RunStore) GetByID(ctx context.Context, id string) (*Run, error) {
-	return s.scanOne(ctx, `SELECT id, wake_id, goal, context, constraints, status, summary, error, started_at, completed_at, updated_at, created_at FROM runs WHERE id = ?`, id)
+	return s.scanOne(ctx, `SELECT `+runColumns+` FROM runs WHERE id = ?`, id)
+}
+
+// GetByIDs retrieves the runs with the given IDs in a single query, oldest
+// first. Unknown IDs are skipped.
+func (s *RunStore) GetByIDs(ctx context.Context, ids []string) ([]*Run, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+runColumns+` FROM runs WHERE id IN (`+placeholders(len(ids))+`) ORDER BY created_at ASC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get runs by ids: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*Run
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
 }
 
 // GetByWakeID retrieves a run by its wake_id.
 func (s *RunStore) GetByWakeID(ctx context.Context, wakeID string) (*Run, error) {
-	return s.scanOne(ctx, `SELECT id, wake_id, goal, context, constraints, status, summary, error, started_at, completed_at, updated_at, created_at FROM runs WHERE wake_id = ?`, wakeID)
+	return s.scanOne(ctx, `SELECT `+runColumns+` FROM runs WHERE wake_id = ?`, wakeID)
 }
 
 // ListByStatus retrieves all runs with the given status.
 func (s *RunStore) ListByStatus(ctx context.Context, status RunStatus) ([]*Run, error) {
-	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, wake_id, goal, context, constraints, status, summary, error, started_at, completed_at, updated_at, created_at FROM runs WHERE status = ? ORDER BY created_at ASC`, string(status))
+	return s.List(ctx, RunFilter{Status: status})
+}
+
+// List retrieves runs matching filter, oldest first.
+func (s *RunStore) List(ctx context.Context, filter RunFilter) ([]*Run, error) {
+	query := `SELECT ` + runColumns + ` FROM runs WHERE 1 = 1`
+	var args []any
+	if filter.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, string(filter.Status))
+	}
+	if filter.ParentRunID != "" {
+		query += ` AND parent_run_id = ?`
+		args = append(args, filter.ParentRunID)
+	}
+	labelKeys := make([]string, 0, len(filter.Labels))
+	for k := range filter.Labels {
+		labelKeys = append(labelKeys, k)
+	}
+	sort.Strings(labelKeys)
+	for _, k := range labelKeys {
+		query += ` AND EXISTS (SELECT 1 FROM json_each(runs.labels) WHERE json_each.key = ? AND json_each.value = ?)`
+		args = append(args, k, filter.Labels[k])
+	}
+	query += ` ORDER BY created_at ASC`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("list runs by status: %w", err)
+		return nil, fmt.Errorf("list runs: %w", err)
 	}
 	defer rows.Close()
 
@@ -126,6 +316,64 @@ func (s *RunStore) ListByStatus(ctx context.Context, status RunStatus) ([]*Run,
 	return runs, rows.Err()
 }
 
+// RunStats aggregates runs across the whole store. AvgDuration covers
+// finished runs with both started_at and completed_at set.
+type RunStats struct {
+	ByStatus     map[RunStatus]int
+	Total        int
+	FinishedRuns int
+	AvgDuration  time.Duration
+}
+
+// Stats counts runs by status and averages the duration of finished runs.
+func (s *RunStore) Stats(ctx context.Context) (RunStats, error) {
+	stats := RunStats{ByStatus: make(map[RunStatus]int)}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM runs GROUP BY status`)
+	if err != nil {
+		return stats, fmt.Errorf("count runs by status: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return stats, fmt.Errorf("scan run status count: %w", err)
+		}
+		stats.ByStatus[RunStatus(status)] = count
+		stats.Total += count
+	}
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("count runs by status: %w", err)
+	}
+
+	durRows, err := s.db.QueryContext(ctx,
+		`SELECT started_at, completed_at FROM runs
+		 WHERE status IN (?, ?) AND started_at IS NOT NULL AND completed_at IS NOT NULL`,
+		string(RunStatusDone), string(RunStatusFailed))
+	if err != nil {
+		return stats, fmt.Errorf("run durations: %w", err)
+	}
+	defer durRows.Close()
+	var total time.Duration
+	for durRows.Next() {
+		var startedAt, completedAt *string
+		if err := durRows.Scan(&startedAt, &completedAt); err != nil {
+			return stats, fmt.Errorf("scan run duration: %w", err)
+		}
+		start, end := parseTime(startedAt), parseTime(completedAt)
+		if start == nil || end == nil || end.Before(*start) {
+			continue
+		}
+		total += end.Sub(*start)
+		stats.FinishedRuns++
+	}
+	if stats.FinishedRuns > 0 {
+		stats.AvgDuration = total / time.Duration(stats.FinishedRuns)
+	}
+	return stats, durRows.Err()
+}
+
 // UpdateStatus updates a run's status and optional fields.
 func (s *RunStore) UpdateStatus(ctx context.Context, id string, status RunStatus, summary *string, errMsg *string) error {
 	now := time.Now().UTC().Format(time.RFC3339Nano)
@@ -151,6 +399,314 @@ func (s *RunStore) UpdateStatus(ctx context.Context, id string, status RunStatus
 	return nil
 }
 
+// Fail marks a run failed with an error message and an optional failure code.
+// A run without a final summary keeps its working summary as the summary.
+func (s *RunStore) Fail(ctx context.Context, id, code, errMsg string) error {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	var codeArg *string
+	if code != "" {
+		codeArg = &code
+	}
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE runs SET status = ?, error = ?, failure_code = COALESCE(?, failure_code),
+		 summary = COALESCE(summary, working_summary), completed_at = ?, updated_at = ? WHERE id = ?`,
+		string(RunStatusFailed), errMsg, codeArg, now, now, id,
+	)
+	if err != nil {
+		return fmt.Errorf("fail run: %w", err)
+	}
+	return nil
+}
+
+// UpdateWorkingSummary records the agent's current best summary of a run in
+// progress. It becomes the summary if the run fails before finishing.
+func (s *RunStore) UpdateWorkingSummary(ctx context.Context, id, summary string) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE runs SET working_summary = ?, updated_at = ? WHERE id = ?`,
+		summary, time.Now().UTC().Format(time.RFC3339Nano), id,
+	)
+	if err != nil {
+		return fmt.Errorf("update working summary: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("update working summary: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// SetWorkspacePath records the resolved workspace directory of run id.
+func (s *RunStore) SetWorkspacePath(ctx context.Context, id, path string) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE runs SET workspace_path = ?, updated_at = ? WHERE id = ?`,
+		path, time.Now().UTC().Format(time.RFC3339Nano), id,
+	)
+	if err != nil {
+		return fmt.Errorf("set workspace path: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("set workspace path: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// RunMessage is operator guidance posted to a run and waiting in its inbox.
+type RunMessage struct {
+	Message    string    `json:"message"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// AppendMessage adds a message to the inbox of a queued, running, or
+// awaiting-approval run and returns how many messages are now pending. It
+// returns sql.ErrNoRows when the run does not exist or has already finished.
+func (s *RunStore) AppendMessage(ctx context.Context, id, message string) (int, error) {
+	var pending int
+	err := s.db.QueryRowContext(ctx,
+		`UPDATE runs SET inbox = json_insert(COALESCE(inbox, '[]'), '$[#]', json_object('message', ?, 'received_at', ?))
+		 WHERE id = ? AND status IN (?, ?, ?) RETURNING json_array_length(inbox)`,
+		message, time.Now().UTC().Format(time.RFC3339Nano), id, string(RunStatusQueued), string(RunStatusRunning), string(RunStatusAwaitingApproval),
+	).Scan(&pending)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("append run message: %w", err)
+	}
+	return pending, nil
+}
+
+// TakeMessages empties the run's inbox and returns its messages, oldest first.
+func (s *RunStore) TakeMessages(ctx context.Context, id string) ([]RunMessage, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("take run messages: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var inbox sql.NullString
+	if err := tx.QueryRowContext(ctx, `SELECT inbox FROM runs WHERE id = ?`, id).Scan(&inbox); err != nil {
+		return nil, fmt.Errorf("take run messages: %w", err)
+	}
+	if !inbox.Valid || inbox.String == "" {
+		return nil, nil
+	}
+	var messages []RunMessage
+	if err := json.Unmarshal([]byte(inbox.String), &messages); err != nil {
+		return nil, fmt.Errorf("take run messages: parse inbox: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE runs SET inbox = NULL WHERE id = ?`, id); err != nil {
+		return nil, fmt.Errorf("take run messages: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("take run messages: %w", err)
+	}
+	return messages, nil
+}
+
+// Approval decisions recorded by DecideApproval.
+const (
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+// Approval is an action a run asked an operator to approve through
+// request_approval, with the operator's decision once one is made.
+type Approval struct {
+	Action      string     `json:"action"`
+	Reason      string     `json:"reason,omitempty"`
+	RequestedAt time.Time  `json:"requested_at"`
+	Decision    string     `json:"decision,omitempty"`
+	Note        string     `json:"note,omitempty"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
+}
+
+// RequestApproval records an action awaiting operator approval and moves the
+// run to awaiting_approval. A request already on the run is kept, with any
+// decision made on it, so a resumed run waits on the same request. It
+// returns sql.ErrNoRows when the run is not running or awaiting approval.
+func (s *RunStore) RequestApproval(ctx context.Context, id string, approval Approval) error {
+	b, err := json.Marshal(approval)
+	if err != nil {
+		return fmt.Errorf("marshal approval: %w", err)
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE runs SET status = ?, pending_approval = COALESCE(pending_approval, ?), updated_at = ?
+		 WHERE id = ? AND status IN (?, ?)`,
+		string(RunStatusAwaitingApproval), string(b), time.Now().UTC().Format(time.RFC3339Nano),
+		id, string(RunStatusRunning), string(RunStatusAwaitingApproval),
+	)
+	if err != nil {
+		return fmt.Errorf("request approval: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DecideApproval records an operator's decision on the run's pending
+// approval and returns the decided request. It returns sql.ErrNoRows when
+// the run has no undecided request.
+func (s *RunStore) DecideApproval(ctx context.Context, id string, approved bool, note string) (*Approval, error) {
+	decision := ApprovalRejected
+	if approved {
+		decision = ApprovalApproved
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	var raw string
+	err := s.db.QueryRowContext(ctx,
+		`UPDATE runs SET pending_approval = json_set(pending_approval, '$.decision', ?, '$.note', ?, '$.decided_at', ?), updated_at = ?
+		 WHERE id = ? AND pending_approval IS NOT NULL AND json_extract(pending_approval, '$.decision') IS NULL
+		 RETURNING pending_approval`,
+		decision, note, now, now, id,
+	).Scan(&raw)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("decide approval: %w", err)
+	}
+	var a Approval
+	if err := json.Unmarshal([]byte(raw), &a); err != nil {
+		return nil, fmt.Errorf("decide approval: parse request: %w", err)
+	}
+	return &a, nil
+}
+
+// PendingApproval returns the run's approval request, or nil when it has none.
+func (s *RunStore) PendingApproval(ctx context.Context, id string) (*Approval, error) {
+	var raw sql.NullString
+	if err := s.db.QueryRowContext(ctx, `SELECT pending_approval FROM runs WHERE id = ?`, id).Scan(&raw); err != nil {
+		return nil, fmt.Errorf("get pending approval: %w", err)
+	}
+	if !raw.Valid || raw.String == "" {
+		return nil, nil
+	}
+	var a Approval
+	if err := json.Unmarshal([]byte(raw.String), &a); err != nil {
+		return nil, fmt.Errorf("get pending approval: %w", err)
+	}
+	return &a, nil
+}
+
+// ResolveApproval clears the run's approval request and returns a run
+// awaiting approval to running.
+func (s *RunStore) ResolveApproval(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE runs SET pending_approval = NULL, status = CASE WHEN status = ? THEN ? ELSE status END, updated_at = ? WHERE id = ?`,
+		string(RunStatusAwaitingApproval), string(RunStatusRunning), time.Now().UTC().Format(time.RFC3339Nano), id,
+	)
+	if err != nil {
+		return fmt.Errorf("resolve approval: %w", err)
+	}
+	return nil
+}
+
+// ExtendDeadline adds seconds to the deadline extension of a running or
+// awaiting-approval run and returns the total extension granted so far. The
+// total may not exceed limit seconds. It returns sql.ErrNoRows when the run
+// does not exist, is not running or awaiting approval, or the extension would
+// pass the limit.
+func (s *RunStore) ExtendDeadline(ctx context.Context, id string, seconds, limit int) (int, error) {
+	var total int
+	err := s.db.QueryRowContext(ctx,
+		`UPDATE runs SET deadline_extension_seconds = deadline_extension_seconds + ?, updated_at = ?
+		 WHERE id = ? AND status IN (?, ?) AND deadline_extension_seconds + ? <= ? RETURNING deadline_extension_seconds`,
+		seconds, time.Now().UTC().Format(time.RFC3339Nano), id, string(RunStatusRunning), string(RunStatusAwaitingApproval), seconds, limit,
+	).Scan(&total)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("extend run deadline: %w", err)
+	}
+	return total, nil
+}
+
+// DeadlineExtension returns the deadline extension granted to a run.
+func (s *RunStore) DeadlineExtension(ctx context.Context, id string) (time.Duration, error) {
+	var seconds int
+	if err := s.db.QueryRowContext(ctx, `SELECT deadline_extension_seconds FROM runs WHERE id = ?`, id).Scan(&seconds); err != nil {
+		return 0, fmt.Errorf("get deadline extension: %w", err)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// SetCallbackDelivered records whether the completion callback of a run has
+// been delivered. Runs never marked have no callback to deliver.
+func (s *RunStore) SetCallbackDelivered(ctx context.Context, id string, delivered bool) error {
+	if _, err := s.db.ExecContext(ctx, `UPDATE runs SET callback_delivered = ? WHERE id = ?`, delivered, id); err != nil {
+		return fmt.Errorf("set callback delivered: %w", err)
+	}
+	return nil
+}
+
+// ListPendingCallbacks returns done and failed runs completed at or after
+// since whose completion callback has not been delivered, oldest first.
+func (s *RunStore) ListPendingCallbacks(ctx context.Context, since time.Time) ([]*Run, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+runColumns+` FROM runs WHERE callback_delivered = 0 AND status IN (?, ?) AND completed_at >= ? ORDER BY completed_at`,
+		string(RunStatusDone), string(RunStatusFailed), since.UTC().Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list pending callbacks: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*Run
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// Requeue returns an interrupted run to queued so recovery picks it up on the
+// next boot. The recovery counter is reset because a clean shutdown is not
+// evidence of a poison run.
+func (s *RunStore) Requeue(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE runs SET status = ?, recovery_attempts = 0, updated_at = ? WHERE id = ?`,
+		string(RunStatusQueued), time.Now().UTC().Format(time.RFC3339Nano), id,
+	)
+	if err != nil {
+		return fmt.Errorf("requeue run: %w", err)
+	}
+	return nil
+}
+
+// MarkQueued moves a running run back to queued without resetting its
+// recovery counter. It reports false when the run was no longer running.
+func (s *RunStore) MarkQueued(ctx context.Context, id string) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE runs SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		string(RunStatusQueued), time.Now().UTC().Format(time.RFC3339Nano), id, string(RunStatusRunning),
+	)
+	if err != nil {
+		return false, fmt.Errorf("mark run queued: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("mark run queued: %w", err)
+	}
+	return n > 0, nil
+}
+
+// IncrementRecoveryAttempts bumps the run's recovery counter and returns the new value.
+func (s *RunStore) IncrementRecoveryAttempts(ctx context.Context, id string) (int, error) {
+	var attempts int
+	err := s.db.QueryRowContext(ctx,
+		`UPDATE runs SET recovery_attempts = recovery_attempts + 1, updated_at = ? WHERE id = ? RETURNING recovery_attempts`,
+		time.Now().UTC().Format(time.RFC3339Nano), id,
+	).Scan(&attempts)
+	if err != nil {
+		return 0, fmt.Errorf("increment recovery attempts: %w", err)
+	}
+	return attempts, nil
+}
+
 func (s *RunStore) scanOne(ctx context.Context, query string, args ...any) (*Run, error) {
 	row := s.db.QueryRowContext(ctx, query, args...)
 	r, err := scanRunRow(row)
@@ -169,14 +725,21 @@ func scanRun(s scanner) (*Run, error) {
 	var r Run
 	var status string
 	var wakeID sql.NullString
+	var parentRunID sql.NullString
+	var continuedFrom sql.NullString
+	var workspacePath sql.NullString
 	var contextJSON sql.NullString
 	var constraintsJSON sql.NullString
+	var labelsJSON sql.NullString
 	var summary sql.NullString
+	var workingSummary sql.NullString
+	var pendingApproval sql.NullString
 	var errMsg sql.NullString
+	var failureCode sql.NullString
 	var startedAt, completedAt, updatedAt, createdAt *string
 
-	err := s.Scan(&r.ID, &wakeID, &r.Goal, &contextJSON, &constraintsJSON,
-		&status, &summary, &errMsg, &startedAt, &completedAt, &updatedAt, &createdAt)
+	err := s.Scan(&r.ID, &wakeID, &parentRunID, &continuedFrom, &workspacePath, &r.Goal, &contextJSON, &constraintsJSON, &labelsJSON, &r.Priority,
+		&status, &summary, &workingSummary, &pendingApproval, &errMsg, &failureCode, &r.RecoveryAttempts, &startedAt, &completedAt, &updatedAt, &createdAt)
 	if err != nil {
 		return nil, fmt.Errorf("scan run: %w", err)
 	}
@@ -185,20 +748,52 @@ func scanRun(s scanner) (*Run, error) {
 		v := wakeID.String
 		r.WakeID = &v
 	}
+	if parentRunID.Valid {
+		v := parentRunID.String
+		r.ParentRunID = &v
+	}
+	if continuedFrom.Valid {
+		v := continuedFrom.String
+		r.ContinuedFrom = &v
+	}
+	if workspacePath.Valid {
+		v := workspacePath.String
+		r.WorkspacePath = &v
+	}
 	if contextJSON.Valid && contextJSON.String != "" {
 		r.Context = json.RawMessage(contextJSON.String)
 	}
 	if constraintsJSON.Valid && constraintsJSON.String != "" {
 		r.Constraints = json.RawMessage(constraintsJSON.String)
 	}
+	if labelsJSON.Valid && labelsJSON.String != "" {
+		if err := json.Unmarshal([]byte(labelsJSON.String), &r.Labels); err != nil {
+			return nil, fmt.Errorf("scan run labels: %w", err)
+		}
+	}
 	if summary.Valid {
 		v := summary.String
 		r.Summary = &v
 	}
+	if workingSummary.Valid {
+		v := workingSummary.String
+		r.WorkingSummary = &v
+	}
+	if pendingApproval.Valid && pendingApproval.String != "" {
+		var a Approval
+		if err := json.Unmarshal([]byte(pendingApproval.String), &a); err != nil {
+			return nil, fmt.Errorf("scan run pending approval: %w", err)
+		}
+		r.PendingApproval = &a
+	}
 	if errMsg.Valid {
 		v := errMsg.String
 		r.Error = &v
 	}
+	if failureCode.Valid {
+		v := failureCode.String
+		r.FailureCode = &v
+	}
 
 	r.Status = RunStatus(status)
 	r.StartedAt = parseTime(startedAt)
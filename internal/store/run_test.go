@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/mattjoyce/agenticloop/internal/storage"
 )
@@ -21,7 +22,7 @@ func TestRunStoreCreateWakeIDIdempotent(t *testing.T) {
 	store := NewRunStore(db)
 	wakeID := "wake-123"
 
-	first, existing, err := store.Create(ctx, "goal", &wakeID, nil, nil)
+	first, existing, err := store.Create(ctx, "goal", &wakeID, nil, nil, nil, 0)
 	if err != nil {
 		t.Fatalf("first create: %v", err)
 	}
@@ -29,7 +30,7 @@ func TestRunStoreCreateWakeIDIdempotent(t *testing.T) {
 		t.Fatalf("first create should not be existing")
 	}
 
-	second, existing, err := store.Create(ctx, "goal", &wakeID, nil, nil)
+	second, existing, err := store.Create(ctx, "goal", &wakeID, nil, nil, nil, 0)
 	if err != nil {
 		t.Fatalf("second create: %v", err)
 	}
@@ -66,7 +67,7 @@ func TestRunStoreCreateWakeIDConcurrent(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			run, existing, err := store.Create(ctx, "goal", &wakeID, nil, nil)
+			run, existing, err := store.Create(ctx, "goal", &wakeID, nil, nil, nil, 0)
 			results <- result{run: run, existing: existing, err: err}
 		}()
 	}
@@ -98,3 +99,115 @@ func TestRunStoreCreateWakeIDConcurrent(t *testing.T) {
 		t.Fatalf("expected %d existing responses, got %d", workers-1, existingCount)
 	}
 }
+
+func TestRunStoreListFiltersByLabels(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "agenticloop.db")
+	db, err := storage.OpenSQLite(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	store := NewRunStore(db)
+	foo, _, err := store.Create(ctx, "foo goal", nil, nil, nil, map[string]string{"project": "foo", "team": "core"}, 0)
+	if err != nil {
+		t.Fatalf("create foo run: %v", err)
+	}
+	if _, _, err := store.Create(ctx, "bar goal", nil, nil, nil, map[string]string{"project": "bar"}, 0); err != nil {
+		t.Fatalf("create bar run: %v", err)
+	}
+	if _, _, err := store.Create(ctx, "unlabelled goal", nil, nil, nil, nil, 0); err != nil {
+		t.Fatalf("create unlabelled run: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		filter  RunFilter
+		wantIDs []string
+		wantLen int
+	}{
+		{"no labels", RunFilter{Status: RunStatusQueued}, nil, 3},
+		{"single label", RunFilter{Status: RunStatusQueued, Labels: map[string]string{"project": "foo"}}, []string{foo.ID}, 1},
+		{"all labels must match", RunFilter{Labels: map[string]string{"project": "foo", "team": "core"}}, []string{foo.ID}, 1},
+		{"mismatched value", RunFilter{Labels: map[string]string{"project": "baz"}}, nil, 0},
+		{"other status", RunFilter{Status: RunStatusDone, Labels: map[string]string{"project": "foo"}}, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, err := store.List(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			if len(runs) != tt.wantLen {
+				t.Fatalf("len = %d, want %d", len(runs), tt.wantLen)
+			}
+			for i, id := range tt.wantIDs {
+				if runs[i].ID != id {
+					t.Fatalf("runs[%d].ID = %s, want %s", i, runs[i].ID, id)
+				}
+			}
+		})
+	}
+
+	got, err := store.GetByID(ctx, foo.ID)
+	if err != nil {
+		t.Fatalf("get foo run: %v", err)
+	}
+	if got.Labels["project"] != "foo" || got.Labels["team"] != "core" {
+		t.Fatalf("unexpected labels roundtrip: %#v", got.Labels)
+	}
+}
+
+func TestRunStoreCreateDedupedConcurrentAndWindow(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "agenticloop.db")
+	db, err := storage.OpenSQLite(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	store := NewRunStore(db)
+
+	const workers = 10
+	ids := make(chan string, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run, _, err := store.CreateDeduped(ctx, "key", time.Minute, "goal", nil, nil, nil, 0)
+			if err != nil {
+				t.Errorf("dedup create: %v", err)
+				return
+			}
+			ids <- run.ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	unique := map[string]struct{}{}
+	var firstID string
+	for id := range ids {
+		unique[id] = struct{}{}
+		firstID = id
+	}
+	if len(unique) != 1 {
+		t.Fatalf("expected one run for identical submissions, got %d", len(unique))
+	}
+
+	// Once the window has passed, the same key creates a new run.
+	if _, err := db.ExecContext(ctx, `UPDATE runs SET created_at = ? WHERE id = ?`,
+		time.Now().Add(-2*time.Minute).UTC().Format(time.RFC3339Nano), firstID); err != nil {
+		t.Fatalf("age run: %v", err)
+	}
+	run, existing, err := store.CreateDeduped(ctx, "key", time.Minute, "goal", nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create after window: %v", err)
+	}
+	if existing || run.ID == firstID {
+		t.Fatalf("expected a new run after the dedup window, got %s existing=%v", run.ID, existing)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,11 +16,13 @@ import (
 type StepPhase string
 
 const (
-	StepPhaseFrame   StepPhase = "frame"
-	StepPhasePlan    StepPhase = "plan"
-	StepPhaseAct     StepPhase = "act"
-	StepPhaseReflect StepPhase = "reflect"
-	StepPhaseDone    StepPhase = "done"
+	StepPhaseFrame     StepPhase = "frame"
+	StepPhasePlan      StepPhase = "plan"
+	StepPhaseAct       StepPhase = "act"
+	StepPhaseObserve   StepPhase = "observe"
+	StepPhaseReflect   StepPhase = "reflect"
+	StepPhaseSummarize StepPhase = "summarize"
+	StepPhaseDone      StepPhase = "done"
 )
 
 // StepStatus represents the lifecycle state of a step.
@@ -58,7 +62,13 @@ func NewStepStore(db *sql.DB) *StepStore {
 	return &StepStore{db: db}
 }
 
-// Append inserts a new step for a run.
+// maxStepNumConflicts bounds how often Append moves past a taken step_num.
+const maxStepNumConflicts = 10
+
+// Append inserts a new step for a run. step_num is unique per run: when
+// stepNum is already taken, for example by a late write from a run's previous
+// worker, the step gets the run's next free number instead. The returned
+// step carries the number actually used.
 func (s *StepStore) Append(ctx context.Context, runID string, stepNum int, phase StepPhase, tool *string, toolInput json.RawMessage) (*Step, error) {
 	now := time.Now().UTC()
 	step := &Step{
@@ -73,18 +83,34 @@ func (s *StepStore) Append(ctx context.Context, runID string, stepNum int, phase
 		CreatedAt: now,
 	}
 
-	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO steps (id, run_id, step_num, phase, tool, tool_input, status, attempt, created_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		step.ID, step.RunID, step.StepNum, string(step.Phase),
-		step.Tool, step.ToolInput, string(step.Status), step.Attempt,
-		now.Format(time.RFC3339Nano),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("insert step: %w", err)
+	for conflicts := 0; ; conflicts++ {
+		res, err := s.db.ExecContext(ctx,
+			`INSERT INTO steps (id, run_id, step_num, phase, tool, tool_input, status, attempt, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			 ON CONFLICT (run_id, step_num) DO NOTHING`,
+			step.ID, step.RunID, step.StepNum, string(step.Phase),
+			step.Tool, step.ToolInput, string(step.Status), step.Attempt,
+			now.Format(time.RFC3339Nano),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("insert step: %w", err)
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("insert step: rows affected: %w", err)
+		}
+		if rows == 1 {
+			return step, nil
+		}
+		if conflicts == maxStepNumConflicts {
+			return nil, fmt.Errorf("insert step: step_num still taken after %d attempts", conflicts+1)
+		}
+		next, err := s.MaxStepNum(ctx, runID)
+		if err != nil {
+			return nil, err
+		}
+		step.StepNum = max(step.StepNum, next) + 1
 	}
-
-	return step, nil
 }
 
 // UpdateStatus updates a step's status and output.
@@ -118,6 +144,32 @@ func (s *StepStore) UpdateStatusWithAttempt(ctx context.Context, id string, stat
 	return nil
 }
 
+// ReplaceOutput overwrites a step's tool_output without touching its status
+// or timestamps.
+func (s *StepStore) ReplaceOutput(ctx context.Context, id string, toolOutput json.RawMessage) error {
+	if _, err := s.db.ExecContext(ctx, `UPDATE steps SET tool_output = ? WHERE id = ?`, toolOutput, id); err != nil {
+		return fmt.Errorf("replace step output: %w", err)
+	}
+	return nil
+}
+
+// InterruptOpen closes every pending or running step of a run as an error with
+// the given message, so an interrupted run leaves no step stuck in flight.
+// It returns the number of steps closed.
+func (s *StepStore) InterruptOpen(ctx context.Context, runID, errMsg string) (int, error) {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE steps SET status = ?, error = ?, completed_at = ?
+		 WHERE run_id = ? AND status IN (?, ?)`,
+		string(StepStatusError), errMsg, now, runID, string(StepStatusPending), string(StepStatusRunning),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("interrupt open steps: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
 // GetByRunID retrieves all steps for a run, ordered by step_num.
 func (s *StepStore) GetByRunID(ctx context.Context, runID string) ([]*Step, error) {
 	rows, err := s.db.QueryContext(ctx,
@@ -153,6 +205,108 @@ func (s *StepStore) MaxStepNum(ctx context.Context, runID string) (int, error) {
 	return int(maxNum.Int64), nil
 }
 
+// PhaseDuration aggregates the wall time spent in one phase of a run.
+type PhaseDuration struct {
+	Count   int   `json:"count"`
+	TotalMS int64 `json:"total_ms"`
+	MaxMS   int64 `json:"max_ms"`
+}
+
+// PhaseDurations maps each phase to its aggregated wall time.
+type PhaseDurations map[StepPhase]PhaseDuration
+
+// DurationsByRun aggregates completed step wall time per phase for a run.
+// Steps without both started_at and completed_at are skipped.
+func (s *StepStore) DurationsByRun(ctx context.Context, runID string) (PhaseDurations, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT phase, started_at, completed_at FROM steps
+		 WHERE run_id = ? AND started_at IS NOT NULL AND completed_at IS NOT NULL`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("step durations by run: %w", err)
+	}
+	defer rows.Close()
+
+	durations := make(PhaseDurations)
+	for rows.Next() {
+		var phase string
+		var startedAt, completedAt *string
+		if err := rows.Scan(&phase, &startedAt, &completedAt); err != nil {
+			return nil, fmt.Errorf("scan step duration: %w", err)
+		}
+		durations.add(StepPhase(phase), startedAt, completedAt)
+	}
+	return durations, rows.Err()
+}
+
+// add records one step's wall time. Steps without both timestamps, or that
+// end before they start, are skipped.
+func (d PhaseDurations) add(phase StepPhase, startedAt, completedAt *string) {
+	start, end := parseTime(startedAt), parseTime(completedAt)
+	if start == nil || end == nil || end.Before(*start) {
+		return
+	}
+	ms := end.Sub(*start).Milliseconds()
+	pd := d[phase]
+	pd.Count++
+	pd.TotalMS += ms
+	if ms > pd.MaxMS {
+		pd.MaxMS = ms
+	}
+	d[phase] = pd
+}
+
+// RunStepStats aggregates the steps of one run.
+type RunStepStats struct {
+	StepCount      int
+	StepsByPhase   map[StepPhase]int
+	StageDurations PhaseDurations
+	TokenUsage     TokenUsage
+}
+
+// StatsByRuns aggregates the steps of each listed run in a single query.
+// Runs without steps get zero stats.
+func (s *StepStore) StatsByRuns(ctx context.Context, runIDs []string) (map[string]*RunStepStats, error) {
+	stats := make(map[string]*RunStepStats, len(runIDs))
+	args := make([]any, len(runIDs))
+	for i, id := range runIDs {
+		stats[id] = &RunStepStats{StepsByPhase: map[StepPhase]int{}, StageDurations: PhaseDurations{}}
+		args[i] = id
+	}
+	if len(runIDs) == 0 {
+		return stats, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT run_id, phase, tool_output, started_at, completed_at FROM steps
+		 WHERE run_id IN (`+placeholders(len(runIDs))+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("step stats by runs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var runID, phase string
+		var toolOutput sql.NullString
+		var startedAt, completedAt *string
+		if err := rows.Scan(&runID, &phase, &toolOutput, &startedAt, &completedAt); err != nil {
+			return nil, fmt.Errorf("scan step stats: %w", err)
+		}
+		st := stats[runID]
+		st.StepCount++
+		st.StepsByPhase[StepPhase(phase)]++
+		st.StageDurations.add(StepPhase(phase), startedAt, completedAt)
+		if toolOutput.Valid {
+			st.TokenUsage.add(json.RawMessage(toolOutput.String))
+		}
+	}
+	return stats, rows.Err()
+}
+
+// placeholders returns n comma-separated SQL bind parameters.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
 func scanStep(s scanner) (*Step, error) {
 	var step Step
 	var phase, status string
@@ -195,3 +349,88 @@ func scanStep(s scanner) (*Step, error) {
 	}
 	return &step, nil
 }
+
+// TokenUsage totals model token counts across steps.
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// SumTokenUsage adds up the token_usage recorded in each step's tool_output.
+// Steps without usage, or with output that is not a JSON object, count as zero.
+func SumTokenUsage(steps []*Step) TokenUsage {
+	var total TokenUsage
+	for _, step := range steps {
+		total.add(step.ToolOutput)
+	}
+	return total
+}
+
+// SumEstimatedCost adds up the estimated_cost recorded next to each step's
+// token_usage. It returns nil when no step recorded usage or any step with
+// usage has no cost estimate, because its model is not in llm.pricing.
+func SumEstimatedCost(steps []*Step) *float64 {
+	var total float64
+	priced := false
+	for _, step := range steps {
+		if len(step.ToolOutput) == 0 {
+			continue
+		}
+		var out struct {
+			TokenUsage    *TokenUsage `json:"token_usage"`
+			EstimatedCost *float64    `json:"estimated_cost"`
+		}
+		if err := json.Unmarshal(step.ToolOutput, &out); err != nil || out.TokenUsage == nil {
+			continue
+		}
+		if out.EstimatedCost == nil {
+			return nil
+		}
+		total += *out.EstimatedCost
+		priced = true
+	}
+	if !priced {
+		return nil
+	}
+	total = math.Round(total*1e6) / 1e6
+	return &total
+}
+
+// TokenUsageSince sums the token_usage of every step created at or after since.
+func (s *StepStore) TokenUsageSince(ctx context.Context, since time.Time) (TokenUsage, error) {
+	// Second precision sorts before any fractional timestamp in the same second.
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT tool_output FROM steps WHERE created_at >= ? AND tool_output IS NOT NULL`,
+		since.UTC().Format("2006-01-02T15:04:05"))
+	if err != nil {
+		return TokenUsage{}, fmt.Errorf("token usage since: %w", err)
+	}
+	defer rows.Close()
+
+	var total TokenUsage
+	for rows.Next() {
+		var output string
+		if err := rows.Scan(&output); err != nil {
+			return TokenUsage{}, fmt.Errorf("scan step token usage: %w", err)
+		}
+		total.add(json.RawMessage(output))
+	}
+	return total, rows.Err()
+}
+
+// add accumulates the token_usage object of a step's tool_output.
+func (u *TokenUsage) add(toolOutput json.RawMessage) {
+	if len(toolOutput) == 0 {
+		return
+	}
+	var out struct {
+		TokenUsage TokenUsage `json:"token_usage"`
+	}
+	if err := json.Unmarshal(toolOutput, &out); err != nil {
+		return
+	}
+	u.PromptTokens += out.TokenUsage.PromptTokens
+	u.CompletionTokens += out.TokenUsage.CompletionTokens
+	u.TotalTokens += out.TokenUsage.TotalTokens
+}
@@ -2,8 +2,11 @@ package store
 
 import (
 	"context"
+	"encoding/json"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mattjoyce/agenticloop/internal/storage"
 )
@@ -18,7 +21,7 @@ func TestStepStoreUpdateStatusWithAttempt(t *testing.T) {
 	t.Cleanup(func() { _ = db.Close() })
 
 	runStore := NewRunStore(db)
-	run, _, err := runStore.Create(ctx, "goal", nil, nil, nil)
+	run, _, err := runStore.Create(ctx, "goal", nil, nil, nil, nil, 0)
 	if err != nil {
 		t.Fatalf("create run: %v", err)
 	}
@@ -57,3 +60,137 @@ func TestStepStoreUpdateStatusWithAttempt(t *testing.T) {
 		t.Fatalf("expected completed_at to be set")
 	}
 }
+
+func TestStepStoreAppendSkipsTakenStepNums(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenSQLite(ctx, filepath.Join(t.TempDir(), "agenticloop.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	stepStore := NewStepStore(db)
+
+	// Each writer numbers its steps from its own counter, like a resumed
+	// worker racing a late write from the previous one.
+	const writers, perWriter = 6, 5
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stepNum := 0
+			for i := 0; i < perWriter; i++ {
+				step, err := stepStore.Append(ctx, run.ID, stepNum+1, StepPhaseAct, nil, nil)
+				if err != nil {
+					errs <- err
+					return
+				}
+				stepNum = step.StepNum
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("append step: %v", err)
+	}
+
+	steps, err := stepStore.GetByRunID(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("get steps: %v", err)
+	}
+	if len(steps) != writers*perWriter {
+		t.Fatalf("expected %d steps, got %d", writers*perWriter, len(steps))
+	}
+	seen := map[int]bool{}
+	for _, step := range steps {
+		if seen[step.StepNum] {
+			t.Fatalf("step_num %d used twice", step.StepNum)
+		}
+		seen[step.StepNum] = true
+	}
+}
+
+func TestStepStoreDurationsByRun(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "agenticloop.db")
+	db, err := storage.OpenSQLite(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	runStore := NewRunStore(db)
+	run, _, err := runStore.Create(ctx, "goal", nil, nil, nil, nil, 0)
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+
+	stepStore := NewStepStore(db)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	timed := []struct {
+		phase StepPhase
+		start time.Duration
+		took  time.Duration
+	}{
+		{StepPhaseAct, 0, 2 * time.Second},
+		{StepPhaseAct, 5 * time.Second, 3 * time.Second},
+		{StepPhaseReflect, 10 * time.Second, 500 * time.Millisecond},
+	}
+	for i, tc := range timed {
+		step, err := stepStore.Append(ctx, run.ID, i+1, tc.phase, nil, nil)
+		if err != nil {
+			t.Fatalf("append step: %v", err)
+		}
+		start := base.Add(tc.start)
+		if _, err := db.ExecContext(ctx, `UPDATE steps SET started_at = ?, completed_at = ? WHERE id = ?`,
+			start.Format(time.RFC3339Nano), start.Add(tc.took).Format(time.RFC3339Nano), step.ID); err != nil {
+			t.Fatalf("set step times: %v", err)
+		}
+	}
+	// A step that never completed must not be counted.
+	if _, err := stepStore.Append(ctx, run.ID, 4, StepPhaseDone, nil, nil); err != nil {
+		t.Fatalf("append pending step: %v", err)
+	}
+
+	durations, err := stepStore.DurationsByRun(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("durations by run: %v", err)
+	}
+	if got := durations[StepPhaseAct]; got != (PhaseDuration{Count: 2, TotalMS: 5000, MaxMS: 3000}) {
+		t.Fatalf("act durations = %+v", got)
+	}
+	if got := durations[StepPhaseReflect]; got != (PhaseDuration{Count: 1, TotalMS: 500, MaxMS: 500}) {
+		t.Fatalf("reflect durations = %+v", got)
+	}
+	if _, ok := durations[StepPhaseDone]; ok {
+		t.Fatalf("expected incomplete done step to be skipped, got %+v", durations)
+	}
+}
+
+func TestSumEstimatedCost(t *testing.T) {
+	step := func(output string) *Step { return &Step{ToolOutput: json.RawMessage(output)} }
+	priced := []*Step{
+		step(`{"content":"a","token_usage":{"total_tokens":10},"estimated_cost":0.25}`),
+		step(`{"content":"tool output"}`),
+		step(`{"content":"b","token_usage":{"total_tokens":5},"estimated_cost":0.125}`),
+		{},
+	}
+	if got := SumEstimatedCost(priced); got == nil || *got != 0.375 {
+		t.Fatalf("SumEstimatedCost = %v, want 0.375", got)
+	}
+	unpriced := append(priced, step(`{"content":"c","token_usage":{"total_tokens":5},"estimated_cost":null}`))
+	if got := SumEstimatedCost(unpriced); got != nil {
+		t.Fatalf("expected nil when a step is unpriced, got %v", *got)
+	}
+	if got := SumEstimatedCost([]*Step{step(`{"content":"tool output"}`)}); got != nil {
+		t.Fatalf("expected nil without token usage, got %v", *got)
+	}
+}